@@ -0,0 +1,313 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/akhilrex/podgrab/db"
+	"github.com/akhilrex/podgrab/internal/config"
+	"github.com/akhilrex/podgrab/internal/logger"
+	"github.com/akhilrex/podgrab/internal/secrets"
+	"github.com/akhilrex/podgrab/service"
+)
+
+// errUsage is returned by a command when it was invoked with bad arguments.
+var errUsage = errors.New("invalid arguments")
+
+// command is a subcommand of the podgrab binary.
+type command struct {
+	run     func(args []string) error
+	name    string
+	args    string
+	summary string
+	// openDB opens and migrates the configured database before run is called.
+	openDB bool
+}
+
+var commands = []command{
+	{name: "serve", summary: "run the web server and background jobs (default)", run: serveCommand},
+	{name: "add", args: "<url>", summary: "subscribe to a podcast feed and fetch its episodes", openDB: true, run: addCommand},
+	{name: "add-local", args: "[-title title -author author] [folder]", summary: "make a podcast from a folder of audio files", openDB: true, run: addLocalCommand},
+	{name: "import-opml", args: "<file>", summary: "subscribe to every feed in an OPML file", openDB: true, run: importOpmlCommand},
+	{name: "export-opml", args: "[-podgrab-links -base-url url] [-o file]", summary: "write subscriptions as OPML", openDB: true, run: exportOpmlCommand},
+	{name: "refresh", args: "[-podcast id]", summary: "fetch new episodes and download pending ones", openDB: true, run: refreshCommand},
+	{name: "download", args: "<episode id>", summary: "download a single episode", openDB: true, run: downloadCommand},
+	{name: "backup", summary: "create a database backup in CONFIG/backups", run: backupCommand},
+	{name: "restore", args: "<backup file>", summary: "replace the database with a backup (stop the server first)", run: restoreCommand},
+	{name: "list", args: "[-podcast id]", summary: "list podcasts, or the episodes of one podcast", openDB: true, run: listCommand},
+	{name: "stats", summary: "show episode counts and disk usage", openDB: true, run: statsCommand},
+	{name: "migrate", args: "<status|up|down>", summary: "inspect or change the database schema version", run: migrateCommand},
+}
+
+// runCommand dispatches the command line to a subcommand and returns the exit code.
+// Without arguments the web server is started, as before subcommands existed.
+// A leading "-config <file>" selects the configuration file for any command.
+func runCommand(args []string) int {
+	configFile := ""
+	if len(args) > 1 && (args[0] == "-config" || args[0] == "--config") {
+		configFile, args = args[1], args[2:]
+	}
+	cfg, err := config.Load(configFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	config.Set(cfg)
+	logger.SetLevel(cfg.LogLevel)
+
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") && args[0] != "-h" && args[0] != "--help" {
+		args = append([]string{"serve"}, args...)
+	}
+	if args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		printUsage()
+		return 0
+	}
+
+	for i := range commands {
+		if commands[i].name != args[0] {
+			continue
+		}
+		if commands[i].openDB {
+			if err := openDatabase(); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return 1
+			}
+		}
+		err := commands[i].run(args[1:])
+		switch {
+		case errors.Is(err, errUsage):
+			fmt.Fprintf(os.Stderr, "Usage: podgrab %s %s\n", commands[i].name, commands[i].args)
+			return 2
+		case err != nil:
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		return 0
+	}
+
+	fmt.Fprintf(os.Stderr, "unknown command %q\n\n", args[0])
+	printUsage()
+	return 2
+}
+
+func printUsage() {
+	fmt.Fprintln(os.Stderr, "Usage: podgrab [-config file] <command> [arguments]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Commands:")
+	w := tabwriter.NewWriter(os.Stderr, 0, 0, 2, ' ', 0)
+	for i := range commands {
+		fmt.Fprintf(w, "  %s %s\t%s\n", commands[i].name, commands[i].args, commands[i].summary)
+	}
+	_ = w.Flush() //nolint:errcheck // nothing useful to do if stderr is gone
+}
+
+func openDatabase() error {
+	if err := secrets.Init(config.Get()); err != nil {
+		return fmt.Errorf("failed to load the secret key: %w", err)
+	}
+	var err error
+	if db.DB, err = db.Init(); err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	if err = db.Migrate(); err != nil {
+		return fmt.Errorf("failed to migrate database: %w", err)
+	}
+	service.ApplyDownloadLimits()
+	return nil
+}
+
+// parseFlags parses args into flags and returns the remaining positional arguments,
+// requiring exactly want of them.
+func parseFlags(flags *flag.FlagSet, args []string, want int) ([]string, error) {
+	flags.SetOutput(os.Stderr)
+	if err := flags.Parse(args); err != nil {
+		return nil, errUsage
+	}
+	if flags.NArg() != want {
+		return nil, errUsage
+	}
+	return flags.Args(), nil
+}
+
+func serveCommand(args []string) error {
+	if _, err := parseFlags(flag.NewFlagSet("serve", flag.ContinueOnError), args, 0); err != nil {
+		return err
+	}
+	return serve()
+}
+
+func addCommand(args []string) error {
+	positional, err := parseFlags(flag.NewFlagSet("add", flag.ContinueOnError), args, 1)
+	if err != nil {
+		return err
+	}
+	podcast, err := service.AddPodcast(context.Background(), positional[0])
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Added %s (%s)\n", podcast.Title, podcast.ID)
+	return service.RefreshPodcast(context.Background(), podcast.ID)
+}
+
+func addLocalCommand(args []string) error {
+	flags := flag.NewFlagSet("add-local", flag.ContinueOnError)
+	title := flags.String("title", "", "title of the podcast (defaults to the folder's name)")
+	author := flags.String("author", "", "author of the podcast")
+	flags.SetOutput(os.Stderr)
+	if err := flags.Parse(args); err != nil || flags.NArg() > 1 {
+		return errUsage
+	}
+	podcast, err := service.AddLocalPodcast(&service.LocalPodcast{Title: *title, Author: *author, Path: flags.Arg(0)})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Added %s (%s)\n", podcast.Title, podcast.ID)
+	return service.ScanLocalPodcast(context.Background(), podcast.ID)
+}
+
+func importOpmlCommand(args []string) error {
+	positional, err := parseFlags(flag.NewFlagSet("import-opml", flag.ContinueOnError), args, 1)
+	if err != nil {
+		return err
+	}
+	content, err := os.ReadFile(positional[0])
+	if err != nil {
+		return err
+	}
+	added, err := service.ImportOpml(context.Background(), string(content))
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Added %d podcasts\n", added)
+	return service.RefreshEpisodes(context.Background())
+}
+
+func exportOpmlCommand(args []string) error {
+	flags := flag.NewFlagSet("export-opml", flag.ContinueOnError)
+	usePodgrabLink := flags.Bool("podgrab-links", false, "point feeds at this Podgrab instance instead of the original feeds")
+	baseURL := flags.String("base-url", "", "base URL used with -podgrab-links (defaults to the Base URL setting)")
+	output := flags.String("o", "", "write to file instead of stdout")
+	if _, err := parseFlags(flags, args, 0); err != nil {
+		return err
+	}
+	if *baseURL == "" {
+		*baseURL = db.GetOrCreateSetting().BaseURL
+	}
+	if *usePodgrabLink && *baseURL == "" {
+		return errors.New("-podgrab-links needs -base-url or the Base URL setting")
+	}
+
+	data, err := service.ExportOmpl(*usePodgrabLink, strings.TrimSuffix(*baseURL, "/"))
+	if err != nil {
+		return err
+	}
+	if *output == "" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	return os.WriteFile(*output, data, 0o600)
+}
+
+func refreshCommand(args []string) error {
+	flags := flag.NewFlagSet("refresh", flag.ContinueOnError)
+	podcastID := flags.String("podcast", "", "only refresh the podcast with this ID")
+	if _, err := parseFlags(flags, args, 0); err != nil {
+		return err
+	}
+	if *podcastID != "" {
+		return service.RefreshPodcast(context.Background(), *podcastID)
+	}
+	return service.RefreshEpisodes(context.Background())
+}
+
+func downloadCommand(args []string) error {
+	positional, err := parseFlags(flag.NewFlagSet("download", flag.ContinueOnError), args, 1)
+	if err != nil {
+		return err
+	}
+	return service.DownloadSingleEpisode(context.Background(), positional[0])
+}
+
+func backupCommand(args []string) error {
+	if _, err := parseFlags(flag.NewFlagSet("backup", flag.ContinueOnError), args, 0); err != nil {
+		return err
+	}
+	name, err := service.CreateBackup()
+	if err != nil {
+		return err
+	}
+	fmt.Println(name)
+	return nil
+}
+
+func restoreCommand(args []string) error {
+	positional, err := parseFlags(flag.NewFlagSet("restore", flag.ContinueOnError), args, 1)
+	if err != nil {
+		return err
+	}
+	if err := service.RestoreBackup(positional[0]); err != nil {
+		return err
+	}
+	fmt.Println("Database restored")
+	return nil
+}
+
+func listCommand(args []string) error {
+	flags := flag.NewFlagSet("list", flag.ContinueOnError)
+	podcastID := flags.String("podcast", "", "list the episodes of the podcast with this ID")
+	if _, err := parseFlags(flags, args, 0); err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	if *podcastID != "" {
+		var items []db.PodcastItem
+		if err := db.GetAllPodcastItemsByPodcastIDs([]string{*podcastID}, &items); err != nil {
+			return err
+		}
+		fmt.Fprintln(w, "ID\tPUBLISHED\tSTATUS\tPLAYED\tTITLE")
+		for i := range items {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%t\t%s\n", items[i].ID, items[i].PubDate.Format("2006-01-02"),
+				items[i].DownloadStatus, items[i].IsPlayed, items[i].Title)
+		}
+		return w.Flush()
+	}
+
+	podcasts := service.GetAllPodcasts("title")
+	fmt.Fprintln(w, "ID\tEPISODES\tDOWNLOADED\tPAUSED\tTITLE")
+	for i := range *podcasts {
+		p := (*podcasts)[i]
+		fmt.Fprintf(w, "%s\t%d\t%d\t%t\t%s\n", p.ID, p.AllEpisodesCount, p.DownloadedEpisodesCount, p.IsPaused, p.Title)
+	}
+	return w.Flush()
+}
+
+func statsCommand(args []string) error {
+	if _, err := parseFlags(flag.NewFlagSet("stats", flag.ContinueOnError), args, 0); err != nil {
+		return err
+	}
+	podcasts := service.GetAllPodcasts("")
+	episodes, downloaded := 0, 0
+	for i := range *podcasts {
+		episodes += (*podcasts)[i].AllEpisodesCount
+		downloaded += (*podcasts)[i].DownloadedEpisodesCount
+	}
+	diskStats, err := db.GetPodcastEpisodeDiskStats()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Podcasts\t%d\n", len(*podcasts))
+	fmt.Fprintf(w, "Episodes\t%d\n", episodes)
+	fmt.Fprintf(w, "Downloaded episodes\t%d\n", downloaded)
+	fmt.Fprintf(w, "Downloaded size\t%s\n", formatFileSize(diskStats.Downloaded))
+	fmt.Fprintf(w, "Pending download size\t%s\n", formatFileSize(diskStats.PendingDownload))
+	fmt.Fprintf(w, "Deleted size\t%s\n", formatFileSize(diskStats.Deleted))
+	return w.Flush()
+}
@@ -0,0 +1,199 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/akhilrex/podgrab/internal/config"
+	"github.com/akhilrex/podgrab/internal/logger"
+	"github.com/akhilrex/podgrab/internal/openapi"
+	"github.com/akhilrex/podgrab/internal/redact"
+	"github.com/akhilrex/podgrab/model"
+	"github.com/akhilrex/podgrab/service"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"gorm.io/gorm"
+)
+
+// APIV1Prefix is the path of the versioned JSON API.
+const APIV1Prefix = "/api/v1"
+
+// legacyRoutesDeprecatedAt is when the unversioned JSON routes were replaced
+// by the versioned API, sent in their Deprecation header.
+var legacyRoutesDeprecatedAt = time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// apiRoute is a route of the versioned API and its documentation.
+type apiRoute struct {
+	handler gin.HandlerFunc
+	openapi.Route
+}
+
+// RegisterAPIV1 adds the routes of the versioned API to group, which is
+// mounted at APIV1Prefix, and serves their OpenAPI document at
+// /openapi.json.
+func RegisterAPIV1(group *gin.RouterGroup) {
+	doc := openapi.New(openapi.Info{
+		Title:       "Podgrab API",
+		Description: "Manage podcasts, episodes, tags, playlists, settings, notifications and jobs.",
+		Version:     "1.0.0",
+	}, APIV1Prefix, model.ErrorResponse{})
+	if config.Get().Password != "" {
+		doc.UseBasicAuth()
+	}
+	if validate, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		validate.RegisterTagNameFunc(requestFieldName)
+	}
+	for _, routes := range [][]apiRoute{podcastRoutes(), episodeRoutes(), tagRoutes(), playlistRoutes(), settingRoutes(), notificationRoutes(), jobRoutes()} {
+		for i := range routes {
+			group.Handle(routes[i].Method, routes[i].Path, routes[i].handler)
+			doc.Add(&routes[i].Route)
+		}
+	}
+	group.GET("/openapi.json", func(c *gin.Context) {
+		c.JSON(http.StatusOK, doc)
+	})
+}
+
+// APINotFound responds to unknown paths of the versioned API with an error
+// envelope, and to other paths like gin.
+func APINotFound(c *gin.Context) {
+	if strings.HasPrefix(c.Request.URL.Path, APIV1Prefix+"/") {
+		apiError(c, model.NewNotFoundError("Route"), "")
+		return
+	}
+	c.String(http.StatusNotFound, "404 page not found")
+}
+
+// Deprecated marks the responses of a legacy route replaced by successor,
+// a path of the versioned API whose :params are filled from the request.
+func Deprecated(successor string) gin.HandlerFunc {
+	deprecation := fmt.Sprintf("@%d", legacyRoutesDeprecatedAt.Unix())
+	return func(c *gin.Context) {
+		link := successor
+		for _, param := range c.Params {
+			link = strings.ReplaceAll(link, ":"+param.Key, url.PathEscape(param.Value))
+		}
+		c.Header("Deprecation", deprecation)
+		c.Header("Link", fmt.Sprintf("<%s>; rel=\"successor-version\"", link))
+		c.Next()
+	}
+}
+
+// PageQuery represents the page of a list request.
+type PageQuery struct {
+	Page  int `form:"page" binding:"omitempty,min=1"`
+	Count int `form:"count" binding:"omitempty,min=1,max=100"`
+}
+
+// pagination returns the requested page with the defaults applied.
+func (query PageQuery) pagination() model.Pagination {
+	pagination := model.Pagination{Page: query.Page, Count: query.Count}
+	pagination.SetDefaults()
+	return pagination
+}
+
+// pageOf returns the page of items and sets the counts of pagination.
+func pageOf[T any](items []T, pagination *model.Pagination) []T {
+	pagination.SetCounts(int64(len(items)))
+	start := min(pagination.Offset(), len(items))
+	end := min(start+pagination.Count, len(items))
+	return items[start:end]
+}
+
+// bindError responds to a request that failed binding, describing the
+// fields that failed validation.
+func bindError(c *gin.Context, err error) {
+	var invalid validator.ValidationErrors
+	if !errors.As(err, &invalid) {
+		apiError(c, model.NewInvalidRequestError(err.Error()), "")
+		return
+	}
+	problems := make([]string, 0, len(invalid))
+	for _, fieldErr := range invalid {
+		problems = append(problems, validationProblem(fieldErr))
+	}
+	apiError(c, model.NewInvalidRequestError(strings.Join(problems, "; ")), "")
+}
+
+// requestFieldName names fields in validation errors as clients send them.
+func requestFieldName(field reflect.StructField) string {
+	for _, key := range []string{"json", "form", "uri"} {
+		if name, _, _ := strings.Cut(field.Tag.Get(key), ","); name != "" && name != "-" {
+			return name
+		}
+	}
+	return field.Name
+}
+
+func validationProblem(fieldErr validator.FieldError) string {
+	field := fieldErr.Field()
+	switch fieldErr.Tag() {
+	case "required", "required_if":
+		return field + " is required"
+	case "min":
+		return fmt.Sprintf("%s must be at least %s", field, fieldErr.Param())
+	case "max":
+		return fmt.Sprintf("%s must be at most %s", field, fieldErr.Param())
+	case "oneof":
+		return fmt.Sprintf("%s must be one of %s", field, strings.Join(strings.Fields(fieldErr.Param()), ", "))
+	case "url":
+		return field + " must be a URL"
+	default:
+		return field + " is invalid"
+	}
+}
+
+// apiError responds with the error envelope of err. Records that are not
+// found are reported as a missing resource, such as "Podcast".
+func apiError(c *gin.Context, err error, resource string) {
+	apiErr := model.AsAPIError(err)
+	switch {
+	case apiErr != nil:
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		apiErr = model.NewNotFoundError(resource)
+	case errors.Is(err, service.ErrJobNotFound):
+		apiErr = model.NewNotFoundError("Job")
+	case errors.Is(err, service.ErrInvalidFeedAuth),
+		errors.Is(err, service.ErrInvalidDedupSensitivity),
+		errors.Is(err, service.ErrInvalidDownloadLimits),
+		errors.Is(err, service.ErrInvalidSchedule),
+		errors.Is(err, service.ErrInvalidBulkRequest),
+		errors.Is(err, service.ErrInvalidPodcastOverrides),
+		errors.Is(err, service.ErrInvalidFeedURL),
+		errors.Is(err, service.ErrInvalidTranscode),
+		errors.Is(err, service.ErrInvalidSmartPlaylist),
+		errors.Is(err, service.ErrInvalidPlaylist),
+		errors.Is(err, service.ErrInvalidLocalPodcast):
+		apiErr = model.NewInvalidRequestError(err.Error())
+	case errors.Is(err, service.ErrNotDownloading),
+		errors.Is(err, service.ErrJobRunning),
+		errors.Is(err, service.ErrJobLocked),
+		errors.Is(err, service.ErrPodcastFolderInUse),
+		errors.Is(err, service.ErrEpisodeNotDownloaded),
+		errors.Is(err, service.ErrNotLocalPodcast),
+		errors.Is(err, service.ErrLocalPodcast):
+		apiErr = model.NewConflictError(err.Error())
+	case errors.Is(err, service.ErrShuttingDown),
+		errors.Is(err, service.ErrTranscoderUnavailable):
+		apiErr = model.NewUnavailableError(err.Error())
+	default:
+		logger.Log.Errorw("API request failed", "method", c.Request.Method, "path", c.FullPath(), "error", err)
+		apiErr = model.NewInternalError("Internal server error")
+	}
+	c.AbortWithStatusJSON(apiErr.Status, model.ErrorResponse{Error: apiErr})
+}
+
+// redactedError returns err as an invalid request with any credentials in
+// its message masked, for errors quoting feed URLs.
+func redactedError(err error) error {
+	if model.AsAPIError(err) != nil || errors.Is(err, service.ErrInvalidFeedAuth) {
+		return err
+	}
+	return model.NewInvalidRequestError(redact.String(err.Error()))
+}
@@ -0,0 +1,487 @@
+package controllers
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/akhilrex/podgrab/db"
+	"github.com/akhilrex/podgrab/internal/logger"
+	"github.com/akhilrex/podgrab/internal/openapi"
+	"github.com/akhilrex/podgrab/internal/redact"
+	"github.com/akhilrex/podgrab/model"
+	"github.com/akhilrex/podgrab/service"
+	"github.com/gin-gonic/gin"
+)
+
+// EpisodeResponse represents an episode in the versioned API.
+type EpisodeResponse struct {
+	PubDate           time.Time  `json:"pubDate"`
+	DownloadDate      *time.Time `json:"downloadDate"`
+	BookmarkDate      *time.Time `json:"bookmarkDate"`
+	RemovedUpstreamAt *time.Time `json:"removedUpstreamAt"`
+	ID                string     `json:"id"`
+	PodcastID         string     `json:"podcastId"`
+	PodcastTitle      string     `json:"podcastTitle"`
+	Title             string     `json:"title"`
+	Summary           string     `json:"summary"`
+	Image             string     `json:"image"`
+	FileURL           string     `json:"fileUrl"`
+	EpisodeType       string     `json:"episodeType"`
+	// DownloadStatus is queued, downloading, downloaded or deleted.
+	DownloadStatus       string `json:"downloadStatus"`
+	FileSize             int64  `json:"fileSize"`
+	Duration             int    `json:"duration"`
+	DownloadFailureCount int    `json:"downloadFailureCount"`
+	IsPlayed             bool   `json:"isPlayed"`
+	IsBookmarked         bool   `json:"isBookmarked"`
+}
+
+// EpisodeList represents a page of episodes.
+type EpisodeList struct {
+	Items      []EpisodeResponse `json:"items"`
+	Pagination model.Pagination  `json:"pagination"`
+}
+
+// EpisodeHistoryResponse represents a change of an episode's GUID or
+// enclosure URL in its feed.
+type EpisodeHistoryResponse struct {
+	CreatedAt  time.Time `json:"createdAt"`
+	ID         string    `json:"id"`
+	OldGUID    string    `json:"oldGuid"`
+	NewGUID    string    `json:"newGuid"`
+	OldFileURL string    `json:"oldFileUrl"`
+	NewFileURL string    `json:"newFileUrl"`
+	MatchedBy  string    `json:"matchedBy"`
+}
+
+// EpisodeHistoryList represents a page of an episode's history.
+type EpisodeHistoryList struct {
+	Items      []EpisodeHistoryResponse `json:"items"`
+	Pagination model.Pagination         `json:"pagination"`
+}
+
+// ListEpisodesQuery represents the list episodes query.
+type ListEpisodesQuery struct {
+	IsDownloaded *bool    `form:"isDownloaded"`
+	IsPlayed     *bool    `form:"isPlayed"`
+	Sorting      string   `form:"sorting" binding:"omitempty,oneof=release_asc release_desc duration_asc duration_desc"`
+	Q            string   `form:"q"`
+	TagIDs       []string `form:"tagIds"`
+	PodcastIDs   []string `form:"podcastIds"`
+	PageQuery
+}
+
+// ListEpisodeHistoryQuery represents the list episode history query.
+type ListEpisodeHistoryQuery struct {
+	ID string `uri:"id" binding:"required"`
+	PageQuery
+}
+
+// StreamEpisodeQuery represents the stream episode request. Format
+// transcodes the episode to opus or aac at bitrate kbit/s.
+type StreamEpisodeQuery struct {
+	ID      string `uri:"id" binding:"required"`
+	Format  string `form:"format" binding:"omitempty,oneof=opus aac"`
+	Bitrate int    `form:"bitrate" binding:"omitempty,oneof=24 32 48 64 96 128"`
+}
+
+// UpdateEpisodeRequest represents the update episode request. Fields left
+// out are unchanged.
+type UpdateEpisodeRequest struct {
+	IsPlayed     *bool `json:"isPlayed"`
+	IsBookmarked *bool `json:"isBookmarked"`
+}
+
+// EpisodeSelection selects the episodes matching every field that is set.
+type EpisodeSelection struct {
+	IsDownloaded *bool    `json:"isDownloaded"`
+	IsPlayed     *bool    `json:"isPlayed"`
+	Q            string   `json:"q"`
+	TagIDs       []string `json:"tagIds"`
+	PodcastIDs   []string `json:"podcastIds"`
+}
+
+// BulkEpisodesRequest represents the bulk episodes request. Episodes are
+// selected by either IDs or Filter. TagID is the tag of the tag action, which
+// tags the podcasts of the episodes, and PlaylistID the playlist of the
+// add_to_playlist action.
+type BulkEpisodesRequest struct {
+	Filter     *EpisodeSelection `json:"filter"`
+	Action     string            `json:"action" binding:"required,oneof=mark_played mark_unplayed download delete_file bookmark unbookmark tag queue add_to_playlist"`
+	TagID      string            `json:"tagId" binding:"required_if=Action tag"`
+	PlaylistID string            `json:"playlistId" binding:"required_if=Action add_to_playlist"`
+	IDs        []string          `json:"ids" binding:"max=1000"`
+}
+
+func episodeRoutes() []apiRoute {
+	const tag = "Episodes"
+	return []apiRoute{
+		{listEpisodes, openapi.Route{Method: http.MethodGet, Path: "/episodes", ID: "listEpisodes", Tag: tag,
+			Summary: "List episodes", Params: ListEpisodesQuery{}, Response: EpisodeList{}}},
+		{bulkEpisodes, openapi.Route{Method: http.MethodPost, Path: "/episodes/bulk", ID: "bulkEpisodes", Tag: tag,
+			Summary: "Run an action on many episodes", Body: BulkEpisodesRequest{}, Response: service.BulkResult{}}},
+		{getEpisode, openapi.Route{Method: http.MethodGet, Path: "/episodes/:id", ID: "getEpisode", Tag: tag,
+			Summary: "Get an episode", Params: SearchByIDQuery{}, Response: EpisodeResponse{}}},
+		{updateEpisode, openapi.Route{Method: http.MethodPatch, Path: "/episodes/:id", ID: "updateEpisode", Tag: tag,
+			Summary: "Mark an episode played or bookmarked", Params: SearchByIDQuery{}, Body: UpdateEpisodeRequest{}, Response: EpisodeResponse{}}},
+		{downloadEpisode, openapi.Route{Method: http.MethodPost, Path: "/episodes/:id/download", ID: "downloadEpisode", Tag: tag,
+			Summary: "Download an episode", Params: SearchByIDQuery{}, Status: http.StatusAccepted}},
+		{cancelEpisodeDownload, openapi.Route{Method: http.MethodDelete, Path: "/episodes/:id/download", ID: "cancelEpisodeDownload", Tag: tag,
+			Summary: "Cancel the download of an episode", Params: SearchByIDQuery{}, Status: http.StatusNoContent, Errors: []int{http.StatusConflict}}},
+		{deleteEpisodeFile, openapi.Route{Method: http.MethodDelete, Path: "/episodes/:id/file", ID: "deleteEpisodeFile", Tag: tag,
+			Summary: "Delete the downloaded file of an episode", Params: SearchByIDQuery{}, Status: http.StatusNoContent}},
+		{streamEpisode, openapi.Route{Method: http.MethodGet, Path: "/episodes/:id/stream", ID: "streamEpisode", Tag: tag,
+			Summary: "Stream an episode, optionally transcoded", Params: StreamEpisodeQuery{}, Media: "audio/*",
+			Errors: []int{http.StatusConflict, http.StatusServiceUnavailable}}},
+		{listEpisodeHistory, openapi.Route{Method: http.MethodGet, Path: "/episodes/:id/history", ID: "listEpisodeHistory", Tag: tag,
+			Summary: "List the GUID and enclosure changes of an episode", Params: ListEpisodeHistoryQuery{}, Response: EpisodeHistoryList{}}},
+	}
+}
+
+// optionalTime returns nil for the zero time.
+func optionalTime(value time.Time) *time.Time {
+	if value.IsZero() {
+		return nil
+	}
+	return &value
+}
+
+func newEpisodeResponse(item *db.PodcastItem) EpisodeResponse {
+	return EpisodeResponse{
+		ID:                   item.ID,
+		PodcastID:            item.PodcastID,
+		PodcastTitle:         item.Podcast.Title,
+		Title:                item.Title,
+		Summary:              item.Summary,
+		Image:                item.Image,
+		FileURL:              redact.URL(item.FileURL),
+		EpisodeType:          item.EpisodeType,
+		PubDate:              item.PubDate,
+		DownloadDate:         optionalTime(item.DownloadDate),
+		BookmarkDate:         optionalTime(item.BookmarkDate),
+		RemovedUpstreamAt:    item.RemovedUpstreamAt,
+		DownloadStatus:       item.DownloadStatus.String(),
+		FileSize:             item.FileSize,
+		Duration:             item.Duration,
+		DownloadFailureCount: item.DownloadFailureCount,
+		IsPlayed:             item.IsPlayed,
+		IsBookmarked:         !item.BookmarkDate.IsZero(),
+	}
+}
+
+// respondWithEpisode responds with the episode id.
+func respondWithEpisode(c *gin.Context, id string) {
+	var item db.PodcastItem
+	if err := db.GetPodcastItemByID(id, &item); err != nil {
+		apiError(c, err, "Episode")
+		return
+	}
+	c.JSON(http.StatusOK, newEpisodeResponse(&item))
+}
+
+// respondWithEpisodes responds with the page of episodes filter selects.
+func respondWithEpisodes(c *gin.Context, filter *model.EpisodesFilter) {
+	filter.VerifyPaginationValues()
+	items, total, err := db.GetPaginatedPodcastItemsNew(filter)
+	if err != nil {
+		apiError(c, err, "Episode")
+		return
+	}
+	filter.SetCounts(total)
+	list := EpisodeList{Pagination: filter.Pagination, Items: make([]EpisodeResponse, 0, len(*items))}
+	for i := range *items {
+		list.Items = append(list.Items, newEpisodeResponse(&(*items)[i]))
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+// formatOptionalBool returns value as the string the episode filter expects.
+func formatOptionalBool(value *bool) *string {
+	if value == nil {
+		return nil
+	}
+	formatted := strconv.FormatBool(*value)
+	return &formatted
+}
+
+// listEpisodes handles the list episodes request.
+func listEpisodes(c *gin.Context) {
+	var query ListEpisodesQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		bindError(c, err)
+		return
+	}
+	respondWithEpisodes(c, &model.EpisodesFilter{
+		IsDownloaded: formatOptionalBool(query.IsDownloaded),
+		IsPlayed:     formatOptionalBool(query.IsPlayed),
+		Sorting:      model.EpisodeSort(query.Sorting),
+		Q:            query.Q,
+		TagIDs:       query.TagIDs,
+		PodcastIDs:   query.PodcastIDs,
+		Pagination:   query.pagination(),
+	})
+}
+
+// getEpisode handles the get episode request.
+func getEpisode(c *gin.Context) {
+	var query SearchByIDQuery
+	if err := c.ShouldBindUri(&query); err != nil {
+		bindError(c, err)
+		return
+	}
+	respondWithEpisode(c, query.ID)
+}
+
+// updateEpisode handles the update episode request.
+func updateEpisode(c *gin.Context) {
+	var query SearchByIDQuery
+	var request UpdateEpisodeRequest
+	if err := c.ShouldBindUri(&query); err != nil {
+		bindError(c, err)
+		return
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		bindError(c, err)
+		return
+	}
+	if request.IsPlayed != nil {
+		if err := service.SetPodcastItemPlayedStatus(query.ID, *request.IsPlayed); err != nil {
+			apiError(c, err, "Episode")
+			return
+		}
+	}
+	if request.IsBookmarked != nil {
+		if err := service.SetPodcastItemBookmarkStatus(query.ID, *request.IsBookmarked); err != nil {
+			apiError(c, err, "Episode")
+			return
+		}
+	}
+	respondWithEpisode(c, query.ID)
+}
+
+// downloadEpisode handles the download episode request.
+func downloadEpisode(c *gin.Context) {
+	var query SearchByIDQuery
+	if err := c.ShouldBindUri(&query); err != nil {
+		bindError(c, err)
+		return
+	}
+	var item db.PodcastItem
+	if err := db.GetPodcastItemByID(query.ID, &item); err != nil {
+		apiError(c, err, "Episode")
+		return
+	}
+	go func() {
+		if downloadErr := service.DownloadSingleEpisode(service.BackgroundContext(), query.ID); downloadErr != nil {
+			logger.Log.Errorw("downloading episode", "error", downloadErr)
+		}
+	}()
+	c.Status(http.StatusAccepted)
+}
+
+// cancelEpisodeDownload handles the cancel episode download request.
+func cancelEpisodeDownload(c *gin.Context) {
+	var query SearchByIDQuery
+	if err := c.ShouldBindUri(&query); err != nil {
+		bindError(c, err)
+		return
+	}
+	if err := service.CancelDownload(query.ID); err != nil {
+		apiError(c, err, "Episode")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// deleteEpisodeFile handles the delete episode file request.
+func deleteEpisodeFile(c *gin.Context) {
+	var query SearchByIDQuery
+	if err := c.ShouldBindUri(&query); err != nil {
+		bindError(c, err)
+		return
+	}
+	if err := service.DeleteEpisodeFile(query.ID); err != nil {
+		apiError(c, err, "Episode")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// streamEpisode handles the stream episode request. Downloaded files and
+// cached transcodes support range requests; episodes that are not downloaded
+// redirect to the publisher's file.
+func streamEpisode(c *gin.Context) {
+	var query StreamEpisodeQuery
+	if err := c.ShouldBindUri(&query); err != nil {
+		bindError(c, err)
+		return
+	}
+	if err := c.ShouldBindQuery(&query); err != nil {
+		bindError(c, err)
+		return
+	}
+	var item db.PodcastItem
+	if err := db.GetPodcastItemByID(query.ID, &item); err != nil {
+		apiError(c, err, "Episode")
+		return
+	}
+	if query.Format != "" {
+		streamTranscode(c, &item, &query)
+		return
+	}
+	if item.DownloadPath == "" {
+		redirectToPublisher(c, &item)
+		return
+	}
+	file, err := os.Open(item.DownloadPath)
+	if err != nil {
+		redirectToPublisher(c, &item)
+		return
+	}
+	defer func() {
+		if closeErr := file.Close(); closeErr != nil {
+			logger.Log.Errorw("closing file", "error", closeErr)
+		}
+	}()
+	info, err := file.Stat()
+	if err != nil {
+		apiError(c, err, "Episode")
+		return
+	}
+	serveEpisodeContent(c, file, info, GetFileContentType(item.DownloadPath))
+}
+
+// streamTranscode streams an episode transcoded as query asks, from the
+// cache when an earlier request encoded it.
+func streamTranscode(c *gin.Context, item *db.PodcastItem, query *StreamEpisodeQuery) {
+	transcode, err := service.PrepareTranscode(item, query.Format, query.Bitrate)
+	if err != nil {
+		apiError(c, err, "Episode")
+		return
+	}
+	if transcode.Cached {
+		file, openErr := os.Open(transcode.Path)
+		if openErr == nil {
+			defer func() {
+				if closeErr := file.Close(); closeErr != nil {
+					logger.Log.Errorw("closing file", "error", closeErr)
+				}
+			}()
+			if info, statErr := file.Stat(); statErr == nil {
+				serveEpisodeContent(c, file, info, transcode.ContentType)
+				return
+			}
+		}
+	}
+	// The length is unknown until the transcode is complete
+	c.Header("Content-Type", transcode.ContentType)
+	c.Header("Content-Disposition", mime.FormatMediaType("inline", map[string]string{"filename": transcode.FileName()}))
+	c.Header("Accept-Ranges", "none")
+	err = transcode.Stream(c.Request.Context(), c.Writer)
+	switch {
+	case err == nil || c.Request.Context().Err() != nil:
+	case !c.Writer.Written():
+		c.Header("Content-Disposition", "")
+		c.Header("Accept-Ranges", "")
+		apiError(c, err, "Episode")
+	default:
+		logger.Log.Errorw("streaming transcoded episode", "episode", item.ID, "error", err)
+	}
+}
+
+// serveEpisodeContent serves an episode's file inline, answering range and
+// conditional requests. The ETag changes when the file does.
+func serveEpisodeContent(c *gin.Context, file *os.File, info os.FileInfo, contentType string) {
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", mime.FormatMediaType("inline", map[string]string{"filename": info.Name()}))
+	c.Header("ETag", fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size()))
+	c.Header("Cache-Control", "private, no-cache")
+	http.ServeContent(c.Writer, c.Request, info.Name(), info.ModTime(), file)
+}
+
+// redirectToPublisher redirects to the publisher's file of an episode that
+// is not downloaded.
+func redirectToPublisher(c *gin.Context, item *db.PodcastItem) {
+	if item.FileURL == "" {
+		apiError(c, service.ErrEpisodeNotDownloaded, "Episode")
+		return
+	}
+	c.Redirect(http.StatusFound, item.FileURL)
+}
+
+// listEpisodeHistory handles the list episode history request.
+func listEpisodeHistory(c *gin.Context) {
+	var query ListEpisodeHistoryQuery
+	if err := c.ShouldBindUri(&query); err != nil {
+		bindError(c, err)
+		return
+	}
+	if err := c.ShouldBindQuery(&query); err != nil {
+		bindError(c, err)
+		return
+	}
+	history, err := service.GetEpisodeHistory(query.ID)
+	if err != nil {
+		apiError(c, err, "Episode")
+		return
+	}
+	list := EpisodeHistoryList{Pagination: query.pagination()}
+	page := pageOf(history, &list.Pagination)
+	list.Items = make([]EpisodeHistoryResponse, 0, len(page))
+	for i := range page {
+		list.Items = append(list.Items, EpisodeHistoryResponse{
+			ID:         page[i].ID,
+			CreatedAt:  page[i].CreatedAt,
+			OldGUID:    page[i].OldGUID,
+			NewGUID:    page[i].NewGUID,
+			OldFileURL: redact.URL(page[i].OldFileURL),
+			NewFileURL: redact.URL(page[i].NewFileURL),
+			MatchedBy:  page[i].MatchedBy,
+		})
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+// bulkEpisodes handles the bulk episodes request.
+func bulkEpisodes(c *gin.Context) {
+	var request BulkEpisodesRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		bindError(c, err)
+		return
+	}
+	bulk := service.BulkRequest{Action: request.Action, TagID: request.TagID, PlaylistID: request.PlaylistID, IDs: request.IDs}
+	if request.Filter != nil {
+		bulk.Filter = &model.EpisodesFilter{
+			IsDownloaded: formatOptionalBool(request.Filter.IsDownloaded),
+			IsPlayed:     formatOptionalBool(request.Filter.IsPlayed),
+			Q:            request.Filter.Q,
+			TagIDs:       request.Filter.TagIDs,
+			PodcastIDs:   request.Filter.PodcastIDs,
+		}
+	}
+	result, err := service.RunBulkAction(&bulk)
+	if err != nil {
+		apiError(c, err, "Episode")
+		return
+	}
+	if request.Action == service.BulkDownload && result.Changed > 0 {
+		go func() {
+			if downloadErr := service.DownloadMissingEpisodes(service.BackgroundContext()); downloadErr != nil {
+				logger.Log.Errorw("downloading queued episodes", "error", downloadErr)
+			}
+		}()
+	}
+	if result.Changed > 0 {
+		switch request.Action {
+		case service.BulkQueue:
+			notifyPlaylistChanged(db.QueuePlaylistID)
+		case service.BulkAddToPlaylist:
+			notifyPlaylistChanged(request.PlaylistID)
+		}
+	}
+	c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,609 @@
+package controllers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/akhilrex/podgrab/db"
+	"github.com/akhilrex/podgrab/internal/logger"
+	"github.com/akhilrex/podgrab/internal/openapi"
+	"github.com/akhilrex/podgrab/model"
+	"github.com/akhilrex/podgrab/service"
+	"github.com/gin-gonic/gin"
+)
+
+// SmartPlaylistData represents the name and criteria of a smart playlist.
+// Criteria left out match every episode.
+type SmartPlaylistData struct {
+	IsPlayed     *bool    `json:"isPlayed"`
+	IsDownloaded *bool    `json:"isDownloaded"`
+	Name         string   `json:"name" binding:"required,max=255"`
+	Sorting      string   `json:"sorting" binding:"omitempty,oneof=release_desc release_asc duration_asc duration_desc"`
+	PodcastIDs   []string `json:"podcastIds"`
+	TagIDs       []string `json:"tagIds"`
+	// MaxAgeDays selects the episodes published in the last days.
+	MaxAgeDays int `json:"maxAgeDays" binding:"min=0"`
+	// MinDuration and MaxDuration are in seconds.
+	MinDuration int `json:"minDuration" binding:"min=0"`
+	MaxDuration int `json:"maxDuration" binding:"min=0"`
+	// Limit caps the number of episodes, zero includes every match.
+	Limit int `json:"limit" binding:"min=0"`
+}
+
+// SmartPlaylistResponse represents a smart playlist in the versioned API.
+type SmartPlaylistResponse struct {
+	CreatedAt    time.Time `json:"createdAt"`
+	IsPlayed     *bool     `json:"isPlayed"`
+	IsDownloaded *bool     `json:"isDownloaded"`
+	ID           string    `json:"id"`
+	Name         string    `json:"name"`
+	Sorting      string    `json:"sorting"`
+	PodcastIDs   []string  `json:"podcastIds"`
+	TagIDs       []string  `json:"tagIds"`
+	MaxAgeDays   int       `json:"maxAgeDays"`
+	MinDuration  int       `json:"minDuration"`
+	MaxDuration  int       `json:"maxDuration"`
+	Limit        int       `json:"limit"`
+}
+
+// SmartPlaylistList represents a page of smart playlists.
+type SmartPlaylistList struct {
+	Items      []SmartPlaylistResponse `json:"items"`
+	Pagination model.Pagination        `json:"pagination"`
+}
+
+// ListPlaylistEpisodesQuery represents the list playlist episodes query.
+type ListPlaylistEpisodesQuery struct {
+	ID string `uri:"id" binding:"required"`
+	PageQuery
+}
+
+// PlaylistData represents the name and episodes of a playlist. EpisodeIDs
+// are left unchanged when they are left out.
+type PlaylistData struct {
+	Name       string   `json:"name" binding:"required,max=255"`
+	EpisodeIDs []string `json:"episodeIds" binding:"max=1000"`
+}
+
+// PlaylistResponse represents a playlist in the versioned API.
+type PlaylistResponse struct {
+	CreatedAt     time.Time `json:"createdAt"`
+	ID            string    `json:"id"`
+	Name          string    `json:"name"`
+	EpisodesCount int       `json:"episodesCount"`
+}
+
+// PlaylistList represents a page of playlists.
+type PlaylistList struct {
+	Items      []PlaylistResponse `json:"items"`
+	Pagination model.Pagination   `json:"pagination"`
+}
+
+// PlaylistEpisodesData represents the episodes arranged in or added to a
+// playlist or the up next queue. Next adds them to the start instead of the
+// end.
+type PlaylistEpisodesData struct {
+	EpisodeIDs []string `json:"episodeIds" binding:"max=1000"`
+	Next       bool     `json:"next"`
+}
+
+// PlaylistEpisodeQuery represents an episode in a playlist.
+type PlaylistEpisodeQuery struct {
+	ID        string `uri:"id" binding:"required"`
+	EpisodeID string `uri:"episodeId" binding:"required"`
+}
+
+// QueueEpisodeQuery represents an episode in the up next queue.
+type QueueEpisodeQuery struct {
+	EpisodeID string `uri:"episodeId" binding:"required"`
+}
+
+func playlistRoutes() []apiRoute {
+	const tag = "Playlists"
+	return []apiRoute{
+		{getQueue, openapi.Route{Method: http.MethodGet, Path: "/queue", ID: "getQueue", Tag: tag,
+			Summary: "List the episodes up next", Params: PageQuery{}, Response: EpisodeList{}}},
+		{setQueue, openapi.Route{Method: http.MethodPut, Path: "/queue", ID: "setQueue", Tag: tag,
+			Summary: "Replace or reorder the episodes up next", Body: PlaylistEpisodesData{}, Status: http.StatusNoContent}},
+		{addToQueue, openapi.Route{Method: http.MethodPost, Path: "/queue", ID: "addToQueue", Tag: tag,
+			Summary: "Add episodes up next", Body: PlaylistEpisodesData{}, Status: http.StatusNoContent}},
+		{removeFromQueue, openapi.Route{Method: http.MethodDelete, Path: "/queue/:episodeId", ID: "removeFromQueue", Tag: tag,
+			Summary: "Remove an episode from up next", Params: QueueEpisodeQuery{}, Status: http.StatusNoContent}},
+		{listPlaylists, openapi.Route{Method: http.MethodGet, Path: "/playlists", ID: "listPlaylists", Tag: tag,
+			Summary: "List playlists", Params: PageQuery{}, Response: PlaylistList{}}},
+		{addPlaylist, openapi.Route{Method: http.MethodPost, Path: "/playlists", ID: "addPlaylist", Tag: tag,
+			Summary: "Add a playlist", Body: PlaylistData{}, Response: PlaylistResponse{}, Status: http.StatusCreated}},
+		{getPlaylist, openapi.Route{Method: http.MethodGet, Path: "/playlists/:id", ID: "getPlaylist", Tag: tag,
+			Summary: "Get a playlist", Params: SearchByIDQuery{}, Response: PlaylistResponse{}}},
+		{updatePlaylist, openapi.Route{Method: http.MethodPut, Path: "/playlists/:id", ID: "updatePlaylist", Tag: tag,
+			Summary: "Rename a playlist", Params: SearchByIDQuery{}, Body: PlaylistData{}, Response: PlaylistResponse{}}},
+		{deletePlaylist, openapi.Route{Method: http.MethodDelete, Path: "/playlists/:id", ID: "deletePlaylist", Tag: tag,
+			Summary: "Delete a playlist", Params: SearchByIDQuery{}, Status: http.StatusNoContent}},
+		{listPlaylistEpisodes, openapi.Route{Method: http.MethodGet, Path: "/playlists/:id/episodes", ID: "listPlaylistEpisodes", Tag: tag,
+			Summary: "List the episodes of a playlist in order", Params: ListPlaylistEpisodesQuery{}, Response: EpisodeList{}}},
+		{setPlaylistEpisodes, openapi.Route{Method: http.MethodPut, Path: "/playlists/:id/episodes", ID: "setPlaylistEpisodes", Tag: tag,
+			Summary: "Replace or reorder the episodes of a playlist", Params: SearchByIDQuery{}, Body: PlaylistEpisodesData{}, Status: http.StatusNoContent}},
+		{addPlaylistEpisodes, openapi.Route{Method: http.MethodPost, Path: "/playlists/:id/episodes", ID: "addPlaylistEpisodes", Tag: tag,
+			Summary: "Add episodes to a playlist", Params: SearchByIDQuery{}, Body: PlaylistEpisodesData{}, Status: http.StatusNoContent}},
+		{removePlaylistEpisode, openapi.Route{Method: http.MethodDelete, Path: "/playlists/:id/episodes/:episodeId", ID: "removePlaylistEpisode", Tag: tag,
+			Summary: "Remove an episode from a playlist", Params: PlaylistEpisodeQuery{}, Status: http.StatusNoContent}},
+		{listSmartPlaylists, openapi.Route{Method: http.MethodGet, Path: "/smart-playlists", ID: "listSmartPlaylists", Tag: tag,
+			Summary: "List smart playlists", Params: PageQuery{}, Response: SmartPlaylistList{}}},
+		{addSmartPlaylist, openapi.Route{Method: http.MethodPost, Path: "/smart-playlists", ID: "addSmartPlaylist", Tag: tag,
+			Summary: "Add a smart playlist", Body: SmartPlaylistData{}, Response: SmartPlaylistResponse{}, Status: http.StatusCreated}},
+		{getSmartPlaylist, openapi.Route{Method: http.MethodGet, Path: "/smart-playlists/:id", ID: "getSmartPlaylist", Tag: tag,
+			Summary: "Get a smart playlist", Params: SearchByIDQuery{}, Response: SmartPlaylistResponse{}}},
+		{updateSmartPlaylist, openapi.Route{Method: http.MethodPut, Path: "/smart-playlists/:id", ID: "updateSmartPlaylist", Tag: tag,
+			Summary: "Replace a smart playlist", Params: SearchByIDQuery{}, Body: SmartPlaylistData{}, Response: SmartPlaylistResponse{}}},
+		{deleteSmartPlaylist, openapi.Route{Method: http.MethodDelete, Path: "/smart-playlists/:id", ID: "deleteSmartPlaylist", Tag: tag,
+			Summary: "Delete a smart playlist", Params: SearchByIDQuery{}, Status: http.StatusNoContent}},
+		{listSmartPlaylistEpisodes, openapi.Route{Method: http.MethodGet, Path: "/smart-playlists/:id/episodes", ID: "listSmartPlaylistEpisodes", Tag: tag,
+			Summary: "List the episodes of a smart playlist in its order", Params: ListPlaylistEpisodesQuery{}, Response: EpisodeList{}}},
+	}
+}
+
+// apply copies the request onto playlist.
+func (data *SmartPlaylistData) apply(playlist *db.SmartPlaylist) {
+	playlist.Name = data.Name
+	playlist.Sorting = data.Sorting
+	playlist.IsPlayed = data.IsPlayed
+	playlist.IsDownloaded = data.IsDownloaded
+	playlist.PodcastIDs = strings.Join(data.PodcastIDs, ",")
+	playlist.TagIDs = strings.Join(data.TagIDs, ",")
+	playlist.MaxAgeDays = data.MaxAgeDays
+	playlist.MinDuration = data.MinDuration
+	playlist.MaxDuration = data.MaxDuration
+	playlist.Limit = data.Limit
+}
+
+func newSmartPlaylistResponse(playlist *db.SmartPlaylist) SmartPlaylistResponse {
+	return SmartPlaylistResponse{
+		ID:           playlist.ID,
+		CreatedAt:    playlist.CreatedAt,
+		Name:         playlist.Name,
+		Sorting:      playlist.Sorting,
+		IsPlayed:     playlist.IsPlayed,
+		IsDownloaded: playlist.IsDownloaded,
+		PodcastIDs:   splitList(playlist.PodcastIDs),
+		TagIDs:       splitList(playlist.TagIDs),
+		MaxAgeDays:   playlist.MaxAgeDays,
+		MinDuration:  playlist.MinDuration,
+		MaxDuration:  playlist.MaxDuration,
+		Limit:        playlist.Limit,
+	}
+}
+
+func newPlaylistResponse(playlist *db.Playlist) PlaylistResponse {
+	return PlaylistResponse{
+		ID:            playlist.ID,
+		CreatedAt:     playlist.CreatedAt,
+		Name:          playlist.Name,
+		EpisodesCount: playlist.EpisodesCount,
+	}
+}
+
+// listSmartPlaylists handles the list smart playlists request.
+func listSmartPlaylists(c *gin.Context) {
+	var query PageQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		bindError(c, err)
+		return
+	}
+	playlists, err := db.GetAllSmartPlaylists()
+	if err != nil {
+		apiError(c, err, "Smart playlist")
+		return
+	}
+	list := SmartPlaylistList{Pagination: query.pagination()}
+	page := pageOf(*playlists, &list.Pagination)
+	list.Items = make([]SmartPlaylistResponse, 0, len(page))
+	for i := range page {
+		list.Items = append(list.Items, newSmartPlaylistResponse(&page[i]))
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+// addSmartPlaylist handles the add smart playlist request.
+func addSmartPlaylist(c *gin.Context) {
+	var data SmartPlaylistData
+	if err := c.ShouldBindJSON(&data); err != nil {
+		bindError(c, err)
+		return
+	}
+	var playlist db.SmartPlaylist
+	data.apply(&playlist)
+	if err := service.ValidateSmartPlaylist(&playlist); err != nil {
+		apiError(c, err, "")
+		return
+	}
+	if err := db.CreateSmartPlaylist(&playlist); err != nil {
+		apiError(c, err, "Smart playlist")
+		return
+	}
+	c.JSON(http.StatusCreated, newSmartPlaylistResponse(&playlist))
+}
+
+// getSmartPlaylist handles the get smart playlist request.
+func getSmartPlaylist(c *gin.Context) {
+	var query SearchByIDQuery
+	if err := c.ShouldBindUri(&query); err != nil {
+		bindError(c, err)
+		return
+	}
+	var playlist db.SmartPlaylist
+	if err := db.GetSmartPlaylistByID(query.ID, &playlist); err != nil {
+		apiError(c, err, "Smart playlist")
+		return
+	}
+	c.JSON(http.StatusOK, newSmartPlaylistResponse(&playlist))
+}
+
+// updateSmartPlaylist handles the update smart playlist request.
+func updateSmartPlaylist(c *gin.Context) {
+	var query SearchByIDQuery
+	var data SmartPlaylistData
+	if err := c.ShouldBindUri(&query); err != nil {
+		bindError(c, err)
+		return
+	}
+	if err := c.ShouldBindJSON(&data); err != nil {
+		bindError(c, err)
+		return
+	}
+	var playlist db.SmartPlaylist
+	if err := db.GetSmartPlaylistByID(query.ID, &playlist); err != nil {
+		apiError(c, err, "Smart playlist")
+		return
+	}
+	data.apply(&playlist)
+	if err := service.ValidateSmartPlaylist(&playlist); err != nil {
+		apiError(c, err, "")
+		return
+	}
+	if err := db.UpdateSmartPlaylist(&playlist); err != nil {
+		apiError(c, err, "Smart playlist")
+		return
+	}
+	c.JSON(http.StatusOK, newSmartPlaylistResponse(&playlist))
+}
+
+// deleteSmartPlaylist handles the delete smart playlist request.
+func deleteSmartPlaylist(c *gin.Context) {
+	var query SearchByIDQuery
+	if err := c.ShouldBindUri(&query); err != nil {
+		bindError(c, err)
+		return
+	}
+	var playlist db.SmartPlaylist
+	if err := db.GetSmartPlaylistByID(query.ID, &playlist); err != nil {
+		apiError(c, err, "Smart playlist")
+		return
+	}
+	if err := db.DeleteSmartPlaylistByID(query.ID); err != nil {
+		apiError(c, err, "Smart playlist")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// listSmartPlaylistEpisodes handles the list smart playlist episodes request.
+func listSmartPlaylistEpisodes(c *gin.Context) {
+	var query ListPlaylistEpisodesQuery
+	if err := c.ShouldBindUri(&query); err != nil {
+		bindError(c, err)
+		return
+	}
+	if err := c.ShouldBindQuery(&query); err != nil {
+		bindError(c, err)
+		return
+	}
+	var playlist db.SmartPlaylist
+	if err := db.GetSmartPlaylistByID(query.ID, &playlist); err != nil {
+		apiError(c, err, "Smart playlist")
+		return
+	}
+	items, err := service.GetSmartPlaylistItems(&playlist)
+	if err != nil {
+		apiError(c, err, "Episode")
+		return
+	}
+	list := EpisodeList{Pagination: query.pagination()}
+	page := pageOf(items, &list.Pagination)
+	list.Items = make([]EpisodeResponse, 0, len(page))
+	for i := range page {
+		list.Items = append(list.Items, newEpisodeResponse(&page[i]))
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+// getQueue handles the get queue request.
+func getQueue(c *gin.Context) {
+	var query PageQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		bindError(c, err)
+		return
+	}
+	episodeListOf(c, db.QueuePlaylistID, &query)
+}
+
+// setQueue handles the set queue request.
+func setQueue(c *gin.Context) {
+	var data PlaylistEpisodesData
+	if err := c.ShouldBindJSON(&data); err != nil {
+		bindError(c, err)
+		return
+	}
+	if err := service.SetPlaylistEpisodes(db.QueuePlaylistID, data.EpisodeIDs); err != nil {
+		apiError(c, err, "Episode")
+		return
+	}
+	notifyPlaylistChanged(db.QueuePlaylistID)
+	c.Status(http.StatusNoContent)
+}
+
+// addToQueue handles the add to queue request.
+func addToQueue(c *gin.Context) {
+	var data PlaylistEpisodesData
+	if err := c.ShouldBindJSON(&data); err != nil {
+		bindError(c, err)
+		return
+	}
+	added, err := service.AddPlaylistEpisodes(db.QueuePlaylistID, data.EpisodeIDs, data.Next)
+	if err != nil {
+		apiError(c, err, "Episode")
+		return
+	}
+	if added > 0 {
+		notifyPlaylistChanged(db.QueuePlaylistID)
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// removeFromQueue handles the remove from queue request.
+func removeFromQueue(c *gin.Context) {
+	var query QueueEpisodeQuery
+	if err := c.ShouldBindUri(&query); err != nil {
+		bindError(c, err)
+		return
+	}
+	if err := db.RemovePlaylistEpisode(db.QueuePlaylistID, query.EpisodeID); err != nil {
+		apiError(c, err, "Episode")
+		return
+	}
+	notifyPlaylistChanged(db.QueuePlaylistID)
+	c.Status(http.StatusNoContent)
+}
+
+// listPlaylists handles the list playlists request.
+func listPlaylists(c *gin.Context) {
+	var query PageQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		bindError(c, err)
+		return
+	}
+	playlists, err := db.GetAllPlaylists()
+	if err != nil {
+		apiError(c, err, "Playlist")
+		return
+	}
+	list := PlaylistList{Pagination: query.pagination()}
+	page := pageOf(*playlists, &list.Pagination)
+	list.Items = make([]PlaylistResponse, 0, len(page))
+	for i := range page {
+		list.Items = append(list.Items, newPlaylistResponse(&page[i]))
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+// addPlaylist handles the add playlist request.
+func addPlaylist(c *gin.Context) {
+	var data PlaylistData
+	if err := c.ShouldBindJSON(&data); err != nil {
+		bindError(c, err)
+		return
+	}
+	playlist := db.Playlist{Name: data.Name}
+	if err := service.ValidatePlaylist(&playlist); err != nil {
+		apiError(c, err, "")
+		return
+	}
+	if err := db.CreatePlaylist(&playlist); err != nil {
+		apiError(c, err, "Playlist")
+		return
+	}
+	if data.EpisodeIDs != nil {
+		if err := service.SetPlaylistEpisodes(playlist.ID, data.EpisodeIDs); err != nil {
+			if deleteErr := db.DeletePlaylistByID(playlist.ID); deleteErr != nil {
+				logger.Log.Errorw("deleting playlist", "playlist", playlist.ID, "error", deleteErr)
+			}
+			apiError(c, err, "Episode")
+			return
+		}
+	}
+	respondPlaylist(c, http.StatusCreated, playlist.ID)
+}
+
+// getPlaylist handles the get playlist request.
+func getPlaylist(c *gin.Context) {
+	var query SearchByIDQuery
+	if err := c.ShouldBindUri(&query); err != nil {
+		bindError(c, err)
+		return
+	}
+	respondPlaylist(c, http.StatusOK, query.ID)
+}
+
+// updatePlaylist handles the update playlist request.
+func updatePlaylist(c *gin.Context) {
+	var query SearchByIDQuery
+	var data PlaylistData
+	if err := c.ShouldBindUri(&query); err != nil {
+		bindError(c, err)
+		return
+	}
+	if err := c.ShouldBindJSON(&data); err != nil {
+		bindError(c, err)
+		return
+	}
+	var playlist db.Playlist
+	if err := db.GetPlaylistByID(query.ID, &playlist); err != nil {
+		apiError(c, err, "Playlist")
+		return
+	}
+	playlist.Name = data.Name
+	if err := service.ValidatePlaylist(&playlist); err != nil {
+		apiError(c, err, "")
+		return
+	}
+	if data.EpisodeIDs != nil {
+		if err := service.SetPlaylistEpisodes(playlist.ID, data.EpisodeIDs); err != nil {
+			apiError(c, err, "Episode")
+			return
+		}
+		notifyPlaylistChanged(playlist.ID)
+	}
+	if err := db.UpdatePlaylist(&playlist); err != nil {
+		apiError(c, err, "Playlist")
+		return
+	}
+	respondPlaylist(c, http.StatusOK, playlist.ID)
+}
+
+// deletePlaylist handles the delete playlist request.
+func deletePlaylist(c *gin.Context) {
+	var query SearchByIDQuery
+	if err := c.ShouldBindUri(&query); err != nil {
+		bindError(c, err)
+		return
+	}
+	var playlist db.Playlist
+	if err := db.GetPlaylistByID(query.ID, &playlist); err != nil {
+		apiError(c, err, "Playlist")
+		return
+	}
+	if err := db.DeletePlaylistByID(query.ID); err != nil {
+		apiError(c, err, "Playlist")
+		return
+	}
+	notifyPlaylistChanged(query.ID)
+	c.Status(http.StatusNoContent)
+}
+
+// listPlaylistEpisodes handles the list playlist episodes request.
+func listPlaylistEpisodes(c *gin.Context) {
+	var query ListPlaylistEpisodesQuery
+	if err := c.ShouldBindUri(&query); err != nil {
+		bindError(c, err)
+		return
+	}
+	if err := c.ShouldBindQuery(&query); err != nil {
+		bindError(c, err)
+		return
+	}
+	var playlist db.Playlist
+	if err := db.GetPlaylistByID(query.ID, &playlist); err != nil {
+		apiError(c, err, "Playlist")
+		return
+	}
+	episodeListOf(c, playlist.ID, &query.PageQuery)
+}
+
+// setPlaylistEpisodes handles the set playlist episodes request.
+func setPlaylistEpisodes(c *gin.Context) {
+	playlistID, data, ok := bindPlaylistEpisodes(c)
+	if !ok {
+		return
+	}
+	if err := service.SetPlaylistEpisodes(playlistID, data.EpisodeIDs); err != nil {
+		apiError(c, err, "Episode")
+		return
+	}
+	notifyPlaylistChanged(playlistID)
+	c.Status(http.StatusNoContent)
+}
+
+// addPlaylistEpisodes handles the add playlist episodes request.
+func addPlaylistEpisodes(c *gin.Context) {
+	playlistID, data, ok := bindPlaylistEpisodes(c)
+	if !ok {
+		return
+	}
+	added, err := service.AddPlaylistEpisodes(playlistID, data.EpisodeIDs, data.Next)
+	if err != nil {
+		apiError(c, err, "Episode")
+		return
+	}
+	if added > 0 {
+		notifyPlaylistChanged(playlistID)
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// removePlaylistEpisode handles the remove playlist episode request.
+func removePlaylistEpisode(c *gin.Context) {
+	var query PlaylistEpisodeQuery
+	if err := c.ShouldBindUri(&query); err != nil {
+		bindError(c, err)
+		return
+	}
+	var playlist db.Playlist
+	if err := db.GetPlaylistByID(query.ID, &playlist); err != nil {
+		apiError(c, err, "Playlist")
+		return
+	}
+	if err := db.RemovePlaylistEpisode(playlist.ID, query.EpisodeID); err != nil {
+		apiError(c, err, "Episode")
+		return
+	}
+	notifyPlaylistChanged(playlist.ID)
+	c.Status(http.StatusNoContent)
+}
+
+// bindPlaylistEpisodes binds the playlist and episodes of a request,
+// responding with an error unless the playlist exists.
+func bindPlaylistEpisodes(c *gin.Context) (string, *PlaylistEpisodesData, bool) {
+	var query SearchByIDQuery
+	var data PlaylistEpisodesData
+	if err := c.ShouldBindUri(&query); err != nil {
+		bindError(c, err)
+		return "", nil, false
+	}
+	if err := c.ShouldBindJSON(&data); err != nil {
+		bindError(c, err)
+		return "", nil, false
+	}
+	var playlist db.Playlist
+	if err := db.GetPlaylistByID(query.ID, &playlist); err != nil {
+		apiError(c, err, "Playlist")
+		return "", nil, false
+	}
+	return playlist.ID, &data, true
+}
+
+// respondPlaylist responds with status and the playlist of id.
+func respondPlaylist(c *gin.Context, status int, id string) {
+	var playlist db.Playlist
+	if err := db.GetPlaylistByID(id, &playlist); err != nil {
+		apiError(c, err, "Playlist")
+		return
+	}
+	c.JSON(status, newPlaylistResponse(&playlist))
+}
+
+// episodeListOf responds with a page of the episodes of a playlist, or of
+// the up next queue for db.QueuePlaylistID.
+func episodeListOf(c *gin.Context, playlistID string, query *PageQuery) {
+	items, err := db.GetPlaylistEpisodes(playlistID)
+	if err != nil {
+		apiError(c, err, "Episode")
+		return
+	}
+	list := EpisodeList{Pagination: query.pagination()}
+	page := pageOf(items, &list.Pagination)
+	list.Items = make([]EpisodeResponse, 0, len(page))
+	for i := range page {
+		list.Items = append(list.Items, newEpisodeResponse(&page[i]))
+	}
+	c.JSON(http.StatusOK, list)
+}
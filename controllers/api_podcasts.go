@@ -0,0 +1,737 @@
+package controllers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/akhilrex/podgrab/db"
+	"github.com/akhilrex/podgrab/internal/logger"
+	"github.com/akhilrex/podgrab/internal/openapi"
+	"github.com/akhilrex/podgrab/internal/redact"
+	"github.com/akhilrex/podgrab/model"
+	"github.com/akhilrex/podgrab/service"
+	"github.com/gin-gonic/gin"
+)
+
+// PodcastResponse represents a podcast in the versioned API.
+type PodcastResponse struct {
+	CreatedAt        time.Time      `json:"createdAt"`
+	LastEpisode      *time.Time     `json:"lastEpisode"`
+	LastFeedSuccess  *time.Time     `json:"lastFeedSuccess"`
+	ID               string         `json:"id"`
+	Title            string         `json:"title"`
+	Summary          string         `json:"summary"`
+	Author           string         `json:"author"`
+	Image            string         `json:"image"`
+	URL              string         `json:"url"`
+	LastFeedError    string         `json:"lastFeedError"`
+	Folder           string         `json:"folder"`
+	LocalPath        string         `json:"localPath"`
+	Feed             PodcastDetails `json:"feed"`
+	Overrides        PodcastDetails `json:"overrides"`
+	Tags             []TagSummary   `json:"tags"`
+	DownloadedSize   int64          `json:"downloadedSize"`
+	QueuedSize       int64          `json:"queuedSize"`
+	EpisodeCount     int            `json:"episodeCount"`
+	DownloadedCount  int            `json:"downloadedCount"`
+	QueuedCount      int            `json:"queuedCount"`
+	FeedFailureCount int            `json:"feedFailureCount"`
+	IsPaused         bool           `json:"isPaused"`
+	IsLocal          bool           `json:"isLocal"`
+	HasCredentials   bool           `json:"hasCredentials"`
+}
+
+// PodcastDetails represents the details of a podcast from its feed or
+// overridden by the user. Title, Summary, Author and Image of
+// PodcastResponse are the details shown, the overrides where set.
+type PodcastDetails struct {
+	Title   string `json:"title"`
+	Summary string `json:"summary"`
+	Author  string `json:"author"`
+	Image   string `json:"image"`
+}
+
+// PodcastList represents a page of podcasts.
+type PodcastList struct {
+	Items      []PodcastResponse `json:"items"`
+	Pagination model.Pagination  `json:"pagination"`
+}
+
+// TagSummary represents a tag applied to a podcast.
+type TagSummary struct {
+	ID    string `json:"id"`
+	Label string `json:"label"`
+}
+
+// TagResponse represents a tag in the versioned API.
+type TagResponse struct {
+	CreatedAt   time.Time `json:"createdAt"`
+	ID          string    `json:"id"`
+	Label       string    `json:"label"`
+	Description string    `json:"description"`
+	PodcastIDs  []string  `json:"podcastIds"`
+}
+
+// TagList represents a page of tags.
+type TagList struct {
+	Items      []TagResponse    `json:"items"`
+	Pagination model.Pagination `json:"pagination"`
+}
+
+// ListPodcastsQuery represents the list podcasts query.
+type ListPodcastsQuery struct {
+	Sort  string `form:"sort" binding:"omitempty,oneof=dateadded name lastepisode"`
+	Order string `form:"order" binding:"omitempty,oneof=asc desc"`
+	PageQuery
+}
+
+// DeletePodcastQuery represents the delete podcast query.
+type DeletePodcastQuery struct {
+	ID string `uri:"id" binding:"required"`
+	// KeepFiles keeps the downloaded episodes on disk.
+	KeepFiles bool `form:"keepFiles"`
+}
+
+// ListEpisodesByPodcastQuery represents the list episodes of a podcast query.
+type ListEpisodesByPodcastQuery struct {
+	ID string `uri:"id" binding:"required"`
+	PageQuery
+}
+
+// AddPodcastRequest represents the add podcast request.
+type AddPodcastRequest struct {
+	// Auth holds the credentials of a private feed.
+	Auth *service.FeedAuth `json:"auth"`
+	URL  string            `json:"url" binding:"required,url"`
+}
+
+// AddLocalPodcastRequest represents the add local podcast request. An
+// empty path creates a folder in the data directory for uploaded files and
+// an empty title uses the name of the folder.
+type AddLocalPodcastRequest struct {
+	Title   string `json:"title" binding:"omitempty,max=255"`
+	Author  string `json:"author" binding:"omitempty,max=255"`
+	Summary string `json:"summary"`
+	Path    string `json:"path" binding:"omitempty,max=4096"`
+}
+
+// UpdatePodcastRequest represents the update podcast request. Fields left
+// out are unchanged. Empty title, summary, author and image overrides revert
+// to the feed's details and an empty folder to the feed's title.
+type UpdatePodcastRequest struct {
+	Title    *string `json:"title"`
+	Summary  *string `json:"summary"`
+	Author   *string `json:"author"`
+	Image    *string `json:"image" binding:"omitempty,max=2048"`
+	Folder   *string `json:"folder" binding:"omitempty,max=255"`
+	IsPaused *bool   `json:"isPaused"`
+}
+
+// ChangePodcastURLRequest represents the change podcast URL request. A
+// missing auth keeps the stored credentials if the feed's host is unchanged.
+type ChangePodcastURLRequest struct {
+	Auth *service.FeedAuth `json:"auth"`
+	URL  string            `json:"url" binding:"required,url"`
+}
+
+// PodcastURLResponse represents a podcast moved to a new feed URL, with how
+// its episodes matched the new feed's entries.
+type PodcastURLResponse struct {
+	Podcast  PodcastResponse `json:"podcast"`
+	Matched  int             `json:"matched"`
+	Added    int             `json:"added"`
+	Unlisted int             `json:"unlisted"`
+}
+
+// AddTagRequest represents the add tag request.
+type AddTagRequest struct {
+	Label       string `json:"label" binding:"required"`
+	Description string `json:"description"`
+}
+
+func podcastRoutes() []apiRoute {
+	const tag = "Podcasts"
+	return []apiRoute{
+		{listPodcasts, openapi.Route{Method: http.MethodGet, Path: "/podcasts", ID: "listPodcasts", Tag: tag,
+			Summary: "List podcasts", Params: ListPodcastsQuery{}, Response: PodcastList{}}},
+		{addPodcast, openapi.Route{Method: http.MethodPost, Path: "/podcasts", ID: "addPodcast", Tag: tag,
+			Summary: "Subscribe to a podcast feed", Body: AddPodcastRequest{}, Response: PodcastResponse{},
+			Status: http.StatusCreated, Errors: []int{http.StatusConflict}}},
+		{addLocalPodcast, openapi.Route{Method: http.MethodPost, Path: "/podcasts/local", ID: "addLocalPodcast", Tag: tag,
+			Summary: "Create a podcast from a folder of audio files", Body: AddLocalPodcastRequest{}, Response: PodcastResponse{},
+			Status: http.StatusCreated, Errors: []int{http.StatusConflict}}},
+		{getPodcast, openapi.Route{Method: http.MethodGet, Path: "/podcasts/:id", ID: "getPodcast", Tag: tag,
+			Summary: "Get a podcast", Params: SearchByIDQuery{}, Response: PodcastResponse{}}},
+		{updatePodcast, openapi.Route{Method: http.MethodPatch, Path: "/podcasts/:id", ID: "updatePodcast", Tag: tag,
+			Summary: "Pause a podcast or change its details and folder", Params: SearchByIDQuery{}, Body: UpdatePodcastRequest{}, Response: PodcastResponse{}}},
+		{refreshPodcastMetadata, openapi.Route{Method: http.MethodPost, Path: "/podcasts/:id/metadata/refresh", ID: "refreshPodcastMetadata", Tag: tag,
+			Summary: "Refresh a podcast's details from its feed", Params: SearchByIDQuery{}, Response: PodcastResponse{}}},
+		{ChangePodcastURL, openapi.Route{Method: http.MethodPut, Path: "/podcasts/:id/url", ID: "changePodcastURL", Tag: tag,
+			Summary: "Move a podcast to a new feed URL, keeping its episodes", Params: SearchByIDQuery{}, Body: ChangePodcastURLRequest{}, Response: PodcastURLResponse{}}},
+		{deletePodcast, openapi.Route{Method: http.MethodDelete, Path: "/podcasts/:id", ID: "deletePodcast", Tag: tag,
+			Summary: "Unsubscribe from a podcast", Params: DeletePodcastQuery{}, Status: http.StatusNoContent}},
+		{listPodcastEpisodes, openapi.Route{Method: http.MethodGet, Path: "/podcasts/:id/episodes", ID: "listPodcastEpisodes", Tag: tag,
+			Summary: "List the episodes of a podcast, newest first", Params: ListEpisodesByPodcastQuery{}, Response: EpisodeList{}}},
+		{downloadPodcastEpisodes, openapi.Route{Method: http.MethodPost, Path: "/podcasts/:id/download", ID: "downloadPodcastEpisodes", Tag: tag,
+			Summary: "Queue every episode of a podcast for download", Params: SearchByIDQuery{}, Status: http.StatusAccepted}},
+		{uploadPodcastFiles, openapi.Route{Method: http.MethodPost, Path: "/podcasts/:id/files", ID: "uploadPodcastFiles", Tag: tag,
+			Summary: "Upload audio files to a local podcast", Params: SearchByIDQuery{}, Upload: "files", Response: PodcastResponse{},
+			Errors: []int{http.StatusConflict}}},
+		{deletePodcastFiles, openapi.Route{Method: http.MethodDelete, Path: "/podcasts/:id/files", ID: "deletePodcastFiles", Tag: tag,
+			Summary: "Delete the downloaded episodes of a podcast", Params: SearchByIDQuery{}, Status: http.StatusNoContent}},
+		{getPodcastCredentials, openapi.Route{Method: http.MethodGet, Path: "/podcasts/:id/credentials", ID: "getPodcastCredentials", Tag: tag,
+			Summary: "Get the masked credentials of a podcast", Params: SearchByIDQuery{}, Response: FeedAuthData{}}},
+		{updatePodcastCredentials, openapi.Route{Method: http.MethodPut, Path: "/podcasts/:id/credentials", ID: "updatePodcastCredentials", Tag: tag,
+			Summary: "Replace the credentials of a podcast", Params: SearchByIDQuery{}, Body: FeedAuthData{}, Response: FeedAuthData{}}},
+		{deletePodcastCredentials, openapi.Route{Method: http.MethodDelete, Path: "/podcasts/:id/credentials", ID: "deletePodcastCredentials", Tag: tag,
+			Summary: "Remove the credentials of a podcast", Params: SearchByIDQuery{}, Status: http.StatusNoContent}},
+		{addPodcastTag, openapi.Route{Method: http.MethodPut, Path: "/podcasts/:id/tags/:tagID", ID: "addPodcastTag", Tag: tag,
+			Summary: "Tag a podcast", Params: AddRemoveTagQuery{}, Status: http.StatusNoContent}},
+		{removePodcastTag, openapi.Route{Method: http.MethodDelete, Path: "/podcasts/:id/tags/:tagID", ID: "removePodcastTag", Tag: tag,
+			Summary: "Untag a podcast", Params: AddRemoveTagQuery{}, Status: http.StatusNoContent}},
+	}
+}
+
+func tagRoutes() []apiRoute {
+	const tag = "Tags"
+	return []apiRoute{
+		{listTags, openapi.Route{Method: http.MethodGet, Path: "/tags", ID: "listTags", Tag: tag,
+			Summary: "List tags", Params: PageQuery{}, Response: TagList{}}},
+		{addTag, openapi.Route{Method: http.MethodPost, Path: "/tags", ID: "addTag", Tag: tag,
+			Summary: "Add a tag", Body: AddTagRequest{}, Response: TagResponse{},
+			Status: http.StatusCreated, Errors: []int{http.StatusConflict}}},
+		{getTag, openapi.Route{Method: http.MethodGet, Path: "/tags/:id", ID: "getTag", Tag: tag,
+			Summary: "Get a tag", Params: SearchByIDQuery{}, Response: TagResponse{}}},
+		{deleteTag, openapi.Route{Method: http.MethodDelete, Path: "/tags/:id", ID: "deleteTag", Tag: tag,
+			Summary: "Delete a tag", Params: SearchByIDQuery{}, Status: http.StatusNoContent}},
+	}
+}
+
+func newPodcastResponse(podcast *db.Podcast) PodcastResponse {
+	response := PodcastResponse{
+		ID:              podcast.ID,
+		CreatedAt:       podcast.CreatedAt,
+		Title:           podcast.Title,
+		Summary:         podcast.Summary,
+		Author:          podcast.Author,
+		Image:           podcast.Image,
+		URL:             redact.URL(podcast.URL),
+		LastEpisode:     podcast.LastEpisode,
+		LastFeedSuccess: podcast.LastFeedSuccess,
+		LastFeedError:   redact.String(podcast.LastFeedError),
+		Folder:          podcast.DataFolder(),
+		LocalPath:       podcast.LocalPath,
+		Feed: PodcastDetails{
+			Title:   podcast.FeedTitle,
+			Summary: podcast.FeedSummary,
+			Author:  podcast.FeedAuthor,
+			Image:   podcast.FeedImage,
+		},
+		Overrides: PodcastDetails{
+			Title:   podcast.TitleOverride,
+			Summary: podcast.SummaryOverride,
+			Author:  podcast.AuthorOverride,
+			Image:   podcast.ImageOverride,
+		},
+		FeedFailureCount: podcast.FeedFailureCount,
+		IsPaused:         podcast.IsPaused,
+		IsLocal:          podcast.IsLocal,
+		HasCredentials:   podcast.FeedAuth != "",
+		EpisodeCount:     podcast.AllEpisodesCount,
+		DownloadedCount:  podcast.DownloadedEpisodesCount,
+		QueuedCount:      podcast.DownloadingEpisodesCount,
+		DownloadedSize:   podcast.DownloadedEpisodesSize,
+		QueuedSize:       podcast.DownloadingEpisodesSize,
+		Tags:             make([]TagSummary, 0, len(podcast.Tags)),
+	}
+	for _, tag := range podcast.Tags {
+		response.Tags = append(response.Tags, TagSummary{ID: tag.ID, Label: tag.Label})
+	}
+	return response
+}
+
+func newTagResponse(tag *db.Tag) TagResponse {
+	response := TagResponse{
+		ID:          tag.ID,
+		CreatedAt:   tag.CreatedAt,
+		Label:       tag.Label,
+		Description: tag.Description,
+		PodcastIDs:  make([]string, 0, len(tag.Podcasts)),
+	}
+	for _, podcast := range tag.Podcasts {
+		response.PodcastIDs = append(response.PodcastIDs, podcast.ID)
+	}
+	return response
+}
+
+// podcastSorting returns the order clause of a podcast list sorted by sort,
+// dateadded by default, in order.
+func podcastSorting(sort, order string) string {
+	sorting := "created_at"
+	switch strings.ToLower(sort) {
+	case Name:
+		sorting = "title"
+	case LastEpisode:
+		sorting = "last_episode"
+	}
+	if strings.ToLower(order) == Desc {
+		sorting += " desc"
+	}
+	return sorting
+}
+
+// respondWithPodcast responds with the podcast id and its episode stats.
+func respondWithPodcast(c *gin.Context, status int, id string) {
+	podcast, err := service.GetPodcastWithStats(id)
+	if err != nil {
+		apiError(c, err, "Podcast")
+		return
+	}
+	c.JSON(status, newPodcastResponse(podcast))
+}
+
+// listPodcasts handles the list podcasts request.
+func listPodcasts(c *gin.Context) {
+	var query ListPodcastsQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		bindError(c, err)
+		return
+	}
+	podcasts := *service.GetAllPodcasts(podcastSorting(query.Sort, query.Order))
+	list := PodcastList{Pagination: query.pagination()}
+	page := pageOf(podcasts, &list.Pagination)
+	list.Items = make([]PodcastResponse, 0, len(page))
+	for i := range page {
+		list.Items = append(list.Items, newPodcastResponse(&page[i]))
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+// addPodcast handles the add podcast request.
+func addPodcast(c *gin.Context) {
+	var request AddPodcastRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		bindError(c, err)
+		return
+	}
+	auth := request.Auth
+	if auth == nil {
+		auth = &service.FeedAuth{}
+	}
+	podcast, err := service.AddPodcastWithAuth(c.Request.Context(), request.URL, auth)
+	if err != nil {
+		apiError(c, redactedError(err), "Podcast")
+		return
+	}
+	go func() {
+		if refreshErr := service.RefreshEpisodes(service.BackgroundContext()); refreshErr != nil {
+			logger.Log.Errorw("refreshing episodes", "error", refreshErr)
+		}
+	}()
+	respondWithPodcast(c, http.StatusCreated, podcast.ID)
+}
+
+// addLocalPodcast handles the add local podcast request.
+func addLocalPodcast(c *gin.Context) {
+	var request AddLocalPodcastRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		bindError(c, err)
+		return
+	}
+	podcast, err := service.AddLocalPodcast(&service.LocalPodcast{
+		Title:   request.Title,
+		Author:  request.Author,
+		Summary: request.Summary,
+		Path:    request.Path,
+	})
+	if err != nil {
+		apiError(c, err, "Podcast")
+		return
+	}
+	go func() {
+		if scanErr := service.ScanLocalPodcast(service.BackgroundContext(), podcast.ID); scanErr != nil {
+			logger.Log.Errorw("scanning local podcast", "error", scanErr)
+		}
+	}()
+	respondWithPodcast(c, http.StatusCreated, podcast.ID)
+}
+
+// uploadPodcastFiles handles the upload podcast files request.
+func uploadPodcastFiles(c *gin.Context) {
+	var query SearchByIDQuery
+	if err := c.ShouldBindUri(&query); err != nil {
+		bindError(c, err)
+		return
+	}
+	form, err := c.MultipartForm()
+	if err != nil {
+		apiError(c, model.NewInvalidRequestError(err.Error()), "")
+		return
+	}
+	files := form.File["files"]
+	if len(files) == 0 {
+		apiError(c, model.NewInvalidRequestError("files is required"), "")
+		return
+	}
+	for _, header := range files {
+		file, openErr := header.Open()
+		if openErr != nil {
+			apiError(c, openErr, "Podcast")
+			return
+		}
+		_, saveErr := service.SaveLocalEpisode(query.ID, header.Filename, file)
+		if closeErr := file.Close(); closeErr != nil {
+			logger.Log.Errorw("closing upload", "error", closeErr)
+		}
+		if saveErr != nil {
+			apiError(c, saveErr, "Podcast")
+			return
+		}
+	}
+	if err := service.ScanLocalPodcast(c.Request.Context(), query.ID); err != nil {
+		apiError(c, err, "Podcast")
+		return
+	}
+	respondWithPodcast(c, http.StatusOK, query.ID)
+}
+
+// getPodcast handles the get podcast request.
+func getPodcast(c *gin.Context) {
+	var query SearchByIDQuery
+	if err := c.ShouldBindUri(&query); err != nil {
+		bindError(c, err)
+		return
+	}
+	respondWithPodcast(c, http.StatusOK, query.ID)
+}
+
+// updatePodcast handles the update podcast request.
+func updatePodcast(c *gin.Context) {
+	var query SearchByIDQuery
+	var request UpdatePodcastRequest
+	if err := c.ShouldBindUri(&query); err != nil {
+		bindError(c, err)
+		return
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		bindError(c, err)
+		return
+	}
+	if request.Title != nil || request.Summary != nil || request.Author != nil || request.Image != nil || request.Folder != nil {
+		err := service.UpdatePodcastOverrides(query.ID, &service.PodcastOverrides{
+			Title:   request.Title,
+			Summary: request.Summary,
+			Author:  request.Author,
+			Image:   request.Image,
+			Folder:  request.Folder,
+		})
+		if err != nil {
+			apiError(c, err, "Podcast")
+			return
+		}
+	}
+	if request.IsPaused != nil {
+		if err := service.TogglePodcastPause(query.ID, *request.IsPaused); err != nil {
+			apiError(c, err, "Podcast")
+			return
+		}
+	}
+	respondWithPodcast(c, http.StatusOK, query.ID)
+}
+
+// ChangePodcastURL handles the change podcast URL request. It also serves
+// PUT /podcasts/:id/url outside the versioned API.
+func ChangePodcastURL(c *gin.Context) {
+	var query SearchByIDQuery
+	var request ChangePodcastURLRequest
+	if err := c.ShouldBindUri(&query); err != nil {
+		bindError(c, err)
+		return
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		bindError(c, err)
+		return
+	}
+	var podcast db.Podcast
+	if err := db.GetPodcastByID(query.ID, &podcast); err != nil {
+		apiError(c, err, "Podcast")
+		return
+	}
+	move, err := service.ChangePodcastURL(c.Request.Context(), query.ID, request.URL, request.Auth)
+	if err != nil {
+		apiError(c, redactedError(err), "Podcast")
+		return
+	}
+	go func() {
+		if downloadErr := service.DownloadMissingEpisodes(service.BackgroundContext()); downloadErr != nil {
+			logger.Log.Errorw("downloading queued episodes", "error", downloadErr)
+		}
+	}()
+	moved, err := service.GetPodcastWithStats(query.ID)
+	if err != nil {
+		apiError(c, err, "Podcast")
+		return
+	}
+	c.JSON(http.StatusOK, PodcastURLResponse{
+		Podcast:  newPodcastResponse(moved),
+		Matched:  move.Matched,
+		Added:    move.Added,
+		Unlisted: move.Unlisted,
+	})
+}
+
+// refreshPodcastMetadata handles the refresh podcast metadata request.
+func refreshPodcastMetadata(c *gin.Context) {
+	var query SearchByIDQuery
+	if err := c.ShouldBindUri(&query); err != nil {
+		bindError(c, err)
+		return
+	}
+	var podcast db.Podcast
+	if err := db.GetPodcastByID(query.ID, &podcast); err != nil {
+		apiError(c, err, "Podcast")
+		return
+	}
+	if err := service.RefreshPodcastMetadata(c.Request.Context(), query.ID); err != nil {
+		apiError(c, redactedError(err), "Podcast")
+		return
+	}
+	respondWithPodcast(c, http.StatusOK, query.ID)
+}
+
+// deletePodcast handles the delete podcast request.
+func deletePodcast(c *gin.Context) {
+	var query DeletePodcastQuery
+	if err := c.ShouldBindUri(&query); err != nil {
+		bindError(c, err)
+		return
+	}
+	if err := c.ShouldBindQuery(&query); err != nil {
+		bindError(c, err)
+		return
+	}
+	if err := service.DeletePodcast(query.ID, !query.KeepFiles); err != nil {
+		apiError(c, err, "Podcast")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// listPodcastEpisodes handles the list podcast episodes request.
+func listPodcastEpisodes(c *gin.Context) {
+	var query ListEpisodesByPodcastQuery
+	if err := c.ShouldBindUri(&query); err != nil {
+		bindError(c, err)
+		return
+	}
+	if err := c.ShouldBindQuery(&query); err != nil {
+		bindError(c, err)
+		return
+	}
+	var podcast db.Podcast
+	if err := db.GetPodcastByID(query.ID, &podcast); err != nil {
+		apiError(c, err, "Podcast")
+		return
+	}
+	filter := model.EpisodesFilter{PodcastIDs: []string{query.ID}, Pagination: query.pagination()}
+	respondWithEpisodes(c, &filter)
+}
+
+// downloadPodcastEpisodes handles the download podcast episodes request.
+func downloadPodcastEpisodes(c *gin.Context) {
+	var query SearchByIDQuery
+	if err := c.ShouldBindUri(&query); err != nil {
+		bindError(c, err)
+		return
+	}
+	if err := service.SetAllEpisodesToDownload(c.Request.Context(), query.ID); err != nil {
+		apiError(c, err, "Podcast")
+		return
+	}
+	go func() {
+		if refreshErr := service.RefreshEpisodes(service.BackgroundContext()); refreshErr != nil {
+			logger.Log.Errorw("refreshing episodes", "error", refreshErr)
+		}
+	}()
+	c.Status(http.StatusAccepted)
+}
+
+// deletePodcastFiles handles the delete podcast files request.
+func deletePodcastFiles(c *gin.Context) {
+	var query SearchByIDQuery
+	if err := c.ShouldBindUri(&query); err != nil {
+		bindError(c, err)
+		return
+	}
+	if err := service.DeletePodcastEpisodes(query.ID); err != nil {
+		apiError(c, err, "Podcast")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// getPodcastCredentials handles the get podcast credentials request.
+func getPodcastCredentials(c *gin.Context) {
+	var query SearchByIDQuery
+	if err := c.ShouldBindUri(&query); err != nil {
+		bindError(c, err)
+		return
+	}
+	auth, err := service.GetFeedAuth(query.ID)
+	if err != nil {
+		apiError(c, err, "Podcast")
+		return
+	}
+	c.JSON(http.StatusOK, maskFeedAuth(&auth))
+}
+
+// updatePodcastCredentials handles the update podcast credentials request.
+func updatePodcastCredentials(c *gin.Context) {
+	var query SearchByIDQuery
+	var data FeedAuthData
+	if err := c.ShouldBindUri(&query); err != nil {
+		bindError(c, err)
+		return
+	}
+	if err := c.ShouldBindJSON(&data); err != nil {
+		bindError(c, err)
+		return
+	}
+	stored, err := service.GetFeedAuth(query.ID)
+	if err != nil {
+		apiError(c, err, "Podcast")
+		return
+	}
+	auth := data.apply(&stored)
+	if err := service.UpdateFeedAuth(query.ID, auth); err != nil {
+		apiError(c, err, "Podcast")
+		return
+	}
+	c.JSON(http.StatusOK, maskFeedAuth(auth))
+}
+
+// deletePodcastCredentials handles the delete podcast credentials request.
+func deletePodcastCredentials(c *gin.Context) {
+	var query SearchByIDQuery
+	if err := c.ShouldBindUri(&query); err != nil {
+		bindError(c, err)
+		return
+	}
+	if err := service.UpdateFeedAuth(query.ID, &service.FeedAuth{}); err != nil {
+		apiError(c, err, "Podcast")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// addPodcastTag handles the add podcast tag request.
+func addPodcastTag(c *gin.Context) {
+	var query AddRemoveTagQuery
+	if err := c.ShouldBindUri(&query); err != nil {
+		bindError(c, err)
+		return
+	}
+	var podcast db.Podcast
+	if err := db.GetPodcastByID(query.ID, &podcast); err != nil {
+		apiError(c, err, "Podcast")
+		return
+	}
+	if _, err := db.GetTagByID(query.TagID); err != nil {
+		apiError(c, err, "Tag")
+		return
+	}
+	if err := db.AddTagToPodcast(query.ID, query.TagID); err != nil {
+		apiError(c, err, "Podcast")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// removePodcastTag handles the remove podcast tag request.
+func removePodcastTag(c *gin.Context) {
+	var query AddRemoveTagQuery
+	if err := c.ShouldBindUri(&query); err != nil {
+		bindError(c, err)
+		return
+	}
+	var podcast db.Podcast
+	if err := db.GetPodcastByID(query.ID, &podcast); err != nil {
+		apiError(c, err, "Podcast")
+		return
+	}
+	if err := db.RemoveTagFromPodcast(query.ID, query.TagID); err != nil {
+		apiError(c, err, "Podcast")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// listTags handles the list tags request.
+func listTags(c *gin.Context) {
+	var query PageQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		bindError(c, err)
+		return
+	}
+	tags, err := db.GetAllTags("")
+	if err != nil {
+		apiError(c, err, "Tag")
+		return
+	}
+	list := TagList{Pagination: query.pagination()}
+	page := pageOf(*tags, &list.Pagination)
+	list.Items = make([]TagResponse, 0, len(page))
+	for i := range page {
+		list.Items = append(list.Items, newTagResponse(&page[i]))
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+// addTag handles the add tag request.
+func addTag(c *gin.Context) {
+	var request AddTagRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		bindError(c, err)
+		return
+	}
+	tag, err := service.AddTag(request.Label, request.Description)
+	if err != nil {
+		apiError(c, err, "Tag")
+		return
+	}
+	c.JSON(http.StatusCreated, newTagResponse(&tag))
+}
+
+// getTag handles the get tag request.
+func getTag(c *gin.Context) {
+	var query SearchByIDQuery
+	if err := c.ShouldBindUri(&query); err != nil {
+		bindError(c, err)
+		return
+	}
+	tag, err := db.GetTagByID(query.ID)
+	if err != nil {
+		apiError(c, err, "Tag")
+		return
+	}
+	c.JSON(http.StatusOK, newTagResponse(tag))
+}
+
+// deleteTag handles the delete tag request.
+func deleteTag(c *gin.Context) {
+	var query SearchByIDQuery
+	if err := c.ShouldBindUri(&query); err != nil {
+		bindError(c, err)
+		return
+	}
+	if _, err := db.GetTagByID(query.ID); err != nil {
+		apiError(c, err, "Tag")
+		return
+	}
+	if err := service.DeleteTag(query.ID); err != nil {
+		apiError(c, err, "Tag")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,605 @@
+package controllers
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/akhilrex/podgrab/db"
+	"github.com/akhilrex/podgrab/internal/config"
+	"github.com/akhilrex/podgrab/internal/openapi"
+	"github.com/akhilrex/podgrab/model"
+	"github.com/akhilrex/podgrab/service"
+	"github.com/gin-gonic/gin"
+)
+
+// NotificationTargetResponse represents a notification target in the
+// versioned API. Secrets are masked.
+type NotificationTargetResponse struct {
+	CreatedAt        time.Time `json:"createdAt"`
+	ID               string    `json:"id"`
+	Name             string    `json:"name"`
+	Kind             string    `json:"kind"`
+	URL              string    `json:"url"`
+	Token            string    `json:"token"`
+	Username         string    `json:"username"`
+	Password         string    `json:"password"`
+	From             string    `json:"from"`
+	To               string    `json:"to"`
+	Events           []string  `json:"events"`
+	PodcastIDs       []string  `json:"podcastIds"`
+	TagIDs           []string  `json:"tagIds"`
+	FailureThreshold int       `json:"failureThreshold"`
+	Enabled          bool      `json:"enabled"`
+}
+
+// NotificationTargetList represents a page of notification targets.
+type NotificationTargetList struct {
+	Items      []NotificationTargetResponse `json:"items"`
+	Pagination model.Pagination             `json:"pagination"`
+}
+
+// NotificationDeliveryResponse represents an attempt to send a notification
+// in the versioned API.
+type NotificationDeliveryResponse struct {
+	CreatedAt     time.Time  `json:"createdAt"`
+	NextAttemptAt time.Time  `json:"nextAttemptAt"`
+	DeliveredAt   *time.Time `json:"deliveredAt"`
+	ID            string     `json:"id"`
+	TargetID      string     `json:"targetId"`
+	TargetName    string     `json:"targetName"`
+	Event         string     `json:"event"`
+	Title         string     `json:"title"`
+	Message       string     `json:"message"`
+	// Status is pending, delivered or failed.
+	Status    string `json:"status"`
+	LastError string `json:"lastError"`
+	Attempts  int    `json:"attempts"`
+}
+
+// NotificationDeliveryList represents a page of notification deliveries.
+type NotificationDeliveryList struct {
+	Items      []NotificationDeliveryResponse `json:"items"`
+	Pagination model.Pagination               `json:"pagination"`
+}
+
+// JobRunResponse represents a run of a scheduled job.
+type JobRunResponse struct {
+	StartedAt  time.Time  `json:"startedAt"`
+	FinishedAt *time.Time `json:"finishedAt"`
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Trigger    string     `json:"trigger"`
+	// Status is running, succeeded, failed, skipped or interrupted.
+	Status     string `json:"status"`
+	Error      string `json:"error"`
+	DurationMs int64  `json:"durationMs"`
+}
+
+// JobRunList represents a page of job runs.
+type JobRunList struct {
+	Items      []JobRunResponse `json:"items"`
+	Pagination model.Pagination `json:"pagination"`
+}
+
+// JobResponse represents a scheduled job in the versioned API.
+type JobResponse struct {
+	NextRun         *time.Time      `json:"nextRun"`
+	LastRun         *JobRunResponse `json:"lastRun"`
+	Name            string          `json:"name"`
+	Description     string          `json:"description"`
+	Schedule        string          `json:"schedule"`
+	DefaultSchedule string          `json:"defaultSchedule"`
+	Enabled         bool            `json:"enabled"`
+	Running         bool            `json:"running"`
+}
+
+// JobList represents a page of scheduled jobs.
+type JobList struct {
+	Items      []JobResponse    `json:"items"`
+	Pagination model.Pagination `json:"pagination"`
+}
+
+// EffectiveSettingsResponse lists the deployment configuration and the
+// database settings with the source of every value.
+type EffectiveSettingsResponse struct {
+	ConfigFile string         `json:"configFile"`
+	Config     []config.Value `json:"config"`
+	Settings   []config.Value `json:"settings"`
+}
+
+// JobNameQuery represents a job name URI parameter.
+type JobNameQuery struct {
+	Name string `uri:"name" binding:"required"`
+}
+
+// JobScheduleData represents job schedule data.
+type JobScheduleData struct {
+	Enabled  *bool  `json:"enabled" form:"enabled"`
+	Schedule string `json:"schedule" form:"schedule"`
+}
+
+// ListJobRunsQuery represents the list job runs query.
+type ListJobRunsQuery struct {
+	Name string `uri:"name" binding:"required"`
+	PageQuery
+}
+
+func settingRoutes() []apiRoute {
+	const tag = "Settings"
+	return []apiRoute{
+		{getSettings, openapi.Route{Method: http.MethodGet, Path: "/settings", ID: "getSettings", Tag: tag,
+			Summary: "Get the settings", Response: SettingModel{}}},
+		{updateSettings, openapi.Route{Method: http.MethodPut, Path: "/settings", ID: "updateSettings", Tag: tag,
+			Summary: "Replace the settings", Body: SettingModel{}, Response: SettingModel{}}},
+		{getEffectiveSettings, openapi.Route{Method: http.MethodGet, Path: "/settings/effective", ID: "getEffectiveSettings", Tag: tag,
+			Summary: "List the configuration and settings in effect with their sources", Response: EffectiveSettingsResponse{}}},
+		{getDownloadLimits, openapi.Route{Method: http.MethodGet, Path: "/settings/downloads", ID: "getDownloadLimits", Tag: tag,
+			Summary: "Get the download window and bandwidth limits", Response: service.DownloadLimits{}}},
+		{updateDownloadLimits, openapi.Route{Method: http.MethodPut, Path: "/settings/downloads", ID: "updateDownloadLimits", Tag: tag,
+			Summary: "Replace the download window and bandwidth limits", Body: service.DownloadLimits{}, Response: service.DownloadLimits{}}},
+		{getTranscodeOptions, openapi.Route{Method: http.MethodGet, Path: "/settings/transcoding", ID: "getTranscodeOptions", Tag: tag,
+			Summary: "Get the formats and bitrates episodes can be streamed in", Response: service.TranscodeOptions{}}},
+	}
+}
+
+func notificationRoutes() []apiRoute {
+	const tag = "Notifications"
+	return []apiRoute{
+		{listNotificationTargets, openapi.Route{Method: http.MethodGet, Path: "/notifications/targets", ID: "listNotificationTargets", Tag: tag,
+			Summary: "List notification targets", Params: PageQuery{}, Response: NotificationTargetList{}}},
+		{addNotificationTarget, openapi.Route{Method: http.MethodPost, Path: "/notifications/targets", ID: "addNotificationTarget", Tag: tag,
+			Summary: "Add a notification target", Body: NotificationTargetData{}, Response: NotificationTargetResponse{}, Status: http.StatusCreated}},
+		{getNotificationTarget, openapi.Route{Method: http.MethodGet, Path: "/notifications/targets/:id", ID: "getNotificationTarget", Tag: tag,
+			Summary: "Get a notification target", Params: SearchByIDQuery{}, Response: NotificationTargetResponse{}}},
+		{updateNotificationTarget, openapi.Route{Method: http.MethodPut, Path: "/notifications/targets/:id", ID: "updateNotificationTarget", Tag: tag,
+			Summary: "Replace a notification target", Params: SearchByIDQuery{}, Body: NotificationTargetData{}, Response: NotificationTargetResponse{}}},
+		{deleteNotificationTarget, openapi.Route{Method: http.MethodDelete, Path: "/notifications/targets/:id", ID: "deleteNotificationTarget", Tag: tag,
+			Summary: "Delete a notification target and its deliveries", Params: SearchByIDQuery{}, Status: http.StatusNoContent}},
+		{testNotificationTarget, openapi.Route{Method: http.MethodPost, Path: "/notifications/targets/:id/test", ID: "testNotificationTarget", Tag: tag,
+			Summary: "Send a test notification to a target", Params: SearchByIDQuery{}, Response: NotificationDeliveryResponse{}}},
+		{listNotificationDeliveries, openapi.Route{Method: http.MethodGet, Path: "/notifications/deliveries", ID: "listNotificationDeliveries", Tag: tag,
+			Summary: "List notification deliveries, newest first", Params: PageQuery{}, Response: NotificationDeliveryList{}}},
+	}
+}
+
+func jobRoutes() []apiRoute {
+	const tag = "Jobs"
+	return []apiRoute{
+		{listJobs, openapi.Route{Method: http.MethodGet, Path: "/jobs", ID: "listJobs", Tag: tag,
+			Summary: "List scheduled jobs", Params: PageQuery{}, Response: JobList{}}},
+		{getJob, openapi.Route{Method: http.MethodGet, Path: "/jobs/:name", ID: "getJob", Tag: tag,
+			Summary: "Get a scheduled job", Params: JobNameQuery{}, Response: JobResponse{}}},
+		{updateJob, openapi.Route{Method: http.MethodPut, Path: "/jobs/:name", ID: "updateJob", Tag: tag,
+			Summary: "Change the schedule of a job", Params: JobNameQuery{}, Body: JobScheduleData{}, Response: JobResponse{}}},
+		{runJob, openapi.Route{Method: http.MethodPost, Path: "/jobs/:name/runs", ID: "runJob", Tag: tag,
+			Summary: "Run a job now", Params: JobNameQuery{}, Status: http.StatusAccepted,
+			Errors: []int{http.StatusConflict, http.StatusServiceUnavailable}}},
+		{listJobRuns, openapi.Route{Method: http.MethodGet, Path: "/jobs/:name/runs", ID: "listJobRuns", Tag: tag,
+			Summary: "List the runs of a job, newest first", Params: ListJobRunsQuery{}, Response: JobRunList{}}},
+	}
+}
+
+func newSettingModel(setting *db.Setting) SettingModel {
+	return SettingModel{
+		BaseURL:                       setting.BaseURL,
+		UserAgent:                     setting.UserAgent,
+		InitialDownloadCount:          setting.InitialDownloadCount,
+		MaxDownloadConcurrency:        setting.MaxDownloadConcurrency,
+		DownloadOnAdd:                 setting.DownloadOnAdd,
+		AutoDownload:                  setting.AutoDownload,
+		AppendDateToFileName:          setting.AppendDateToFileName,
+		AppendEpisodeNumberToFileName: setting.AppendEpisodeNumberToFileName,
+		DarkMode:                      setting.DarkMode,
+		DownloadEpisodeImages:         setting.DownloadEpisodeImages,
+		GenerateNFOFile:               setting.GenerateNFOFile,
+		DontDownloadDeletedFromDisk:   setting.DontDownloadDeletedFromDisk,
+		DedupSensitivity:              setting.DedupSensitivity,
+		RedownloadChangedEnclosures:   setting.RedownloadChangedEnclosures,
+		WritePlaylistFiles:            setting.WritePlaylistFiles,
+	}
+}
+
+// splitList splits a comma separated list, which is empty for "".
+func splitList(list string) []string {
+	if list == "" {
+		return []string{}
+	}
+	return strings.Split(list, ",")
+}
+
+func newNotificationTargetResponse(target *db.NotificationTarget) NotificationTargetResponse {
+	masked := maskNotificationTarget(*target)
+	return NotificationTargetResponse{
+		ID:               masked.ID,
+		CreatedAt:        masked.CreatedAt,
+		Name:             masked.Name,
+		Kind:             masked.Kind,
+		URL:              masked.URL,
+		Token:            masked.Token,
+		Username:         masked.Username,
+		Password:         masked.Password,
+		From:             masked.From,
+		To:               masked.To,
+		Events:           splitList(masked.Events),
+		PodcastIDs:       splitList(masked.PodcastIDs),
+		TagIDs:           splitList(masked.TagIDs),
+		FailureThreshold: masked.FailureThreshold,
+		Enabled:          masked.Enabled,
+	}
+}
+
+func newNotificationDeliveryResponse(delivery *db.NotificationDelivery) NotificationDeliveryResponse {
+	return NotificationDeliveryResponse{
+		ID:            delivery.ID,
+		CreatedAt:     delivery.CreatedAt,
+		NextAttemptAt: delivery.NextAttemptAt,
+		DeliveredAt:   delivery.DeliveredAt,
+		TargetID:      delivery.NotificationTargetID,
+		TargetName:    delivery.NotificationTarget.Name,
+		Event:         delivery.Event,
+		Title:         delivery.Title,
+		Message:       delivery.Message,
+		Status:        string(delivery.Status),
+		LastError:     delivery.LastError,
+		Attempts:      delivery.Attempts,
+	}
+}
+
+func newJobRunResponse(run *db.JobRun) JobRunResponse {
+	return JobRunResponse{
+		ID:         run.ID,
+		StartedAt:  run.StartedAt,
+		FinishedAt: run.FinishedAt,
+		Name:       run.Name,
+		Trigger:    run.Trigger,
+		Status:     string(run.Status),
+		Error:      run.Error,
+		DurationMs: run.DurationMs,
+	}
+}
+
+func newJobResponse(job *service.JobInfo) JobResponse {
+	response := JobResponse{
+		NextRun:         job.NextRun,
+		Name:            job.Name,
+		Description:     job.Description,
+		Schedule:        job.Schedule,
+		DefaultSchedule: job.DefaultSchedule,
+		Enabled:         job.Enabled,
+		Running:         job.Running,
+	}
+	if job.LastRun != nil {
+		lastRun := newJobRunResponse(job.LastRun)
+		response.LastRun = &lastRun
+	}
+	return response
+}
+
+// getSettings handles the get settings request.
+func getSettings(c *gin.Context) {
+	c.JSON(http.StatusOK, newSettingModel(db.GetOrCreateSetting()))
+}
+
+// getEffectiveSettings handles the get effective settings request. Secrets
+// are masked.
+func getEffectiveSettings(c *gin.Context) {
+	cfg := config.Get()
+	c.JSON(http.StatusOK, EffectiveSettingsResponse{
+		ConfigFile: cfg.File,
+		Config:     cfg.Effective(),
+		Settings:   settingValues(db.GetOrCreateSetting()),
+	})
+}
+
+// settingValues lists the user-editable settings stored in the database.
+func settingValues(setting *db.Setting) []config.Value {
+	value := reflect.ValueOf(setting).Elem()
+	values := make([]config.Value, 0, value.NumField())
+	for i := 0; i < value.NumField(); i++ {
+		fieldType := value.Type().Field(i)
+		if fieldType.Anonymous || !fieldType.IsExported() {
+			continue
+		}
+		name := fieldType.Name
+		values = append(values, config.Value{
+			Key:    strings.ToLower(name[:1]) + name[1:],
+			Value:  value.Field(i).Interface(),
+			Source: config.SourceDatabase,
+		})
+	}
+	return values
+}
+
+// updateSettings handles the update settings request.
+func updateSettings(c *gin.Context) {
+	var request SettingModel
+	if err := c.ShouldBindJSON(&request); err != nil {
+		bindError(c, err)
+		return
+	}
+	if err := request.save(); err != nil {
+		apiError(c, err, "Setting")
+		return
+	}
+	c.JSON(http.StatusOK, newSettingModel(db.GetOrCreateSetting()))
+}
+
+// getDownloadLimits handles the get download limits request.
+func getDownloadLimits(c *gin.Context) {
+	c.JSON(http.StatusOK, service.GetDownloadLimits())
+}
+
+// getTranscodeOptions handles the get transcode options request.
+func getTranscodeOptions(c *gin.Context) {
+	c.JSON(http.StatusOK, service.GetTranscodeOptions())
+}
+
+// updateDownloadLimits handles the update download limits request.
+func updateDownloadLimits(c *gin.Context) {
+	var limits service.DownloadLimits
+	if err := c.ShouldBindJSON(&limits); err != nil {
+		bindError(c, err)
+		return
+	}
+	if err := service.UpdateDownloadLimits(limits); err != nil {
+		apiError(c, err, "Setting")
+		return
+	}
+	c.JSON(http.StatusOK, service.GetDownloadLimits())
+}
+
+// listNotificationTargets handles the list notification targets request.
+func listNotificationTargets(c *gin.Context) {
+	var query PageQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		bindError(c, err)
+		return
+	}
+	targets, err := db.GetAllNotificationTargets()
+	if err != nil {
+		apiError(c, err, "Notification target")
+		return
+	}
+	list := NotificationTargetList{Pagination: query.pagination()}
+	page := pageOf(*targets, &list.Pagination)
+	list.Items = make([]NotificationTargetResponse, 0, len(page))
+	for i := range page {
+		list.Items = append(list.Items, newNotificationTargetResponse(&page[i]))
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+// addNotificationTarget handles the add notification target request.
+func addNotificationTarget(c *gin.Context) {
+	var data NotificationTargetData
+	if err := c.ShouldBindJSON(&data); err != nil {
+		bindError(c, err)
+		return
+	}
+	var target db.NotificationTarget
+	if err := data.apply(&target); err != nil {
+		apiError(c, err, "Notification target")
+		return
+	}
+	if err := service.ValidateNotificationTarget(&target); err != nil {
+		apiError(c, model.NewInvalidRequestError(err.Error()), "")
+		return
+	}
+	if err := db.CreateNotificationTarget(&target); err != nil {
+		apiError(c, err, "Notification target")
+		return
+	}
+	c.JSON(http.StatusCreated, newNotificationTargetResponse(&target))
+}
+
+// getNotificationTarget handles the get notification target request.
+func getNotificationTarget(c *gin.Context) {
+	var query SearchByIDQuery
+	if err := c.ShouldBindUri(&query); err != nil {
+		bindError(c, err)
+		return
+	}
+	var target db.NotificationTarget
+	if err := db.GetNotificationTargetByID(query.ID, &target); err != nil {
+		apiError(c, err, "Notification target")
+		return
+	}
+	c.JSON(http.StatusOK, newNotificationTargetResponse(&target))
+}
+
+// updateNotificationTarget handles the update notification target request.
+func updateNotificationTarget(c *gin.Context) {
+	var query SearchByIDQuery
+	var data NotificationTargetData
+	if err := c.ShouldBindUri(&query); err != nil {
+		bindError(c, err)
+		return
+	}
+	if err := c.ShouldBindJSON(&data); err != nil {
+		bindError(c, err)
+		return
+	}
+	var target db.NotificationTarget
+	if err := db.GetNotificationTargetByID(query.ID, &target); err != nil {
+		apiError(c, err, "Notification target")
+		return
+	}
+	if err := data.apply(&target); err != nil {
+		apiError(c, err, "Notification target")
+		return
+	}
+	if err := service.ValidateNotificationTarget(&target); err != nil {
+		apiError(c, model.NewInvalidRequestError(err.Error()), "")
+		return
+	}
+	if err := db.UpdateNotificationTarget(&target); err != nil {
+		apiError(c, err, "Notification target")
+		return
+	}
+	c.JSON(http.StatusOK, newNotificationTargetResponse(&target))
+}
+
+// deleteNotificationTarget handles the delete notification target request.
+func deleteNotificationTarget(c *gin.Context) {
+	var query SearchByIDQuery
+	if err := c.ShouldBindUri(&query); err != nil {
+		bindError(c, err)
+		return
+	}
+	var target db.NotificationTarget
+	if err := db.GetNotificationTargetByID(query.ID, &target); err != nil {
+		apiError(c, err, "Notification target")
+		return
+	}
+	if err := db.DeleteNotificationTargetByID(query.ID); err != nil {
+		apiError(c, err, "Notification target")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// testNotificationTarget handles the test notification target request. The
+// delivery's status tells whether the target accepted the notification.
+func testNotificationTarget(c *gin.Context) {
+	var query SearchByIDQuery
+	if err := c.ShouldBindUri(&query); err != nil {
+		bindError(c, err)
+		return
+	}
+	delivery, err := service.SendTestNotification(query.ID)
+	if err != nil {
+		apiError(c, err, "Notification target")
+		return
+	}
+	c.JSON(http.StatusOK, newNotificationDeliveryResponse(delivery))
+}
+
+// listNotificationDeliveries handles the list notification deliveries request.
+func listNotificationDeliveries(c *gin.Context) {
+	var query PageQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		bindError(c, err)
+		return
+	}
+	list := NotificationDeliveryList{Pagination: query.pagination()}
+	var deliveries []db.NotificationDelivery
+	var total int64
+	if err := db.GetPaginatedNotificationDeliveries(list.Pagination.Page, list.Pagination.Count, &deliveries, &total); err != nil {
+		apiError(c, err, "Notification delivery")
+		return
+	}
+	list.Pagination.SetCounts(total)
+	list.Items = make([]NotificationDeliveryResponse, 0, len(deliveries))
+	for i := range deliveries {
+		list.Items = append(list.Items, newNotificationDeliveryResponse(&deliveries[i]))
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+// findJob returns the scheduled job name.
+func findJob(name string) (*service.JobInfo, error) {
+	jobs := service.GetJobs()
+	for i := range jobs {
+		if jobs[i].Name == name {
+			return &jobs[i], nil
+		}
+	}
+	return nil, service.ErrJobNotFound
+}
+
+// listJobs handles the list jobs request.
+func listJobs(c *gin.Context) {
+	var query PageQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		bindError(c, err)
+		return
+	}
+	list := JobList{Pagination: query.pagination()}
+	page := pageOf(service.GetJobs(), &list.Pagination)
+	list.Items = make([]JobResponse, 0, len(page))
+	for i := range page {
+		list.Items = append(list.Items, newJobResponse(&page[i]))
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+// getJob handles the get job request.
+func getJob(c *gin.Context) {
+	var query JobNameQuery
+	if err := c.ShouldBindUri(&query); err != nil {
+		bindError(c, err)
+		return
+	}
+	job, err := findJob(query.Name)
+	if err != nil {
+		apiError(c, err, "Job")
+		return
+	}
+	c.JSON(http.StatusOK, newJobResponse(job))
+}
+
+// updateJob handles the update job request.
+func updateJob(c *gin.Context) {
+	var query JobNameQuery
+	var data JobScheduleData
+	if err := c.ShouldBindUri(&query); err != nil {
+		bindError(c, err)
+		return
+	}
+	if err := c.ShouldBindJSON(&data); err != nil {
+		bindError(c, err)
+		return
+	}
+	enabled := data.Enabled == nil || *data.Enabled
+	if err := service.UpdateJobSchedule(query.Name, data.Schedule, enabled); err != nil {
+		apiError(c, err, "Job")
+		return
+	}
+	job, err := findJob(query.Name)
+	if err != nil {
+		apiError(c, err, "Job")
+		return
+	}
+	c.JSON(http.StatusOK, newJobResponse(job))
+}
+
+// runJob handles the run job request.
+func runJob(c *gin.Context) {
+	var query JobNameQuery
+	if err := c.ShouldBindUri(&query); err != nil {
+		bindError(c, err)
+		return
+	}
+	if err := service.RunJob(query.Name); err != nil {
+		apiError(c, err, "Job")
+		return
+	}
+	c.Status(http.StatusAccepted)
+}
+
+// listJobRuns handles the list job runs request.
+func listJobRuns(c *gin.Context) {
+	var query ListJobRunsQuery
+	if err := c.ShouldBindUri(&query); err != nil {
+		bindError(c, err)
+		return
+	}
+	if err := c.ShouldBindQuery(&query); err != nil {
+		bindError(c, err)
+		return
+	}
+	list := JobRunList{Pagination: query.pagination()}
+	runs, total, err := service.GetJobRuns(query.Name, list.Pagination.Page, list.Pagination.Count)
+	if err != nil {
+		apiError(c, err, "Job")
+		return
+	}
+	list.Pagination.SetCounts(total)
+	list.Items = make([]JobRunResponse, 0, len(runs))
+	for i := range runs {
+		list.Items = append(list.Items, newJobRunResponse(&runs[i]))
+	}
+	c.JSON(http.StatusOK, list)
+}
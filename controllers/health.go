@@ -0,0 +1,30 @@
+package controllers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/akhilrex/podgrab/service"
+	"github.com/gin-gonic/gin"
+)
+
+var startedAt = time.Now()
+
+// Healthz handles the liveness probe. It only reports that the process is serving requests.
+func Healthz(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"status":    service.HealthOK,
+		"startedAt": startedAt,
+		"uptime":    time.Since(startedAt).Round(time.Second).String(),
+	})
+}
+
+// Readyz handles the readiness probe. It returns 503 when any dependency check fails.
+func Readyz(c *gin.Context) {
+	report := service.CheckReadiness(c.Request.Context())
+	status := http.StatusOK
+	if !report.Ready() {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, report)
+}
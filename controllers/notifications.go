@@ -0,0 +1,66 @@
+package controllers
+
+import (
+	"strings"
+
+	"github.com/akhilrex/podgrab/db"
+	"github.com/akhilrex/podgrab/service"
+)
+
+// maskedSecret replaces stored secrets in responses. Sending it back on update keeps the stored value.
+const maskedSecret = "********"
+
+// NotificationTargetData represents notification target data.
+type NotificationTargetData struct {
+	Enabled          *bool    `json:"enabled" form:"enabled"`
+	Name             string   `binding:"required" json:"name" form:"name"`
+	Kind             string   `binding:"required" json:"kind" form:"kind"`
+	URL              string   `binding:"required" json:"url" form:"url"`
+	Token            string   `json:"token" form:"token"`
+	Username         string   `json:"username" form:"username"`
+	Password         string   `json:"password" form:"password"`
+	From             string   `json:"from" form:"from"`
+	To               string   `json:"to" form:"to"`
+	Events           []string `json:"events" form:"events"`
+	PodcastIDs       []string `json:"podcastIds" form:"podcastIds"`
+	TagIDs           []string `json:"tagIds" form:"tagIds"`
+	FailureThreshold int      `json:"failureThreshold" form:"failureThreshold"`
+}
+
+// apply copies the request onto target, encrypting new secrets and keeping
+// stored secrets that were sent back masked.
+func (data *NotificationTargetData) apply(target *db.NotificationTarget) error {
+	target.Name = data.Name
+	target.Kind = strings.ToLower(data.Kind)
+	target.URL = data.URL
+	target.Username = data.Username
+	target.From = data.From
+	target.To = data.To
+	target.Events = strings.Join(data.Events, ",")
+	target.PodcastIDs = strings.Join(data.PodcastIDs, ",")
+	target.TagIDs = strings.Join(data.TagIDs, ",")
+	target.FailureThreshold = data.FailureThreshold
+	target.Enabled = data.Enabled == nil || *data.Enabled
+	var err error
+	if data.Token != maskedSecret {
+		if target.Token, err = service.SealNotificationSecret(data.Token); err != nil {
+			return err
+		}
+	}
+	if data.Password != maskedSecret {
+		if target.Password, err = service.SealNotificationSecret(data.Password); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func maskNotificationTarget(target db.NotificationTarget) db.NotificationTarget {
+	if target.Token != "" {
+		target.Token = maskedSecret
+	}
+	if target.Password != "" {
+		target.Password = maskedSecret
+	}
+	return target
+}
@@ -38,6 +38,30 @@ type SettingModel struct {
 	DownloadEpisodeImages         bool   `form:"downloadEpisodeImages" json:"downloadEpisodeImages" query:"downloadEpisodeImages"`
 	GenerateNFOFile               bool   `form:"generateNFOFile" json:"generateNFOFile" query:"generateNFOFile"`
 	DontDownloadDeletedFromDisk   bool   `form:"dontDownloadDeletedFromDisk" json:"dontDownloadDeletedFromDisk" query:"dontDownloadDeletedFromDisk"`
+	DedupSensitivity              string `form:"dedupSensitivity" json:"dedupSensitivity" query:"dedupSensitivity"`
+	RedownloadChangedEnclosures   bool   `form:"redownloadChangedEnclosures" json:"redownloadChangedEnclosures" query:"redownloadChangedEnclosures"`
+	WritePlaylistFiles            bool   `form:"writePlaylistFiles" json:"writePlaylistFiles" query:"writePlaylistFiles"`
+}
+
+// save stores the settings.
+func (settingModel *SettingModel) save() error {
+	return service.UpdateSettings(&service.SettingsUpdate{
+		BaseURL:                       settingModel.BaseURL,
+		UserAgent:                     settingModel.UserAgent,
+		DedupSensitivity:              settingModel.DedupSensitivity,
+		InitialDownloadCount:          settingModel.InitialDownloadCount,
+		MaxDownloadConcurrency:        settingModel.MaxDownloadConcurrency,
+		DownloadOnAdd:                 settingModel.DownloadOnAdd,
+		AutoDownload:                  settingModel.AutoDownload,
+		AppendDateToFileName:          settingModel.AppendDateToFileName,
+		AppendEpisodeNumberToFileName: settingModel.AppendEpisodeNumberToFileName,
+		DarkMode:                      settingModel.DarkMode,
+		DownloadEpisodeImages:         settingModel.DownloadEpisodeImages,
+		GenerateNFOFile:               settingModel.GenerateNFOFile,
+		DontDownloadDeletedFromDisk:   settingModel.DontDownloadDeletedFromDisk,
+		RedownloadChangedEnclosures:   settingModel.RedownloadChangedEnclosures,
+		WritePlaylistFiles:            settingModel.WritePlaylistFiles,
+	})
 }
 
 var searchOptions = map[string]string{
@@ -130,7 +154,7 @@ func PodcastPage(c *gin.Context) {
 	}
 }
 
-func getItemsToPlay(itemIDs []string, podcastID string, tagIDs []string) []db.PodcastItem {
+func getItemsToPlay(itemIDs []string, podcastID string, tagIDs []string, smartPlaylistID string) []db.PodcastItem {
 	var items []db.PodcastItem
 	switch {
 	case len(itemIDs) > 0:
@@ -152,18 +176,35 @@ func getItemsToPlay(itemIDs []string, podcastID string, tagIDs []string) []db.Po
 			}
 		}
 		items = *service.GetAllPodcastItemsByPodcastIDs(podIDs)
+	case smartPlaylistID != "":
+		var playlist db.SmartPlaylist
+		if err := db.GetSmartPlaylistByID(smartPlaylistID, &playlist); err != nil {
+			logger.Log.Errorw("getting smart playlist", "error", err)
+			return []db.PodcastItem{}
+		}
+		toAdd, err := service.GetSmartPlaylistItems(&playlist)
+		if err != nil {
+			logger.Log.Errorw("getting smart playlist episodes", "error", err)
+			return []db.PodcastItem{}
+		}
+		items = toAdd
 	}
 	return items
 }
 
 // PlayerPage handles the player page request.
 func PlayerPage(c *gin.Context) {
-	itemIDs, hasItemIDs := c.GetQueryArray("itemIDs")
-	podcastID, hasPodcastID := c.GetQuery("podcastID")
-	tagIDs, hasTagIDs := c.GetQueryArray("tagIDs")
+	itemIDs, hasItemIDs := c.GetQueryArray("itemIds")
+	podcastID, hasPodcastID := c.GetQuery("podcastId")
+	tagIDs, hasTagIDs := c.GetQueryArray("tagIds")
+	smartPlaylistID, hasSmartPlaylistID := c.GetQuery("smartPlaylistId")
+	playlistID, hasPlaylistID := c.GetQuery("playlistId")
 	title := "Podgrab"
 	var items []db.PodcastItem
 	var totalCount int64
+	// syncPlaylist is set when the player plays the playlist of playlistID,
+	// or the up next queue, and keeps it up to date.
+	syncPlaylist := false
 	switch {
 	case hasItemIDs:
 		toAdd, err := service.GetAllPodcastItemsByIDs(itemIDs)
@@ -195,7 +236,50 @@ func PlayerPage(c *gin.Context) {
 		} else {
 			title = fmt.Sprintf("Playing episodes with tags : %s", strings.Join(tagNames, ", "))
 		}
+	case hasSmartPlaylistID:
+		var playlist db.SmartPlaylist
+		if err := db.GetSmartPlaylistByID(smartPlaylistID, &playlist); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Smart playlist not found"})
+			return
+		}
+		toAdd, err := service.GetSmartPlaylistItems(&playlist)
+		if err != nil {
+			logger.Log.Errorw("getting smart playlist episodes", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load items"})
+			return
+		}
+		items = toAdd
+		title = "Playing: " + playlist.Name
+		totalCount = int64(len(items))
+	case hasPlaylistID:
+		var playlist db.Playlist
+		if err := db.GetPlaylistByID(playlistID, &playlist); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Playlist not found"})
+			return
+		}
+		toAdd, err := db.GetPlaylistEpisodes(playlist.ID)
+		if err != nil {
+			logger.Log.Errorw("getting playlist episodes", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load items"})
+			return
+		}
+		items = toAdd
+		title = "Playing: " + playlist.Name
+		totalCount = int64(len(items))
+		syncPlaylist = true
 	default:
+		queue, err := db.GetPlaylistEpisodes(db.QueuePlaylistID)
+		if err != nil {
+			logger.Log.Errorw("getting queue", "error", err)
+		}
+		if len(queue) > 0 {
+			items = queue
+			title = "Playing Up Next"
+			totalCount = int64(len(items))
+			playlistID = db.QueuePlaylistID
+			syncPlaylist = true
+			break
+		}
 		title = "Playing Latest Episodes"
 		if err := db.GetPaginatedPodcastItems(1, 20, nil, nil, time.Time{}, &items, &totalCount); err != nil {
 			logger.Log.Error(err.Error())
@@ -214,6 +298,8 @@ func PlayerPage(c *gin.Context) {
 		"count":          len(items),
 		"totalCount":     totalCount,
 		"downloadedOnly": true,
+		"playlistId":     playlistID,
+		"syncPlaylist":   syncPlaylist,
 	})
 }
 
@@ -316,6 +402,27 @@ func AllEpisodesPage(c *gin.Context) {
 	c.HTML(http.StatusOK, "episodes_new.html", toReturn)
 }
 
+// PlaylistsPage handles the playlists page request.
+func PlaylistsPage(c *gin.Context) {
+	setting, ok := c.MustGet("setting").(*db.Setting)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve settings"})
+		return
+	}
+	tags, err := db.GetAllTags("")
+	if err != nil {
+		logger.Log.Errorw("getting all tags", "error", err)
+		tags = &[]db.Tag{}
+	}
+	c.HTML(http.StatusOK, "playlists.html", gin.H{
+		"title":       "Playlists",
+		"setting":     setting,
+		"podcasts":    service.GetAllPodcasts(""),
+		"tags":        tags,
+		"sortOptions": getSortOptions(),
+	})
+}
+
 // AllTagsPage handles the all tags page request.
 func AllTagsPage(c *gin.Context) {
 	var pagination model.Pagination
@@ -423,7 +530,7 @@ func UploadOpml(c *gin.Context) {
 		return
 	}
 	content := buf.String()
-	err = service.AddOpml(content)
+	err = service.AddOpml(c.Request.Context(), content)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
 	} else {
@@ -437,10 +544,10 @@ func AddNewPodcast(c *gin.Context) {
 	err := c.ShouldBind(&addPodcastData)
 
 	if err == nil {
-		_, err = service.AddPodcast(addPodcastData.URL)
+		_, err = service.AddPodcast(c.Request.Context(), addPodcastData.URL)
 		if err == nil {
 			go func() {
-				if refreshErr := service.RefreshEpisodes(); refreshErr != nil {
+				if refreshErr := service.RefreshEpisodes(service.BackgroundContext()); refreshErr != nil {
 					logger.Log.Errorw("refreshing episodes", "error", refreshErr)
 				}
 			}()
@@ -1,13 +1,21 @@
 package controllers
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
 	"fmt"
+	"mime"
 	"net/http"
+	neturl "net/url"
 	"os"
 	"path"
-	"strings"
+	"strconv"
+	"time"
 
 	"github.com/akhilrex/podgrab/db"
+	"github.com/akhilrex/podgrab/internal/config"
 	"github.com/akhilrex/podgrab/internal/logger"
 	"github.com/akhilrex/podgrab/model"
 	"github.com/akhilrex/podgrab/service"
@@ -59,7 +67,9 @@ type PatchPodcastItem struct {
 
 // AddPodcastData represents add podcast data data.
 type AddPodcastData struct {
-	URL string `binding:"required" form:"url" json:"url"`
+	// Auth holds the credentials of a private feed.
+	Auth *service.FeedAuth `form:"-" json:"auth"`
+	URL  string            `binding:"required" form:"url" json:"url"`
 }
 
 // AddTagData represents add tag data data.
@@ -73,21 +83,7 @@ func GetAllPodcasts(c *gin.Context) {
 	var podcastListQuery PodcastListQuery
 
 	if c.ShouldBindQuery(&podcastListQuery) == nil {
-		var order = strings.ToLower(podcastListQuery.Order)
-		var sorting = "created_at"
-		switch sort := strings.ToLower(podcastListQuery.Sort); sort {
-		case DateAdded:
-			sorting = "created_at"
-		case Name:
-			sorting = "title"
-		case LastEpisode:
-			sorting = "last_episode"
-		}
-		if order == Desc {
-			sorting = fmt.Sprintf("%s desc", sorting)
-		}
-
-		c.JSON(200, service.GetAllPodcasts(sorting))
+		c.JSON(200, service.GetAllPodcasts(podcastSorting(podcastListQuery.Sort, podcastListQuery.Order)))
 	}
 }
 
@@ -172,6 +168,10 @@ func DeletePodcastEpisodesByID(c *gin.Context) {
 
 	if c.ShouldBindUri(&searchByIDQuery) == nil {
 		if err := service.DeletePodcastEpisodes(searchByIDQuery.ID); err != nil {
+			if errors.Is(err, service.ErrLocalPodcast) {
+				c.JSON(http.StatusConflict, gin.H{"message": err.Error()})
+				return
+			}
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
@@ -187,6 +187,10 @@ func DeletePodcasDeleteOnlyPodcasttEpisodesByID(c *gin.Context) {
 
 	if c.ShouldBindUri(&searchByIDQuery) == nil {
 		if err := service.DeletePodcastEpisodes(searchByIDQuery.ID); err != nil {
+			if errors.Is(err, service.ErrLocalPodcast) {
+				c.JSON(http.StatusConflict, gin.H{"message": err.Error()})
+				return
+			}
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
@@ -216,10 +220,10 @@ func DownloadAllEpisodesByPodcastID(c *gin.Context) {
 	var searchByIDQuery SearchByIDQuery
 
 	if c.ShouldBindUri(&searchByIDQuery) == nil {
-		err := service.SetAllEpisodesToDownload(searchByIDQuery.ID)
+		err := service.SetAllEpisodesToDownload(c.Request.Context(), searchByIDQuery.ID)
 		logger.Log.Error(err)
 		go func() {
-			if refreshErr := service.RefreshEpisodes(); refreshErr != nil {
+			if refreshErr := service.RefreshEpisodes(service.BackgroundContext()); refreshErr != nil {
 				logger.Log.Errorw("refreshing episodes", "error", refreshErr)
 			}
 		}()
@@ -292,8 +296,16 @@ func GetPodcastImageByID(c *gin.Context) {
 		var podcast db.Podcast
 
 		err := db.GetPodcastByID(searchByIDQuery.ID, &podcast)
+		if err == nil && podcast.IsLocal && podcast.ImageOverride == "" {
+			if artwork := service.LocalPodcastArtwork(&podcast); artwork != "" {
+				c.File(artwork)
+			} else {
+				c.Redirect(302, "/webassets/blank.png")
+			}
+			return
+		}
 		if err == nil {
-			localPath := service.GetPodcastLocalImagePath(podcast.Image, podcast.Title)
+			localPath := service.GetPodcastLocalImagePath(podcast.Image, podcast.DataFolder())
 			if _, err = os.Stat(localPath); os.IsNotExist(err) {
 				c.Redirect(302, podcast.Image)
 			} else {
@@ -436,7 +448,7 @@ func DownloadPodcastItem(c *gin.Context) {
 
 	if c.ShouldBindUri(&searchByIDQuery) == nil {
 		go func() {
-			if downloadErr := service.DownloadSingleEpisode(searchByIDQuery.ID); downloadErr != nil {
+			if downloadErr := service.DownloadSingleEpisode(service.BackgroundContext(), searchByIDQuery.ID); downloadErr != nil {
 				logger.Log.Errorw("downloading episode", "error", downloadErr)
 			}
 		}()
@@ -467,10 +479,14 @@ func AddPodcast(c *gin.Context) {
 	var addPodcastData AddPodcastData
 	err := c.ShouldBindJSON(&addPodcastData)
 	if err == nil {
-		pod, addErr := service.AddPodcast(addPodcastData.URL)
+		auth := addPodcastData.Auth
+		if auth == nil {
+			auth = &service.FeedAuth{}
+		}
+		pod, addErr := service.AddPodcastWithAuth(c.Request.Context(), addPodcastData.URL, auth)
 		if addErr == nil {
 			go func() {
-				if refreshErr := service.RefreshEpisodes(); refreshErr != nil {
+				if refreshErr := service.RefreshEpisodes(service.BackgroundContext()); refreshErr != nil {
 					logger.Log.Errorw("refreshing episodes", "error", refreshErr)
 				}
 			}()
@@ -524,119 +540,378 @@ func getBaseURL(c *gin.Context) string {
 	return setting.BaseURL
 }
 
-func createRss(items []db.PodcastItem, title, description, image string, c *gin.Context) model.RssPodcastData {
-	rssItems := make([]model.RssItem, 0, len(items))
-	url := getBaseURL(c)
-	for i := range items {
-		rssItem := model.RssItem{
-			Title:       items[i].Title,
-			Description: items[i].Summary,
-			Summary:     items[i].Summary,
-			Image: model.RssItemImage{
-				Text: items[i].Title,
-				Href: fmt.Sprintf("%s/podcastitems/%s/image", url, items[i].ID),
-			},
-			EpisodeType: items[i].EpisodeType,
-			Enclosure: model.RssItemEnclosure{
-				URL:    fmt.Sprintf("%s/podcastitems/%s/file", url, items[i].ID),
-				Length: fmt.Sprint(items[i].FileSize),
-				Type:   "audio/mpeg",
-			},
-			PubDate: items[i].PubDate.Format("Mon, 02 Jan 2006 15:04:05 -0700"),
-			GUID: model.RssItemGUID{
-				IsPermaLink: "false",
-				Text:        items[i].ID,
-			},
-			Link:     fmt.Sprintf("%s/allTags", url),
-			Text:     items[i].Title,
-			Duration: fmt.Sprint(items[i].Duration),
-		}
-		rssItems = append(rssItems, rssItem)
-	}
-
-	imagePath := fmt.Sprintf("%s/webassets/blank.png", url)
-	if image != "" {
-		imagePath = image
-	}
-
-	return model.RssPodcastData{
-		Itunes:  "http://www.itunes.com/dtds/podcast-1.0.dtd",
-		Media:   "http://search.yahoo.com/mrss/",
-		Version: "2.0",
-		Atom:    "http://www.w3.org/2005/Atom",
-		Psc:     "https://podlove.org/simple-chapters/",
-		Content: "http://purl.org/rss/1.0/modules/content/",
-		Channel: model.RssChannel{
-			Item:        rssItems,
-			Title:       title,
-			Description: description,
-			Summary:     description,
-			Author:      "Podgrab Aggregation",
-			Link:        fmt.Sprintf("%s/allTags", url),
-			Image:       model.RssItemImage{Text: title, URL: imagePath},
-		},
-	}
+// FeedQuery represents the page of a generated RSS feed. Count defaults to
+// the configured feed page size.
+type FeedQuery struct {
+	Page  int `form:"page" binding:"omitempty,min=1"`
+	Count int `form:"count" binding:"omitempty,min=1"`
 }
 
 // GetRssForPodcastByID handles the get rss for podcast by id request.
 func GetRssForPodcastByID(c *gin.Context) {
 	var searchByIDQuery SearchByIDQuery
-	if c.ShouldBindUri(&searchByIDQuery) == nil {
-		var podcast db.Podcast
-		err := db.GetPodcastByID(searchByIDQuery.ID, &podcast)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
-		}
-		podIDs := make([]string, 0, 1)
-		podIDs = append(podIDs, searchByIDQuery.ID)
-		items := *service.GetAllPodcastItemsByPodcastIDs(podIDs)
-
-		description := podcast.Summary
-		title := podcast.Title
-
-		if err == nil {
-			c.XML(200, createRss(items, title, description, podcast.Image, c))
-		}
-	} else {
+	if c.ShouldBindUri(&searchByIDQuery) != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	var podcast db.Podcast
+	if err := db.GetPodcastByID(searchByIDQuery.ID, &podcast); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Podcast not found"})
+		return
 	}
+	url := getBaseURL(c)
+	feed := service.RssFeed{
+		LastBuildDate: podcast.UpdatedAt,
+		Title:         podcast.Title,
+		Description:   podcast.Summary,
+		Link:          fmt.Sprintf("%s/podcasts/%s/view", url, podcast.ID),
+		Image:         fmt.Sprintf("%s/podcasts/%s/image", url, podcast.ID),
+		Author:        podcast.Author,
+	}
+	writeFilteredRss(c, &feed, func(filter *model.EpisodesFilter) {
+		filter.PodcastIDs = []string{podcast.ID}
+	})
 }
 
 // GetRssForTagByID handles the get rss for tag by id request.
 func GetRssForTagByID(c *gin.Context) {
 	var searchByIDQuery SearchByIDQuery
-	if c.ShouldBindUri(&searchByIDQuery) == nil {
-		tag, err := db.GetTagByID(searchByIDQuery.ID)
-		podIDs := make([]string, 0, len(tag.Podcasts))
-		for i := range tag.Podcasts {
-			podIDs = append(podIDs, tag.Podcasts[i].ID)
-		}
-		items := *service.GetAllPodcastItemsByPodcastIDs(podIDs)
-
-		description := fmt.Sprintf("Playing episodes with tag : %s", tag.Label)
-		title := fmt.Sprintf(" %s | Podgrab", tag.Label)
+	if c.ShouldBindUri(&searchByIDQuery) != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	tag, err := db.GetTagByID(searchByIDQuery.ID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Tag not found"})
+		return
+	}
+	feed := service.RssFeed{
+		LastBuildDate: tag.UpdatedAt,
+		Title:         fmt.Sprintf("%s | Podgrab", tag.Label),
+		Description:   fmt.Sprintf("Playing episodes with tag : %s", tag.Label),
+		Link:          fmt.Sprintf("%s/allTags", getBaseURL(c)),
+		Author:        "Podgrab Aggregation",
+	}
+	writeFilteredRss(c, &feed, func(filter *model.EpisodesFilter) {
+		filter.TagIDs = []string{tag.ID}
+	})
+}
 
-		if err == nil {
-			c.XML(200, createRss(items, title, description, "", c))
-		}
-	} else {
+// GetRssForSmartPlaylistByID handles the get rss for smart playlist by id request.
+func GetRssForSmartPlaylistByID(c *gin.Context) {
+	var feedQuery FeedQuery
+	if c.ShouldBindQuery(&feedQuery) != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	playlist, items, ok := getSmartPlaylistItems(c)
+	if !ok {
+		return
+	}
+	feed := service.RssFeed{
+		LastBuildDate: playlist.UpdatedAt,
+		Title:         fmt.Sprintf("%s | Podgrab", playlist.Name),
+		Description:   fmt.Sprintf("Playing episodes of smart playlist : %s", playlist.Name),
+		Link:          fmt.Sprintf("%s/playlists", getBaseURL(c)),
+		Author:        "Podgrab Aggregation",
+	}
+	page, size := feedQuery.page()
+	hasNext := false
+	if size > 0 {
+		start := min((page-1)*size, len(items))
+		end := min(start+size, len(items))
+		hasNext = end < len(items)
+		items = items[start:end]
 	}
+	writeRss(c, &feed, items, page, hasNext)
 }
 
 // GetRss handles the get rss request.
 func GetRss(c *gin.Context) {
-	var items []db.PodcastItem
+	url := getBaseURL(c)
+	feed := service.RssFeed{
+		Title:       "Podgrab",
+		Description: "Podgrab playlist",
+		Link:        url + "/",
+		Author:      "Podgrab Aggregation",
+	}
+	writeFilteredRss(c, &feed, func(*model.EpisodesFilter) {})
+}
 
-	if err := db.GetAllPodcastItems(&items); err != nil {
-		logger.Log.Error(err.Error())
+// page returns the requested page and the number of episodes on it, zero for
+// all of them.
+func (query FeedQuery) page() (page, size int) {
+	page = max(query.Page, 1)
+	size = query.Count
+	if size == 0 {
+		size = config.Get().FeedPageSize
+	}
+	return page, size
+}
+
+// writeFilteredRss responds with the page of feed holding the episodes the
+// EpisodesFilter in the query selects, narrowed by scope.
+func writeFilteredRss(c *gin.Context, feed *service.RssFeed, scope func(filter *model.EpisodesFilter)) {
+	var feedQuery FeedQuery
+	var filter model.EpisodesFilter
+	if c.ShouldBindQuery(&feedQuery) != nil || c.ShouldBindQuery(&filter) != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	if filter.Sorting == "" {
+		filter.Sorting = model.ReleaseDesc
+	}
+	scope(&filter)
+	page, size := feedQuery.page()
+	offset, limit := 0, 0
+	if size > 0 {
+		// One more episode than fits tells whether there is a next page.
+		offset, limit = (page-1)*size, size+1
+	}
+	items, err := db.GetFilteredPodcastItems(&filter, offset, limit)
+	if err != nil {
+		logger.Log.Errorw("getting feed episodes", "feed", feed.Title, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load episodes"})
+		return
+	}
+	hasNext := size > 0 && len(*items) > size
+	if hasNext {
+		*items = (*items)[:size]
+	}
+	writeRss(c, feed, *items, page, hasNext)
+}
+
+// writeRss responds with feed holding items, the page of a paged feed. The
+// response carries an ETag, so that podcast apps polling the feed get 304 Not
+// Modified while it does not change. It has no Last-Modified: removing an
+// episode changes the feed without making it any newer.
+func writeRss(c *gin.Context, feed *service.RssFeed, items []db.PodcastItem, page int, hasNext bool) {
+	url := getBaseURL(c)
+	if feed.Image == "" {
+		feed.Image = fmt.Sprintf("%s/webassets/blank.png", url)
+	}
+	feed.Items = make([]service.RssFeedItem, 0, len(items))
+	for i := range items {
+		location := items[i].FileURL
+		if items[i].DownloadStatus == db.Downloaded {
+			location = items[i].DownloadPath
+		}
+		feed.Items = append(feed.Items, service.RssFeedItem{
+			PubDate:       items[i].PubDate,
+			GUID:          items[i].ID,
+			Title:         items[i].Title,
+			Description:   items[i].Summary,
+			Link:          fmt.Sprintf("%s/podcasts/%s/view", url, items[i].PodcastID),
+			Image:         fmt.Sprintf("%s/podcastitems/%s/image", url, items[i].ID),
+			EnclosureURL:  fmt.Sprintf("%s/podcastitems/%s/file", url, items[i].ID),
+			EnclosureType: service.EnclosureType(location),
+			EpisodeType:   items[i].EpisodeType,
+			Length:        items[i].FileSize,
+			Duration:      items[i].Duration,
+		})
+		if items[i].UpdatedAt.After(feed.LastBuildDate) {
+			feed.LastBuildDate = items[i].UpdatedAt
+		}
+	}
+
+	self := *c.Request.URL
+	feed.SelfURL = url + self.RequestURI()
+	if page > 1 || hasNext {
+		feed.FirstURL = url + feedPageURI(self, 1)
+	}
+	if page > 1 {
+		feed.PreviousURL = url + feedPageURI(self, page-1)
+	}
+	if hasNext {
+		feed.NextURL = url + feedPageURI(self, page+1)
+	}
+
+	var body bytes.Buffer
+	if err := service.WriteRss(&body, feed); err != nil {
+		logger.Log.Errorw("writing feed", "feed", feed.Title, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write feed"})
+		return
+	}
+	sum := sha256.Sum256(body.Bytes())
+	c.Header("Content-Type", service.RssContentType)
+	c.Header("ETag", fmt.Sprintf(`"%x"`, sum[:16]))
+	c.Header("Cache-Control", "no-cache")
+	// ServeContent answers conditional requests with 304 Not Modified.
+	http.ServeContent(c.Writer, c.Request, "", time.Time{}, bytes.NewReader(body.Bytes()))
+}
+
+// feedPageURI returns the request URI of page of the feed at self.
+func feedPageURI(self neturl.URL, page int) string {
+	query := self.Query()
+	if page > 1 {
+		query.Set("page", strconv.Itoa(page))
+	} else {
+		query.Del("page")
+	}
+	self.RawQuery = query.Encode()
+	return self.RequestURI()
+}
+
+// GetSmartPlaylistFile returns the handler of the get smart playlist file
+// request, which downloads a smart playlist as a playlist file in format.
+func GetSmartPlaylistFile(format string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		playlist, items, ok := getSmartPlaylistItems(c)
+		if !ok {
+			return
+		}
+		writePlaylistFile(c, format, playlist.Name, items)
+	}
+}
+
+// GetPodcastPlaylistFile returns the handler of the get podcast playlist
+// file request, which downloads the episodes of a podcast the query's
+// EpisodesFilter selects as a playlist file in format.
+func GetPodcastPlaylistFile(format string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var searchByIDQuery SearchByIDQuery
+		if c.ShouldBindUri(&searchByIDQuery) != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+		var podcast db.Podcast
+		if err := db.GetPodcastByID(searchByIDQuery.ID, &podcast); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Podcast not found"})
+			return
+		}
+		items, ok := getFilteredPlaylistItems(c, func(filter *model.EpisodesFilter) {
+			filter.PodcastIDs = []string{podcast.ID}
+		})
+		if ok {
+			writePlaylistFile(c, format, podcast.Title, items)
+		}
+	}
+}
+
+// GetTagPlaylistFile returns the handler of the get tag playlist file
+// request, which downloads the episodes of the podcasts with a tag the
+// query's EpisodesFilter selects as a playlist file in format.
+func GetTagPlaylistFile(format string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var searchByIDQuery SearchByIDQuery
+		if c.ShouldBindUri(&searchByIDQuery) != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+		tag, err := db.GetTagByID(searchByIDQuery.ID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Tag not found"})
+			return
+		}
+		items, ok := getFilteredPlaylistItems(c, func(filter *model.EpisodesFilter) {
+			filter.TagIDs = []string{tag.ID}
+		})
+		if ok {
+			writePlaylistFile(c, format, tag.Label, items)
+		}
+	}
+}
+
+// GetEpisodesPlaylistFile returns the handler of the get episodes playlist
+// file request, which downloads the episodes the query's EpisodesFilter
+// selects as a playlist file in format.
+func GetEpisodesPlaylistFile(format string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		items, ok := getFilteredPlaylistItems(c, func(*model.EpisodesFilter) {})
+		if ok {
+			writePlaylistFile(c, format, "Podgrab", items)
+		}
+	}
+}
+
+// getFilteredPlaylistItems loads the episodes selected by the EpisodesFilter
+// in the query, narrowed by scope. The count limits the number of episodes,
+// all of them by default. It responds with an error when it cannot.
+func getFilteredPlaylistItems(c *gin.Context, scope func(filter *model.EpisodesFilter)) ([]db.PodcastItem, bool) {
+	var filter model.EpisodesFilter
+	if err := c.ShouldBindQuery(&filter); err != nil || filter.Count < 0 {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return nil, false
 	}
+	if filter.Sorting == "" {
+		filter.Sorting = model.ReleaseDesc
+	}
+	scope(&filter)
+	items, err := db.GetPlaylistPodcastItems(&filter, filter.Count)
+	if err != nil {
+		logger.Log.Errorw("getting playlist episodes", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load episodes"})
+		return nil, false
+	}
+	return *items, true
+}
 
-	title := "Podgrab"
-	description := "Pograb playlist"
+// writePlaylistFile responds with items as a playlist file in format named
+// after the playlist.
+func writePlaylistFile(c *gin.Context, format, name string, items []db.PodcastItem) {
+	url := getBaseURL(c)
+	query := playlistTokenQuery()
+	entries := make([]service.PlaylistEntry, 0, len(items))
+	for i := range items {
+		entries = append(entries, service.PlaylistEntry{
+			Title:    items[i].Title,
+			Artist:   items[i].Podcast.Title,
+			URL:      fmt.Sprintf("%s/podcastitems/%s/file%s", url, items[i].ID, query),
+			Image:    fmt.Sprintf("%s/podcastitems/%s/image%s", url, items[i].ID, query),
+			Duration: items[i].Duration,
+		})
+	}
+	c.Header("Content-Type", service.PlaylistContentType(format))
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name + "." + format}))
+	if err := service.WritePlaylist(c.Writer, format, name, entries); err != nil {
+		logger.Log.Errorw("writing playlist", "playlist", name, "error", err)
+	}
+}
+
+// playlistTokenQuery returns the query that authenticates the episode URLs
+// in playlist files, empty unless both a password and a playlist token are
+// configured.
+func playlistTokenQuery() string {
+	cfg := config.Get()
+	if cfg.Password == "" || cfg.PlaylistToken == "" {
+		return ""
+	}
+	return "?token=" + neturl.QueryEscape(cfg.PlaylistToken)
+}
 
-	c.XML(200, createRss(items, title, description, "", c))
+// TokenAuth authenticates requests whose token query parameter matches
+// token, and passes the others to fallback. An empty token disables it.
+func TokenAuth(token string, fallback gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		supplied := c.Query("token")
+		if token != "" && supplied != "" && subtle.ConstantTimeCompare([]byte(supplied), []byte(token)) == 1 {
+			c.Next()
+			return
+		}
+		fallback(c)
+	}
+}
+
+// getSmartPlaylistItems loads the smart playlist of the request and its
+// episodes, responding with an error when it cannot.
+func getSmartPlaylistItems(c *gin.Context) (*db.SmartPlaylist, []db.PodcastItem, bool) {
+	var searchByIDQuery SearchByIDQuery
+	if c.ShouldBindUri(&searchByIDQuery) != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return nil, nil, false
+	}
+	var playlist db.SmartPlaylist
+	if err := db.GetSmartPlaylistByID(searchByIDQuery.ID, &playlist); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Smart playlist not found"})
+		return nil, nil, false
+	}
+	items, err := service.GetSmartPlaylistItems(&playlist)
+	if err != nil {
+		logger.Log.Errorw("getting smart playlist episodes", "playlist", playlist.Name, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load episodes"})
+		return nil, nil, false
+	}
+	return &playlist, items, true
 }
 
 // DeleteTagByID handles the delete tag by id request.
@@ -708,14 +983,13 @@ func UpdateSetting(c *gin.Context) {
 	err := c.ShouldBind(&settingModel)
 
 	if err == nil {
-		err = service.UpdateSettings(settingModel.DownloadOnAdd, settingModel.InitialDownloadCount,
-			settingModel.AutoDownload, settingModel.AppendDateToFileName, settingModel.AppendEpisodeNumberToFileName,
-			settingModel.DarkMode, settingModel.DownloadEpisodeImages, settingModel.GenerateNFOFile, settingModel.DontDownloadDeletedFromDisk, settingModel.BaseURL,
-			settingModel.MaxDownloadConcurrency, settingModel.UserAgent,
-		)
-		if err == nil {
+		err = settingModel.save()
+		switch {
+		case err == nil:
 			c.JSON(200, gin.H{"message": "Success"})
-		} else {
+		case errors.Is(err, service.ErrInvalidDedupSensitivity):
+			c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		default:
 			c.JSON(http.StatusBadRequest, err)
 		}
 	} else {
@@ -723,3 +997,65 @@ func UpdateSetting(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, err)
 	}
 }
+
+// FeedAuthData represents feed credentials data. Secrets sent back masked
+// keep their stored values.
+type FeedAuthData struct {
+	Headers  map[string]string `json:"headers"`
+	Query    map[string]string `json:"query"`
+	Username string            `json:"username"`
+	Password string            `json:"password"`
+	Token    string            `json:"token"`
+}
+
+// apply returns the credentials to store, keeping the stored secrets of auth
+// that were sent back masked.
+func (data *FeedAuthData) apply(auth *service.FeedAuth) *service.FeedAuth {
+	updated := &service.FeedAuth{
+		Username: data.Username,
+		Password: data.Password,
+		Token:    data.Token,
+		Headers:  make(map[string]string, len(data.Headers)),
+		Query:    make(map[string]string, len(data.Query)),
+	}
+	if data.Password == maskedSecret {
+		updated.Password = auth.Password
+	}
+	if data.Token == maskedSecret {
+		updated.Token = auth.Token
+	}
+	for name, value := range data.Headers {
+		if value == maskedSecret {
+			value = auth.Headers[name]
+		}
+		updated.Headers[name] = value
+	}
+	for name, value := range data.Query {
+		if value == maskedSecret {
+			value = auth.Query[name]
+		}
+		updated.Query[name] = value
+	}
+	return updated
+}
+
+func maskFeedAuth(auth *service.FeedAuth) FeedAuthData {
+	data := FeedAuthData{
+		Username: auth.Username,
+		Headers:  make(map[string]string, len(auth.Headers)),
+		Query:    make(map[string]string, len(auth.Query)),
+	}
+	if auth.Password != "" {
+		data.Password = maskedSecret
+	}
+	if auth.Token != "" {
+		data.Token = maskedSecret
+	}
+	for name := range auth.Headers {
+		data.Headers[name] = maskedSecret
+	}
+	for name := range auth.Query {
+		data.Query[name] = maskedSecret
+	}
+	return data
+}
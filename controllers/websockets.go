@@ -1,19 +1,25 @@
 package controllers
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"sync"
+	"time"
 
+	"github.com/akhilrex/podgrab/db"
 	"github.com/akhilrex/podgrab/internal/logger"
+	"github.com/akhilrex/podgrab/internal/metrics"
+	"github.com/akhilrex/podgrab/service"
 	"github.com/gorilla/websocket"
 )
 
 // EnqueuePayload represents enqueue payload data.
 type EnqueuePayload struct {
-	ItemIDs   []string `json:"itemIDs"`
-	PodcastID string   `json:"podcastID"`
-	TagIDs    []string `json:"tagIDs"`
+	ItemIDs         []string `json:"itemIDs"`
+	PodcastID       string   `json:"podcastID"`
+	TagIDs          []string `json:"tagIDs"`
+	SmartPlaylistID string   `json:"smartPlaylistID"`
 }
 
 var wsupgrader = websocket.Upgrader{
@@ -24,11 +30,23 @@ var wsupgrader = websocket.Upgrader{
 var (
 	activePlayers  = make(map[*websocket.Conn]string)
 	allConnections = make(map[*websocket.Conn]string)
-	connMutex      sync.RWMutex
+	// openConnections holds every upgraded connection, including those that
+	// have not sent a message yet, so they can be closed on shutdown.
+	openConnections = make(map[*websocket.Conn]bool)
+	connMutex       sync.RWMutex
 )
 
 var broadcast = make(chan Message) // broadcast channel
 
+// notifyPlaylistChanged tells every page that the episodes of a playlist,
+// or of the up next queue for db.QueuePlaylistID, changed. Players showing
+// it load it again.
+func notifyPlaylistChanged(playlistID string) {
+	go func() {
+		broadcast <- Message{MessageType: "PlaylistChanged", Payload: playlistID}
+	}()
+}
+
 // Message represents message data.
 type Message struct {
 	Connection  *websocket.Conn `json:"-"`
@@ -44,7 +62,15 @@ func Wshandler(w http.ResponseWriter, r *http.Request) {
 		logger.Log.Errorw("Failed to set websocket upgrade", "error", err)
 		return
 	}
+	metrics.WebsocketConnections.Inc()
+	defer metrics.WebsocketConnections.Dec()
+	connMutex.Lock()
+	openConnections[conn] = true
+	connMutex.Unlock()
 	defer func() {
+		connMutex.Lock()
+		delete(openConnections, conn)
+		connMutex.Unlock()
 		if err := conn.Close(); err != nil {
 			logger.Log.Errorw("closing websocket connection", "error", err)
 		}
@@ -114,7 +140,18 @@ func HandleWebsocketMessages() {
 			logger.Log.Debugw("Received message payload", "payload", msg.Payload)
 			err := json.Unmarshal([]byte(msg.Payload), &payload)
 			if err == nil {
-				items := getItemsToPlay(payload.ItemIDs, payload.PodcastID, payload.TagIDs)
+				items := getItemsToPlay(payload.ItemIDs, payload.PodcastID, payload.TagIDs, payload.SmartPlaylistID)
+				ids := make([]string, 0, len(items))
+				for i := range items {
+					ids = append(ids, items[i].ID)
+				}
+				added, queueErr := service.AddPlaylistEpisodes(db.QueuePlaylistID, ids, false)
+				if queueErr != nil {
+					logger.Log.Errorw("adding episodes to the queue", "error", queueErr)
+				}
+				if added > 0 {
+					writeToAll(Message{MessageType: "PlaylistChanged", Payload: db.QueuePlaylistID})
+				}
 				var player *websocket.Conn
 				connMutex.RLock()
 				for connection, id := range activePlayers {
@@ -139,6 +176,8 @@ func HandleWebsocketMessages() {
 			} else {
 				logger.Log.Error(err.Error())
 			}
+		case "PlaylistChanged":
+			writeToAll(msg)
 		case "Register":
 			var player *websocket.Conn
 			connMutex.RLock()
@@ -169,3 +208,52 @@ func HandleWebsocketMessages() {
 		}
 	}
 }
+
+// writeToAll sends msg to every connection. Only HandleWebsocketMessages
+// writes messages, as a connection supports one writer at a time.
+func writeToAll(msg Message) {
+	connMutex.RLock()
+	defer connMutex.RUnlock()
+	for connection := range allConnections {
+		if err := connection.WriteJSON(msg); err != nil {
+			logger.Log.Errorw("writing JSON to connection", "error", err)
+		}
+	}
+}
+
+// CloseWebsockets asks every websocket client to disconnect and waits for the
+// connections to close. Connections still open when ctx ends are closed
+// without waiting for the client.
+func CloseWebsockets(ctx context.Context) {
+	closeMessage := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+	connMutex.RLock()
+	for conn := range openConnections {
+		if err := conn.WriteControl(websocket.CloseMessage, closeMessage, time.Now().Add(time.Second)); err != nil {
+			logger.Log.Debugw("sending websocket close message", "error", err)
+		}
+	}
+	connMutex.RUnlock()
+
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		connMutex.RLock()
+		remaining := len(openConnections)
+		connMutex.RUnlock()
+		if remaining == 0 {
+			return
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			connMutex.RLock()
+			for conn := range openConnections {
+				if err := conn.Close(); err != nil {
+					logger.Log.Debugw("closing websocket connection", "error", err)
+				}
+			}
+			connMutex.RUnlock()
+			return
+		}
+	}
+}
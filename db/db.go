@@ -3,9 +3,9 @@ package db
 
 import (
 	"fmt"
-	"os"
 	"path"
 
+	"github.com/akhilrex/podgrab/internal/config"
 	"github.com/akhilrex/podgrab/internal/logger"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
@@ -17,8 +17,7 @@ var DB *gorm.DB
 // Init is used to Initialize Database
 func Init() (*gorm.DB, error) {
 	// github.com/mattn/go-sqlite3
-	configPath := os.Getenv("CONFIG")
-	dbPath := path.Join(configPath, "podgrab.db")
+	dbPath := path.Join(config.Get().ConfigDir, "podgrab.db")
 	logger.Log.Info(dbPath)
 	db, err := gorm.Open(sqlite.Open(dbPath), &gorm.Config{})
 	if err != nil {
@@ -36,12 +35,16 @@ func Init() (*gorm.DB, error) {
 	return DB, nil
 }
 
-// Migrate Database
-func Migrate() {
-	if err := DB.AutoMigrate(&Podcast{}, &PodcastItem{}, &Setting{}, &Migration{}, &JobLock{}, &Tag{}); err != nil {
-		panic(fmt.Sprintf("failed to auto-migrate database: %v", err))
+// Migrate brings the schema up to date. It refuses to run against a schema
+// written by a newer version of Podgrab.
+func Migrate() error {
+	if err := DB.AutoMigrate(&Migration{}); err != nil {
+		return fmt.Errorf("failed to prepare migrations table: %w", err)
 	}
-	RunMigrations()
+	if err := CheckSchemaVersion(); err != nil {
+		return err
+	}
+	return RunMigrations()
 }
 
 // GetDB returns the database connection for creating a connection pool.
@@ -8,8 +8,8 @@ import (
 	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
-	"github.com/akhilrex/podgrab/internal/logger"
 	"github.com/akhilrex/podgrab/model"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
@@ -36,6 +36,11 @@ func GetAllPodcasts(podcasts *[]Podcast, sorting string) error {
 	return result.Error
 }
 
+// GetLocalPodcasts returns the podcasts made from folders of audio files.
+func GetLocalPodcasts(podcasts *[]Podcast) error {
+	return DB.Where("is_local = ?", true).Order("created_at").Find(podcasts).Error
+}
+
 // GetAllPodcastItems get all podcast items.
 func GetAllPodcastItems(podcasts *[]PodcastItem) error {
 	result := DB.Preload("Podcast").Order("pub_date desc").Find(&podcasts)
@@ -45,7 +50,7 @@ func GetAllPodcastItems(podcasts *[]PodcastItem) error {
 // GetAllPodcastItemsWithoutSize get all podcast items without size.
 func GetAllPodcastItemsWithoutSize() (*[]PodcastItem, error) {
 	var podcasts []PodcastItem
-	result := DB.Where("file_size<=?", 0).Order("pub_date desc").Find(&podcasts)
+	result := DB.Preload("Podcast").Where("file_size<=?", 0).Order("pub_date desc").Find(&podcasts)
 	return &podcasts, result.Error
 }
 
@@ -68,7 +73,25 @@ func getSortOrder(sorting model.EpisodeSort) string {
 func GetPaginatedPodcastItemsNew(queryModel *model.EpisodesFilter) (*[]PodcastItem, int64, error) {
 	var podcasts []PodcastItem
 	var total int64
-	query := DB.Debug().Preload("Podcast")
+	query := filterPodcastItems(DB.Debug().Preload("Podcast"), queryModel)
+
+	totalsQuery := query.Order(getSortOrder(queryModel.Sorting)).Find(&podcasts)
+	totalsQuery.Count(&total)
+
+	result := query.Limit(queryModel.Count).Offset((queryModel.Page - 1) * queryModel.Count).Order("pub_date desc").Find(&podcasts)
+	return &podcasts, total, result.Error
+}
+
+// GetPodcastItemsByFilter returns every episode queryModel selects, ignoring
+// its pagination.
+func GetPodcastItemsByFilter(queryModel *model.EpisodesFilter) (*[]PodcastItem, error) {
+	var podcastItems []PodcastItem
+	result := filterPodcastItems(DB, queryModel).Order(getSortOrder(queryModel.Sorting)).Find(&podcastItems)
+	return &podcastItems, result.Error
+}
+
+// filterPodcastItems restricts query to the episodes queryModel selects.
+func filterPodcastItems(query *gorm.DB, queryModel *model.EpisodesFilter) *gorm.DB {
 	if queryModel.IsDownloaded != nil {
 		isDownloaded, err := strconv.ParseBool(*queryModel.IsDownloaded)
 		if err == nil {
@@ -102,11 +125,16 @@ func GetPaginatedPodcastItemsNew(queryModel *model.EpisodesFilter) (*[]PodcastIt
 		query = query.Where("podcast_id in ?", queryModel.PodcastIDs)
 	}
 
-	totalsQuery := query.Order(getSortOrder(queryModel.Sorting)).Find(&podcasts)
-	totalsQuery.Count(&total)
-
-	result := query.Limit(queryModel.Count).Offset((queryModel.Page - 1) * queryModel.Count).Order("pub_date desc").Find(&podcasts)
-	return &podcasts, total, result.Error
+	if queryModel.MaxAgeDays > 0 {
+		query = query.Where("pub_date >= ?", time.Now().AddDate(0, 0, -queryModel.MaxAgeDays))
+	}
+	if queryModel.MinDuration > 0 {
+		query = query.Where("duration >= ?", queryModel.MinDuration)
+	}
+	if queryModel.MaxDuration > 0 {
+		query = query.Where("duration <= ?", queryModel.MaxDuration)
+	}
+	return query
 }
 
 // GetPaginatedPodcastItems get paginated podcast items.
@@ -164,6 +192,12 @@ func GetPodcastItemByID(id string, podcastItem *PodcastItem) error {
 
 // DeletePodcastItemByID delete podcast item by id.
 func DeletePodcastItemByID(id string) error {
+	if err := DB.Where("podcast_item_id = ?", id).Delete(&PodcastItemHistory{}).Error; err != nil {
+		return err
+	}
+	if err := DB.Where("podcast_item_id = ?", id).Delete(&PlaylistItem{}).Error; err != nil {
+		return err
+	}
 	result := DB.Where("id=?", id).Delete(&PodcastItem{})
 	return result.Error
 }
@@ -171,6 +205,13 @@ func DeletePodcastItemByID(id string) error {
 // DeletePodcastByID delete podcast by id.
 func DeletePodcastByID(id string) error {
 	// Delete associated podcast items first
+	items := DB.Model(&PodcastItem{}).Select("id").Where("podcast_id = ?", id)
+	if err := DB.Where("podcast_item_id in (?)", items).Delete(&PodcastItemHistory{}).Error; err != nil {
+		return err
+	}
+	if err := DB.Where("podcast_item_id in (?)", items).Delete(&PlaylistItem{}).Error; err != nil {
+		return err
+	}
 	if err := DB.Where("podcast_id = ?", id).Delete(&PodcastItem{}).Error; err != nil {
 		return err
 	}
@@ -249,7 +290,19 @@ func GetAllPodcastItemsToBeDownloaded() (*[]PodcastItem, error) {
 	}
 
 	var podcastItems []PodcastItem
-	result := DB.Preload(clause.Associations).Where("download_status=?", NotDownloaded).Find(&podcastItems)
+	// Episodes removed from their feed are likely gone from the server too
+	result := DB.Preload(clause.Associations).Where("download_status=?", NotDownloaded).
+		Where("removed_upstream_at IS NULL").Find(&podcastItems)
+	return &podcastItems, result.Error
+}
+
+// GetPodcastItemsToBeDownloadedByPodcastID get the podcast items of a podcast
+// to be downloaded.
+func GetPodcastItemsToBeDownloadedByPodcastID(podcastID string) (*[]PodcastItem, error) {
+	var podcastItems []PodcastItem
+	result := DB.Preload(clause.Associations).Where("podcast_id = ?", podcastID).
+		Where("download_status=?", NotDownloaded).
+		Where("removed_upstream_at IS NULL").Find(&podcastItems)
 	return &podcastItems, result.Error
 }
 
@@ -356,6 +409,66 @@ func UpdatePodcast(podcast *Podcast) error {
 	return tx.Error
 }
 
+// UpdatePodcastMetadata stores the details of a podcast, from its feed and
+// the user's overrides.
+func UpdatePodcastMetadata(podcast *Podcast) error {
+	tx := DB.Model(&Podcast{}).Where("id = ?", podcast.ID).Updates(map[string]interface{}{
+		"title":            podcast.Title,
+		"summary":          podcast.Summary,
+		"author":           podcast.Author,
+		"image":            podcast.Image,
+		"feed_title":       podcast.FeedTitle,
+		"feed_summary":     podcast.FeedSummary,
+		"feed_author":      podcast.FeedAuthor,
+		"feed_image":       podcast.FeedImage,
+		"title_override":   podcast.TitleOverride,
+		"summary_override": podcast.SummaryOverride,
+		"author_override":  podcast.AuthorOverride,
+		"image_override":   podcast.ImageOverride,
+	})
+	return tx.Error
+}
+
+// GetPodcastDataFolder returns the name of a podcast's folder in the data
+// directory.
+func GetPodcastDataFolder(podcastID string) (string, error) {
+	var podcast Podcast
+	result := DB.Select("folder", "title").First(&podcast, "id = ?", podcastID)
+	return podcast.DataFolder(), result.Error
+}
+
+// UpdatePodcastFolder names the folder of a podcast, moving the files of its
+// episodes, and the folder of a local podcast, from oldDir to newDir.
+func UpdatePodcastFolder(podcastID, folder, oldDir, newDir string) error {
+	oldPrefix, newPrefix := oldDir+"/", newDir+"/"
+	// SQLite counts characters rather than bytes
+	length := utf8.RuneCountInString(oldPrefix)
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&Podcast{}).Where("id = ?", podcastID).Update("folder", folder).Error; err != nil {
+			return err
+		}
+		err := tx.Model(&Podcast{}).Where("id = ? AND local_path = ?", podcastID, oldDir).Update("local_path", newDir).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Model(&Podcast{}).
+			Where("id = ? AND substr(local_path, 1, ?) = ?", podcastID, length, oldPrefix).
+			Update("local_path", gorm.Expr("? || substr(local_path, ?)", newPrefix, length+1)).Error
+		if err != nil {
+			return err
+		}
+		for _, column := range []string{"download_path", "local_image"} {
+			err := tx.Model(&PodcastItem{}).
+				Where("podcast_id = ? AND substr("+column+", 1, ?) = ?", podcastID, length, oldPrefix).
+				Update(column, gorm.Expr("? || substr("+column+", ?)", newPrefix, length+1)).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
 // UpdatePodcastItem update podcast item.
 func UpdatePodcastItem(podcastItem *PodcastItem) error {
 	tx := DB.Omit("Podcast").Save(&podcastItem)
@@ -418,6 +531,8 @@ func Lock(name string, duration int) {
 	}
 	jobLock.Duration = duration
 	jobLock.Date = time.Now()
+	jobLock.LeaseUntil = time.Now().UTC().Add(time.Duration(duration) * time.Minute)
+	jobLock.Owner = ""
 	if jobLock.ID == "" {
 		DB.Create(&jobLock)
 	} else {
@@ -438,28 +553,125 @@ func Unlock(name string) {
 	}
 	jobLock.Duration = 0
 	jobLock.Date = time.Time{}
+	jobLock.LeaseUntil = time.Time{}
+	jobLock.Owner = ""
 	DB.Save(&jobLock)
 }
 
-// UnlockMissedJobs unlock missed jobs.
-func UnlockMissedJobs() {
+// AcquireLock takes the named lock for owner with a lease that expires after
+// lease unless it is renewed. It returns false if another owner holds an
+// unexpired lease. Duration is how many minutes the job is expected to run.
+func AcquireLock(name, owner string, duration int, lease time.Duration) (bool, error) {
+	if err := DB.Where(JobLock{Name: name}).FirstOrCreate(&JobLock{}).Error; err != nil {
+		return false, err
+	}
+	now := time.Now().UTC()
+	result := DB.Model(&JobLock{}).
+		Where("name = ? AND (lease_until IS NULL OR lease_until <= ?)", name, now).
+		Updates(map[string]interface{}{
+			"owner":       owner,
+			"date":        time.Now(),
+			"duration":    duration,
+			"lease_until": now.Add(lease),
+		})
+	return result.RowsAffected == 1, result.Error
+}
+
+// RenewLock extends owner's lease on the named lock. It returns false if the
+// lock is no longer held by owner.
+func RenewLock(name, owner string, lease time.Duration) (bool, error) {
+	result := DB.Model(&JobLock{}).
+		Where("name = ? AND owner = ?", name, owner).
+		Update("lease_until", time.Now().UTC().Add(lease))
+	return result.RowsAffected == 1, result.Error
+}
+
+// ReleaseLock releases the named lock if owner still holds it.
+func ReleaseLock(name, owner string) error {
+	return DB.Model(&JobLock{}).
+		Where("name = ? AND owner = ?", name, owner).
+		Updates(map[string]interface{}{
+			"owner":       "",
+			"date":        time.Time{},
+			"duration":    0,
+			"lease_until": time.Time{},
+		}).Error
+}
+
+// GetAllJobLocks returns every job lock ordered by name.
+func GetAllJobLocks() (*[]JobLock, error) {
 	var jobLocks []JobLock
+	result := DB.Order("name").Find(&jobLocks)
+	return &jobLocks, result.Error
+}
 
-	result := DB.Find(&jobLocks)
+// GetAllJobSchedules returns every stored job schedule.
+func GetAllJobSchedules() (*[]JobSchedule, error) {
+	var schedules []JobSchedule
+	result := DB.Order("name").Find(&schedules)
+	return &schedules, result.Error
+}
+
+// SaveJobSchedule creates or updates the stored schedule of a job.
+func SaveJobSchedule(schedule *JobSchedule) error {
+	var existing JobSchedule
+	result := DB.Where("name = ?", schedule.Name).First(&existing)
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return DB.Create(schedule).Error
+	}
 	if result.Error != nil {
-		return
+		return result.Error
 	}
-	for _, job := range jobLocks {
-		if (job.Date.Equal(time.Time{})) {
-			continue
-		}
-		var duration = time.Duration(job.Duration)
-		d := job.Date.Add(time.Minute * duration)
-		if d.Before(time.Now()) {
-			logger.Log.Debug(job.Name + " is unlocked")
-			Unlock(job.Name)
-		}
+	schedule.ID = existing.ID
+	schedule.CreatedAt = existing.CreatedAt
+	return DB.Save(schedule).Error
+}
+
+// CreateJobRun create job run.
+func CreateJobRun(run *JobRun) error {
+	tx := DB.Create(run)
+	return tx.Error
+}
+
+// UpdateJobRun update job run.
+func UpdateJobRun(run *JobRun) error {
+	tx := DB.Save(run)
+	return tx.Error
+}
+
+// GetLastJobRun returns the most recent run of a job, or nil if it never ran.
+func GetLastJobRun(name string) (*JobRun, error) {
+	var runs []JobRun
+	result := DB.Where("name = ?", name).Order("started_at desc").Limit(1).Find(&runs)
+	if result.Error != nil || len(runs) == 0 {
+		return nil, result.Error
 	}
+	return &runs[0], nil
+}
+
+// GetPaginatedJobRuns returns a page of a job's runs, newest first.
+func GetPaginatedJobRuns(name string, page, count int, runs *[]JobRun, total *int64) error {
+	query := DB.Model(&JobRun{}).Where("name = ?", name)
+	if err := query.Count(total).Error; err != nil {
+		return err
+	}
+	result := query.Order("started_at desc").Limit(count).Offset((page - 1) * count).Find(runs)
+	return result.Error
+}
+
+// PruneJobRuns deletes all but the keep most recent runs of a job.
+func PruneJobRuns(name string, keep int) error {
+	keepIDs := DB.Model(&JobRun{}).Select("id").Where("name = ?", name).Order("started_at desc").Limit(keep)
+	result := DB.Where("name = ? AND id NOT IN (?)", name, keepIDs).Delete(&JobRun{})
+	return result.Error
+}
+
+// InterruptJobRuns marks a job's unfinished runs as interrupted.
+func InterruptJobRuns(name string) error {
+	result := DB.Model(&JobRun{}).
+		Where("name = ? AND status = ?", name, JobRunRunning).
+		Update("status", JobRunInterrupted)
+	return result.Error
 }
 
 // GetAllTags get all tags.
@@ -516,6 +728,19 @@ func AddTagToPodcast(id, tagID string) error {
 	return tx.Error
 }
 
+// AddTagToPodcasts tags every podcast of podcastIDs, or none if one fails.
+func AddTagToPodcasts(podcastIDs []string, tagID string) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		for _, id := range podcastIDs {
+			err := tx.Exec("INSERT INTO `podcast_tags` (`podcast_id`,`tag_id`) VALUES (?,?) ON CONFLICT DO NOTHING", id, tagID).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
 // RemoveTagFromPodcast remove tag from podcast.
 func RemoveTagFromPodcast(id, tagID string) error {
 	tx := DB.Exec("DELETE FROM `podcast_tags` WHERE `podcast_id`=? AND `tag_id`=?", id, tagID)
@@ -527,3 +752,476 @@ func UntagAllByTagID(tagID string) error {
 	tx := DB.Exec("DELETE FROM `podcast_tags` WHERE `tag_id`=?", tagID)
 	return tx.Error
 }
+
+// GetTagIDsForPodcast returns the ids of the tags applied to a podcast.
+func GetTagIDsForPodcast(podcastID string) ([]string, error) {
+	var tagIDs []string
+	result := DB.Table("podcast_tags").Where("podcast_id = ?", podcastID).Pluck("tag_id", &tagIDs)
+	return tagIDs, result.Error
+}
+
+// RecordFeedSuccess clears the failure count of a podcast's feed.
+func RecordFeedSuccess(podcastID string) error {
+	tx := DB.Model(&Podcast{}).Where("id = ?", podcastID).Updates(map[string]interface{}{
+		"feed_failure_count": 0,
+		"last_feed_error":    "",
+		"last_feed_success":  time.Now(),
+	})
+	return tx.Error
+}
+
+// RecordFeedFailure increments the failure count of a podcast's feed and returns the new count.
+func RecordFeedFailure(podcastID, feedError string) (int, error) {
+	tx := DB.Model(&Podcast{}).Where("id = ?", podcastID).Updates(map[string]interface{}{
+		"feed_failure_count": gorm.Expr("feed_failure_count + 1"),
+		"last_feed_error":    feedError,
+	})
+	if tx.Error != nil {
+		return 0, tx.Error
+	}
+	var count int
+	result := DB.Model(&Podcast{}).Where("id = ?", podcastID).Pluck("feed_failure_count", &count)
+	return count, result.Error
+}
+
+// UpdatePodcastFeedAuth stores the encrypted credentials of a podcast.
+func UpdatePodcastFeedAuth(podcastID, feedAuth string) error {
+	tx := DB.Model(&Podcast{}).Where("id = ?", podcastID).Update("feed_auth", feedAuth)
+	if tx.Error == nil && tx.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return tx.Error
+}
+
+// MergePodcastItem stores the GUID, enclosure and details an episode took
+// from a changed feed entry, recording the change in its history unless
+// history is nil. The episode is listed in its feed again.
+func MergePodcastItem(podcastItem *PodcastItem, history *PodcastItemHistory) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		return mergePodcastItem(tx, podcastItem, history)
+	})
+}
+
+func mergePodcastItem(tx *gorm.DB, podcastItem *PodcastItem, history *PodcastItemHistory) error {
+	err := tx.Model(&PodcastItem{}).Where("id = ?", podcastItem.ID).Updates(map[string]interface{}{
+		"guid":                podcastItem.GUID,
+		"file_url":            podcastItem.FileURL,
+		"title":               podcastItem.Title,
+		"summary":             podcastItem.Summary,
+		"image":               podcastItem.Image,
+		"episode_type":        podcastItem.EpisodeType,
+		"duration":            podcastItem.Duration,
+		"pub_date":            podcastItem.PubDate,
+		"fingerprint":         podcastItem.Fingerprint,
+		"removed_upstream_at": nil,
+	}).Error
+	if err != nil || history == nil {
+		return err
+	}
+	history.PodcastItemID = podcastItem.ID
+	return tx.Create(history).Error
+}
+
+// PodcastItemMerge is an episode updated from the entry it matched in a
+// feed, with its history record or nil.
+type PodcastItemMerge struct {
+	PodcastItem *PodcastItem
+	History     *PodcastItemHistory
+}
+
+// MovePodcastFeed changes the feed URL and credentials of a podcast and
+// merges its episodes into the entries they matched in the new feed, all in
+// one transaction.
+func MovePodcastFeed(podcastID, url, feedAuth string, merges []PodcastItemMerge) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&Podcast{}).Where("id = ?", podcastID).Updates(map[string]interface{}{
+			"url":       url,
+			"feed_auth": feedAuth,
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		for i := range merges {
+			if err := mergePodcastItem(tx, merges[i].PodcastItem, merges[i].History); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// bulkUpdateBatchSize is how many episodes UpdatePodcastItemsByIDs updates
+// per statement, keeping below the SQLite limit on query parameters.
+const bulkUpdateBatchSize = 500
+
+// UpdatePodcastItemsByIDs sets the columns in values on the episodes of
+// podcastItemIDs, or on none if an update fails.
+func UpdatePodcastItemsByIDs(podcastItemIDs []string, values map[string]interface{}) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		for start := 0; start < len(podcastItemIDs); start += bulkUpdateBatchSize {
+			batch := podcastItemIDs[start:min(start+bulkUpdateBatchSize, len(podcastItemIDs))]
+			if err := tx.Model(&PodcastItem{}).Where("id IN ?", batch).Updates(values).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// UpdateRemovedUpstream flags the episodes of a podcast whose GUIDs are not
+// in guids as removed from the feed, and clears the flag of those that are.
+// It returns the number of episodes newly flagged.
+func UpdateRemovedUpstream(podcastID string, guids []string) (int64, error) {
+	var removed int64
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&PodcastItem{}).
+			Where("podcast_id = ? AND guid IN ? AND removed_upstream_at IS NOT NULL", podcastID, guids).
+			Update("removed_upstream_at", nil).Error
+		if err != nil {
+			return err
+		}
+		result := tx.Model(&PodcastItem{}).
+			Where("podcast_id = ? AND guid NOT IN ? AND removed_upstream_at IS NULL", podcastID, guids).
+			Update("removed_upstream_at", time.Now())
+		removed = result.RowsAffected
+		return result.Error
+	})
+	return removed, err
+}
+
+// GetPodcastItemHistory returns the GUID and enclosure changes of an episode,
+// oldest first.
+func GetPodcastItemHistory(podcastItemID string) ([]PodcastItemHistory, error) {
+	var history []PodcastItemHistory
+	result := DB.Where("podcast_item_id = ?", podcastItemID).Order("created_at").Find(&history)
+	return history, result.Error
+}
+
+// UpdatePodcastURLAndFeedAuth replaces the feed URL and the encrypted
+// credentials of a podcast.
+func UpdatePodcastURLAndFeedAuth(podcastID, url, feedAuth string) error {
+	tx := DB.Model(&Podcast{}).Where("id = ?", podcastID).Updates(map[string]interface{}{
+		"url":       url,
+		"feed_auth": feedAuth,
+	})
+	if tx.Error == nil && tx.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return tx.Error
+}
+
+// RecordFeedThrottled counts a podcast's servers asking Podgrab to slow down.
+func RecordFeedThrottled(podcastID string) error {
+	tx := DB.Model(&Podcast{}).Where("id = ?", podcastID).Updates(map[string]interface{}{
+		"feed_throttle_count": gorm.Expr("feed_throttle_count + 1"),
+		"last_feed_throttled": time.Now(),
+	})
+	return tx.Error
+}
+
+// IncrementDownloadFailureCount increments the failed download count of an episode and returns the new count.
+func IncrementDownloadFailureCount(podcastItemID string) (int, error) {
+	tx := DB.Model(&PodcastItem{}).Where("id = ?", podcastItemID).
+		Update("download_failure_count", gorm.Expr("download_failure_count + 1"))
+	if tx.Error != nil {
+		return 0, tx.Error
+	}
+	var count int
+	result := DB.Model(&PodcastItem{}).Where("id = ?", podcastItemID).Pluck("download_failure_count", &count)
+	return count, result.Error
+}
+
+// GetAllNotificationTargets get all notification targets.
+func GetAllNotificationTargets() (*[]NotificationTarget, error) {
+	var targets []NotificationTarget
+	result := DB.Order("created_at").Find(&targets)
+	return &targets, result.Error
+}
+
+// GetEnabledNotificationTargets get enabled notification targets.
+func GetEnabledNotificationTargets() (*[]NotificationTarget, error) {
+	var targets []NotificationTarget
+	result := DB.Where("enabled = ?", true).Order("created_at").Find(&targets)
+	return &targets, result.Error
+}
+
+// GetNotificationTargetByID get notification target by id.
+func GetNotificationTargetByID(id string, target *NotificationTarget) error {
+	result := DB.First(&target, "id=?", id)
+	return result.Error
+}
+
+// CreateNotificationTarget create notification target.
+func CreateNotificationTarget(target *NotificationTarget) error {
+	tx := DB.Create(&target)
+	return tx.Error
+}
+
+// UpdateNotificationTarget update notification target.
+func UpdateNotificationTarget(target *NotificationTarget) error {
+	tx := DB.Save(&target)
+	return tx.Error
+}
+
+// DeleteNotificationTargetByID deletes a notification target and its delivery log.
+func DeleteNotificationTargetByID(id string) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("notification_target_id = ?", id).Delete(&NotificationAlert{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("notification_target_id = ?", id).Delete(&NotificationDelivery{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("id=?", id).Delete(&NotificationTarget{}).Error
+	})
+}
+
+// MarkNotificationAlertSent records that a target is sent the failure alert of
+// event for subjectID, and reports false when it already was.
+func MarkNotificationAlertSent(targetID, event, subjectID string) (bool, error) {
+	alert := NotificationAlert{NotificationTargetID: targetID, Event: event, SubjectID: subjectID}
+	tx := DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&alert)
+	return tx.RowsAffected == 1, tx.Error
+}
+
+// ClearNotificationAlerts forgets the failure alerts of event for subjectID,
+// once its failures have stopped.
+func ClearNotificationAlerts(event, subjectID string) error {
+	tx := DB.Where("event = ? AND subject_id = ?", event, subjectID).Delete(&NotificationAlert{})
+	return tx.Error
+}
+
+// CreateNotificationDelivery create notification delivery.
+func CreateNotificationDelivery(delivery *NotificationDelivery) error {
+	tx := DB.Omit("NotificationTarget").Create(&delivery)
+	return tx.Error
+}
+
+// UpdateNotificationDelivery update notification delivery.
+func UpdateNotificationDelivery(delivery *NotificationDelivery) error {
+	tx := DB.Omit("NotificationTarget").Save(&delivery)
+	return tx.Error
+}
+
+// GetNotificationDeliveriesDue returns pending deliveries whose next attempt is due.
+func GetNotificationDeliveriesDue(now time.Time) (*[]NotificationDelivery, error) {
+	var deliveries []NotificationDelivery
+	result := DB.Preload("NotificationTarget").
+		Where("status = ? AND next_attempt_at <= ?", DeliveryPending, now).
+		Order("created_at").Find(&deliveries)
+	return &deliveries, result.Error
+}
+
+// GetPaginatedNotificationDeliveries returns the delivery log, newest first.
+func GetPaginatedNotificationDeliveries(page, count int, deliveries *[]NotificationDelivery, total *int64) error {
+	query := DB.Model(&NotificationDelivery{})
+	query.Count(total)
+	result := DB.Preload("NotificationTarget").Limit(count).Offset((page - 1) * count).Order("created_at desc").Find(&deliveries)
+	return result.Error
+}
+
+// GetAllSmartPlaylists returns the smart playlists by name.
+func GetAllSmartPlaylists() (*[]SmartPlaylist, error) {
+	var playlists []SmartPlaylist
+	result := DB.Order("name").Find(&playlists)
+	return &playlists, result.Error
+}
+
+// GetSmartPlaylistByID get smart playlist by id.
+func GetSmartPlaylistByID(id string, playlist *SmartPlaylist) error {
+	result := DB.First(&playlist, "id=?", id)
+	return result.Error
+}
+
+// CreateSmartPlaylist create smart playlist.
+func CreateSmartPlaylist(playlist *SmartPlaylist) error {
+	tx := DB.Create(&playlist)
+	return tx.Error
+}
+
+// UpdateSmartPlaylist update smart playlist.
+func UpdateSmartPlaylist(playlist *SmartPlaylist) error {
+	tx := DB.Save(&playlist)
+	return tx.Error
+}
+
+// DeleteSmartPlaylistByID delete smart playlist by id.
+func DeleteSmartPlaylistByID(id string) error {
+	result := DB.Where("id=?", id).Delete(&SmartPlaylist{})
+	return result.Error
+}
+
+// GetPlaylistPodcastItems returns the episodes queryModel selects with their
+// podcasts, in its sort order and at most limit of them unless limit is zero.
+func GetPlaylistPodcastItems(queryModel *model.EpisodesFilter, limit int) (*[]PodcastItem, error) {
+	return GetFilteredPodcastItems(queryModel, 0, limit)
+}
+
+// GetFilteredPodcastItems returns the episodes queryModel selects with their
+// podcasts in its sort order, skipping offset of them and returning at most
+// limit unless limit is zero.
+func GetFilteredPodcastItems(queryModel *model.EpisodesFilter, offset, limit int) (*[]PodcastItem, error) {
+	var podcastItems []PodcastItem
+	query := filterPodcastItems(DB.Preload("Podcast"), queryModel).Order(getSortOrder(queryModel.Sorting)).Order("id")
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	if offset > 0 {
+		query = query.Offset(offset)
+	}
+	result := query.Find(&podcastItems)
+	return &podcastItems, result.Error
+}
+
+// GetAllPlaylists returns the playlists by name with their episode counts.
+func GetAllPlaylists() (*[]Playlist, error) {
+	var playlists []Playlist
+	if err := DB.Order("name").Find(&playlists).Error; err != nil {
+		return nil, err
+	}
+	var counts []struct {
+		PlaylistID string
+		Count      int
+	}
+	err := DB.Model(&PlaylistItem{}).Select("playlist_id, count(*) as count").Group("playlist_id").Scan(&counts).Error
+	if err != nil {
+		return nil, err
+	}
+	byPlaylist := make(map[string]int, len(counts))
+	for _, count := range counts {
+		byPlaylist[count.PlaylistID] = count.Count
+	}
+	for i := range playlists {
+		playlists[i].EpisodesCount = byPlaylist[playlists[i].ID]
+	}
+	return &playlists, nil
+}
+
+// GetPlaylistByID get playlist by id.
+func GetPlaylistByID(id string, playlist *Playlist) error {
+	if err := DB.First(&playlist, "id=?", id).Error; err != nil {
+		return err
+	}
+	var count int64
+	err := DB.Model(&PlaylistItem{}).Where("playlist_id = ?", id).Count(&count).Error
+	playlist.EpisodesCount = int(count)
+	return err
+}
+
+// CreatePlaylist create playlist.
+func CreatePlaylist(playlist *Playlist) error {
+	tx := DB.Create(&playlist)
+	return tx.Error
+}
+
+// UpdatePlaylist update playlist.
+func UpdatePlaylist(playlist *Playlist) error {
+	tx := DB.Save(&playlist)
+	return tx.Error
+}
+
+// DeletePlaylistByID deletes a playlist with its items.
+func DeletePlaylistByID(id string) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("playlist_id = ?", id).Delete(&PlaylistItem{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("id=?", id).Delete(&Playlist{}).Error
+	})
+}
+
+// GetPlaylistEpisodes returns the episodes of a playlist, or of the up next
+// queue for QueuePlaylistID, with their podcasts in order.
+func GetPlaylistEpisodes(playlistID string) ([]PodcastItem, error) {
+	var podcastItems []PodcastItem
+	result := DB.Preload("Podcast").
+		Joins("JOIN playlist_items ON playlist_items.podcast_item_id = podcast_items.id").
+		Where("playlist_items.playlist_id = ?", playlistID).
+		Order("playlist_items.position").
+		Find(&podcastItems)
+	return podcastItems, result.Error
+}
+
+// SetPlaylistEpisodes replaces the episodes of a playlist, or of the up next
+// queue for QueuePlaylistID, with podcastItemIDs in order.
+func SetPlaylistEpisodes(playlistID string, podcastItemIDs []string) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("playlist_id = ?", playlistID).Delete(&PlaylistItem{}).Error; err != nil {
+			return err
+		}
+		if len(podcastItemIDs) == 0 {
+			return nil
+		}
+		items := make([]PlaylistItem, 0, len(podcastItemIDs))
+		for i, id := range podcastItemIDs {
+			items = append(items, PlaylistItem{PlaylistID: playlistID, PodcastItemID: id, Position: i})
+		}
+		return tx.CreateInBatches(&items, bulkUpdateBatchSize).Error
+	})
+}
+
+// AddPlaylistEpisodes adds podcastItemIDs in order to the end of a playlist,
+// or of the up next queue for QueuePlaylistID, or to its start when next is
+// set. Episodes already in it keep their position. It returns the number of
+// episodes added.
+func AddPlaylistEpisodes(playlistID string, podcastItemIDs []string, next bool) (int, error) {
+	var added []string
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var listedIDs []string
+		if err := tx.Model(&PlaylistItem{}).Where("playlist_id = ?", playlistID).
+			Pluck("podcast_item_id", &listedIDs).Error; err != nil {
+			return err
+		}
+		listed := make(map[string]bool, len(listedIDs)+len(podcastItemIDs))
+		for _, id := range listedIDs {
+			listed[id] = true
+		}
+		for _, id := range podcastItemIDs {
+			if !listed[id] {
+				listed[id] = true
+				added = append(added, id)
+			}
+		}
+		if len(added) == 0 {
+			return nil
+		}
+		start := 0
+		if next {
+			if err := tx.Model(&PlaylistItem{}).Where("playlist_id = ?", playlistID).
+				Update("position", gorm.Expr("position + ?", len(added))).Error; err != nil {
+				return err
+			}
+		} else {
+			var last *int
+			if err := tx.Model(&PlaylistItem{}).Where("playlist_id = ?", playlistID).
+				Select("MAX(position)").Scan(&last).Error; err != nil {
+				return err
+			}
+			if last != nil {
+				start = *last + 1
+			}
+		}
+		items := make([]PlaylistItem, 0, len(added))
+		for i, id := range added {
+			items = append(items, PlaylistItem{PlaylistID: playlistID, PodcastItemID: id, Position: start + i})
+		}
+		return tx.CreateInBatches(&items, bulkUpdateBatchSize).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(added), nil
+}
+
+// RemovePlaylistEpisode removes an episode from a playlist, or from the up
+// next queue for QueuePlaylistID.
+func RemovePlaylistEpisode(playlistID, podcastItemID string) error {
+	tx := DB.Where("playlist_id = ? AND podcast_item_id = ?", playlistID, podcastItemID).Delete(&PlaylistItem{})
+	if tx.Error == nil && tx.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return tx.Error
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/akhilrex/podgrab/model"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
 )
 
 // TestGetPodcastByURL tests podcast retrieval by URL.
@@ -117,6 +118,25 @@ func TestGetAllPodcasts(t *testing.T) {
 	}
 }
 
+// TestGetLocalPodcasts tests listing only the podcasts made from folders.
+func TestGetLocalPodcasts(t *testing.T) {
+	database := SetupTestDB(t)
+	defer TeardownTestDB(t, database)
+
+	originalDB := DB
+	DB = database
+	defer func() { DB = originalDB }()
+
+	CreateTestPodcast(t, database)
+	local := CreateTestPodcast(t, database, &Podcast{Title: "Recordings", IsLocal: true, LocalPath: "/recordings"})
+
+	var podcasts []Podcast
+	require.NoError(t, GetLocalPodcasts(&podcasts))
+	require.Len(t, podcasts, 1, "Should skip podcasts subscribed to feeds")
+	assert.Equal(t, local.ID, podcasts[0].ID)
+	assert.Equal(t, "/recordings", podcasts[0].LocalPath)
+}
+
 // TestCreatePodcast tests podcast creation.
 func TestCreatePodcast(t *testing.T) {
 	database := SetupTestDB(t)
@@ -418,6 +438,29 @@ func TestGetAllPodcastItemsToBeDownloaded(t *testing.T) {
 	assert.Len(t, *items, 2, "Should return only NotDownloaded items")
 }
 
+// TestGetPodcastItemsToBeDownloadedByPodcastID tests querying one podcast's
+// items queued for download.
+func TestGetPodcastItemsToBeDownloadedByPodcastID(t *testing.T) {
+	database := SetupTestDB(t)
+	defer TeardownTestDB(t, database)
+
+	originalDB := DB
+	DB = database
+	defer func() { DB = originalDB }()
+
+	podcast := CreateTestPodcast(t, database)
+	other := CreateTestPodcast(t, database)
+	queued := CreateTestPodcastItem(t, database, podcast.ID)
+	CreateTestPodcastItem(t, database, podcast.ID, &PodcastItem{DownloadStatus: Downloaded})
+	CreateTestPodcastItem(t, database, other.ID)
+
+	items, err := GetPodcastItemsToBeDownloadedByPodcastID(podcast.ID)
+
+	require.NoError(t, err, "Should query items")
+	require.Len(t, *items, 1, "Should return only the podcast's queued items")
+	assert.Equal(t, queued.ID, (*items)[0].ID)
+}
+
 // TestGetAllPodcastItemsAlreadyDownloaded tests querying downloaded items.
 func TestGetAllPodcastItemsAlreadyDownloaded(t *testing.T) {
 	database := SetupTestDB(t)
@@ -743,6 +786,200 @@ func TestLockAndUnlock(t *testing.T) {
 	assert.False(t, lock.IsLocked(), "Job should be unlocked")
 }
 
+// TestGetAllJobLocks tests listing job locks.
+func TestGetAllJobLocks(t *testing.T) {
+	database := SetupTestDB(t)
+	defer TeardownTestDB(t, database)
+
+	originalDB := DB
+	DB = database
+	defer func() { DB = originalDB }()
+
+	Lock("b-job", 30)
+	Lock("a-job", 30)
+	Unlock("b-job")
+
+	locks, err := GetAllJobLocks()
+	require.NoError(t, err)
+	require.Len(t, *locks, 2, "Should return every lock")
+	assert.Equal(t, "a-job", (*locks)[0].Name, "Should be ordered by name")
+	assert.True(t, (*locks)[0].IsLocked(), "a-job should be locked")
+	assert.False(t, (*locks)[1].IsLocked(), "b-job should be unlocked")
+}
+
+// TestAcquireLock tests lease based job locking.
+func TestAcquireLock(t *testing.T) {
+	database := SetupTestDB(t)
+	defer TeardownTestDB(t, database)
+
+	originalDB := DB
+	DB = database
+	defer func() { DB = originalDB }()
+
+	acquired, err := AcquireLock("job", "first", 60, time.Minute)
+	require.NoError(t, err)
+	assert.True(t, acquired, "Should acquire a free lock")
+	assert.True(t, GetLock("job").IsLocked())
+
+	acquired, err = AcquireLock("job", "second", 60, time.Minute)
+	require.NoError(t, err)
+	assert.False(t, acquired, "Should not acquire a lock with an unexpired lease")
+
+	renewed, err := RenewLock("job", "second", time.Minute)
+	require.NoError(t, err)
+	assert.False(t, renewed, "Only the owner can renew")
+
+	renewed, err = RenewLock("job", "first", -time.Second)
+	require.NoError(t, err)
+	assert.True(t, renewed)
+	assert.False(t, GetLock("job").IsLocked(), "Lease in the past should be expired")
+
+	acquired, err = AcquireLock("job", "second", 60, time.Minute)
+	require.NoError(t, err)
+	assert.True(t, acquired, "Should take over an expired lease")
+
+	require.NoError(t, ReleaseLock("job", "first"))
+	assert.True(t, GetLock("job").IsLocked(), "Former owner should not release the lock")
+	require.NoError(t, ReleaseLock("job", "second"))
+	assert.False(t, GetLock("job").IsLocked())
+
+	var count int64
+	database.Model(&JobLock{}).Where("name = ?", "job").Count(&count)
+	assert.Equal(t, int64(1), count, "Should reuse the lock row")
+}
+
+// TestSaveJobSchedule tests storing job schedules.
+func TestSaveJobSchedule(t *testing.T) {
+	database := SetupTestDB(t)
+	defer TeardownTestDB(t, database)
+
+	originalDB := DB
+	DB = database
+	defer func() { DB = originalDB }()
+
+	require.NoError(t, SaveJobSchedule(&JobSchedule{Name: "job", Schedule: "*/5 * * * *"}))
+	require.NoError(t, SaveJobSchedule(&JobSchedule{Name: "job", Schedule: "0 * * * *", Disabled: true}))
+
+	schedules, err := GetAllJobSchedules()
+	require.NoError(t, err)
+	require.Len(t, *schedules, 1, "Should update the existing schedule")
+	assert.Equal(t, "0 * * * *", (*schedules)[0].Schedule)
+	assert.True(t, (*schedules)[0].Disabled)
+}
+
+// TestJobRuns tests recording, listing and pruning job runs.
+func TestJobRuns(t *testing.T) {
+	database := SetupTestDB(t)
+	defer TeardownTestDB(t, database)
+
+	originalDB := DB
+	DB = database
+	defer func() { DB = originalDB }()
+
+	start := time.Now().Add(-time.Hour)
+	for i := 0; i < 5; i++ {
+		require.NoError(t, CreateJobRun(&JobRun{
+			Name:      "job",
+			StartedAt: start.Add(time.Duration(i) * time.Minute),
+			Status:    JobRunSucceeded,
+		}))
+	}
+	running := JobRun{Name: "job", StartedAt: time.Now(), Status: JobRunRunning}
+	require.NoError(t, CreateJobRun(&running))
+	require.NoError(t, CreateJobRun(&JobRun{Name: "other", StartedAt: start, Status: JobRunFailed}))
+
+	last, err := GetLastJobRun("job")
+	require.NoError(t, err)
+	assert.Equal(t, running.ID, last.ID, "Should return the newest run")
+
+	require.NoError(t, InterruptJobRuns("job"))
+	last, err = GetLastJobRun("job")
+	require.NoError(t, err)
+	assert.Equal(t, JobRunInterrupted, last.Status)
+
+	require.NoError(t, PruneJobRuns("job", 3))
+	var runs []JobRun
+	var total int64
+	require.NoError(t, GetPaginatedJobRuns("job", 1, 2, &runs, &total))
+	assert.Equal(t, int64(3), total, "Should keep the newest runs")
+	require.Len(t, runs, 2)
+	assert.Equal(t, running.ID, runs[0].ID)
+
+	other, err := GetLastJobRun("other")
+	require.NoError(t, err)
+	assert.NotNil(t, other, "Pruning should not touch other jobs")
+
+	never, err := GetLastJobRun("never")
+	require.NoError(t, err)
+	assert.Nil(t, never, "Job that never ran has no last run")
+}
+
+// TestFeedAndDownloadFailureCounts tests the feed health, throttling and download
+// failure counters.
+func TestFeedAndDownloadFailureCounts(t *testing.T) {
+	database := SetupTestDB(t)
+	defer TeardownTestDB(t, database)
+
+	originalDB := DB
+	DB = database
+	defer func() { DB = originalDB }()
+
+	podcast := CreateTestPodcast(t, database)
+	item := CreateTestPodcastItem(t, database, podcast.ID)
+
+	count, err := RecordFeedFailure(podcast.ID, "timeout")
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+	count, err = RecordFeedFailure(podcast.ID, "404")
+	require.NoError(t, err)
+	assert.Equal(t, 2, count, "Failures should accumulate")
+
+	var stored Podcast
+	require.NoError(t, database.First(&stored, "id = ?", podcast.ID).Error)
+	assert.Equal(t, "404", stored.LastFeedError)
+
+	require.NoError(t, RecordFeedSuccess(podcast.ID))
+	require.NoError(t, database.First(&stored, "id = ?", podcast.ID).Error)
+	assert.Equal(t, 0, stored.FeedFailureCount, "Success should reset the count")
+	assert.Empty(t, stored.LastFeedError)
+	assert.NotNil(t, stored.LastFeedSuccess)
+
+	require.NoError(t, RecordFeedThrottled(podcast.ID))
+	require.NoError(t, RecordFeedThrottled(podcast.ID))
+	require.NoError(t, database.First(&stored, "id = ?", podcast.ID).Error)
+	assert.Equal(t, 2, stored.FeedThrottleCount)
+	assert.NotNil(t, stored.LastFeedThrottled)
+	assert.Equal(t, 0, stored.FeedFailureCount, "Throttling is not a failure")
+
+	count, err = IncrementDownloadFailureCount(item.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+}
+
+// TestUpdatePodcastFeedAuth tests storing a podcast's sealed credentials.
+func TestUpdatePodcastFeedAuth(t *testing.T) {
+	database := SetupTestDB(t)
+	defer TeardownTestDB(t, database)
+
+	originalDB := DB
+	DB = database
+	defer func() { DB = originalDB }()
+
+	podcast := CreateTestPodcast(t, database)
+	require.NoError(t, UpdatePodcastFeedAuth(podcast.ID, "v1:sealed"))
+	var stored Podcast
+	require.NoError(t, database.First(&stored, "id = ?", podcast.ID).Error)
+	assert.Equal(t, "v1:sealed", stored.FeedAuth)
+
+	assert.Error(t, UpdatePodcastFeedAuth("missing", ""), "Unknown podcast should be reported")
+
+	require.NoError(t, UpdatePodcastURLAndFeedAuth(podcast.ID, "https://example.com/clean.xml", "v1:moved"))
+	require.NoError(t, database.First(&stored, "id = ?", podcast.ID).Error)
+	assert.Equal(t, "https://example.com/clean.xml", stored.URL)
+	assert.Equal(t, "v1:moved", stored.FeedAuth)
+	assert.Error(t, UpdatePodcastURLAndFeedAuth("missing", "", ""), "Unknown podcast should be reported")
+}
+
 // TestGetPaginatedPodcastItemsNew tests advanced episode filtering and pagination.
 func TestGetPaginatedPodcastItemsNew(t *testing.T) {
 	database := SetupTestDB(t)
@@ -819,6 +1056,28 @@ func TestGetPaginatedPodcastItemsNew(t *testing.T) {
 			},
 			wantCount: 2,
 		},
+		{
+			name: "published_recently",
+			filter: model.EpisodesFilter{
+				Pagination: model.Pagination{
+					Page:  1,
+					Count: 10,
+				},
+				MaxAgeDays: 2,
+			},
+			wantCount: 3,
+		},
+		{
+			name: "longer_than_an_hour",
+			filter: model.EpisodesFilter{
+				Pagination: model.Pagination{
+					Page:  1,
+					Count: 10,
+				},
+				MinDuration: 3600,
+			},
+			wantCount: 0,
+		},
 	}
 
 	for _, tt := range tests {
@@ -897,3 +1156,337 @@ func TestGetAllPodcastItemsWithoutSize(t *testing.T) {
 	require.NoError(t, err, "Should query items")
 	assert.Len(t, *items, 2, "Should return items with zero size")
 }
+
+// TestCreateNotificationTarget tests that targets keep their enabled flag.
+func TestCreateNotificationTarget(t *testing.T) {
+	database := SetupTestDB(t)
+	defer TeardownTestDB(t, database)
+
+	originalDB := DB
+	DB = database
+	defer func() { DB = originalDB }()
+
+	require.NoError(t, CreateNotificationTarget(&NotificationTarget{Name: "on", Kind: "webhook", Enabled: true}))
+	require.NoError(t, CreateNotificationTarget(&NotificationTarget{Name: "off", Kind: "webhook", Enabled: false}))
+
+	all, err := GetAllNotificationTargets()
+	require.NoError(t, err)
+	assert.Len(t, *all, 2)
+
+	enabled, err := GetEnabledNotificationTargets()
+	require.NoError(t, err)
+	require.Len(t, *enabled, 1, "Disabled target should be stored as disabled")
+	assert.Equal(t, "on", (*enabled)[0].Name)
+}
+
+// TestMarkNotificationAlertSent tests that a failure alert is recorded once
+// until it is cleared.
+func TestMarkNotificationAlertSent(t *testing.T) {
+	database := SetupTestDB(t)
+	defer TeardownTestDB(t, database)
+
+	originalDB := DB
+	DB = database
+	defer func() { DB = originalDB }()
+
+	sent, err := MarkNotificationAlertSent("target", "feed_dead", "podcast")
+	require.NoError(t, err)
+	assert.True(t, sent)
+
+	sent, err = MarkNotificationAlertSent("target", "feed_dead", "podcast")
+	require.NoError(t, err)
+	assert.False(t, sent, "Alert should only be sent once")
+
+	sent, err = MarkNotificationAlertSent("other", "feed_dead", "podcast")
+	require.NoError(t, err)
+	assert.True(t, sent, "Each target should be alerted")
+
+	require.NoError(t, ClearNotificationAlerts("feed_dead", "podcast"))
+	sent, err = MarkNotificationAlertSent("target", "feed_dead", "podcast")
+	require.NoError(t, err)
+	assert.True(t, sent, "Cleared alert should be sent again")
+}
+
+// TestMergePodcastItem tests moving a changed feed entry into an episode and
+// recording the change.
+func TestMergePodcastItem(t *testing.T) {
+	database := SetupTestDB(t)
+	defer TeardownTestDB(t, database)
+
+	originalDB := DB
+	DB = database
+	defer func() { DB = originalDB }()
+
+	podcast := CreateTestPodcast(t, database)
+	item := CreateTestPodcastItem(t, database, podcast.ID, &PodcastItem{
+		GUID:           "old-guid",
+		FileURL:        "https://old.example.com/episode.mp3",
+		DownloadStatus: Downloaded,
+		DownloadPath:   "/assets/episode.mp3",
+	})
+
+	merged := *item
+	merged.GUID = "new-guid"
+	merged.FileURL = "https://new.example.com/episode.mp3"
+	require.NoError(t, MergePodcastItem(&merged, &PodcastItemHistory{
+		OldGUID: "old-guid", NewGUID: "new-guid", MatchedBy: "title_date",
+	}))
+
+	var stored PodcastItem
+	require.NoError(t, database.First(&stored, "id = ?", item.ID).Error)
+	assert.Equal(t, "new-guid", stored.GUID)
+	assert.Equal(t, "https://new.example.com/episode.mp3", stored.FileURL)
+	assert.Equal(t, Downloaded, stored.DownloadStatus, "The download should be kept")
+	assert.Equal(t, "/assets/episode.mp3", stored.DownloadPath)
+
+	history, err := GetPodcastItemHistory(item.ID)
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	assert.Equal(t, "old-guid", history[0].OldGUID)
+	assert.Equal(t, "title_date", history[0].MatchedBy)
+
+	require.NoError(t, DeletePodcastByID(podcast.ID))
+	history, err = GetPodcastItemHistory(item.ID)
+	require.NoError(t, err)
+	assert.Empty(t, history, "History should be deleted with the podcast")
+}
+
+// TestUpdateRemovedUpstream tests flagging episodes missing from their feed.
+func TestUpdateRemovedUpstream(t *testing.T) {
+	database := SetupTestDB(t)
+	defer TeardownTestDB(t, database)
+
+	originalDB := DB
+	DB = database
+	defer func() { DB = originalDB }()
+
+	podcast := CreateTestPodcast(t, database)
+	other := CreateTestPodcast(t, database, &Podcast{URL: "https://example.com/other.xml"})
+	listed := CreateTestPodcastItem(t, database, podcast.ID, &PodcastItem{GUID: "listed"})
+	missing := CreateTestPodcastItem(t, database, podcast.ID, &PodcastItem{GUID: "missing"})
+	otherItem := CreateTestPodcastItem(t, database, other.ID, &PodcastItem{GUID: "elsewhere"})
+
+	removed, err := UpdateRemovedUpstream(podcast.ID, []string{"listed"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), removed)
+	removed, err = UpdateRemovedUpstream(podcast.ID, []string{"listed"})
+	require.NoError(t, err)
+	assert.Zero(t, removed, "Flagged episodes should not be counted again")
+
+	removedAt := func(id string) *time.Time {
+		var stored PodcastItem
+		require.NoError(t, database.First(&stored, "id = ?", id).Error)
+		return stored.RemovedUpstreamAt
+	}
+	assert.NotNil(t, removedAt(missing.ID))
+	assert.Nil(t, removedAt(listed.ID))
+	assert.Nil(t, removedAt(otherItem.ID), "Other podcasts should not be touched")
+
+	queue, err := GetAllPodcastItemsToBeDownloaded()
+	require.NoError(t, err)
+	for _, item := range *queue {
+		assert.NotEqual(t, missing.ID, item.ID, "Removed episodes should not be queued")
+	}
+
+	_, err = UpdateRemovedUpstream(podcast.ID, []string{"listed", "missing"})
+	require.NoError(t, err)
+	assert.Nil(t, removedAt(missing.ID), "Returning episodes should be unflagged")
+}
+
+// TestUpdatePodcastItemsByIDs tests updating episodes across batches.
+func TestUpdatePodcastItemsByIDs(t *testing.T) {
+	database := SetupTestDB(t)
+	defer TeardownTestDB(t, database)
+
+	originalDB := DB
+	DB = database
+	defer func() { DB = originalDB }()
+
+	podcast := CreateTestPodcast(t, database)
+	untouched := CreateTestPodcastItem(t, database, podcast.ID)
+	ids := make([]string, 0, bulkUpdateBatchSize+1)
+	for range bulkUpdateBatchSize + 1 {
+		ids = append(ids, CreateTestPodcastItem(t, database, podcast.ID).ID)
+	}
+
+	require.NoError(t, UpdatePodcastItemsByIDs(ids, map[string]interface{}{"is_played": true}))
+
+	var played int64
+	require.NoError(t, database.Model(&PodcastItem{}).Where("is_played = ?", true).Count(&played).Error)
+	assert.Equal(t, int64(len(ids)), played)
+	var stored PodcastItem
+	require.NoError(t, database.First(&stored, "id = ?", untouched.ID).Error)
+	assert.False(t, stored.IsPlayed, "Unselected episodes should not be updated")
+
+	require.NoError(t, UpdatePodcastItemsByIDs(nil, map[string]interface{}{"is_played": false}))
+}
+
+// TestUpdatePodcastFolder tests renaming a podcast's folder and moving its
+// episodes' files.
+func TestUpdatePodcastFolder(t *testing.T) {
+	database := SetupTestDB(t)
+	defer TeardownTestDB(t, database)
+
+	originalDB := DB
+	DB = database
+	defer func() { DB = originalDB }()
+
+	podcast := CreateTestPodcast(t, database, &Podcast{Title: "Émission"})
+	other := CreateTestPodcast(t, database, &Podcast{URL: "https://example.com/other.xml"})
+	moved := CreateTestPodcastItem(t, database, podcast.ID, &PodcastItem{DownloadPath: "/data/Émission/episode.mp3"})
+	require.NoError(t, database.Model(moved).Update("local_image", "/data/Émission/images/episode.jpg").Error)
+	outside := CreateTestPodcastItem(t, database, podcast.ID, &PodcastItem{DownloadPath: "/data/Émission-old/episode.mp3"})
+	otherItem := CreateTestPodcastItem(t, database, other.ID, &PodcastItem{DownloadPath: "/data/Émission/other.mp3"})
+
+	folder, err := GetPodcastDataFolder(podcast.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Émission", folder, "Podcasts without a folder should use their title")
+
+	require.NoError(t, UpdatePodcastFolder(podcast.ID, "Show", "/data/Émission", "/data/Show"))
+
+	folder, err = GetPodcastDataFolder(podcast.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Show", folder)
+	stored := func(id string) PodcastItem {
+		var item PodcastItem
+		require.NoError(t, database.First(&item, "id = ?", id).Error)
+		return item
+	}
+	assert.Equal(t, "/data/Show/episode.mp3", stored(moved.ID).DownloadPath)
+	assert.Equal(t, "/data/Show/images/episode.jpg", stored(moved.ID).LocalImage)
+	assert.Equal(t, "/data/Émission-old/episode.mp3", stored(outside.ID).DownloadPath, "Only files in the folder should move")
+	assert.Equal(t, "/data/Émission/other.mp3", stored(otherItem.ID).DownloadPath, "Other podcasts should not be touched")
+}
+
+// TestUpdatePodcastFolder_LocalPath tests that moving the folder of a local
+// podcast moves the folder its episodes are scanned from.
+func TestUpdatePodcastFolder_LocalPath(t *testing.T) {
+	database := SetupTestDB(t)
+	defer TeardownTestDB(t, database)
+
+	originalDB := DB
+	DB = database
+	defer func() { DB = originalDB }()
+
+	local := func(title, localPath string) *Podcast {
+		podcast := CreateTestPodcast(t, database, &Podcast{Title: title, URL: "local:" + title})
+		require.NoError(t, database.Model(podcast).Updates(map[string]interface{}{"is_local": true, "local_path": localPath}).Error)
+		return podcast
+	}
+	localPath := func(podcast *Podcast) string {
+		var stored Podcast
+		require.NoError(t, database.First(&stored, "id = ?", podcast.ID).Error)
+		return stored.LocalPath
+	}
+	folder := local("Émission", "/data/Émission")
+	subfolder := local("Recordings", "/data/Émission/recordings")
+	sibling := local("Old", "/data/Émission-old")
+
+	for _, podcast := range []*Podcast{folder, subfolder, sibling} {
+		require.NoError(t, UpdatePodcastFolder(podcast.ID, "Show", "/data/Émission", "/data/Show"))
+	}
+
+	assert.Equal(t, "/data/Show", localPath(folder))
+	assert.Equal(t, "/data/Show/recordings", localPath(subfolder))
+	assert.Equal(t, "/data/Émission-old", localPath(sibling), "Only folders in the moved folder should move")
+}
+
+// TestPlaylistEpisodes tests arranging the episodes of playlists and the up
+// next queue, and that deleting episodes and playlists removes their items.
+func TestPlaylistEpisodes(t *testing.T) {
+	database := SetupTestDB(t)
+	defer TeardownTestDB(t, database)
+
+	originalDB := DB
+	DB = database
+	defer func() { DB = originalDB }()
+
+	podcast := CreateTestPodcast(t, database)
+	first := CreateTestPodcastItem(t, database, podcast.ID, &PodcastItem{Title: "First"})
+	second := CreateTestPodcastItem(t, database, podcast.ID, &PodcastItem{Title: "Second"})
+	third := CreateTestPodcastItem(t, database, podcast.ID, &PodcastItem{Title: "Third"})
+	playlist := &Playlist{Name: "Favorites"}
+	require.NoError(t, CreatePlaylist(playlist))
+	titles := func(playlistID string) []string {
+		items, err := GetPlaylistEpisodes(playlistID)
+		require.NoError(t, err)
+		var titles []string
+		for i := range items {
+			assert.Equal(t, podcast.Title, items[i].Podcast.Title, "Episodes should come with their podcast")
+			titles = append(titles, items[i].Title)
+		}
+		return titles
+	}
+
+	require.NoError(t, SetPlaylistEpisodes(playlist.ID, []string{third.ID, first.ID, second.ID}))
+	require.NoError(t, SetPlaylistEpisodes(QueuePlaylistID, []string{second.ID}))
+	assert.Equal(t, []string{"Third", "First", "Second"}, titles(playlist.ID))
+	assert.Equal(t, []string{"Second"}, titles(QueuePlaylistID), "The queue should be kept apart from playlists")
+
+	require.NoError(t, SetPlaylistEpisodes(playlist.ID, []string{first.ID, third.ID}))
+	assert.Equal(t, []string{"First", "Third"}, titles(playlist.ID))
+	playlists, err := GetAllPlaylists()
+	require.NoError(t, err)
+	require.Len(t, *playlists, 1)
+	assert.Equal(t, 2, (*playlists)[0].EpisodesCount)
+
+	added, err := AddPlaylistEpisodes(playlist.ID, []string{second.ID, first.ID}, false)
+	require.NoError(t, err)
+	assert.Equal(t, 1, added, "Episodes already listed should not be added again")
+	assert.Equal(t, []string{"First", "Third", "Second"}, titles(playlist.ID))
+	require.NoError(t, RemovePlaylistEpisode(playlist.ID, third.ID))
+	added, err = AddPlaylistEpisodes(playlist.ID, []string{third.ID}, false)
+	require.NoError(t, err)
+	assert.Equal(t, 1, added)
+	assert.Equal(t, []string{"First", "Second", "Third"}, titles(playlist.ID), "Episodes should go after the last one")
+	added, err = AddPlaylistEpisodes(playlist.ID, []string{third.ID}, true)
+	require.NoError(t, err)
+	assert.Zero(t, added)
+	assert.Equal(t, []string{"First", "Second", "Third"}, titles(playlist.ID), "Listed episodes should keep their position")
+	require.NoError(t, SetPlaylistEpisodes(playlist.ID, []string{first.ID, third.ID}))
+
+	require.NoError(t, RemovePlaylistEpisode(playlist.ID, first.ID))
+	assert.ErrorIs(t, RemovePlaylistEpisode(playlist.ID, first.ID), gorm.ErrRecordNotFound)
+	require.NoError(t, DeletePodcastItemByID(second.ID))
+	assert.Equal(t, []string{"Third"}, titles(playlist.ID))
+	assert.Empty(t, titles(QueuePlaylistID), "Deleted episodes should leave the queue")
+
+	require.NoError(t, DeletePlaylistByID(playlist.ID))
+	var remaining int64
+	require.NoError(t, database.Model(&PlaylistItem{}).Count(&remaining).Error)
+	assert.Zero(t, remaining, "Deleting a playlist should delete its items")
+}
+
+// TestGetFilteredPodcastItems tests paging through the episodes a filter
+// selects.
+func TestGetFilteredPodcastItems(t *testing.T) {
+	database := SetupTestDB(t)
+	defer TeardownTestDB(t, database)
+
+	originalDB := DB
+	DB = database
+	defer func() { DB = originalDB }()
+
+	podcast := CreateTestPodcast(t, database)
+	other := CreateTestPodcast(t, database, &Podcast{Title: "Other", URL: "https://example.com/other.xml"})
+	now := time.Now()
+	for i, title := range []string{"First", "Second", "Third"} {
+		CreateTestPodcastItem(t, database, podcast.ID, &PodcastItem{Title: title, PubDate: now.Add(time.Duration(i) * time.Hour)})
+	}
+	CreateTestPodcastItem(t, database, other.ID, &PodcastItem{Title: "Elsewhere"})
+	titles := func(offset, limit int) []string {
+		items, err := GetFilteredPodcastItems(&model.EpisodesFilter{PodcastIDs: []string{podcast.ID}, Sorting: model.ReleaseAsc}, offset, limit)
+		require.NoError(t, err)
+		var titles []string
+		for i := range *items {
+			assert.Equal(t, podcast.Title, (*items)[i].Podcast.Title, "Episodes should come with their podcast")
+			titles = append(titles, (*items)[i].Title)
+		}
+		return titles
+	}
+
+	assert.Equal(t, []string{"First", "Second", "Third"}, titles(0, 0))
+	assert.Equal(t, []string{"First", "Second"}, titles(0, 2))
+	assert.Equal(t, []string{"Third"}, titles(2, 2))
+	assert.Empty(t, titles(4, 2))
+}
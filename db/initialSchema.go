@@ -0,0 +1,87 @@
+package db
+
+import "time"
+
+// The structs below freeze the schema created by the first migration, so a
+// new database is built by the same steps as one migrated from that release.
+// They must not change; later columns and tables belong to new migrations.
+
+type initialPodcast struct {
+	Base
+	Title        string
+	Summary      string `gorm:"type:text"`
+	Author       string
+	Image        string
+	URL          string
+	LastEpisode  *time.Time
+	PodcastItems []initialPodcastItem `gorm:"foreignKey:PodcastID"`
+	IsPaused     bool                 `gorm:"default:false"`
+}
+
+func (initialPodcast) TableName() string { return "podcasts" }
+
+type initialPodcastItem struct {
+	Base
+	PubDate        time.Time
+	BookmarkDate   time.Time
+	DownloadDate   time.Time
+	FileURL        string
+	PodcastID      string
+	LocalImage     string
+	Summary        string `gorm:"type:text"`
+	Title          string
+	GUID           string
+	Image          string
+	EpisodeType    string
+	DownloadPath   string
+	DownloadStatus DownloadStatus `gorm:"default:0"`
+	Duration       int
+	FileSize       int64
+	IsPlayed       bool `gorm:"default:false"`
+}
+
+func (initialPodcastItem) TableName() string { return "podcast_items" }
+
+type initialSetting struct {
+	Base
+	UserAgent                     string
+	BaseURL                       string
+	InitialDownloadCount          int  `gorm:"default:5"`
+	MaxDownloadConcurrency        int  `gorm:"default:5"`
+	DarkMode                      bool `gorm:"default:false"`
+	AppendEpisodeNumberToFileName bool `gorm:"default:false"`
+	DownloadEpisodeImages         bool `gorm:"default:false"`
+	GenerateNFOFile               bool `gorm:"default:false"`
+	DontDownloadDeletedFromDisk   bool `gorm:"default:false"`
+	AppendDateToFileName          bool `gorm:"default:false"`
+	AutoDownload                  bool `gorm:"default:true"`
+	DownloadOnAdd                 bool `gorm:"default:true"`
+}
+
+func (initialSetting) TableName() string { return "settings" }
+
+type initialJobLock struct {
+	Base
+	Date     time.Time
+	Name     string
+	Duration int
+}
+
+func (initialJobLock) TableName() string { return "job_locks" }
+
+type initialTag struct {
+	Base
+	Label       string
+	Description string `gorm:"type:text"`
+}
+
+func (initialTag) TableName() string { return "tags" }
+
+type initialPodcastTag struct {
+	TagID     string `gorm:"primaryKey"`
+	PodcastID string `gorm:"primaryKey"`
+	Tag       initialTag
+	Podcast   initialPodcast
+}
+
+func (initialPodcastTag) TableName() string { return "podcast_tags" }
@@ -0,0 +1,216 @@
+package db
+
+import "time"
+
+// The structs below freeze the tables and columns added by the migrations
+// after the first, named after the migration that adds them, so that changing
+// a model never changes what an earlier migration creates. They must not
+// change; a changed column belongs to a new migration with its own structs.
+
+type v3Podcast struct {
+	LastFeedSuccess  *time.Time
+	LastFeedError    string
+	FeedFailureCount int `gorm:"default:0"`
+}
+
+func (v3Podcast) TableName() string { return "podcasts" }
+
+type v3PodcastItem struct {
+	DownloadFailureCount int `gorm:"default:0"`
+}
+
+func (v3PodcastItem) TableName() string { return "podcast_items" }
+
+type v3NotificationTarget struct {
+	Base
+	Name             string
+	Kind             string
+	URL              string
+	Token            string
+	Username         string
+	Password         string
+	From             string
+	To               string
+	Events           string
+	PodcastIDs       string
+	TagIDs           string
+	FailureThreshold int
+	Enabled          bool
+}
+
+func (v3NotificationTarget) TableName() string { return "notification_targets" }
+
+type v3NotificationDelivery struct {
+	Base
+	NextAttemptAt        time.Time
+	DeliveredAt          *time.Time
+	NotificationTarget   v3NotificationTarget
+	NotificationTargetID string `gorm:"index"`
+	Event                string
+	Title                string
+	Message              string `gorm:"type:text"`
+	Payload              string `gorm:"type:text"`
+	Status               string
+	LastError            string
+	Attempts             int
+}
+
+func (v3NotificationDelivery) TableName() string { return "notification_deliveries" }
+
+type v4JobLock struct {
+	LeaseUntil time.Time
+	Owner      string
+}
+
+func (v4JobLock) TableName() string { return "job_locks" }
+
+type v4JobSchedule struct {
+	Base
+	Name     string `gorm:"uniqueIndex"`
+	Schedule string
+	Disabled bool
+}
+
+func (v4JobSchedule) TableName() string { return "job_schedules" }
+
+type v4JobRun struct {
+	Base
+	StartedAt  time.Time
+	FinishedAt *time.Time
+	Name       string `gorm:"index"`
+	Trigger    string
+	Status     string
+	Error      string `gorm:"type:text"`
+	DurationMs int64
+}
+
+func (v4JobRun) TableName() string { return "job_runs" }
+
+type v5Setting struct {
+	DownloadWindowStart string
+	DownloadWindowEnd   string
+	MaxDownloadRate     int
+	MaxHostDownloadRate int
+	MeteredConnection   bool
+}
+
+func (v5Setting) TableName() string { return "settings" }
+
+type v6Setting struct {
+	HostConnections       int
+	HostRequestsPerMinute int
+}
+
+func (v6Setting) TableName() string { return "settings" }
+
+type v6Podcast struct {
+	LastFeedThrottled *time.Time
+	FeedThrottleCount int
+}
+
+func (v6Podcast) TableName() string { return "podcasts" }
+
+type v7Podcast struct {
+	FeedAuth string
+}
+
+func (v7Podcast) TableName() string { return "podcasts" }
+
+type v8Setting struct {
+	DedupSensitivity string
+}
+
+func (v8Setting) TableName() string { return "settings" }
+
+type v8PodcastItemHistory struct {
+	Base
+	PodcastItemID string `gorm:"index"`
+	OldGUID       string
+	NewGUID       string
+	OldFileURL    string
+	NewFileURL    string
+	MatchedBy     string
+}
+
+func (v8PodcastItemHistory) TableName() string { return "podcast_item_histories" }
+
+type v9Setting struct {
+	RedownloadChangedEnclosures bool
+}
+
+func (v9Setting) TableName() string { return "settings" }
+
+type v9PodcastItem struct {
+	Fingerprint       string
+	RemovedUpstreamAt *time.Time
+}
+
+func (v9PodcastItem) TableName() string { return "podcast_items" }
+
+type v10Podcast struct {
+	FeedTitle       string
+	FeedSummary     string `gorm:"type:text"`
+	FeedAuthor      string
+	FeedImage       string
+	TitleOverride   string
+	SummaryOverride string `gorm:"type:text"`
+	AuthorOverride  string
+	ImageOverride   string
+	Folder          string
+}
+
+func (v10Podcast) TableName() string { return "podcasts" }
+
+type v11SmartPlaylist struct {
+	Base
+	IsPlayed     *bool
+	IsDownloaded *bool
+	Name         string
+	Sorting      string
+	PodcastIDs   string
+	TagIDs       string
+	MaxAgeDays   int
+	MinDuration  int
+	MaxDuration  int
+	Limit        int
+}
+
+func (v11SmartPlaylist) TableName() string { return "smart_playlists" }
+
+type v12Playlist struct {
+	Base
+	Name string
+}
+
+func (v12Playlist) TableName() string { return "playlists" }
+
+type v12PlaylistItem struct {
+	Base
+	PlaylistID    string `gorm:"index"`
+	PodcastItemID string `gorm:"index"`
+	Position      int
+}
+
+func (v12PlaylistItem) TableName() string { return "playlist_items" }
+
+type v13Setting struct {
+	WritePlaylistFiles bool
+}
+
+func (v13Setting) TableName() string { return "settings" }
+
+type v14Podcast struct {
+	LocalPath string
+	IsLocal   bool `gorm:"default:false"`
+}
+
+func (v14Podcast) TableName() string { return "podcasts" }
+
+type v15NotificationAlert struct {
+	Base
+	NotificationTargetID string `gorm:"uniqueIndex:idx_notification_alert"`
+	Event                string `gorm:"uniqueIndex:idx_notification_alert"`
+	SubjectID            string `gorm:"uniqueIndex:idx_notification_alert"`
+}
+
+func (v15NotificationAlert) TableName() string { return "notification_alerts" }
@@ -3,31 +3,473 @@ package db
 
 import (
 	"errors"
+	"fmt"
+	"sort"
 	"time"
 
 	"github.com/akhilrex/podgrab/internal/logger"
+	"github.com/akhilrex/podgrab/model"
 	"gorm.io/gorm"
 )
 
+// localMigration is a single numbered schema change. Query/DownQuery cover
+// plain SQL migrations, Up/Down cover migrations that need GORM's migrator.
+// A migration without any down step is irreversible.
 type localMigration struct {
-	Name  string
-	Query string
+	Version   int
+	Name      string
+	Query     string
+	DownQuery string
+	Up        func(tx *gorm.DB) error
+	Down      func(tx *gorm.DB) error
+}
+
+// MigrationStatus describes whether a known migration has been applied and
+// whether it can be rolled back.
+type MigrationStatus struct {
+	AppliedAt  time.Time
+	Name       string
+	Version    int
+	Applied    bool
+	Reversible bool
 }
 
 var migrations = []localMigration{
 	{
-		Name:  "2020_11_03_04_42_SetDefaultDownloadStatus",
-		Query: "update podcast_items set download_status=2 where download_path!='' and download_status=0",
+		// The initial schema is irreversible: rolling it back would drop
+		// every table and the data in them.
+		Version: 1,
+		Name:    "2020_10_01_00_00_InitialSchema",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&initialPodcast{}, &initialPodcastItem{}, &initialSetting{}, &initialJobLock{}, &initialTag{}, &initialPodcastTag{})
+		},
+	},
+	{
+		Version: 2,
+		Name:    "2020_11_03_04_42_SetDefaultDownloadStatus",
+		Query:   "update podcast_items set download_status=2 where download_path!='' and download_status=0",
+		Down:    noopMigration,
+	},
+	{
+		Version: 3,
+		Name:    "2024_06_01_00_00_AddNotifications",
+		Up: func(tx *gorm.DB) error {
+			if err := addColumns(tx, &v3Podcast{}, "LastFeedSuccess", "LastFeedError", "FeedFailureCount"); err != nil {
+				return err
+			}
+			if err := addColumns(tx, &v3PodcastItem{}, "DownloadFailureCount"); err != nil {
+				return err
+			}
+			return tx.AutoMigrate(&v3NotificationTarget{}, &v3NotificationDelivery{})
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Migrator().DropTable(&v3NotificationDelivery{}, &v3NotificationTarget{}); err != nil {
+				return err
+			}
+			if err := dropColumns(tx, &v3PodcastItem{}, "DownloadFailureCount"); err != nil {
+				return err
+			}
+			return dropColumns(tx, &v3Podcast{}, "LastFeedSuccess", "LastFeedError", "FeedFailureCount")
+		},
+	},
+	{
+		Version: 4,
+		Name:    "2024_07_01_00_00_AddJobScheduler",
+		Up: func(tx *gorm.DB) error {
+			if err := addColumns(tx, &v4JobLock{}, "LeaseUntil", "Owner"); err != nil {
+				return err
+			}
+			return tx.AutoMigrate(&v4JobSchedule{}, &v4JobRun{})
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Migrator().DropTable(&v4JobRun{}, &v4JobSchedule{}); err != nil {
+				return err
+			}
+			return dropColumns(tx, &v4JobLock{}, "LeaseUntil", "Owner")
+		},
+	},
+	{
+		Version: 5,
+		Name:    "2024_08_01_00_00_AddDownloadLimits",
+		Up: func(tx *gorm.DB) error {
+			return addColumns(tx, &v5Setting{}, downloadLimitColumns...)
+		},
+		Down: func(tx *gorm.DB) error {
+			return dropColumns(tx, &v5Setting{}, downloadLimitColumns...)
+		},
+	},
+	{
+		Version: 6,
+		Name:    "2024_09_01_00_00_AddHostPoliteness",
+		Up: func(tx *gorm.DB) error {
+			if err := addColumns(tx, &v6Setting{}, "HostConnections", "HostRequestsPerMinute"); err != nil {
+				return err
+			}
+			return addColumns(tx, &v6Podcast{}, "LastFeedThrottled", "FeedThrottleCount")
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := dropColumns(tx, &v6Podcast{}, "LastFeedThrottled", "FeedThrottleCount"); err != nil {
+				return err
+			}
+			return dropColumns(tx, &v6Setting{}, "HostConnections", "HostRequestsPerMinute")
+		},
+	},
+	{
+		Version: 7,
+		Name:    "2024_10_01_00_00_AddFeedAuth",
+		Up: func(tx *gorm.DB) error {
+			return addColumns(tx, &v7Podcast{}, "FeedAuth")
+		},
+		Down: func(tx *gorm.DB) error {
+			return dropColumns(tx, &v7Podcast{}, "FeedAuth")
+		},
+	},
+	{
+		Version: 8,
+		Name:    "2024_11_01_00_00_AddEpisodeDedup",
+		Up: func(tx *gorm.DB) error {
+			if err := addColumns(tx, &v8Setting{}, "DedupSensitivity"); err != nil {
+				return err
+			}
+			return tx.AutoMigrate(&v8PodcastItemHistory{})
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Migrator().DropTable(&v8PodcastItemHistory{}); err != nil {
+				return err
+			}
+			return dropColumns(tx, &v8Setting{}, "DedupSensitivity")
+		},
+	},
+	{
+		Version: 9,
+		Name:    "2024_12_01_00_00_TrackFeedChanges",
+		Up: func(tx *gorm.DB) error {
+			if err := addColumns(tx, &v9Setting{}, "RedownloadChangedEnclosures"); err != nil {
+				return err
+			}
+			return addColumns(tx, &v9PodcastItem{}, "Fingerprint", "RemovedUpstreamAt")
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := dropColumns(tx, &v9PodcastItem{}, "Fingerprint", "RemovedUpstreamAt"); err != nil {
+				return err
+			}
+			return dropColumns(tx, &v9Setting{}, "RedownloadChangedEnclosures")
+		},
+	},
+	{
+		Version: 10,
+		Name:    "2025_01_01_00_00_AddPodcastOverrides",
+		Up: func(tx *gorm.DB) error {
+			if err := addColumns(tx, &v10Podcast{}, podcastOverrideColumns...); err != nil {
+				return err
+			}
+			return tx.Exec("UPDATE podcasts SET feed_title = title, feed_summary = summary, " +
+				"feed_author = author, feed_image = image, folder = title").Error
+		},
+		Down: func(tx *gorm.DB) error {
+			return dropColumns(tx, &v10Podcast{}, podcastOverrideColumns...)
+		},
+	},
+	{
+		Version: 11,
+		Name:    "2025_02_01_00_00_AddSmartPlaylists",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&v11SmartPlaylist{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&v11SmartPlaylist{})
+		},
+	},
+	{
+		Version: 12,
+		Name:    "2025_03_01_00_00_AddPlaylistsAndQueue",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&v12Playlist{}, &v12PlaylistItem{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&v12PlaylistItem{}, &v12Playlist{})
+		},
+	},
+	{
+		Version: 13,
+		Name:    "2025_04_01_00_00_AddPlaylistFilesSetting",
+		Up: func(tx *gorm.DB) error {
+			return addColumns(tx, &v13Setting{}, "WritePlaylistFiles")
+		},
+		Down: func(tx *gorm.DB) error {
+			return dropColumns(tx, &v13Setting{}, "WritePlaylistFiles")
+		},
+	},
+	{
+		Version: 14,
+		Name:    "2025_05_01_00_00_AddLocalPodcasts",
+		Up: func(tx *gorm.DB) error {
+			return addColumns(tx, &v14Podcast{}, "IsLocal", "LocalPath")
+		},
+		Down: func(tx *gorm.DB) error {
+			return dropColumns(tx, &v14Podcast{}, "IsLocal", "LocalPath")
+		},
+	},
+	{
+		Version: 15,
+		Name:    "2025_06_01_00_00_AddNotificationAlerts",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&v15NotificationAlert{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&v15NotificationAlert{})
+		},
 	},
 }
 
-// RunMigrations run migrations.
-func RunMigrations() {
-	for _, mig := range migrations {
-		if err := ExecuteAndSaveMigration(mig.Name, mig.Query); err != nil {
-			logger.Log.Warnw("migration '%s' failed", "error", mig.Name, err)
+var podcastOverrideColumns = []string{
+	"FeedTitle", "FeedSummary", "FeedAuthor", "FeedImage",
+	"TitleOverride", "SummaryOverride", "AuthorOverride", "ImageOverride", "Folder",
+}
+
+var downloadLimitColumns = []string{
+	"DownloadWindowStart", "DownloadWindowEnd", "MaxDownloadRate", "MaxHostDownloadRate", "MeteredConnection",
+}
+
+// noopMigration is used as the down step of data fixes that have nothing to undo.
+func noopMigration(_ *gorm.DB) error {
+	return nil
+}
+
+// addColumns adds the named fields of model that do not exist yet.
+func addColumns(tx *gorm.DB, model interface{}, fields ...string) error {
+	for _, field := range fields {
+		if tx.Migrator().HasColumn(model, field) {
+			continue
+		}
+		if err := tx.Migrator().AddColumn(model, field); err != nil {
+			return err
 		}
 	}
+	return nil
+}
+
+// dropColumns drops the named fields of model that exist.
+func dropColumns(tx *gorm.DB, model interface{}, fields ...string) error {
+	for _, field := range fields {
+		if !tx.Migrator().HasColumn(model, field) {
+			continue
+		}
+		if err := tx.Migrator().DropColumn(model, field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (mig *localMigration) up(tx *gorm.DB) error {
+	if mig.Up != nil {
+		return mig.Up(tx)
+	}
+	logger.Log.Debug(mig.Query)
+	return tx.Exec(mig.Query).Error
+}
+
+// reversible reports whether the migration has a down step.
+func (mig *localMigration) reversible() bool {
+	return mig.Down != nil || mig.DownQuery != ""
+}
+
+func (mig *localMigration) down(tx *gorm.DB) error {
+	if mig.Down != nil {
+		return mig.Down(tx)
+	}
+	if mig.DownQuery != "" {
+		logger.Log.Debug(mig.DownQuery)
+		return tx.Exec(mig.DownQuery).Error
+	}
+	return fmt.Errorf("migration %d (%s) is irreversible", mig.Version, mig.Name)
+}
+
+// sortedMigrations returns the known migrations ordered by version.
+func sortedMigrations() []localMigration {
+	sorted := make([]localMigration, len(migrations))
+	copy(sorted, migrations)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Version < sorted[j].Version
+	})
+	return sorted
+}
+
+// LatestSchemaVersion returns the highest migration version this build knows about.
+func LatestSchemaVersion() int {
+	latest := 0
+	for i := range migrations {
+		if migrations[i].Version > latest {
+			latest = migrations[i].Version
+		}
+	}
+	return latest
+}
+
+// appliedMigrations returns applied migrations keyed by version. Records
+// written before migrations were numbered are matched by name and backfilled.
+func appliedMigrations() (map[int]Migration, error) {
+	var records []Migration
+	if err := DB.Find(&records).Error; err != nil {
+		return nil, err
+	}
+
+	byName := make(map[string]int, len(migrations))
+	for i := range migrations {
+		byName[migrations[i].Name] = migrations[i].Version
+	}
+
+	applied := make(map[int]Migration, len(records))
+	for i := range records {
+		if records[i].Version == 0 {
+			version, known := byName[records[i].Name]
+			if !known {
+				continue
+			}
+			records[i].Version = version
+			if err := DB.Model(&Migration{}).Where("id = ?", records[i].ID).Update("version", version).Error; err != nil {
+				return nil, err
+			}
+		}
+		applied[records[i].Version] = records[i]
+	}
+	return applied, nil
+}
+
+// GetSchemaVersion returns the highest applied migration version.
+func GetSchemaVersion() (int, error) {
+	applied, err := appliedMigrations()
+	if err != nil {
+		return 0, err
+	}
+	current := 0
+	for version := range applied {
+		if version > current {
+			current = version
+		}
+	}
+	return current, nil
+}
+
+// CheckSchemaVersion refuses to continue when the database was migrated by a
+// newer build than this one.
+func CheckSchemaVersion() error {
+	current, err := GetSchemaVersion()
+	if err != nil {
+		return err
+	}
+	if latest := LatestSchemaVersion(); current > latest {
+		return &model.SchemaVersionError{Current: current, Supported: latest}
+	}
+	return nil
+}
+
+// GetMigrationStatus lists every known migration and whether it has been applied.
+func GetMigrationStatus() ([]MigrationStatus, error) {
+	applied, err := appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+	sorted := sortedMigrations()
+	statuses := make([]MigrationStatus, 0, len(sorted))
+	for i := range sorted {
+		record, ok := applied[sorted[i].Version]
+		statuses = append(statuses, MigrationStatus{
+			Version:    sorted[i].Version,
+			Name:       sorted[i].Name,
+			Applied:    ok,
+			AppliedAt:  record.Date,
+			Reversible: sorted[i].reversible(),
+		})
+	}
+	return statuses, nil
+}
+
+// RunMigrations applies every pending migration in version order.
+func RunMigrations() error {
+	return MigrateTo(LatestSchemaVersion())
+}
+
+// MigrateTo migrates the schema up or down until target is the highest applied version.
+func MigrateTo(target int) error {
+	if target < 0 || target > LatestSchemaVersion() {
+		return fmt.Errorf("unknown schema version %d", target)
+	}
+	applied, err := appliedMigrations()
+	if err != nil {
+		return err
+	}
+
+	sorted := sortedMigrations()
+	for i := range sorted {
+		if _, ok := applied[sorted[i].Version]; ok || sorted[i].Version > target {
+			continue
+		}
+		if err := applyMigration(&sorted[i]); err != nil {
+			return err
+		}
+	}
+	for i := len(sorted) - 1; i >= 0; i-- {
+		if _, ok := applied[sorted[i].Version]; !ok || sorted[i].Version <= target {
+			continue
+		}
+		if err := revertMigration(&sorted[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RollbackMigrations reverts the most recent steps applied migrations.
+func RollbackMigrations(steps int) error {
+	applied, err := appliedMigrations()
+	if err != nil {
+		return err
+	}
+	sorted := sortedMigrations()
+	for i := len(sorted) - 1; i >= 0 && steps > 0; i-- {
+		if _, ok := applied[sorted[i].Version]; !ok {
+			continue
+		}
+		if err := revertMigration(&sorted[i]); err != nil {
+			return err
+		}
+		steps--
+	}
+	return nil
+}
+
+func applyMigration(mig *localMigration) error {
+	logger.Log.Infow("Applying migration", "version", mig.Version, "name", mig.Name)
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := mig.up(tx); err != nil {
+			return err
+		}
+		return tx.Create(&Migration{
+			Date:    time.Now(),
+			Name:    mig.Name,
+			Version: mig.Version,
+		}).Error
+	})
+	if err != nil {
+		return fmt.Errorf("migration %d (%s) failed: %w", mig.Version, mig.Name, err)
+	}
+	return nil
+}
+
+func revertMigration(mig *localMigration) error {
+	logger.Log.Infow("Reverting migration", "version", mig.Version, "name", mig.Name)
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := mig.down(tx); err != nil {
+			return err
+		}
+		return tx.Where("version = ?", mig.Version).Delete(&Migration{}).Error
+	})
+	if err != nil {
+		return fmt.Errorf("rollback of migration %d (%s) failed: %w", mig.Version, mig.Name, err)
+	}
+	return nil
 }
 
 // ExecuteAndSaveMigration execute and save migration.
@@ -35,15 +477,7 @@ func ExecuteAndSaveMigration(name, query string) error {
 	var migration Migration
 	result := DB.Where("name=?", name).First(&migration)
 	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
-		logger.Log.Debug(query)
-		result = DB.Debug().Exec(query)
-		if result.Error == nil {
-			DB.Save(&Migration{
-				Date: time.Now(),
-				Name: name,
-			})
-		}
-		return result.Error
+		return applyMigration(&localMigration{Name: name, Query: query})
 	}
-	return nil
+	return result.Error
 }
@@ -1,10 +1,17 @@
 package db
 
 import (
+	"fmt"
+	"sort"
 	"testing"
 
+	"github.com/akhilrex/podgrab/model"
+	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
 )
 
 // TestExecuteAndSaveMigration tests single migration execution.
@@ -98,7 +105,7 @@ func TestRunMigrations(t *testing.T) {
 	})
 
 	// Run all migrations
-	RunMigrations()
+	require.NoError(t, RunMigrations())
 
 	// Verify migration records were created
 	var migrations []Migration
@@ -244,7 +251,7 @@ func TestDefaultMigration(t *testing.T) {
 	})
 
 	// Run the default migration
-	RunMigrations()
+	require.NoError(t, RunMigrations())
 
 	// Verify results
 	var updated1 PodcastItem
@@ -259,3 +266,525 @@ func TestDefaultMigration(t *testing.T) {
 	database.First(&updated3, "id = ?", item3.ID)
 	assert.Equal(t, Downloaded, updated3.DownloadStatus, "Item3 should remain Downloaded")
 }
+
+// withTestMigrations swaps the registered migrations for the duration of a test.
+func withTestMigrations(t *testing.T, list []localMigration) {
+	t.Helper()
+	original := migrations
+	migrations = list
+	t.Cleanup(func() { migrations = original })
+}
+
+// TestMigrationsHaveUniqueVersions tests that registered migrations are numbered consistently.
+func TestMigrationsHaveUniqueVersions(t *testing.T) {
+	seen := make(map[int]string)
+	for _, mig := range migrations {
+		assert.Positive(t, mig.Version, "Migration %s should have a positive version", mig.Name)
+		previous, duplicate := seen[mig.Version]
+		assert.False(t, duplicate, "Version %d used by %s and %s", mig.Version, previous, mig.Name)
+		seen[mig.Version] = mig.Name
+	}
+}
+
+// TestRunMigrations_RecordsVersions tests that applied migrations store their version.
+func TestRunMigrations_RecordsVersions(t *testing.T) {
+	database := SetupTestDB(t)
+	defer TeardownTestDB(t, database)
+
+	originalDB := DB
+	DB = database
+	defer func() { DB = originalDB }()
+
+	require.NoError(t, RunMigrations())
+
+	version, err := GetSchemaVersion()
+	require.NoError(t, err)
+	assert.Equal(t, LatestSchemaVersion(), version, "Schema should be at the latest version")
+
+	statuses, err := GetMigrationStatus()
+	require.NoError(t, err)
+	for _, status := range statuses {
+		assert.True(t, status.Applied, "Migration %s should be applied", status.Name)
+		assert.Equal(t, status.Version != 1, status.Reversible, "Only the initial schema should be irreversible")
+	}
+
+	err = MigrateTo(0)
+	assert.ErrorContains(t, err, "irreversible", "The initial schema should not be rolled back")
+	version, err = GetSchemaVersion()
+	require.NoError(t, err)
+	assert.Equal(t, 1, version)
+}
+
+// TestLegacyMigrationRecordIsRecognised tests that records written before versioning are matched by name.
+func TestLegacyMigrationRecordIsRecognised(t *testing.T) {
+	database := SetupTestDB(t)
+	defer TeardownTestDB(t, database)
+
+	originalDB := DB
+	DB = database
+	defer func() { DB = originalDB }()
+
+	require.NoError(t, database.Create(&Migration{Name: "2020_11_03_04_42_SetDefaultDownloadStatus"}).Error)
+
+	statuses, err := GetMigrationStatus()
+	require.NoError(t, err)
+	for _, status := range statuses {
+		if status.Name == "2020_11_03_04_42_SetDefaultDownloadStatus" {
+			assert.True(t, status.Applied, "Legacy record should count as applied")
+		}
+	}
+
+	var record Migration
+	require.NoError(t, database.Where("name = ?", "2020_11_03_04_42_SetDefaultDownloadStatus").First(&record).Error)
+	assert.Equal(t, 2, record.Version, "Legacy record should be backfilled with its version")
+}
+
+// TestMigrateToAndRollback tests migrating up to a version and rolling back.
+func TestMigrateToAndRollback(t *testing.T) {
+	database := SetupTestDB(t)
+	defer TeardownTestDB(t, database)
+
+	originalDB := DB
+	DB = database
+	defer func() { DB = originalDB }()
+
+	withTestMigrations(t, []localMigration{
+		{Version: 2, Name: "second", Query: "CREATE TABLE second_table (id integer)", DownQuery: "DROP TABLE second_table"},
+		{Version: 1, Name: "first", Query: "CREATE TABLE first_table (id integer)", DownQuery: "DROP TABLE first_table"},
+	})
+
+	require.NoError(t, MigrateTo(1))
+	assert.True(t, database.Migrator().HasTable("first_table"), "First migration should be applied")
+	assert.False(t, database.Migrator().HasTable("second_table"), "Second migration should be pending")
+
+	require.NoError(t, RunMigrations())
+	assert.True(t, database.Migrator().HasTable("second_table"), "Second migration should be applied")
+
+	require.NoError(t, RollbackMigrations(1))
+	assert.False(t, database.Migrator().HasTable("second_table"), "Second migration should be rolled back")
+	assert.True(t, database.Migrator().HasTable("first_table"), "First migration should remain")
+
+	version, err := GetSchemaVersion()
+	require.NoError(t, err)
+	assert.Equal(t, 1, version)
+
+	require.NoError(t, MigrateTo(0))
+	assert.False(t, database.Migrator().HasTable("first_table"), "First migration should be rolled back")
+}
+
+// TestRollbackIrreversibleMigration tests that migrations without a down step cannot be rolled back.
+func TestRollbackIrreversibleMigration(t *testing.T) {
+	database := SetupTestDB(t)
+	defer TeardownTestDB(t, database)
+
+	originalDB := DB
+	DB = database
+	defer func() { DB = originalDB }()
+
+	withTestMigrations(t, []localMigration{
+		{Version: 1, Name: "one_way", Query: "SELECT 1"},
+	})
+
+	require.NoError(t, RunMigrations())
+	err := RollbackMigrations(1)
+	assert.Error(t, err, "Irreversible migration should not roll back")
+
+	version, err := GetSchemaVersion()
+	require.NoError(t, err)
+	assert.Equal(t, 1, version, "Failed rollback should leave the record in place")
+}
+
+// TestFailedMigrationIsRolledBack tests that a failing migration leaves no partial changes.
+func TestFailedMigrationIsRolledBack(t *testing.T) {
+	database := SetupTestDB(t)
+	defer TeardownTestDB(t, database)
+
+	originalDB := DB
+	DB = database
+	defer func() { DB = originalDB }()
+
+	withTestMigrations(t, []localMigration{
+		{
+			Version: 1,
+			Name:    "half_done",
+			Up: func(tx *gorm.DB) error {
+				if err := tx.Exec("CREATE TABLE half_done (id integer)").Error; err != nil {
+					return err
+				}
+				return tx.Exec("invalid sql").Error
+			},
+		},
+	})
+
+	assert.Error(t, RunMigrations())
+	assert.False(t, database.Migrator().HasTable("half_done"), "Partial changes should be rolled back")
+
+	version, err := GetSchemaVersion()
+	require.NoError(t, err)
+	assert.Equal(t, 0, version)
+}
+
+// TestCheckSchemaVersion_TooNew tests that a newer schema is refused.
+func TestCheckSchemaVersion_TooNew(t *testing.T) {
+	database := SetupTestDB(t)
+	defer TeardownTestDB(t, database)
+
+	originalDB := DB
+	DB = database
+	defer func() { DB = originalDB }()
+
+	require.NoError(t, CheckSchemaVersion(), "Empty schema should be accepted")
+
+	require.NoError(t, database.Create(&Migration{Name: "from_the_future", Version: LatestSchemaVersion() + 1}).Error)
+
+	err := CheckSchemaVersion()
+	var versionErr *model.SchemaVersionError
+	require.ErrorAs(t, err, &versionErr)
+	assert.Equal(t, LatestSchemaVersion()+1, versionErr.Current)
+	assert.Equal(t, LatestSchemaVersion(), versionErr.Supported)
+
+	assert.Error(t, Migrate(), "Migrate should refuse a newer schema")
+}
+
+// TestNotificationsMigration tests that the notifications migration can be reverted and reapplied.
+func TestNotificationsMigration(t *testing.T) {
+	database := SetupTestDB(t)
+	defer TeardownTestDB(t, database)
+
+	originalDB := DB
+	DB = database
+	defer func() { DB = originalDB }()
+
+	require.NoError(t, MigrateTo(3))
+	assert.True(t, database.Migrator().HasTable(&NotificationTarget{}))
+	assert.True(t, database.Migrator().HasColumn(&Podcast{}, "FeedFailureCount"))
+
+	require.NoError(t, MigrateTo(2))
+	assert.False(t, database.Migrator().HasTable(&NotificationTarget{}), "Targets table should be dropped")
+	assert.False(t, database.Migrator().HasTable(&NotificationDelivery{}), "Deliveries table should be dropped")
+	assert.False(t, database.Migrator().HasColumn(&Podcast{}, "FeedFailureCount"), "Feed health columns should be dropped")
+	assert.False(t, database.Migrator().HasColumn(&PodcastItem{}, "DownloadFailureCount"), "Failure count column should be dropped")
+
+	require.NoError(t, MigrateTo(3))
+	assert.True(t, database.Migrator().HasTable(&NotificationDelivery{}))
+	assert.True(t, database.Migrator().HasColumn(&PodcastItem{}, "DownloadFailureCount"))
+}
+
+// TestJobSchedulerMigration tests that the scheduler tables and lock lease columns migrate both ways.
+func TestJobSchedulerMigration(t *testing.T) {
+	database := SetupTestDB(t)
+	defer TeardownTestDB(t, database)
+
+	originalDB := DB
+	DB = database
+	defer func() { DB = originalDB }()
+
+	require.NoError(t, MigrateTo(4))
+	assert.True(t, database.Migrator().HasTable(&JobRun{}))
+	assert.True(t, database.Migrator().HasColumn(&JobLock{}, "LeaseUntil"))
+
+	require.NoError(t, MigrateTo(3))
+	assert.False(t, database.Migrator().HasTable(&JobRun{}), "Runs table should be dropped")
+	assert.False(t, database.Migrator().HasTable(&JobSchedule{}), "Schedules table should be dropped")
+	assert.False(t, database.Migrator().HasColumn(&JobLock{}, "Owner"), "Lease columns should be dropped")
+
+	require.NoError(t, MigrateTo(4))
+	assert.True(t, database.Migrator().HasTable(&JobSchedule{}))
+	assert.True(t, database.Migrator().HasColumn(&JobLock{}, "Owner"))
+}
+
+// TestDownloadLimitsMigration tests adding and removing the download limit settings.
+func TestDownloadLimitsMigration(t *testing.T) {
+	database := SetupTestDB(t)
+	defer TeardownTestDB(t, database)
+
+	originalDB := DB
+	DB = database
+	defer func() { DB = originalDB }()
+
+	require.NoError(t, MigrateTo(5))
+	for _, column := range downloadLimitColumns {
+		assert.True(t, database.Migrator().HasColumn(&Setting{}, column), column)
+	}
+
+	require.NoError(t, MigrateTo(4))
+	for _, column := range downloadLimitColumns {
+		assert.False(t, database.Migrator().HasColumn(&Setting{}, column), "%s should be dropped", column)
+	}
+
+	require.NoError(t, MigrateTo(5))
+	assert.True(t, database.Migrator().HasColumn(&Setting{}, "MeteredConnection"))
+}
+
+// TestHostPolitenessMigration tests adding and removing the host limit settings
+// and feed throttling columns.
+func TestHostPolitenessMigration(t *testing.T) {
+	database := SetupTestDB(t)
+	defer TeardownTestDB(t, database)
+
+	originalDB := DB
+	DB = database
+	defer func() { DB = originalDB }()
+
+	require.NoError(t, MigrateTo(6))
+	assert.True(t, database.Migrator().HasColumn(&Setting{}, "HostConnections"))
+	assert.True(t, database.Migrator().HasColumn(&Setting{}, "HostRequestsPerMinute"))
+	assert.True(t, database.Migrator().HasColumn(&Podcast{}, "LastFeedThrottled"))
+	assert.True(t, database.Migrator().HasColumn(&Podcast{}, "FeedThrottleCount"))
+
+	require.NoError(t, MigrateTo(5))
+	assert.False(t, database.Migrator().HasColumn(&Setting{}, "HostConnections"))
+	assert.False(t, database.Migrator().HasColumn(&Podcast{}, "FeedThrottleCount"))
+	assert.True(t, database.Migrator().HasColumn(&Setting{}, "MeteredConnection"), "Earlier columns should be kept")
+}
+
+// TestFeedAuthMigration tests adding and removing the feed credentials column.
+func TestFeedAuthMigration(t *testing.T) {
+	database := SetupTestDB(t)
+	defer TeardownTestDB(t, database)
+
+	originalDB := DB
+	DB = database
+	defer func() { DB = originalDB }()
+
+	require.NoError(t, MigrateTo(7))
+	assert.True(t, database.Migrator().HasColumn(&Podcast{}, "FeedAuth"))
+
+	require.NoError(t, MigrateTo(6))
+	assert.False(t, database.Migrator().HasColumn(&Podcast{}, "FeedAuth"))
+	assert.True(t, database.Migrator().HasColumn(&Podcast{}, "FeedThrottleCount"), "Earlier columns should be kept")
+}
+
+// TestEpisodeDedupMigration tests adding and removing the dedup setting and
+// the episode history table.
+func TestEpisodeDedupMigration(t *testing.T) {
+	database := SetupTestDB(t)
+	defer TeardownTestDB(t, database)
+
+	originalDB := DB
+	DB = database
+	defer func() { DB = originalDB }()
+
+	require.NoError(t, MigrateTo(8))
+	assert.True(t, database.Migrator().HasColumn(&Setting{}, "DedupSensitivity"))
+	assert.True(t, database.Migrator().HasTable(&PodcastItemHistory{}))
+
+	require.NoError(t, MigrateTo(7))
+	assert.False(t, database.Migrator().HasColumn(&Setting{}, "DedupSensitivity"))
+	assert.False(t, database.Migrator().HasTable(&PodcastItemHistory{}))
+	assert.True(t, database.Migrator().HasColumn(&Podcast{}, "FeedAuth"), "Earlier columns should be kept")
+}
+
+// TestFeedChangesMigration tests adding and removing the columns tracking
+// feed entry changes.
+func TestFeedChangesMigration(t *testing.T) {
+	database := SetupTestDB(t)
+	defer TeardownTestDB(t, database)
+
+	originalDB := DB
+	DB = database
+	defer func() { DB = originalDB }()
+
+	require.NoError(t, MigrateTo(9))
+	assert.True(t, database.Migrator().HasColumn(&PodcastItem{}, "Fingerprint"))
+	assert.True(t, database.Migrator().HasColumn(&PodcastItem{}, "RemovedUpstreamAt"))
+	assert.True(t, database.Migrator().HasColumn(&Setting{}, "RedownloadChangedEnclosures"))
+
+	require.NoError(t, MigrateTo(8))
+	assert.False(t, database.Migrator().HasColumn(&PodcastItem{}, "Fingerprint"))
+	assert.False(t, database.Migrator().HasColumn(&PodcastItem{}, "RemovedUpstreamAt"))
+	assert.False(t, database.Migrator().HasColumn(&Setting{}, "RedownloadChangedEnclosures"))
+	assert.True(t, database.Migrator().HasTable(&PodcastItemHistory{}), "Earlier tables should be kept")
+}
+
+// TestPodcastOverridesMigration tests adding the podcast override columns,
+// filled from the current details.
+func TestPodcastOverridesMigration(t *testing.T) {
+	database := SetupTestDB(t)
+	defer TeardownTestDB(t, database)
+
+	originalDB := DB
+	DB = database
+	defer func() { DB = originalDB }()
+
+	require.NoError(t, MigrateTo(10))
+	require.NoError(t, MigrateTo(9))
+	assert.False(t, database.Migrator().HasColumn(&Podcast{}, "Folder"))
+	require.NoError(t, database.Exec("INSERT INTO podcasts (id, title, summary, author, image, url) VALUES (?, ?, ?, ?, ?, ?)",
+		"podcast", "Show", "About", "Host", "https://example.com/cover.jpg", "https://example.com/feed.xml").Error)
+
+	require.NoError(t, MigrateTo(10))
+	var podcast Podcast
+	require.NoError(t, database.First(&podcast, "id = ?", "podcast").Error)
+	assert.Equal(t, "Show", podcast.FeedTitle)
+	assert.Equal(t, "About", podcast.FeedSummary)
+	assert.Equal(t, "Host", podcast.FeedAuthor)
+	assert.Equal(t, "https://example.com/cover.jpg", podcast.FeedImage)
+	assert.Equal(t, "Show", podcast.Folder, "Existing podcasts should keep their folder")
+	assert.Empty(t, podcast.TitleOverride)
+
+	require.NoError(t, MigrateTo(9))
+	assert.False(t, database.Migrator().HasColumn(&Podcast{}, "FeedTitle"))
+	assert.False(t, database.Migrator().HasColumn(&Podcast{}, "Folder"))
+}
+
+// TestSmartPlaylistsMigration tests adding and removing the smart playlists
+// table.
+func TestSmartPlaylistsMigration(t *testing.T) {
+	database := SetupTestDB(t)
+	defer TeardownTestDB(t, database)
+
+	originalDB := DB
+	DB = database
+	defer func() { DB = originalDB }()
+
+	require.NoError(t, MigrateTo(11))
+	assert.True(t, database.Migrator().HasTable(&SmartPlaylist{}))
+
+	require.NoError(t, MigrateTo(10))
+	assert.False(t, database.Migrator().HasTable(&SmartPlaylist{}))
+	assert.True(t, database.Migrator().HasColumn(&Podcast{}, "Folder"), "Earlier columns should be kept")
+}
+
+// TestPlaylistsMigration tests adding and removing the playlist and up next
+// queue tables.
+func TestPlaylistsMigration(t *testing.T) {
+	database := SetupTestDB(t)
+	defer TeardownTestDB(t, database)
+
+	originalDB := DB
+	DB = database
+	defer func() { DB = originalDB }()
+
+	require.NoError(t, MigrateTo(12))
+	assert.True(t, database.Migrator().HasTable(&Playlist{}))
+	assert.True(t, database.Migrator().HasColumn(&PlaylistItem{}, "Position"))
+
+	require.NoError(t, MigrateTo(11))
+	assert.False(t, database.Migrator().HasTable(&Playlist{}))
+	assert.False(t, database.Migrator().HasTable(&PlaylistItem{}))
+	assert.True(t, database.Migrator().HasTable(&SmartPlaylist{}), "Earlier tables should be kept")
+}
+
+// TestPlaylistFilesSettingMigration tests adding and removing the setting to
+// write playlist files.
+func TestPlaylistFilesSettingMigration(t *testing.T) {
+	database := SetupTestDB(t)
+	defer TeardownTestDB(t, database)
+
+	originalDB := DB
+	DB = database
+	defer func() { DB = originalDB }()
+
+	require.NoError(t, MigrateTo(13))
+	assert.True(t, database.Migrator().HasColumn(&Setting{}, "WritePlaylistFiles"))
+
+	require.NoError(t, MigrateTo(12))
+	assert.False(t, database.Migrator().HasColumn(&Setting{}, "WritePlaylistFiles"))
+	assert.True(t, database.Migrator().HasTable(&Playlist{}), "Earlier tables should be kept")
+}
+
+// TestLocalPodcastsMigration tests adding and removing the local podcast columns.
+func TestLocalPodcastsMigration(t *testing.T) {
+	database := SetupTestDB(t)
+	defer TeardownTestDB(t, database)
+
+	originalDB := DB
+	DB = database
+	defer func() { DB = originalDB }()
+
+	require.NoError(t, MigrateTo(14))
+	assert.True(t, database.Migrator().HasColumn(&Podcast{}, "IsLocal"))
+	assert.True(t, database.Migrator().HasColumn(&Podcast{}, "LocalPath"))
+
+	require.NoError(t, MigrateTo(13))
+	assert.False(t, database.Migrator().HasColumn(&Podcast{}, "IsLocal"))
+	assert.False(t, database.Migrator().HasColumn(&Podcast{}, "LocalPath"))
+	assert.True(t, database.Migrator().HasColumn(&Setting{}, "WritePlaylistFiles"), "Earlier columns should be kept")
+}
+
+// TestNotificationAlertsMigration tests adding and removing the sent failure
+// alerts table.
+func TestNotificationAlertsMigration(t *testing.T) {
+	database := SetupTestDB(t)
+	defer TeardownTestDB(t, database)
+
+	originalDB := DB
+	DB = database
+	defer func() { DB = originalDB }()
+
+	require.NoError(t, MigrateTo(15))
+	assert.True(t, database.Migrator().HasTable(&NotificationAlert{}))
+
+	require.NoError(t, MigrateTo(14))
+	assert.False(t, database.Migrator().HasTable(&NotificationAlert{}))
+	assert.True(t, database.Migrator().HasColumn(&Podcast{}, "IsLocal"), "Earlier columns should be kept")
+}
+
+// setupEmptyDB opens a database holding only the migrations table, like a new
+// installation.
+func setupEmptyDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	database, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:%s?mode=memory&cache=shared", uuid.New().String())), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	require.NoError(t, err)
+	require.NoError(t, database.AutoMigrate(&Migration{}))
+	originalDB := DB
+	DB = database
+	t.Cleanup(func() {
+		DB = originalDB
+		TeardownTestDB(t, database)
+	})
+	return database
+}
+
+// tableColumns returns the column names of every table in database.
+func tableColumns(t *testing.T, database *gorm.DB) map[string][]string {
+	t.Helper()
+	tables, err := database.Migrator().GetTables()
+	require.NoError(t, err)
+	columns := make(map[string][]string, len(tables))
+	for _, table := range tables {
+		types, err := database.Migrator().ColumnTypes(table)
+		require.NoError(t, err)
+		for _, column := range types {
+			columns[table] = append(columns[table], column.Name())
+		}
+		sort.Strings(columns[table])
+	}
+	return columns
+}
+
+// TestInitialSchemaMigration tests that the first migration creates the
+// original schema rather than the current models.
+func TestInitialSchemaMigration(t *testing.T) {
+	database := setupEmptyDB(t)
+
+	require.NoError(t, MigrateTo(1))
+	assert.True(t, database.Migrator().HasTable("podcast_tags"))
+	assert.True(t, database.Migrator().HasColumn(&Podcast{}, "IsPaused"))
+	assert.False(t, database.Migrator().HasColumn(&Podcast{}, "FeedFailureCount"), "Later columns should be left to their migrations")
+	assert.False(t, database.Migrator().HasColumn(&Podcast{}, "Folder"))
+	assert.False(t, database.Migrator().HasColumn(&JobLock{}, "Owner"))
+	assert.False(t, database.Migrator().HasColumn(&Setting{}, "DedupSensitivity"))
+
+	require.NoError(t, MigrateTo(9))
+	require.NoError(t, database.Exec("INSERT INTO podcasts (id, title, url) VALUES (?, ?, ?)",
+		"podcast", "Show", "https://example.com/feed.xml").Error)
+	require.NoError(t, MigrateTo(10))
+	var podcast Podcast
+	require.NoError(t, database.First(&podcast, "id = ?", "podcast").Error)
+	assert.Equal(t, "Show", podcast.Folder, "New databases should run the folder backfill too")
+}
+
+// TestMigrationsMatchModels tests that migrating a new database from scratch
+// gives the schema of the current models.
+func TestMigrationsMatchModels(t *testing.T) {
+	models := SetupTestDB(t)
+	defer TeardownTestDB(t, models)
+	database := setupEmptyDB(t)
+
+	require.NoError(t, RunMigrations())
+	assert.Equal(t, tableColumns(t, models), tableColumns(t, database))
+}
@@ -8,6 +8,8 @@ import (
 // Podcast is
 type Podcast struct {
 	Base
+	// Title, Summary, Author and Image are shown for the podcast. They are
+	// the user's overrides where set and the feed's values otherwise.
 	Title string
 
 	Summary string `gorm:"type:text"`
@@ -16,8 +18,32 @@ type Podcast struct {
 
 	Image string
 
+	// FeedTitle, FeedSummary, FeedAuthor and FeedImage are the details in
+	// the podcast's feed, kept apart so that refreshing them keeps the
+	// overrides.
+	FeedTitle   string
+	FeedSummary string `gorm:"type:text"`
+	FeedAuthor  string
+	FeedImage   string
+
+	// TitleOverride, SummaryOverride, AuthorOverride and ImageOverride are
+	// set by the user, empty when the feed's value is shown.
+	TitleOverride   string
+	SummaryOverride string `gorm:"type:text"`
+	AuthorOverride  string
+	ImageOverride   string
+
+	// Folder names the podcast's folder in the data directory. Empty uses
+	// the title.
+	Folder string
+
+	// URL is the podcast's feed, empty for local podcasts.
 	URL string
 
+	// LocalPath is the directory the episodes of a local podcast are read
+	// from. Empty uses the podcast's folder in the data directory.
+	LocalPath string
+
 	LastEpisode *time.Time
 
 	PodcastItems []PodcastItem
@@ -33,6 +59,30 @@ type Podcast struct {
 	AllEpisodesSize         int64 `gorm:"-"`
 
 	IsPaused bool `gorm:"default:false"`
+
+	// IsLocal marks a podcast made from a folder of audio files rather than
+	// subscribed to a feed.
+	IsLocal bool `gorm:"default:false"`
+
+	LastFeedSuccess  *time.Time
+	LastFeedError    string
+	FeedFailureCount int `gorm:"default:0"`
+	// LastFeedThrottled and FeedThrottleCount record the podcast's servers
+	// asking Podgrab to slow down, which is not counted as a failure.
+	LastFeedThrottled *time.Time
+	FeedThrottleCount int
+
+	// FeedAuth holds the encrypted credentials and extra headers sent with
+	// the podcast's requests.
+	FeedAuth string `json:"-"`
+}
+
+// DataFolder returns the name of the podcast's folder in the data directory.
+func (podcast *Podcast) DataFolder() string {
+	if podcast.Folder != "" {
+		return podcast.Folder
+	}
+	return podcast.Title
 }
 
 // PodcastItem is
@@ -55,6 +105,29 @@ type PodcastItem struct {
 	Duration       int
 	FileSize       int64
 	IsPlayed       bool `gorm:"default:false"`
+
+	DownloadFailureCount int `gorm:"default:0"`
+
+	// Fingerprint is a hash of the feed entry the episode was last updated
+	// from, so refreshes only write episodes whose entry changed.
+	Fingerprint string `json:"-"`
+	// RemovedUpstreamAt is when the episode disappeared from its feed. Nil
+	// while the feed lists it.
+	RemovedUpstreamAt *time.Time
+}
+
+// PodcastItemHistory records an episode's GUID or enclosure URL changing in
+// its feed, and how the changed entry was matched to the episode.
+type PodcastItemHistory struct {
+	Base
+	PodcastItemID string `gorm:"index"`
+	OldGUID       string
+	NewGUID       string
+	OldFileURL    string
+	NewFileURL    string
+	// MatchedBy is the strategy that matched the entry, such as guid,
+	// enclosure or title_date.
+	MatchedBy string
 }
 
 // DownloadStatus represents the download state of a podcast episode.
@@ -72,6 +145,22 @@ const (
 	Deleted
 )
 
+// String returns a lower-case name for the download status.
+func (status DownloadStatus) String() string {
+	switch status {
+	case NotDownloaded:
+		return "queued"
+	case Downloading:
+		return "downloading"
+	case Downloaded:
+		return "downloaded"
+	case Deleted:
+		return "deleted"
+	default:
+		return "unknown"
+	}
+}
+
 // Setting represents setting data.
 type Setting struct {
 	Base
@@ -87,23 +176,92 @@ type Setting struct {
 	AppendDateToFileName          bool `gorm:"default:false"`
 	AutoDownload                  bool `gorm:"default:true"`
 	DownloadOnAdd                 bool `gorm:"default:true"`
+	// DownloadWindowStart and DownloadWindowEnd limit queued downloads to a
+	// daily window in local time, as "15:04". Empty means any time.
+	DownloadWindowStart string
+	DownloadWindowEnd   string
+	// MaxDownloadRate caps the bandwidth of all downloads together and
+	// MaxHostDownloadRate the bandwidth per remote host, in KB/s. Zero means
+	// unlimited.
+	MaxDownloadRate     int
+	MaxHostDownloadRate int
+	// MeteredConnection pauses queued downloads.
+	MeteredConnection bool
+	// HostConnections limits concurrent requests and HostRequestsPerMinute
+	// the request rate to each remote host. Zero uses the defaults.
+	HostConnections       int
+	HostRequestsPerMinute int
+	// DedupSensitivity controls matching feed entries with a new GUID to
+	// existing episodes: off, strict, normal or loose. Empty uses normal.
+	DedupSensitivity string
+	// RedownloadChangedEnclosures downloads episodes again when their feed
+	// entry points to a different file.
+	RedownloadChangedEnclosures bool
+	// WritePlaylistFiles keeps a playlist of the downloaded episodes in the
+	// folder of each podcast, for media servers that scan the filesystem.
+	WritePlaylistFiles bool
 }
 
 // Migration represents migration data.
 type Migration struct {
 	Base
-	Date time.Time
-	Name string
+	Date    time.Time
+	Name    string
+	Version int `gorm:"index"`
 }
 
-// JobLock represents job lock data.
+// JobLock represents job lock data. A lock is held while its lease has not
+// expired; the holder renews the lease while the job runs.
 type JobLock struct {
 	Base
-	Date     time.Time
-	Name     string
+	Date       time.Time
+	LeaseUntil time.Time
+	Name       string
+	// Owner identifies the run holding the lock. Only the owner can renew or
+	// release it.
+	Owner    string
 	Duration int
 }
 
+// JobSchedule stores a scheduled job's schedule when it was changed from the default.
+type JobSchedule struct {
+	Base
+	Name string `gorm:"uniqueIndex"`
+	// Schedule is a cron expression. Empty uses the job's default schedule.
+	Schedule string
+	Disabled bool
+}
+
+// JobRun records a single run of a scheduled job.
+type JobRun struct {
+	Base
+	StartedAt  time.Time
+	FinishedAt *time.Time
+	// Name is indexed so a job's history can be listed and pruned.
+	Name       string `gorm:"index"`
+	Trigger    string
+	Status     JobRunStatus
+	Error      string `gorm:"type:text"`
+	DurationMs int64
+}
+
+// JobRunStatus represents the outcome of a job run.
+type JobRunStatus string
+
+// Job run status constants.
+const (
+	// JobRunRunning indicates the job is still running.
+	JobRunRunning JobRunStatus = "running"
+	// JobRunSucceeded indicates the job finished without an error.
+	JobRunSucceeded JobRunStatus = "succeeded"
+	// JobRunFailed indicates the job returned an error.
+	JobRunFailed JobRunStatus = "failed"
+	// JobRunSkipped indicates another process held the job's lock.
+	JobRunSkipped JobRunStatus = "skipped"
+	// JobRunInterrupted indicates the process stopped before the job finished.
+	JobRunInterrupted JobRunStatus = "interrupted"
+)
+
 // Tag represents tag data.
 type Tag struct {
 	Base
@@ -112,9 +270,118 @@ type Tag struct {
 	Podcasts    []*Podcast `gorm:"many2many:podcast_tags;"`
 }
 
+// NotificationTarget is a destination for notifications and the events it receives.
+type NotificationTarget struct {
+	Base
+	Name string
+	// Kind is one of webhook, ntfy, gotify, smtp or apprise.
+	Kind string
+	// URL is the webhook, ntfy topic, Gotify server or Apprise API URL, or
+	// host:port of the SMTP server.
+	URL string
+	// Token is the ntfy access token, Gotify application token or Apprise
+	// notification URLs. Token and Password are stored encrypted.
+	Token    string
+	Username string
+	Password string
+	From     string
+	To       string
+	// Events, PodcastIDs and TagIDs are comma separated. Empty PodcastIDs and
+	// TagIDs match every podcast.
+	Events     string
+	PodcastIDs string
+	TagIDs     string
+	// FailureThreshold of zero uses the default of three failures.
+	FailureThreshold int
+	Enabled          bool
+}
+
+// NotificationAlert records that a target was sent the failure alert of a
+// podcast's feed or an episode's download, so each run of failures is only
+// alerted once. SubjectID is the podcast or episode ID.
+type NotificationAlert struct {
+	Base
+	NotificationTargetID string `gorm:"uniqueIndex:idx_notification_alert"`
+	Event                string `gorm:"uniqueIndex:idx_notification_alert"`
+	SubjectID            string `gorm:"uniqueIndex:idx_notification_alert"`
+}
+
+// NotificationDelivery records an attempt to send a notification to a target.
+type NotificationDelivery struct {
+	Base
+	NextAttemptAt      time.Time
+	DeliveredAt        *time.Time
+	NotificationTarget NotificationTarget
+	// NotificationTargetID is indexed so a target's log can be listed and removed.
+	NotificationTargetID string `gorm:"index"`
+	Event                string
+	Title                string
+	Message              string `gorm:"type:text"`
+	Payload              string `gorm:"type:text"`
+	Status               DeliveryStatus
+	LastError            string
+	Attempts             int
+}
+
+// DeliveryStatus represents the state of a notification delivery.
+type DeliveryStatus string
+
+// Delivery status constants.
+const (
+	// DeliveryPending indicates the delivery is waiting for its first or next attempt.
+	DeliveryPending DeliveryStatus = "pending"
+	// DeliveryDelivered indicates the target accepted the notification.
+	DeliveryDelivered DeliveryStatus = "delivered"
+	// DeliveryFailed indicates every attempt failed.
+	DeliveryFailed DeliveryStatus = "failed"
+)
+
+// SmartPlaylist is a saved episode filter, played and published as a
+// playlist of the episodes it matches.
+type SmartPlaylist struct {
+	Base
+	// IsPlayed and IsDownloaded match every episode when nil.
+	IsPlayed     *bool
+	IsDownloaded *bool
+	Name         string
+	// Sorting is one of the model.EpisodeSort values.
+	Sorting string
+	// PodcastIDs and TagIDs are comma separated. Empty PodcastIDs and TagIDs
+	// match every podcast.
+	PodcastIDs string
+	TagIDs     string
+	// MaxAgeDays, MinDuration and MaxDuration of zero are not applied.
+	MaxAgeDays  int
+	MinDuration int
+	MaxDuration int
+	// Limit caps the number of episodes, zero includes every match.
+	Limit int
+}
+
+// Playlist is a named list of episodes in the order they were arranged.
+type Playlist struct {
+	Base
+	Name string
+	// EpisodesCount is the number of episodes in the playlist.
+	EpisodesCount int `gorm:"-"`
+}
+
+// QueuePlaylistID is the PlaylistID of the items of the up next queue.
+// Podgrab has a single login, so every browser shares one queue.
+const QueuePlaylistID = ""
+
+// PlaylistItem is an episode at a position in a playlist or in the up next
+// queue. An episode is in a list at most once.
+type PlaylistItem struct {
+	Base
+	PlaylistID    string `gorm:"index"`
+	PodcastItemID string `gorm:"index"`
+	Position      int
+}
+
 // IsLocked returns true if the job lock is currently active.
 func (lock *JobLock) IsLocked() bool {
-	return lock != nil && lock.Date != time.Time{}
+	return lock != nil && lock.LeaseUntil.After(time.Now())
 }
 
 // PodcastItemStatsModel represents podcast item stats model data.
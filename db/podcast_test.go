@@ -162,12 +162,23 @@ func TestJobLockModel(t *testing.T) {
 		{
 			name: "locked_job",
 			lock: &JobLock{
-				Name:     "test-job",
-				Date:     time.Now(),
-				Duration: 30,
+				Name:       "test-job",
+				Date:       time.Now(),
+				LeaseUntil: time.Now().Add(time.Minute),
+				Duration:   30,
 			},
 			wantLocked: true,
 		},
+		{
+			name: "expired_lease",
+			lock: &JobLock{
+				Name:       "test-job",
+				Date:       time.Now().Add(-time.Hour),
+				LeaseUntil: time.Now().Add(-time.Minute),
+				Duration:   120,
+			},
+			wantLocked: false,
+		},
 		{
 			name: "unlocked_job",
 			lock: &JobLock{
@@ -30,10 +30,19 @@ func SetupTestDB(t *testing.T) *gorm.DB {
 	err = database.AutoMigrate(
 		&Podcast{},
 		&PodcastItem{},
+		&PodcastItemHistory{},
 		&Setting{},
 		&Tag{},
 		&Migration{},
 		&JobLock{},
+		&NotificationTarget{},
+		&NotificationDelivery{},
+		&NotificationAlert{},
+		&JobSchedule{},
+		&JobRun{},
+		&SmartPlaylist{},
+		&Playlist{},
+		&PlaylistItem{},
 	)
 	if err != nil {
 		t.Fatalf("Failed to run migrations: %v", err)
@@ -132,7 +141,11 @@ func CreateTestPodcast(t *testing.T, database *gorm.DB, overrides ...*Podcast) *
 		if override.IsPaused {
 			podcast.IsPaused = override.IsPaused
 		}
+		podcast.Folder = override.Folder
+		podcast.IsLocal, podcast.LocalPath = override.IsLocal, override.LocalPath
 	}
+	podcast.FeedTitle, podcast.FeedSummary = podcast.Title, podcast.Summary
+	podcast.FeedAuthor, podcast.FeedImage = podcast.Author, podcast.Image
 
 	if err := database.Create(podcast).Error; err != nil {
 		t.Fatalf("Failed to create test podcast: %v", err)
@@ -297,6 +297,7 @@ func setupTestServer(database *gorm.DB) *httptest.Server {
 		api.POST("/tags", controllers.AddTag)
 		api.PATCH("/settings", controllers.UpdateSetting)
 	}
+	controllers.RegisterAPIV1(router.Group(controllers.APIV1Prefix))
 
 	server := httptest.NewServer(router)
 	return server
@@ -4,6 +4,7 @@
 package integration_test
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -40,7 +41,7 @@ func TestBackgroundJob_RefreshEpisodes(t *testing.T) {
 	server := httptest.NewServer(testhelpers.CreateMockRSSHandler(testhelpers.ValidRSSFeed))
 	defer server.Close()
 
-	_, err := service.AddPodcast(server.URL)
+	_, err := service.AddPodcast(context.Background(), server.URL)
 	require.NoError(t, err, "Should add podcast")
 
 	var podcast db.Podcast
@@ -55,7 +56,7 @@ func TestBackgroundJob_RefreshEpisodes(t *testing.T) {
 	server.Config.Handler = testhelpers.CreateMockRSSHandler(newFeed)
 
 	// Refresh episodes (simulates background job)
-	err = service.RefreshEpisodes()
+	err = service.RefreshEpisodes(context.Background())
 	require.NoError(t, err, "Should refresh episodes")
 
 	// Verify new episodes were added
@@ -100,7 +101,7 @@ func TestBackgroundJob_DownloadMissingEpisodes(t *testing.T) {
 	})
 
 	// Run download job
-	err := service.DownloadMissingEpisodes()
+	err := service.DownloadMissingEpisodes(context.Background())
 	require.NoError(t, err, "Should download queued episodes")
 
 	// Verify downloads completed
@@ -255,7 +256,7 @@ func TestBackgroundJob_ConcurrencyLimit(t *testing.T) {
 
 	// Start download job
 	start := time.Now()
-	err := service.DownloadMissingEpisodes()
+	err := service.DownloadMissingEpisodes(context.Background())
 	duration := time.Since(start)
 
 	require.NoError(t, err, "Should complete downloads")
@@ -4,6 +4,7 @@
 package integration_test
 
 import (
+	"context"
 	"net/http/httptest"
 	"os"
 	"testing"
@@ -39,12 +40,12 @@ func TestPodcastLifecycle_AddDownloadDelete(t *testing.T) {
 	defer server.Close()
 
 	// Step 1: Add podcast (RSS parsing)
-	podcast, err := service.AddPodcast(server.URL)
+	podcast, err := service.AddPodcast(context.Background(), server.URL)
 	require.NoError(t, err, "Should add podcast")
 	assert.Equal(t, "Test Podcast", podcast.Title, "Should have correct title")
 
 	// Add episodes (AddPodcast only creates podcast record, not episodes)
-	err = service.AddPodcastItems(&podcast, true)
+	err = service.AddPodcastItems(context.Background(), &podcast, true)
 	require.NoError(t, err, "Should add podcast episodes")
 
 	// Step 2: Verify episodes were created
@@ -67,7 +68,7 @@ func TestPodcastLifecycle_AddDownloadDelete(t *testing.T) {
 	episode.FileURL = mockFileServer.URL
 	database.Save(&episode)
 
-	err = service.DownloadSingleEpisode(episode.ID)
+	err = service.DownloadSingleEpisode(context.Background(), episode.ID)
 	require.NoError(t, err, "Should download episode")
 
 	// Verify download
@@ -114,7 +115,7 @@ func TestPodcastLifecycle_DuplicateDetection(t *testing.T) {
 	defer server.Close()
 
 	// Add podcast first time
-	_, err := service.AddPodcast(server.URL)
+	_, err := service.AddPodcast(context.Background(), server.URL)
 	require.NoError(t, err, "First add should succeed")
 
 	// Count podcasts
@@ -123,7 +124,7 @@ func TestPodcastLifecycle_DuplicateDetection(t *testing.T) {
 	assert.Equal(t, int64(1), count1, "Should have one podcast")
 
 	// Try to add same podcast again
-	_, err = service.AddPodcast(server.URL)
+	_, err = service.AddPodcast(context.Background(), server.URL)
 	assert.Error(t, err, "Should reject duplicate podcast")
 
 	// Verify still only one podcast
@@ -152,11 +153,11 @@ func TestPodcastLifecycle_EpisodeDeduplication(t *testing.T) {
 	defer server.Close()
 
 	// Add podcast
-	podcast, err := service.AddPodcast(server.URL)
+	podcast, err := service.AddPodcast(context.Background(), server.URL)
 	require.NoError(t, err, "Should add podcast")
 
 	// Add episodes first time
-	err = service.AddPodcastItems(&podcast, true)
+	err = service.AddPodcastItems(context.Background(), &podcast, true)
 	require.NoError(t, err, "Should add episodes")
 
 	// Count episodes after first addition
@@ -165,7 +166,7 @@ func TestPodcastLifecycle_EpisodeDeduplication(t *testing.T) {
 	assert.Greater(t, count1, int64(0), "Should have episodes after first addition")
 
 	// Re-parse same RSS feed (simulates refresh - should detect duplicates)
-	err = service.AddPodcastItems(&podcast, false)
+	err = service.AddPodcastItems(context.Background(), &podcast, false)
 	require.NoError(t, err, "Should process items")
 
 	// Verify episode count unchanged (no duplicates)
@@ -198,11 +199,11 @@ func TestPodcastLifecycle_DownloadOnAdd(t *testing.T) {
 	defer server.Close()
 
 	// Add podcast
-	podcast, err := service.AddPodcast(server.URL)
+	podcast, err := service.AddPodcast(context.Background(), server.URL)
 	require.NoError(t, err, "Should add podcast")
 
 	// Add episodes (with DownloadOnAdd=true, they should be queued)
-	err = service.AddPodcastItems(&podcast, true)
+	err = service.AddPodcastItems(context.Background(), &podcast, true)
 	require.NoError(t, err, "Should add episodes")
 
 	// Verify some episodes queued for download
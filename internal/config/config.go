@@ -0,0 +1,433 @@
+// Package config loads Podgrab's deployment configuration.
+//
+// Values come from built-in defaults, an optional YAML file and environment
+// variables, in increasing order of precedence. Settings that users change
+// from the web UI live in the database (db.Setting) and are not handled here.
+package config
+
+import (
+	"bytes"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FileEnv names the environment variable that points at the config file.
+const FileEnv = "PODGRAB_CONFIG_FILE"
+
+// DefaultFileName is the config file looked up in the CONFIG directory when
+// FileEnv is not set.
+const DefaultFileName = "podgrab.yml"
+
+// Source describes where an effective configuration value came from.
+type Source string
+
+// Configuration value sources.
+const (
+	SourceDefault  Source = "default"
+	SourceFile     Source = "file"
+	SourceEnv      Source = "env"
+	SourceDatabase Source = "database"
+)
+
+// PodcastIndex holds the podcastindex.org API credentials used for search.
+type PodcastIndex struct {
+	Key    string `yaml:"key"`
+	Secret string `yaml:"secret"`
+}
+
+// HTTP configures the client used for feed fetches and downloads.
+type HTTP struct {
+	// Proxy is an http, https, socks5 or socks5h URL. Empty uses the
+	// HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables.
+	Proxy string `yaml:"proxy"`
+	// CABundle is a PEM file of certificates trusted in addition to the
+	// system roots.
+	CABundle string `yaml:"ca_bundle"`
+	// ConnectTimeout and ReadTimeout are in seconds. ReadTimeout is how long a
+	// response may go without sending data.
+	ConnectTimeout int `yaml:"connect_timeout"`
+	ReadTimeout    int `yaml:"read_timeout"`
+}
+
+// Transcoding configures converting episodes for streaming at a lower
+// bitrate.
+type Transcoding struct {
+	// FFmpeg is the encoder's executable. Empty looks up ffmpeg on the PATH.
+	FFmpeg string `yaml:"ffmpeg"`
+	// CacheMB is how many megabytes of transcoded files are kept, the least
+	// recently streamed removed first.
+	CacheMB int `yaml:"cache_mb"`
+}
+
+// Config is the typed deployment configuration.
+type Config struct {
+	sources   map[string]Source
+	File      string `yaml:"-"`
+	ConfigDir string `yaml:"config_dir"`
+	DataDir   string `yaml:"data_dir"`
+	// LocalDir is where local podcasts may read folders of audio files from,
+	// besides the data directory. Empty allows only the data directory.
+	LocalDir string `yaml:"local_dir"`
+	Password string `yaml:"password"`
+	// Port is the HTTP port to listen on.
+	Port int `yaml:"port"`
+	// PUID and PGID own the files Podgrab writes. -1 leaves ownership to the
+	// process.
+	PUID int `yaml:"puid"`
+	PGID int `yaml:"pgid"`
+	// PlaylistToken lets players that cannot send the password fetch playlist
+	// files and the episodes in them by adding ?token= to the URL.
+	PlaylistToken string `yaml:"playlist_token"`
+	// SecretKey encrypts credentials stored in the database. Empty uses a
+	// key generated in the config directory.
+	SecretKey      string       `yaml:"secret_key"`
+	LogLevel       string       `yaml:"log_level"`
+	PodcastIndex   PodcastIndex `yaml:"podcastindex"`
+	Transcoding    Transcoding  `yaml:"transcoding"`
+	HTTP           HTTP         `yaml:"http"`
+	CheckFrequency int          `yaml:"check_frequency"`
+	MinFreeSpaceMB int          `yaml:"min_free_space_mb"`
+	// ShutdownTimeout is in seconds.
+	ShutdownTimeout int `yaml:"shutdown_timeout"`
+	// FeedPageSize is the number of episodes on a page of the RSS feeds
+	// Podgrab generates. Zero puts every episode on one page.
+	FeedPageSize int `yaml:"feed_page_size"`
+}
+
+// Value is a single effective configuration value and its origin.
+type Value struct {
+	Value  interface{} `json:"value"`
+	Key    string      `json:"key"`
+	Env    string      `json:"env,omitempty"`
+	Source Source      `json:"source"`
+}
+
+// ValidationError lists every problem found in a configuration.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid configuration:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+// field binds a config key to its environment variable and struct member.
+type field struct {
+	str    func(c *Config) *string
+	num    func(c *Config) *int
+	key    string
+	env    string
+	secret bool
+}
+
+var fields = []field{
+	{key: "config_dir", env: "CONFIG", str: func(c *Config) *string { return &c.ConfigDir }},
+	{key: "data_dir", env: "DATA", str: func(c *Config) *string { return &c.DataDir }},
+	{key: "local_dir", env: "LOCAL_DIR", str: func(c *Config) *string { return &c.LocalDir }},
+	{key: "port", env: "PORT", num: func(c *Config) *int { return &c.Port }},
+	{key: "puid", env: "PUID", num: func(c *Config) *int { return &c.PUID }},
+	{key: "pgid", env: "PGID", num: func(c *Config) *int { return &c.PGID }},
+	{key: "check_frequency", env: "CHECK_FREQUENCY", num: func(c *Config) *int { return &c.CheckFrequency }},
+	{key: "min_free_space_mb", env: "MIN_FREE_SPACE_MB", num: func(c *Config) *int { return &c.MinFreeSpaceMB }},
+	{key: "shutdown_timeout", env: "SHUTDOWN_TIMEOUT", num: func(c *Config) *int { return &c.ShutdownTimeout }},
+	{key: "feed_page_size", env: "FEED_PAGE_SIZE", num: func(c *Config) *int { return &c.FeedPageSize }},
+	{key: "password", env: "PASSWORD", secret: true, str: func(c *Config) *string { return &c.Password }},
+	{key: "playlist_token", env: "PLAYLIST_TOKEN", secret: true, str: func(c *Config) *string { return &c.PlaylistToken }},
+	{key: "log_level", env: "LOG_LEVEL", str: func(c *Config) *string { return &c.LogLevel }},
+	{key: "podcastindex.key", env: "PODCASTINDEX_KEY", str: func(c *Config) *string { return &c.PodcastIndex.Key }},
+	{key: "podcastindex.secret", env: "PODCASTINDEX_SECRET", secret: true, str: func(c *Config) *string { return &c.PodcastIndex.Secret }},
+	{key: "secret_key", env: "SECRET_KEY", secret: true, str: func(c *Config) *string { return &c.SecretKey }},
+	{key: "http.proxy", env: "PROXY_URL", secret: true, str: func(c *Config) *string { return &c.HTTP.Proxy }},
+	{key: "http.ca_bundle", env: "CA_BUNDLE", str: func(c *Config) *string { return &c.HTTP.CABundle }},
+	{key: "http.connect_timeout", env: "CONNECT_TIMEOUT", num: func(c *Config) *int { return &c.HTTP.ConnectTimeout }},
+	{key: "http.read_timeout", env: "READ_TIMEOUT", num: func(c *Config) *int { return &c.HTTP.ReadTimeout }},
+	{key: "transcoding.ffmpeg", env: "FFMPEG_PATH", str: func(c *Config) *string { return &c.Transcoding.FFmpeg }},
+	{key: "transcoding.cache_mb", env: "TRANSCODE_CACHE_MB", num: func(c *Config) *int { return &c.Transcoding.CacheMB }},
+}
+
+var validProxySchemes = map[string]bool{"http": true, "https": true, "socks5": true, "socks5h": true}
+
+var validLogLevels = map[string]bool{"debug": true, "info": true, "warn": true, "warning": true, "error": true}
+
+var (
+	current *Config
+	mu      sync.RWMutex
+)
+
+// Default returns the built-in configuration.
+func Default() *Config {
+	c := &Config{
+		ConfigDir:       ".",
+		DataDir:         ".",
+		Port:            8080,
+		PUID:            -1,
+		PGID:            -1,
+		CheckFrequency:  30,
+		MinFreeSpaceMB:  100,
+		ShutdownTimeout: 20,
+		FeedPageSize:    100,
+		LogLevel:        "info",
+		HTTP:            HTTP{ConnectTimeout: 30, ReadTimeout: 120},
+		Transcoding:     Transcoding{CacheMB: 1024},
+		sources:         make(map[string]Source, len(fields)),
+	}
+	for i := range fields {
+		c.sources[fields[i].key] = SourceDefault
+	}
+	return c
+}
+
+// Load builds the configuration from defaults, the config file and the
+// environment, then validates it. An empty path means the file named by
+// FileEnv, or DefaultFileName in the CONFIG directory if it exists.
+func Load(path string) (*Config, error) {
+	c := Default()
+	var problems []string
+
+	if path == "" {
+		path = os.Getenv(FileEnv)
+	}
+	explicit := path != ""
+	if !explicit {
+		dir := strings.TrimSpace(os.Getenv("CONFIG"))
+		if dir == "" {
+			dir = c.ConfigDir
+		}
+		path = filepath.Join(dir, DefaultFileName)
+	}
+
+	content, err := os.ReadFile(path) //nolint:gosec // G304: path is chosen by the operator
+	switch {
+	case err == nil:
+		c.File = path
+		if fileErr := c.applyFile(content); fileErr != nil {
+			return nil, fmt.Errorf("reading config file %s: %w", path, fileErr)
+		}
+	case explicit || !errors.Is(err, os.ErrNotExist):
+		return nil, fmt.Errorf("reading config file %s: %w", path, err)
+	}
+
+	problems = append(problems, c.applyEnv()...)
+	if err := c.validate(problems); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// applyFile decodes YAML content over c, rejecting unknown keys, and records
+// which keys were present.
+func (c *Config) applyFile(content []byte) error {
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+
+	var present map[string]interface{}
+	if err := yaml.Unmarshal(content, &present); err != nil {
+		return err
+	}
+	for i := range fields {
+		if hasKey(present, fields[i].key) {
+			c.sources[fields[i].key] = SourceFile
+		}
+	}
+	return nil
+}
+
+func hasKey(values map[string]interface{}, key string) bool {
+	head, rest, nested := strings.Cut(key, ".")
+	value, ok := values[head]
+	if !ok || !nested {
+		return ok
+	}
+	inner, ok := value.(map[string]interface{})
+	return ok && hasKey(inner, rest)
+}
+
+// applyEnv overrides values from environment variables and returns parse problems.
+func (c *Config) applyEnv() []string {
+	var problems []string
+	for i := range fields {
+		raw, ok := os.LookupEnv(fields[i].env)
+		raw = strings.TrimSpace(raw)
+		if !ok || raw == "" {
+			continue
+		}
+		if fields[i].num != nil {
+			parsed, err := strconv.Atoi(raw)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %q is not a whole number", fields[i].env, raw))
+				continue
+			}
+			*fields[i].num(c) = parsed
+		} else {
+			*fields[i].str(c) = raw
+		}
+		c.sources[fields[i].key] = SourceEnv
+	}
+	return problems
+}
+
+// Validate checks the configuration for invalid values.
+func (c *Config) Validate() error {
+	return c.validate(nil)
+}
+
+func (c *Config) validate(problems []string) error {
+	if c.CheckFrequency < 1 || c.CheckFrequency > 1440 {
+		problems = append(problems, fmt.Sprintf("check_frequency (CHECK_FREQUENCY): %d is outside 1-1440 minutes", c.CheckFrequency))
+	}
+	if c.Port < 1 || c.Port > 65535 {
+		problems = append(problems, fmt.Sprintf("port (PORT): %d is outside 1-65535", c.Port))
+	}
+	if c.PUID < -1 || c.PGID < -1 {
+		problems = append(problems, "puid (PUID), pgid (PGID): must be -1 or a user and group id")
+	} else if (c.PUID == -1) != (c.PGID == -1) {
+		problems = append(problems, "puid (PUID), pgid (PGID): must be set together")
+	}
+	if c.MinFreeSpaceMB < 0 {
+		problems = append(problems, fmt.Sprintf("min_free_space_mb (MIN_FREE_SPACE_MB): %d must not be negative", c.MinFreeSpaceMB))
+	}
+	if c.ShutdownTimeout < 1 {
+		problems = append(problems, fmt.Sprintf("shutdown_timeout (SHUTDOWN_TIMEOUT): %d must be at least 1 second", c.ShutdownTimeout))
+	}
+	if c.FeedPageSize < 0 {
+		problems = append(problems, fmt.Sprintf("feed_page_size (FEED_PAGE_SIZE): %d must not be negative", c.FeedPageSize))
+	}
+	if !validLogLevels[strings.ToLower(c.LogLevel)] {
+		problems = append(problems, fmt.Sprintf("log_level (LOG_LEVEL): %q is not one of debug, info, warn, error", c.LogLevel))
+	}
+	for _, dir := range []struct{ key, value string }{
+		{"config_dir (CONFIG)", c.ConfigDir},
+		{"data_dir (DATA)", c.DataDir},
+	} {
+		if dir.value == "" {
+			problems = append(problems, dir.key+": must not be empty")
+			continue
+		}
+		if info, err := os.Stat(dir.value); err == nil && !info.IsDir() {
+			problems = append(problems, fmt.Sprintf("%s: %s is not a directory", dir.key, dir.value))
+		}
+	}
+	if c.LocalDir != "" {
+		if info, err := os.Stat(c.LocalDir); err != nil {
+			problems = append(problems, fmt.Sprintf("local_dir (LOCAL_DIR): %v", err))
+		} else if !info.IsDir() {
+			problems = append(problems, fmt.Sprintf("local_dir (LOCAL_DIR): %s is not a directory", c.LocalDir))
+		}
+	}
+	if (c.PodcastIndex.Key == "") != (c.PodcastIndex.Secret == "") {
+		problems = append(problems, "podcastindex: key and secret must be set together")
+	}
+	problems = append(problems, c.HTTP.validate()...)
+	problems = append(problems, c.Transcoding.validate()...)
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+func (h *HTTP) validate() []string {
+	var problems []string
+	if h.Proxy != "" {
+		proxy, err := url.Parse(h.Proxy)
+		if err != nil || !validProxySchemes[proxy.Scheme] || proxy.Host == "" {
+			problems = append(problems, "http.proxy (PROXY_URL): must be an http, https, socks5 or socks5h URL")
+		}
+	}
+	if h.CABundle != "" {
+		pem, err := os.ReadFile(h.CABundle)
+		switch {
+		case err != nil:
+			problems = append(problems, fmt.Sprintf("http.ca_bundle (CA_BUNDLE): %v", err))
+		case !x509.NewCertPool().AppendCertsFromPEM(pem):
+			problems = append(problems, fmt.Sprintf("http.ca_bundle (CA_BUNDLE): %s holds no PEM certificates", h.CABundle))
+		}
+	}
+	if h.ConnectTimeout < 1 {
+		problems = append(problems, fmt.Sprintf("http.connect_timeout (CONNECT_TIMEOUT): %d must be at least 1 second", h.ConnectTimeout))
+	}
+	if h.ReadTimeout < 1 {
+		problems = append(problems, fmt.Sprintf("http.read_timeout (READ_TIMEOUT): %d must be at least 1 second", h.ReadTimeout))
+	}
+	return problems
+}
+
+func (t *Transcoding) validate() []string {
+	var problems []string
+	if t.FFmpeg != "" {
+		if _, err := exec.LookPath(t.FFmpeg); err != nil {
+			problems = append(problems, fmt.Sprintf("transcoding.ffmpeg (FFMPEG_PATH): %v", err))
+		}
+	}
+	if t.CacheMB < 0 {
+		problems = append(problems, fmt.Sprintf("transcoding.cache_mb (TRANSCODE_CACHE_MB): %d must not be negative", t.CacheMB))
+	}
+	return problems
+}
+
+// SourceOf returns where the value for key came from.
+func (c *Config) SourceOf(key string) Source {
+	if source, ok := c.sources[key]; ok {
+		return source
+	}
+	return SourceDefault
+}
+
+// Effective lists every configuration value with its source. Secrets are masked.
+func (c *Config) Effective() []Value {
+	values := make([]Value, 0, len(fields))
+	for i := range fields {
+		var value interface{}
+		if fields[i].num != nil {
+			value = *fields[i].num(c)
+		} else {
+			value = *fields[i].str(c)
+			if fields[i].secret && value != "" {
+				value = "********"
+			}
+		}
+		values = append(values, Value{
+			Key:    fields[i].key,
+			Env:    fields[i].env,
+			Value:  value,
+			Source: c.SourceOf(fields[i].key),
+		})
+	}
+	return values
+}
+
+// Set installs c as the process-wide configuration.
+func Set(c *Config) {
+	mu.Lock()
+	defer mu.Unlock()
+	current = c
+}
+
+// Get returns the process-wide configuration. Until Set is called it is
+// rebuilt from defaults and the environment on every call, which keeps code
+// paths that are exercised without a loaded config (tests, tools) working.
+func Get() *Config {
+	mu.RLock()
+	c := current
+	mu.RUnlock()
+	if c != nil {
+		return c
+	}
+	c = Default()
+	c.applyEnv()
+	return c
+}
@@ -0,0 +1,193 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// clearEnv unsets every configuration environment variable for the duration of a test.
+func clearEnv(t *testing.T) {
+	t.Helper()
+	for _, name := range []string{FileEnv, "CONFIG", "DATA", "LOCAL_DIR", "PORT", "PUID", "PGID", "CHECK_FREQUENCY", "MIN_FREE_SPACE_MB", "SHUTDOWN_TIMEOUT", "FEED_PAGE_SIZE", "PASSWORD", "PLAYLIST_TOKEN", "LOG_LEVEL", "PODCASTINDEX_KEY", "PODCASTINDEX_SECRET",
+		"SECRET_KEY", "PROXY_URL", "CA_BUNDLE", "CONNECT_TIMEOUT", "READ_TIMEOUT",
+		"FFMPEG_PATH", "TRANSCODE_CACHE_MB"} {
+		t.Setenv(name, "")
+		require.NoError(t, os.Unsetenv(name))
+	}
+}
+
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), DefaultFileName)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+// TestLoad_Defaults tests loading without a file or environment.
+func TestLoad_Defaults(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("CONFIG", t.TempDir())
+
+	cfg, err := Load("")
+	require.NoError(t, err)
+	assert.Equal(t, 30, cfg.CheckFrequency)
+	assert.Equal(t, "info", cfg.LogLevel)
+	assert.Equal(t, 20, cfg.ShutdownTimeout)
+	assert.Equal(t, 100, cfg.FeedPageSize)
+	assert.Equal(t, 8080, cfg.Port)
+	assert.Equal(t, -1, cfg.PUID, "Ownership should be left to the process")
+	assert.Equal(t, -1, cfg.PGID, "Ownership should be left to the process")
+	assert.Equal(t, HTTP{ConnectTimeout: 30, ReadTimeout: 120}, cfg.HTTP)
+	assert.Equal(t, Transcoding{CacheMB: 1024}, cfg.Transcoding)
+	assert.Empty(t, cfg.File, "No config file should be recorded")
+	assert.Equal(t, SourceDefault, cfg.SourceOf("check_frequency"))
+	assert.Equal(t, SourceEnv, cfg.SourceOf("config_dir"))
+}
+
+// TestLoad_FileAndEnvPrecedence tests that env vars override the file and the file overrides defaults.
+func TestLoad_FileAndEnvPrecedence(t *testing.T) {
+	clearEnv(t)
+	path := writeConfigFile(t, `
+check_frequency: 15
+log_level: debug
+podcastindex:
+  key: file-key
+  secret: file-secret
+`)
+	t.Setenv("LOG_LEVEL", "warn")
+
+	cfg, err := Load(path)
+	require.NoError(t, err)
+	assert.Equal(t, path, cfg.File)
+	assert.Equal(t, 15, cfg.CheckFrequency)
+	assert.Equal(t, SourceFile, cfg.SourceOf("check_frequency"))
+	assert.Equal(t, "warn", cfg.LogLevel)
+	assert.Equal(t, SourceEnv, cfg.SourceOf("log_level"))
+	assert.Equal(t, "file-key", cfg.PodcastIndex.Key)
+	assert.Equal(t, SourceFile, cfg.SourceOf("podcastindex.secret"))
+	assert.Equal(t, SourceDefault, cfg.SourceOf("password"))
+}
+
+// TestLoad_DefaultFileInConfigDir tests that podgrab.yml in CONFIG is picked up automatically.
+func TestLoad_DefaultFileInConfigDir(t *testing.T) {
+	clearEnv(t)
+	path := writeConfigFile(t, "check_frequency: 45\n")
+	t.Setenv("CONFIG", filepath.Dir(path))
+
+	cfg, err := Load("")
+	require.NoError(t, err)
+	assert.Equal(t, path, cfg.File)
+	assert.Equal(t, 45, cfg.CheckFrequency)
+}
+
+// TestLoad_Errors tests that invalid configuration is reported clearly.
+func TestLoad_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		env     map[string]string
+		missing bool
+		wantErr string
+	}{
+		{name: "unknown_key", file: "check_frequncy: 10\n", wantErr: "check_frequncy"},
+		{name: "bad_yaml", file: "check_frequency: [\n", wantErr: "reading config file"},
+		{name: "explicit_file_missing", missing: true, wantErr: "reading config file"},
+		{name: "non_numeric_env", env: map[string]string{"CHECK_FREQUENCY": "often"}, wantErr: `CHECK_FREQUENCY: "often" is not a whole number`},
+		{name: "frequency_out_of_range", file: "check_frequency: 0\n", wantErr: "outside 1-1440"},
+		{name: "negative_free_space", env: map[string]string{"MIN_FREE_SPACE_MB": "-1"}, wantErr: "must not be negative"},
+		{name: "negative_feed_page_size", file: "feed_page_size: -1\n", wantErr: "feed_page_size (FEED_PAGE_SIZE)"},
+		{name: "port_out_of_range", env: map[string]string{"PORT": "70000"}, wantErr: "port (PORT)"},
+		{name: "non_numeric_port", env: map[string]string{"PORT": "http"}, wantErr: `PORT: "http" is not a whole number`},
+		{name: "puid_without_pgid", env: map[string]string{"PUID": "1000"}, wantErr: "must be set together"},
+		{name: "negative_pgid", file: "puid: 1000\npgid: -2\n", wantErr: "pgid (PGID)"},
+		{name: "zero_shutdown_timeout", env: map[string]string{"SHUTDOWN_TIMEOUT": "0"}, wantErr: "at least 1 second"},
+		{name: "bad_log_level", env: map[string]string{"LOG_LEVEL": "loud"}, wantErr: "log_level"},
+		{name: "missing_local_dir", env: map[string]string{"LOCAL_DIR": "/nonexistent/recordings"}, wantErr: "local_dir (LOCAL_DIR)"},
+		{name: "half_podcastindex_credentials", file: "podcastindex:\n  key: only-key\n", wantErr: "key and secret"},
+		{name: "bad_proxy_scheme", env: map[string]string{"PROXY_URL": "ftp://proxy:21"}, wantErr: "http.proxy (PROXY_URL)"},
+		{name: "missing_ca_bundle", env: map[string]string{"CA_BUNDLE": "/nonexistent/ca.pem"}, wantErr: "http.ca_bundle (CA_BUNDLE)"},
+		{name: "ca_bundle_without_certificates", file: "http:\n  ca_bundle: " + os.Args[0] + "\n", wantErr: "holds no PEM certificates"},
+		{name: "zero_read_timeout", file: "http:\n  read_timeout: 0\n", wantErr: "http.read_timeout"},
+		{name: "missing_ffmpeg", env: map[string]string{"FFMPEG_PATH": "/nonexistent/ffmpeg"}, wantErr: "transcoding.ffmpeg (FFMPEG_PATH)"},
+		{name: "negative_transcode_cache", file: "transcoding:\n  cache_mb: -1\n", wantErr: "transcoding.cache_mb"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearEnv(t)
+			t.Setenv("CONFIG", t.TempDir())
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+			path := ""
+			switch {
+			case tt.missing:
+				path = filepath.Join(t.TempDir(), "missing.yml")
+			case tt.file != "":
+				path = writeConfigFile(t, tt.file)
+			}
+
+			_, err := Load(path)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+// TestLoad_HTTP tests reading the HTTP client settings from the file and environment.
+func TestLoad_HTTP(t *testing.T) {
+	clearEnv(t)
+	path := writeConfigFile(t, `
+http:
+  proxy: socks5://proxy.local:1080
+  connect_timeout: 5
+`)
+	t.Setenv("READ_TIMEOUT", "300")
+
+	cfg, err := Load(path)
+	require.NoError(t, err)
+	assert.Equal(t, HTTP{Proxy: "socks5://proxy.local:1080", ConnectTimeout: 5, ReadTimeout: 300}, cfg.HTTP)
+	assert.Equal(t, SourceFile, cfg.SourceOf("http.proxy"))
+	assert.Equal(t, SourceEnv, cfg.SourceOf("http.read_timeout"))
+}
+
+// TestEffective_MasksSecrets tests that secrets are not exposed in the effective view.
+func TestEffective_MasksSecrets(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("CONFIG", t.TempDir())
+	t.Setenv("PASSWORD", "hunter2")
+	t.Setenv("PLAYLIST_TOKEN", "car-stereo")
+
+	cfg, err := Load("")
+	require.NoError(t, err)
+	assert.Equal(t, "car-stereo", cfg.PlaylistToken)
+
+	for _, value := range cfg.Effective() {
+		if value.Key == "password" || value.Key == "playlist_token" {
+			assert.Equal(t, "********", value.Value)
+			assert.Equal(t, SourceEnv, value.Source)
+		}
+		assert.NotEqual(t, "hunter2", value.Value, "Secret should be masked for %s", value.Key)
+		assert.NotEqual(t, "car-stereo", value.Value, "Secret should be masked for %s", value.Key)
+	}
+}
+
+// TestGet_FallsBackToEnvironment tests that Get reflects the environment until Set is called.
+func TestGet_FallsBackToEnvironment(t *testing.T) {
+	clearEnv(t)
+	Set(nil)
+	t.Setenv("DATA", "/first")
+	assert.Equal(t, "/first", Get().DataDir)
+	t.Setenv("DATA", "/second")
+	assert.Equal(t, "/second", Get().DataDir)
+
+	loaded := Default()
+	loaded.DataDir = "/loaded"
+	Set(loaded)
+	defer Set(nil)
+	assert.Equal(t, "/loaded", Get().DataDir)
+}
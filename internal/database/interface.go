@@ -72,5 +72,7 @@ type Repository interface {
 	GetLock(name string) *db.JobLock
 	Lock(name string, duration int)
 	Unlock(name string)
-	UnlockMissedJobs()
+	AcquireLock(name, owner string, duration int, lease time.Duration) (bool, error)
+	RenewLock(name, owner string, lease time.Duration) (bool, error)
+	ReleaseLock(name, owner string) error
 }
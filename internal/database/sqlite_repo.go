@@ -294,7 +294,17 @@ func (r *SQLiteRepository) Unlock(name string) {
 	db.Unlock(name)
 }
 
-// UnlockMissedJobs releases locks for jobs that have exceeded their duration.
-func (r *SQLiteRepository) UnlockMissedJobs() {
-	db.UnlockMissedJobs()
+// AcquireLock takes a job lock for owner unless another owner holds an unexpired lease.
+func (r *SQLiteRepository) AcquireLock(name, owner string, duration int, lease time.Duration) (bool, error) {
+	return db.AcquireLock(name, owner, duration, lease)
+}
+
+// RenewLock extends owner's lease on a job lock.
+func (r *SQLiteRepository) RenewLock(name, owner string, lease time.Duration) (bool, error) {
+	return db.RenewLock(name, owner, lease)
+}
+
+// ReleaseLock releases a job lock held by owner.
+func (r *SQLiteRepository) ReleaseLock(name, owner string) error {
+	return db.ReleaseLock(name, owner)
 }
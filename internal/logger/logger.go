@@ -3,6 +3,7 @@ package logger
 
 import (
 	"os"
+	"strings"
 
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
@@ -11,6 +12,8 @@ import (
 var (
 	// Log is the global logger instance
 	Log *zap.SugaredLogger
+
+	level = zap.NewAtomicLevelAt(zapcore.InfoLevel)
 )
 
 func init() {
@@ -22,19 +25,8 @@ func Initialize() {
 	config := zap.NewProductionConfig()
 
 	// Set log level from environment or default to info
-	logLevel := os.Getenv("LOG_LEVEL")
-	switch logLevel {
-	case "debug", "DEBUG":
-		config.Level = zap.NewAtomicLevelAt(zapcore.DebugLevel)
-	case "info", "INFO":
-		config.Level = zap.NewAtomicLevelAt(zapcore.InfoLevel)
-	case "warn", "WARN", "warning", "WARNING":
-		config.Level = zap.NewAtomicLevelAt(zapcore.WarnLevel)
-	case "error", "ERROR":
-		config.Level = zap.NewAtomicLevelAt(zapcore.ErrorLevel)
-	default:
-		config.Level = zap.NewAtomicLevelAt(zapcore.InfoLevel)
-	}
+	SetLevel(os.Getenv("LOG_LEVEL"))
+	config.Level = level
 
 	// Use a more human-readable output format in development
 	if os.Getenv("GIN_MODE") != "release" {
@@ -43,7 +35,9 @@ func Initialize() {
 		config.EncoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder
 	}
 
-	logger, err := config.Build()
+	logger, err := config.Build(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		return redactCore{core}
+	}))
 	if err != nil {
 		// Fallback to no-op logger if initialization fails
 		logger = zap.NewNop()
@@ -52,6 +46,20 @@ func Initialize() {
 	Log = logger.Sugar()
 }
 
+// SetLevel changes the minimum level of the global logger. Unknown values fall back to info.
+func SetLevel(logLevel string) {
+	switch strings.ToLower(logLevel) {
+	case "debug":
+		level.SetLevel(zapcore.DebugLevel)
+	case "warn", "warning":
+		level.SetLevel(zapcore.WarnLevel)
+	case "error":
+		level.SetLevel(zapcore.ErrorLevel)
+	default:
+		level.SetLevel(zapcore.InfoLevel)
+	}
+}
+
 // Sync flushes any buffered log entries
 func Sync() {
 	if Log != nil {
@@ -0,0 +1,51 @@
+package logger
+
+import (
+	"fmt"
+
+	"github.com/akhilrex/podgrab/internal/redact"
+	"go.uber.org/zap/zapcore"
+)
+
+// redactCore masks credentials in messages and string, error and stringer
+// fields before they are written, so feed tokens quoted in URLs and errors
+// do not end up in the logs.
+type redactCore struct {
+	zapcore.Core
+}
+
+func (c redactCore) With(fields []zapcore.Field) zapcore.Core {
+	return redactCore{c.Core.With(redactFields(fields))}
+}
+
+func (c redactCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return checked.AddCore(entry, c)
+	}
+	return checked
+}
+
+func (c redactCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	entry.Message = redact.String(entry.Message)
+	return c.Core.Write(entry, redactFields(fields))
+}
+
+func redactFields(fields []zapcore.Field) []zapcore.Field {
+	redacted := make([]zapcore.Field, len(fields))
+	for i, field := range fields {
+		switch field.Type {
+		case zapcore.StringType:
+			field.String = redact.String(field.String)
+		case zapcore.ErrorType:
+			if err, ok := field.Interface.(error); ok && err != nil {
+				field = zapcore.Field{Key: field.Key, Type: zapcore.StringType, String: redact.String(err.Error())}
+			}
+		case zapcore.StringerType:
+			if stringer, ok := field.Interface.(fmt.Stringer); ok && stringer != nil {
+				field = zapcore.Field{Key: field.Key, Type: zapcore.StringType, String: redact.String(stringer.String())}
+			}
+		}
+		redacted[i] = field
+	}
+	return redacted
+}
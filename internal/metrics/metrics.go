@@ -0,0 +1,237 @@
+// Package metrics exposes Podgrab's Prometheus metrics.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/akhilrex/podgrab/db"
+	"github.com/akhilrex/podgrab/internal/logger"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "podgrab"
+
+// Result label values.
+const (
+	ResultSuccess = "success"
+	ResultFailure = "failure"
+)
+
+var registry = prometheus.NewRegistry()
+
+var (
+	// FeedRefreshes counts feed refreshes per podcast and result. Podcasts
+	// are labelled by ID, which unlike the title never changes.
+	FeedRefreshes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "feed_refreshes_total",
+		Help:      "Feed refreshes by podcast ID and result.",
+	}, []string{"podcast_id", "result"})
+
+	// FeedRefreshDuration observes how long feed refreshes take.
+	FeedRefreshDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "feed_refresh_duration_seconds",
+		Help:      "Time taken to fetch and process a feed.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"result"})
+
+	// DownloadedBytes counts bytes written by episode downloads.
+	DownloadedBytes = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "downloaded_bytes_total",
+		Help:      "Bytes downloaded for episodes.",
+	})
+
+	// DownloadDuration observes how long successful episode downloads take.
+	DownloadDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "download_duration_seconds",
+		Help:      "Time taken to download an episode.",
+		Buckets:   []float64{1, 5, 15, 30, 60, 120, 300, 600, 1800},
+	})
+
+	// DownloadFailures counts failed episode downloads.
+	DownloadFailures = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "download_failures_total",
+		Help:      "Episode downloads that failed.",
+	})
+
+	// DownloadQueueDepth is the number of episodes waiting in the running download job.
+	DownloadQueueDepth = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "download_queue_depth",
+		Help:      "Episodes waiting to be downloaded by the current download job.",
+	})
+
+	// HostThrottles counts responses from remote hosts asking Podgrab to slow down.
+	HostThrottles = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "host_throttles_total",
+		Help:      "Responses asking Podgrab to slow down, by remote host.",
+	}, []string{"host"})
+
+	// WebsocketConnections is the number of open websocket connections.
+	WebsocketConnections = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "websocket_connections",
+		Help:      "Open websocket connections.",
+	})
+
+	// HTTPRequestDuration observes request latency per gin route.
+	HTTPRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by method, route and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		FeedRefreshes,
+		FeedRefreshDuration,
+		DownloadedBytes,
+		DownloadDuration,
+		DownloadFailures,
+		DownloadQueueDepth,
+		HostThrottles,
+		WebsocketConnections,
+		HTTPRequestDuration,
+		&databaseCollector{},
+	)
+}
+
+// Handler serves the registered metrics in the Prometheus exposition format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+// Middleware records request latency for every gin route.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		HTTPRequestDuration.WithLabelValues(c.Request.Method, route, strconv.Itoa(c.Writer.Status())).
+			Observe(time.Since(start).Seconds())
+	}
+}
+
+// ObserveFeedRefresh records the outcome of refreshing the feed of the podcast
+// with podcastID.
+func ObserveFeedRefresh(podcastID string, start time.Time, err error) {
+	result := resultOf(err)
+	FeedRefreshes.WithLabelValues(podcastID, result).Inc()
+	FeedRefreshDuration.WithLabelValues(result).Observe(time.Since(start).Seconds())
+}
+
+// ForgetPodcast removes the series of a deleted podcast.
+func ForgetPodcast(podcastID string) {
+	FeedRefreshes.DeletePartialMatch(prometheus.Labels{"podcast_id": podcastID})
+}
+
+// ObserveDownload records the outcome of an episode download.
+func ObserveDownload(start time.Time, written int64, err error) {
+	DownloadedBytes.Add(float64(written))
+	if err != nil {
+		DownloadFailures.Inc()
+		return
+	}
+	DownloadDuration.Observe(time.Since(start).Seconds())
+}
+
+func resultOf(err error) string {
+	if err != nil {
+		return ResultFailure
+	}
+	return ResultSuccess
+}
+
+// databaseCollector reads episode, disk and job lock state from the database
+// on every scrape.
+type databaseCollector struct{}
+
+var (
+	episodesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "episodes"),
+		"Episodes by download status.",
+		[]string{"status"}, nil)
+	episodeBytesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "episode_bytes"),
+		"Size of episodes by download status.",
+		[]string{"status"}, nil)
+	pendingBytesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "pending_download_bytes"),
+		"Size of episodes still waiting to be downloaded.",
+		nil, nil)
+	jobLockedDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "job_locked"),
+		"Whether a background job currently holds its lock (1) or not (0).",
+		[]string{"job"}, nil)
+)
+
+func (collector *databaseCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- episodesDesc
+	ch <- episodeBytesDesc
+	ch <- pendingBytesDesc
+	ch <- jobLockedDesc
+}
+
+func (collector *databaseCollector) Collect(ch chan<- prometheus.Metric) {
+	if db.DB == nil {
+		return
+	}
+
+	statuses := []db.DownloadStatus{db.NotDownloaded, db.Downloading, db.Downloaded, db.Deleted}
+	counts := make(map[db.DownloadStatus]int, len(statuses))
+	if stats, err := db.GetPodcastEpisodeStats(); err != nil {
+		logger.Log.Errorw("collecting episode metrics", "error", err)
+	} else {
+		for _, stat := range *stats {
+			counts[stat.DownloadStatus] += stat.Count
+		}
+		for _, status := range statuses {
+			ch <- prometheus.MustNewConstMetric(episodesDesc, prometheus.GaugeValue, float64(counts[status]), status.String())
+		}
+	}
+
+	if disk, err := db.GetPodcastEpisodeDiskStats(); err != nil {
+		logger.Log.Errorw("collecting disk metrics", "error", err)
+	} else {
+		sizes := map[db.DownloadStatus]int64{
+			db.NotDownloaded: disk.NotDownloaded,
+			db.Downloading:   disk.Downloading,
+			db.Downloaded:    disk.Downloaded,
+			db.Deleted:       disk.Deleted,
+		}
+		for _, status := range statuses {
+			ch <- prometheus.MustNewConstMetric(episodeBytesDesc, prometheus.GaugeValue, float64(sizes[status]), status.String())
+		}
+		ch <- prometheus.MustNewConstMetric(pendingBytesDesc, prometheus.GaugeValue, float64(disk.PendingDownload))
+	}
+
+	if locks, err := db.GetAllJobLocks(); err != nil {
+		logger.Log.Errorw("collecting job lock metrics", "error", err)
+	} else {
+		for i := range *locks {
+			locked := 0.0
+			if (*locks)[i].IsLocked() {
+				locked = 1
+			}
+			ch <- prometheus.MustNewConstMetric(jobLockedDesc, prometheus.GaugeValue, locked, (*locks)[i].Name)
+		}
+	}
+}
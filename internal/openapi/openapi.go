@@ -0,0 +1,414 @@
+// Package openapi generates an OpenAPI 3 document from the routes of an API
+// and the Go types they bind and return.
+//
+// Schemas follow the json tags of the types. Parameters follow the uri and
+// form tags gin binds, and the binding tag marks them required and adds
+// enumerations and bounds from its oneof, min and max rules.
+package openapi
+
+import (
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Version is the OpenAPI version of generated documents.
+const Version = "3.0.3"
+
+// Document is an OpenAPI document.
+type Document struct {
+	Paths      map[string]PathItem `json:"paths"`
+	Components Components          `json:"components"`
+	Info       Info                `json:"info"`
+	OpenAPI    string              `json:"openapi"`
+	Servers    []Server            `json:"servers,omitempty"`
+	Security   []map[string][]any  `json:"security,omitempty"`
+
+	errorSchema *Schema
+	names       map[reflect.Type]string
+}
+
+// Info describes the API.
+type Info struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+// Server is a base URL of the API.
+type Server struct {
+	URL string `json:"url"`
+}
+
+// PathItem holds the operations of a path by lower case method.
+type PathItem map[string]*Operation
+
+// Components holds the schemas of named types.
+type Components struct {
+	Schemas         map[string]*Schema        `json:"schemas"`
+	SecuritySchemes map[string]SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+// SecurityScheme describes how requests authenticate.
+type SecurityScheme struct {
+	Type   string `json:"type"`
+	Scheme string `json:"scheme,omitempty"`
+}
+
+// Operation is a method on a path.
+type Operation struct {
+	RequestBody *RequestBody        `json:"requestBody,omitempty"`
+	Responses   map[string]Response `json:"responses"`
+	OperationID string              `json:"operationId"`
+	Summary     string              `json:"summary,omitempty"`
+	Tags        []string            `json:"tags,omitempty"`
+	Parameters  []Parameter         `json:"parameters,omitempty"`
+}
+
+// Parameter is a path or query parameter.
+type Parameter struct {
+	Schema   *Schema `json:"schema"`
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required,omitempty"`
+}
+
+// RequestBody is the JSON or multipart body of a request.
+type RequestBody struct {
+	Content  map[string]MediaType `json:"content"`
+	Required bool                 `json:"required"`
+}
+
+// Response is a response of an operation.
+type Response struct {
+	Content     map[string]MediaType `json:"content,omitempty"`
+	Description string               `json:"description"`
+}
+
+// MediaType is the schema of a body.
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Schema describes a value.
+type Schema struct {
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+}
+
+// Route documents a route of the API.
+type Route struct {
+	// Params is a struct whose uri and form fields are the path and query
+	// parameters, or nil.
+	Params any
+	// Body is the JSON request body, or nil.
+	Body any
+	// Upload names the multipart/form-data field of the files uploaded with
+	// the request, for routes without a JSON Body.
+	Upload string
+	// Response is the JSON body of successful responses, or nil for none.
+	Response any
+	// Media is the type of binary successful responses, such as audio/*,
+	// for routes without a JSON Response.
+	Media  string
+	Method string
+	// Path uses gin's :name syntax for parameters.
+	Path    string
+	ID      string
+	Summary string
+	Tag     string
+	// Status of successful responses. Zero is 200.
+	Status int
+	// Errors lists error statuses besides those every route can return.
+	Errors []int
+}
+
+// New returns a document for an API at serverURL whose errors respond with
+// errorBody.
+func New(info Info, serverURL string, errorBody any) *Document {
+	doc := &Document{
+		OpenAPI:    Version,
+		Info:       info,
+		Servers:    []Server{{URL: serverURL}},
+		Paths:      make(map[string]PathItem),
+		Components: Components{Schemas: make(map[string]*Schema)},
+		names:      make(map[reflect.Type]string),
+	}
+	doc.errorSchema = doc.SchemaOf(errorBody)
+	return doc
+}
+
+// UseBasicAuth requires HTTP basic authentication for every operation.
+func (doc *Document) UseBasicAuth() {
+	doc.Components.SecuritySchemes = map[string]SecurityScheme{"basicAuth": {Type: "http", Scheme: "basic"}}
+	doc.Security = []map[string][]any{{"basicAuth": {}}}
+}
+
+// Add documents route.
+func (doc *Document) Add(route *Route) {
+	path, pathParams := convertPath(route.Path)
+	operation := &Operation{
+		OperationID: route.ID,
+		Summary:     route.Summary,
+		Responses:   make(map[string]Response),
+	}
+	if route.Tag != "" {
+		operation.Tags = []string{route.Tag}
+	}
+	if route.Params != nil {
+		operation.Parameters = doc.parameters(reflect.TypeOf(route.Params), pathParams)
+	}
+	if route.Body != nil {
+		operation.RequestBody = &RequestBody{
+			Required: true,
+			Content:  map[string]MediaType{"application/json": {Schema: doc.SchemaOf(route.Body)}},
+		}
+	}
+	if route.Upload != "" {
+		files := &Schema{Type: "array", Items: &Schema{Type: "string", Format: "binary"}}
+		operation.RequestBody = &RequestBody{
+			Required: true,
+			Content: map[string]MediaType{"multipart/form-data": {Schema: &Schema{
+				Type:       "object",
+				Properties: map[string]*Schema{route.Upload: files},
+				Required:   []string{route.Upload},
+			}}},
+		}
+	}
+
+	status := route.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	success := Response{Description: http.StatusText(status)}
+	if route.Response != nil {
+		success.Content = map[string]MediaType{"application/json": {Schema: doc.SchemaOf(route.Response)}}
+	} else if route.Media != "" {
+		success.Content = map[string]MediaType{route.Media: {Schema: &Schema{Type: "string", Format: "binary"}}}
+	}
+	operation.Responses[strconv.Itoa(status)] = success
+
+	errorStatuses := append([]int{http.StatusInternalServerError}, route.Errors...)
+	if route.Params != nil || route.Body != nil || route.Upload != "" {
+		errorStatuses = append(errorStatuses, http.StatusBadRequest)
+	}
+	if len(pathParams) > 0 {
+		errorStatuses = append(errorStatuses, http.StatusNotFound)
+	}
+	for _, code := range errorStatuses {
+		operation.Responses[strconv.Itoa(code)] = Response{
+			Description: http.StatusText(code),
+			Content:     map[string]MediaType{"application/json": {Schema: doc.errorSchema}},
+		}
+	}
+
+	if doc.Paths[path] == nil {
+		doc.Paths[path] = make(PathItem)
+	}
+	doc.Paths[path][strings.ToLower(route.Method)] = operation
+}
+
+// convertPath turns gin's :name and *name parameters into OpenAPI's {name}
+// and returns the parameter names.
+func convertPath(path string) (string, map[string]bool) {
+	params := make(map[string]bool)
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+			params[segment[1:]] = true
+			segments[i] = "{" + segment[1:] + "}"
+		}
+	}
+	return strings.Join(segments, "/"), params
+}
+
+// parameters lists the fields of the struct type params bound from the path
+// and the query.
+func (doc *Document) parameters(params reflect.Type, pathParams map[string]bool) []Parameter {
+	for params.Kind() == reflect.Pointer {
+		params = params.Elem()
+	}
+	var result []Parameter
+	for i := 0; i < params.NumField(); i++ {
+		field := params.Field(i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			result = append(result, doc.parameters(field.Type, pathParams)...)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		rules := bindingRules(field)
+		if name := tagName(field, "uri"); pathParams[name] {
+			result = append(result, Parameter{Name: name, In: "path", Required: true, Schema: doc.fieldSchema(field, rules)})
+			continue
+		}
+		if name := tagName(field, "form"); name != "" {
+			_, required := rules["required"]
+			result = append(result, Parameter{Name: name, In: "query", Required: required, Schema: doc.fieldSchema(field, rules)})
+		}
+	}
+	return result
+}
+
+func tagName(field reflect.StructField, key string) string {
+	name, _, _ := strings.Cut(field.Tag.Get(key), ",")
+	if name == "-" {
+		return ""
+	}
+	return name
+}
+
+// bindingRules parses the validation rules of field's binding tag.
+func bindingRules(field reflect.StructField) map[string]string {
+	rules := make(map[string]string)
+	for _, rule := range strings.Split(field.Tag.Get("binding"), ",") {
+		name, value, _ := strings.Cut(rule, "=")
+		if name != "" {
+			rules[name] = value
+		}
+	}
+	return rules
+}
+
+// fieldSchema returns the schema of field with the bounds and values its
+// binding rules allow.
+func (doc *Document) fieldSchema(field reflect.StructField, rules map[string]string) *Schema {
+	schema := doc.schemaOfType(field.Type)
+	if schema.Ref != "" || len(rules) == 0 {
+		return schema
+	}
+	target := schema
+	if target.Type == "array" && target.Items != nil && target.Items.Ref == "" {
+		// dive applies the remaining rules to the elements
+		if _, dive := rules["dive"]; !dive {
+			return schema
+		}
+		target = target.Items
+	}
+	if values, ok := rules["oneof"]; ok {
+		target.Enum = strings.Fields(values)
+	}
+	if target.Type == "integer" || target.Type == "number" {
+		if value, err := strconv.ParseFloat(rules["min"], 64); err == nil {
+			target.Minimum = &value
+		}
+		if value, err := strconv.ParseFloat(rules["max"], 64); err == nil {
+			target.Maximum = &value
+		}
+	}
+	return schema
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// SchemaOf returns the schema of value's type, adding named struct types to
+// the document's components.
+func (doc *Document) SchemaOf(value any) *Schema {
+	return doc.schemaOfType(reflect.TypeOf(value))
+}
+
+func (doc *Document) schemaOfType(t reflect.Type) *Schema {
+	switch t.Kind() {
+	case reflect.Pointer:
+		schema := doc.schemaOfType(t.Elem())
+		if schema.Ref == "" {
+			schema.Nullable = true
+		}
+		return schema
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: doc.schemaOfType(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: doc.schemaOfType(t.Elem())}
+	case reflect.Struct:
+		if t == timeType {
+			return &Schema{Type: "string", Format: "date-time"}
+		}
+		if t.Name() == "" {
+			return doc.structSchema(t)
+		}
+		return &Schema{Ref: "#/components/schemas/" + doc.component(t)}
+	default:
+		return &Schema{}
+	}
+}
+
+// component adds the named struct type t to the components and returns its
+// name.
+func (doc *Document) component(t reflect.Type) string {
+	if name, ok := doc.names[t]; ok {
+		return name
+	}
+	name := t.Name()
+	if _, taken := doc.Components.Schemas[name]; taken {
+		pkg := t.PkgPath()
+		name = pkg[strings.LastIndex(pkg, "/")+1:] + "." + name
+	}
+	doc.names[t] = name
+	// Registered before the fields so recursive types refer to themselves
+	doc.Components.Schemas[name] = &Schema{}
+	*doc.Components.Schemas[name] = *doc.structSchema(t)
+	return name
+}
+
+func (doc *Document) structSchema(t reflect.Type) *Schema {
+	schema := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	doc.addFields(schema, t)
+	sort.Strings(schema.Required)
+	return schema
+}
+
+// addFields adds the JSON fields of struct type t to schema, flattening
+// embedded structs like encoding/json.
+func (doc *Document) addFields(schema *Schema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			doc.addFields(schema, field.Type)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		rules := bindingRules(field)
+		if _, required := rules["required"]; required {
+			schema.Required = append(schema.Required, name)
+		}
+		schema.Properties[name] = doc.fieldSchema(field, rules)
+	}
+}
@@ -0,0 +1,138 @@
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testError struct {
+	Message string `json:"message"`
+}
+
+type testEnvelope struct {
+	Error testError `json:"error"`
+}
+
+type testBase struct {
+	ID      string    `json:"id"`
+	Created time.Time `json:"createdAt"`
+}
+
+type testNode struct {
+	testBase
+	Parent   *testNode         `json:"parent"`
+	Labels   map[string]string `json:"labels"`
+	Secret   string            `json:"-"`
+	Name     string            `json:"name" binding:"required"`
+	Children []testNode        `json:"children,omitempty"`
+	Size     *int64            `json:"size"`
+	Kind     string            `json:"kind" binding:"omitempty,oneof=leaf branch"`
+}
+
+type testPage struct {
+	Page  int `form:"page" binding:"omitempty,min=1"`
+	Count int `form:"count" binding:"omitempty,min=1,max=100"`
+}
+
+type testQuery struct {
+	ID   string   `uri:"id" binding:"required"`
+	Sort string   `form:"sort" binding:"omitempty,oneof=name date"`
+	Tags []string `form:"tags"`
+	testPage
+}
+
+// TestSchemaOf tests generating schemas from Go types.
+func TestSchemaOf(t *testing.T) {
+	doc := New(Info{Title: "Test", Version: "1"}, "/api", testEnvelope{})
+
+	schema := doc.SchemaOf([]testNode{})
+	assert.Equal(t, "array", schema.Type)
+	assert.Equal(t, "#/components/schemas/testNode", schema.Items.Ref)
+
+	node := doc.Components.Schemas["testNode"]
+	require.NotNil(t, node)
+	assert.Equal(t, "object", node.Type)
+	assert.ElementsMatch(t, []string{"id", "createdAt", "parent", "labels", "name", "children", "size", "kind"}, keys(node.Properties))
+	assert.Equal(t, []string{"name"}, node.Required)
+	assert.Equal(t, &Schema{Type: "string", Format: "date-time"}, node.Properties["createdAt"])
+	assert.Equal(t, "#/components/schemas/testNode", node.Properties["parent"].Ref)
+	assert.Equal(t, &Schema{Type: "object", AdditionalProperties: &Schema{Type: "string"}}, node.Properties["labels"])
+	assert.Equal(t, &Schema{Type: "integer", Format: "int64", Nullable: true}, node.Properties["size"])
+	assert.Equal(t, []string{"leaf", "branch"}, node.Properties["kind"].Enum)
+
+	assert.Equal(t, "#/components/schemas/testEnvelope", doc.errorSchema.Ref)
+	assert.Contains(t, doc.Components.Schemas, "testError")
+}
+
+// TestAdd tests documenting routes.
+func TestAdd(t *testing.T) {
+	doc := New(Info{Title: "Test", Version: "1"}, "/api", testEnvelope{})
+	doc.Add(&Route{
+		Method:   http.MethodGet,
+		Path:     "/nodes/:id/children",
+		ID:       "listChildren",
+		Tag:      "nodes",
+		Params:   testQuery{},
+		Response: []testNode{},
+	})
+	doc.Add(&Route{
+		Method: http.MethodDelete,
+		Path:   "/nodes/:id",
+		ID:     "deleteNode",
+		Params: testQuery{},
+		Status: http.StatusNoContent,
+		Errors: []int{http.StatusConflict},
+	})
+	doc.Add(&Route{Method: http.MethodPost, Path: "/nodes", ID: "addNode", Body: testNode{}, Response: testNode{}, Status: http.StatusCreated})
+	doc.Add(&Route{Method: http.MethodGet, Path: "/nodes/:id/file", ID: "getNodeFile", Params: testQuery{}, Media: "audio/*"})
+	doc.Add(&Route{Method: http.MethodPost, Path: "/nodes/:id/files", ID: "uploadNodeFiles", Params: testQuery{}, Upload: "files", Response: testNode{}})
+
+	list := doc.Paths["/nodes/{id}/children"]["get"]
+	require.NotNil(t, list)
+	assert.Equal(t, []string{"nodes"}, list.Tags)
+	require.Len(t, list.Parameters, 5)
+	assert.Equal(t, Parameter{Name: "id", In: "path", Required: true, Schema: &Schema{Type: "string"}}, list.Parameters[0])
+	assert.Equal(t, Parameter{Name: "sort", In: "query", Schema: &Schema{Type: "string", Enum: []string{"name", "date"}}}, list.Parameters[1])
+	assert.Equal(t, &Schema{Type: "array", Items: &Schema{Type: "string"}}, list.Parameters[2].Schema)
+	assert.Equal(t, "count", list.Parameters[4].Name)
+	assert.InDelta(t, 100, *list.Parameters[4].Schema.Maximum, 0)
+	assert.ElementsMatch(t, []string{"200", "400", "404", "500"}, keys(list.Responses))
+
+	remove := doc.Paths["/nodes/{id}"]["delete"]
+	require.NotNil(t, remove)
+	assert.Nil(t, remove.Responses["204"].Content)
+	assert.Equal(t, "#/components/schemas/testEnvelope", remove.Responses["409"].Content["application/json"].Schema.Ref)
+
+	add := doc.Paths["/nodes"]["post"]
+	require.NotNil(t, add)
+	assert.True(t, add.RequestBody.Required)
+	assert.ElementsMatch(t, []string{"201", "400", "500"}, keys(add.Responses))
+
+	file := doc.Paths["/nodes/{id}/file"]["get"]
+	require.NotNil(t, file)
+	assert.Equal(t, &Schema{Type: "string", Format: "binary"}, file.Responses["200"].Content["audio/*"].Schema)
+
+	upload := doc.Paths["/nodes/{id}/files"]["post"]
+	require.NotNil(t, upload)
+	form := upload.RequestBody.Content["multipart/form-data"].Schema
+	assert.Equal(t, []string{"files"}, form.Required)
+	assert.Equal(t, &Schema{Type: "string", Format: "binary"}, form.Properties["files"].Items)
+
+	body, err := json.Marshal(doc)
+	require.NoError(t, err)
+	assert.Contains(t, string(body), `"openapi":"3.0.3"`)
+	assert.Contains(t, string(body), `"$ref":"#/components/schemas/testNode"`)
+}
+
+func keys[V any](values map[string]V) []string {
+	result := make([]string, 0, len(values))
+	for key := range values {
+		result = append(result, key)
+	}
+	return result
+}
@@ -0,0 +1,100 @@
+// Package redact masks credentials in URLs and log output.
+//
+// Feed URLs of premium podcasts often carry a token in the query string or a
+// username and password, and errors from the HTTP client quote those URLs.
+package redact
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Mask replaces redacted values.
+const Mask = "********"
+
+// secretParams are the query parameters holding credentials, lower case.
+var secretParams = map[string]bool{
+	"access_token": true,
+	"api_key":      true,
+	"apikey":       true,
+	"auth":         true,
+	"key":          true,
+	"password":     true,
+	"secret":       true,
+	"sig":          true,
+	"signature":    true,
+	"token":        true,
+}
+
+var (
+	urlPattern    = regexp.MustCompile(`[a-zA-Z][a-zA-Z0-9+.-]*://[^\s"'<>]+`)
+	headerPattern = regexp.MustCompile(`(?i)\b(Bearer|Basic)\s+[A-Za-z0-9._~+/=-]+`)
+)
+
+// IsSecretParam reports whether the query parameter name holds credentials.
+func IsSecretParam(name string) bool {
+	return secretParams[strings.ToLower(name)]
+}
+
+// URL masks the password and secret query parameters of raw. Values that do
+// not parse as a URL are returned unchanged.
+func URL(raw string) string {
+	parsed, err := url.Parse(raw)
+	if err != nil || parsed.Host == "" {
+		return raw
+	}
+	changed := false
+	if _, hasPassword := parsed.User.Password(); hasPassword {
+		parsed.User = url.UserPassword(parsed.User.Username(), Mask)
+		changed = true
+	}
+	if query, masked := maskQuery(parsed.RawQuery); masked {
+		parsed.RawQuery = query
+		changed = true
+	}
+	if !changed {
+		return raw
+	}
+	// Keep the mask readable instead of percent-encoded
+	return strings.ReplaceAll(parsed.String(), url.QueryEscape(Mask), Mask)
+}
+
+// RequestURI masks the secret query parameters of a request URI such as
+// "/podcasts/1/playlist.m3u8?token=abc", which has no scheme or host.
+func RequestURI(uri string) string {
+	path, rawQuery, found := strings.Cut(uri, "?")
+	if !found {
+		return uri
+	}
+	if query, masked := maskQuery(rawQuery); masked {
+		return path + "?" + query
+	}
+	return uri
+}
+
+// maskQuery masks the secret parameters of a raw query string and reports
+// whether there were any.
+func maskQuery(rawQuery string) (string, bool) {
+	if rawQuery == "" {
+		return rawQuery, false
+	}
+	query, _ := url.ParseQuery(rawQuery) //nolint:errcheck // the parameters that did parse are still masked
+	masked := false
+	for name := range query {
+		if IsSecretParam(name) {
+			query.Set(name, Mask)
+			masked = true
+		}
+	}
+	if !masked {
+		return rawQuery, false
+	}
+	return strings.ReplaceAll(query.Encode(), url.QueryEscape(Mask), Mask), true
+}
+
+// String masks the URLs and authorization header values found in text.
+func String(text string) string {
+	text = urlPattern.ReplaceAllStringFunc(text, URL)
+	return headerPattern.ReplaceAllString(text, "$1 "+Mask)
+}
@@ -0,0 +1,162 @@
+// Package secrets encrypts credentials stored in the database.
+//
+// Values are sealed with AES-256-GCM. The key is derived from the configured
+// secret_key, or generated once and kept in KeyFileName in the config
+// directory. Losing the key makes the stored credentials unreadable.
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/akhilrex/podgrab/internal/config"
+)
+
+// KeyFileName is the generated key file in the config directory.
+const KeyFileName = "podgrab.key"
+
+// prefix marks sealed values and the format they are sealed in.
+const prefix = "v1:"
+
+// ErrDecrypt is returned for values that cannot be opened with the current key.
+var ErrDecrypt = errors.New("cannot decrypt secret")
+
+// ErrNoKey is returned when values are sealed or opened before Init or SetKey.
+var ErrNoKey = errors.New("secret key not loaded")
+
+var (
+	aead cipher.AEAD
+	mu   sync.Mutex
+)
+
+// Init loads the key of cfg, generating the key file if needed.
+func Init(cfg *config.Config) error {
+	key, err := loadKey(cfg)
+	if err != nil {
+		return err
+	}
+	return SetKey(key)
+}
+
+// SetKey sets the 32 byte key used to seal and open values.
+func SetKey(key []byte) error {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return err
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	aead = gcm
+	return nil
+}
+
+// Reset forgets the key, so values cannot be sealed or opened until Init or
+// SetKey is called again.
+func Reset() {
+	mu.Lock()
+	defer mu.Unlock()
+	aead = nil
+}
+
+func loadKey(cfg *config.Config) ([]byte, error) {
+	if cfg.SecretKey != "" {
+		sum := sha256.Sum256([]byte(cfg.SecretKey))
+		return sum[:], nil
+	}
+
+	path := filepath.Join(cfg.ConfigDir, KeyFileName)
+	content, err := os.ReadFile(path) //nolint:gosec // G304: path is in the operator's config directory
+	if err == nil {
+		key, decodeErr := base64.StdEncoding.DecodeString(strings.TrimSpace(string(content)))
+		if decodeErr != nil || len(key) != 32 {
+			return nil, fmt.Errorf("reading key file %s: not a base64 encoded 32 byte key", path)
+		}
+		return key, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("reading key file %s: %w", path, err)
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, []byte(base64.StdEncoding.EncodeToString(key)+"\n"), 0o600); err != nil {
+		return nil, fmt.Errorf("writing key file %s: %w", path, err)
+	}
+	return key, nil
+}
+
+// current returns the cipher. The key is never loaded or generated here, so a
+// missed Init cannot leave a stray key file that later values depend on.
+func current() (cipher.AEAD, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	if aead == nil {
+		return nil, ErrNoKey
+	}
+	return aead, nil
+}
+
+// Encrypt seals plaintext. An empty plaintext stays empty.
+func Encrypt(plaintext string) (string, error) {
+	if plaintext == "" {
+		return "", nil
+	}
+	gcm, err := current()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
+	return prefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// IsSealed reports whether value looks like it was sealed by Encrypt, so that
+// values stored before encryption was added can be told apart.
+func IsSealed(value string) bool {
+	return strings.HasPrefix(value, prefix)
+}
+
+// Decrypt opens a value sealed by Encrypt. An empty value stays empty.
+func Decrypt(sealed string) (string, error) {
+	if sealed == "" {
+		return "", nil
+	}
+	encoded, ok := strings.CutPrefix(sealed, prefix)
+	if !ok {
+		return "", fmt.Errorf("%w: unknown format", ErrDecrypt)
+	}
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrDecrypt, err)
+	}
+	gcm, err := current()
+	if err != nil {
+		return "", err
+	}
+	if len(raw) < gcm.NonceSize() {
+		return "", fmt.Errorf("%w: too short", ErrDecrypt)
+	}
+	plaintext, err := gcm.Open(nil, raw[:gcm.NonceSize()], raw[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("%w: wrong key or corrupted value", ErrDecrypt)
+	}
+	return string(plaintext), nil
+}
@@ -0,0 +1,96 @@
+package secrets
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/akhilrex/podgrab/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// useKey sets a key for the duration of a test.
+func useKey(t *testing.T, key []byte) {
+	t.Helper()
+	require.NoError(t, SetKey(key))
+	t.Cleanup(Reset)
+}
+
+// TestNoKey tests that values are not sealed or opened, and no key file is
+// generated, before a key is loaded.
+func TestNoKey(t *testing.T) {
+	Reset()
+	t.Chdir(t.TempDir())
+
+	_, err := Encrypt("hunter2")
+	assert.ErrorIs(t, err, ErrNoKey)
+	_, err = Decrypt("v1:AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA")
+	assert.ErrorIs(t, err, ErrNoKey)
+	assert.NoFileExists(t, KeyFileName)
+}
+
+// TestEncryptDecrypt tests sealing and opening values.
+func TestEncryptDecrypt(t *testing.T) {
+	useKey(t, bytes.Repeat([]byte("k"), 32))
+
+	sealed, err := Encrypt("hunter2")
+	require.NoError(t, err)
+	assert.NotContains(t, sealed, "hunter2")
+	again, err := Encrypt("hunter2")
+	require.NoError(t, err)
+	assert.NotEqual(t, sealed, again, "Each value should use a fresh nonce")
+
+	assert.True(t, IsSealed(sealed))
+	assert.False(t, IsSealed("hunter2"))
+
+	opened, err := Decrypt(sealed)
+	require.NoError(t, err)
+	assert.Equal(t, "hunter2", opened)
+
+	empty, err := Encrypt("")
+	require.NoError(t, err)
+	assert.Empty(t, empty)
+	opened, err = Decrypt("")
+	require.NoError(t, err)
+	assert.Empty(t, opened)
+
+	_, err = Decrypt("plaintext")
+	assert.ErrorIs(t, err, ErrDecrypt)
+	_, err = Decrypt(sealed[:len(sealed)-4] + "AAA=")
+	assert.ErrorIs(t, err, ErrDecrypt)
+
+	useKey(t, bytes.Repeat([]byte("x"), 32))
+	_, err = Decrypt(sealed)
+	assert.ErrorIs(t, err, ErrDecrypt, "Another key should not open the value")
+}
+
+// TestInit tests deriving the key from the configuration or a generated key file.
+func TestInit(t *testing.T) {
+	t.Cleanup(Reset)
+	dir := t.TempDir()
+	cfg := config.Default()
+	cfg.ConfigDir = dir
+
+	require.NoError(t, Init(cfg))
+	info, err := os.Stat(filepath.Join(dir, KeyFileName))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+	sealed, err := Encrypt("token")
+	require.NoError(t, err)
+
+	require.NoError(t, Init(cfg))
+	opened, err := Decrypt(sealed)
+	require.NoError(t, err)
+	assert.Equal(t, "token", opened, "The generated key should be reused")
+
+	cfg.SecretKey = "configured"
+	require.NoError(t, Init(cfg))
+	_, err = Decrypt(sealed)
+	assert.ErrorIs(t, err, ErrDecrypt, "A configured key should replace the key file")
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, KeyFileName), []byte("short"), 0o600))
+	cfg.SecretKey = ""
+	assert.Error(t, Init(cfg))
+}
@@ -4,10 +4,12 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/akhilrex/podgrab/db"
 	applogger "github.com/akhilrex/podgrab/internal/logger"
+	"github.com/akhilrex/podgrab/internal/secrets"
 	"github.com/google/uuid"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
@@ -33,10 +35,19 @@ func SetupTestDB(t *testing.T) *gorm.DB {
 	err = database.AutoMigrate(
 		&db.Podcast{},
 		&db.PodcastItem{},
+		&db.PodcastItemHistory{},
 		&db.Setting{},
 		&db.Tag{},
 		&db.Migration{},
 		&db.JobLock{},
+		&db.NotificationTarget{},
+		&db.NotificationDelivery{},
+		&db.NotificationAlert{},
+		&db.JobSchedule{},
+		&db.JobRun{},
+		&db.SmartPlaylist{},
+		&db.Playlist{},
+		&db.PlaylistItem{},
 	)
 	if err != nil {
 		t.Fatalf("Failed to run migrations: %v", err)
@@ -76,6 +87,16 @@ func SetupTestDataDir(t *testing.T) (dataDir string, cleanup func()) {
 	return dataDir, cleanup
 }
 
+// UseTestSecretKey seals stored credentials with a fixed in-memory key for the
+// duration of the test, so no key file is generated.
+func UseTestSecretKey(t *testing.T) {
+	t.Helper()
+	if err := secrets.SetKey([]byte(strings.Repeat("k", 32))); err != nil {
+		t.Fatalf("Failed to set test secret key: %v", err)
+	}
+	t.Cleanup(secrets.Reset)
+}
+
 // CreateMockRSSHandler creates an HTTP handler that returns RSS feed content.
 func CreateMockRSSHandler(rssContent string) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
@@ -497,9 +497,10 @@ func (m *MockRepository) GetLock(name string) *db.JobLock {
 func (m *MockRepository) Lock(name string, duration int) {
 	m.LockCalls++
 	m.JobLocks[name] = &db.JobLock{
-		Name:     name,
-		Duration: duration,
-		Date:     time.Now(),
+		Name:       name,
+		Duration:   duration,
+		Date:       time.Now(),
+		LeaseUntil: time.Now().Add(time.Duration(duration) * time.Minute),
 	}
 }
 
@@ -507,12 +508,44 @@ func (m *MockRepository) Unlock(name string) {
 	m.UnlockCalls++
 	if lock, exists := m.JobLocks[name]; exists {
 		lock.Date = time.Time{}
+		lock.LeaseUntil = time.Time{}
 		lock.Duration = 0
 	}
 }
 
-func (m *MockRepository) UnlockMissedJobs() {
-	// Simplified mock - no-op
+func (m *MockRepository) AcquireLock(name, owner string, duration int, lease time.Duration) (bool, error) {
+	if lock, exists := m.JobLocks[name]; exists && lock.IsLocked() {
+		return false, nil
+	}
+	m.LockCalls++
+	m.JobLocks[name] = &db.JobLock{
+		Name:       name,
+		Owner:      owner,
+		Duration:   duration,
+		Date:       time.Now(),
+		LeaseUntil: time.Now().Add(lease),
+	}
+	return true, nil
+}
+
+func (m *MockRepository) RenewLock(name, owner string, lease time.Duration) (bool, error) {
+	lock, exists := m.JobLocks[name]
+	if !exists || lock.Owner != owner {
+		return false, nil
+	}
+	lock.LeaseUntil = time.Now().Add(lease)
+	return true, nil
+}
+
+func (m *MockRepository) ReleaseLock(name, owner string) error {
+	if lock, exists := m.JobLocks[name]; exists && lock.Owner == owner {
+		m.UnlockCalls++
+		lock.Date = time.Time{}
+		lock.LeaseUntil = time.Time{}
+		lock.Owner = ""
+		lock.Duration = 0
+	}
+	return nil
 }
 
 // Helper functions
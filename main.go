@@ -2,38 +2,68 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"html/template"
+	"net/http"
 	"os"
+	"os/signal"
 	"path"
 	"strconv"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/akhilrex/podgrab/controllers"
 	"github.com/akhilrex/podgrab/db"
+	"github.com/akhilrex/podgrab/internal/config"
 	"github.com/akhilrex/podgrab/internal/logger"
+	"github.com/akhilrex/podgrab/internal/metrics"
+	"github.com/akhilrex/podgrab/internal/redact"
+	"github.com/akhilrex/podgrab/internal/secrets"
 	"github.com/akhilrex/podgrab/service"
 	"github.com/gin-contrib/location"
 	"github.com/gin-gonic/gin"
-	"github.com/jasonlvhit/gocron"
 	_ "github.com/joho/godotenv/autoload"
 )
 
 func main() {
-	defer logger.Sync()
+	code := runCommand(os.Args[1:])
+	logger.Sync()
+	os.Exit(code)
+}
 
+// serve runs the web server and the background jobs until the process is stopped.
+func serve() error {
+	if err := secrets.Init(config.Get()); err != nil {
+		return fmt.Errorf("failed to load the secret key: %w", err)
+	}
 	var err error
 	db.DB, err = db.Init()
 	if err != nil {
 		logger.Log.Errorw("Failed to initialize database", "error", err)
+	} else if err := db.Migrate(); err != nil {
+		return fmt.Errorf("failed to migrate database: %w", err)
 	} else {
-		db.Migrate()
+		if err := service.MoveFeedURLSecrets(); err != nil {
+			logger.Log.Errorw("Failed to move feed credentials out of feed URLs", "error", err)
+		}
+		if err := service.EncryptNotificationSecrets(); err != nil {
+			logger.Log.Errorw("Failed to encrypt notification target secrets", "error", err)
+		}
+		service.ApplyDownloadLimits()
 	}
-	r := gin.Default()
+	r := gin.New()
+	r.Use(requestLogger(), gin.Recovery())
+
+	// Probes are registered before the remaining middleware so they skip
+	// authentication and the per-request settings lookup.
+	r.GET("/healthz", controllers.Healthz)
+	r.GET("/readyz", controllers.Readyz)
 
 	r.Use(setupSettings())
-	r.Use(gin.Recovery())
 	r.Use(location.Default())
+	r.Use(metrics.Middleware())
 
 	funcMap := template.FuncMap{
 		"intRange": func(start, end int) []int {
@@ -91,27 +121,7 @@ func main() {
 			}
 			return count
 		},
-		"formatFileSize": func(inputSize int64) string {
-			size := float64(inputSize)
-			const divisor float64 = 1024
-			if size < divisor {
-				return fmt.Sprintf("%.0f bytes", size)
-			}
-			size /= divisor
-			if size < divisor {
-				return fmt.Sprintf("%.2f KB", size)
-			}
-			size /= divisor
-			if size < divisor {
-				return fmt.Sprintf("%.2f MB", size)
-			}
-			size /= divisor
-			if size < divisor {
-				return fmt.Sprintf("%.2f GB", size)
-			}
-			size /= divisor
-			return fmt.Sprintf("%.2f TB", size)
-		},
+		"formatFileSize": formatFileSize,
 		"formatDuration": func(total int) string {
 			if total <= 0 {
 				return ""
@@ -133,54 +143,79 @@ func main() {
 
 	r.SetHTMLTemplate(tmpl)
 
-	pass := os.Getenv("PASSWORD")
+	cfg := config.Get()
+	pass := cfg.Password
 	var router *gin.RouterGroup
+	// media serves playlist files and the episodes in them, which players
+	// that cannot send the password may fetch with the playlist token.
+	var media *gin.RouterGroup
 	if pass != "" {
-		router = r.Group("/", gin.BasicAuth(gin.Accounts{
+		auth := gin.BasicAuth(gin.Accounts{
 			"podgrab": pass,
-		}))
+		})
+		router = r.Group("/", auth)
+		media = r.Group("/", controllers.TokenAuth(cfg.PlaylistToken, auth))
 	} else {
 		router = &r.RouterGroup
+		media = router
 	}
 
-	dataPath := os.Getenv("DATA")
-	backupPath := path.Join(os.Getenv("CONFIG"), "backups")
+	dataPath := cfg.DataDir
+	backupPath := path.Join(cfg.ConfigDir, "backups")
+
+	controllers.RegisterAPIV1(router.Group(controllers.APIV1Prefix))
+	r.NoRoute(controllers.APINotFound)
+
+	// The unversioned JSON routes remain for existing clients and point
+	// them to their replacements in the versioned API. Endpoints added since
+	// are only served under /api/v1, apart from the feed URL change.
+	deprecated := func(successor string) gin.HandlerFunc {
+		return controllers.Deprecated(controllers.APIV1Prefix + successor)
+	}
 
 	router.Static("/webassets", "./webassets")
 	router.Static("/assets", dataPath)
 	router.Static(backupPath, backupPath)
-	router.POST("/podcasts", controllers.AddPodcast)
-	router.GET("/podcasts", controllers.GetAllPodcasts)
-	router.GET("/podcasts/:id", controllers.GetPodcastByID)
+	router.POST("/podcasts", deprecated("/podcasts"), controllers.AddPodcast)
+	router.GET("/podcasts", deprecated("/podcasts"), controllers.GetAllPodcasts)
+	router.GET("/podcasts/:id", deprecated("/podcasts/:id"), controllers.GetPodcastByID)
 	router.GET("/podcasts/:id/image", controllers.GetPodcastImageByID)
-	router.DELETE("/podcasts/:id", controllers.DeletePodcastByID)
-	router.GET("/podcasts/:id/items", controllers.GetPodcastItemsByPodcastID)
-	router.GET("/podcasts/:id/download", controllers.DownloadAllEpisodesByPodcastID)
-	router.DELETE("/podcasts/:id/items", controllers.DeletePodcastEpisodesByID)
-	router.DELETE("/podcasts/:id/podcast", controllers.DeleteOnlyPodcastByID)
-	router.GET("/podcasts/:id/pause", controllers.PausePodcastByID)
-	router.GET("/podcasts/:id/unpause", controllers.UnpausePodcastByID)
+	router.DELETE("/podcasts/:id", deprecated("/podcasts/:id"), controllers.DeletePodcastByID)
+	router.GET("/podcasts/:id/items", deprecated("/podcasts/:id/episodes"), controllers.GetPodcastItemsByPodcastID)
+	router.GET("/podcasts/:id/download", deprecated("/podcasts/:id/download"), controllers.DownloadAllEpisodesByPodcastID)
+	router.DELETE("/podcasts/:id/items", deprecated("/podcasts/:id/files"), controllers.DeletePodcastEpisodesByID)
+	router.DELETE("/podcasts/:id/podcast", deprecated("/podcasts/:id?keepFiles=true"), controllers.DeleteOnlyPodcastByID)
+	router.GET("/podcasts/:id/pause", deprecated("/podcasts/:id"), controllers.PausePodcastByID)
+	router.GET("/podcasts/:id/unpause", deprecated("/podcasts/:id"), controllers.UnpausePodcastByID)
 	router.GET("/podcasts/:id/rss", controllers.GetRssForPodcastByID)
+	router.PUT("/podcasts/:id/url", controllers.ChangePodcastURL)
+
+	router.GET("/podcastitems", deprecated("/episodes"), controllers.GetAllPodcastItems)
+	router.GET("/podcastitems/:id", deprecated("/episodes/:id"), controllers.GetPodcastItemByID)
+	media.GET("/podcastitems/:id/image", controllers.GetPodcastItemImageByID)
+	media.GET("/podcastitems/:id/file", controllers.GetPodcastItemFileByID)
+	router.GET("/podcastitems/:id/markUnplayed", deprecated("/episodes/:id"), controllers.MarkPodcastItemAsUnplayed)
+	router.GET("/podcastitems/:id/markPlayed", deprecated("/episodes/:id"), controllers.MarkPodcastItemAsPlayed)
+	router.GET("/podcastitems/:id/bookmark", deprecated("/episodes/:id"), controllers.BookmarkPodcastItem)
+	router.GET("/podcastitems/:id/unbookmark", deprecated("/episodes/:id"), controllers.UnbookmarkPodcastItem)
+	router.PATCH("/podcastitems/:id", deprecated("/episodes/:id"), controllers.PatchPodcastItemByID)
+	router.GET("/podcastitems/:id/download", deprecated("/episodes/:id/download"), controllers.DownloadPodcastItem)
+	router.GET("/podcastitems/:id/delete", deprecated("/episodes/:id/file"), controllers.DeletePodcastItem)
 
-	router.GET("/podcastitems", controllers.GetAllPodcastItems)
-	router.GET("/podcastitems/:id", controllers.GetPodcastItemByID)
-	router.GET("/podcastitems/:id/image", controllers.GetPodcastItemImageByID)
-	router.GET("/podcastitems/:id/file", controllers.GetPodcastItemFileByID)
-	router.GET("/podcastitems/:id/markUnplayed", controllers.MarkPodcastItemAsUnplayed)
-	router.GET("/podcastitems/:id/markPlayed", controllers.MarkPodcastItemAsPlayed)
-	router.GET("/podcastitems/:id/bookmark", controllers.BookmarkPodcastItem)
-	router.GET("/podcastitems/:id/unbookmark", controllers.UnbookmarkPodcastItem)
-	router.PATCH("/podcastitems/:id", controllers.PatchPodcastItemByID)
-	router.GET("/podcastitems/:id/download", controllers.DownloadPodcastItem)
-	router.GET("/podcastitems/:id/delete", controllers.DeletePodcastItem)
-
-	router.GET("/tags", controllers.GetAllTags)
-	router.GET("/tags/:id", controllers.GetTagByID)
+	router.GET("/tags", deprecated("/tags"), controllers.GetAllTags)
+	router.GET("/tags/:id", deprecated("/tags/:id"), controllers.GetTagByID)
 	router.GET("/tags/:id/rss", controllers.GetRssForTagByID)
-	router.DELETE("/tags/:id", controllers.DeleteTagByID)
-	router.POST("/tags", controllers.AddTag)
-	router.POST("/podcasts/:id/tags/:tagID", controllers.AddTagToPodcast)
-	router.DELETE("/podcasts/:id/tags/:tagID", controllers.RemoveTagFromPodcast)
+	router.GET("/smart-playlists/:id/rss", controllers.GetRssForSmartPlaylistByID)
+	for _, format := range service.PlaylistFormats {
+		media.GET("/podcasts/:id/"+format, controllers.GetPodcastPlaylistFile(format))
+		media.GET("/tags/:id/"+format, controllers.GetTagPlaylistFile(format))
+		media.GET("/smart-playlists/:id/"+format, controllers.GetSmartPlaylistFile(format))
+		media.GET("/episodes/"+format, controllers.GetEpisodesPlaylistFile(format))
+	}
+	router.DELETE("/tags/:id", deprecated("/tags/:id"), controllers.DeleteTagByID)
+	router.POST("/tags", deprecated("/tags"), controllers.AddTag)
+	router.POST("/podcasts/:id/tags/:tagID", deprecated("/podcasts/:id/tags/:tagID"), controllers.AddTagToPodcast)
+	router.DELETE("/podcasts/:id/tags/:tagID", deprecated("/podcasts/:id/tags/:tagID"), controllers.RemoveTagFromPodcast)
 
 	router.GET("/add", controllers.AddPage)
 	router.GET("/search", controllers.Search)
@@ -189,12 +224,14 @@ func main() {
 	router.GET("/episodes", controllers.AllEpisodesPage)
 	router.GET("/allTags", controllers.AllTagsPage)
 	router.GET("/settings", controllers.SettingsPage)
-	router.POST("/settings", controllers.UpdateSetting)
+	router.POST("/settings", deprecated("/settings"), controllers.UpdateSetting)
 	router.GET("/backups", controllers.BackupsPage)
 	router.POST("/opml", controllers.UploadOpml)
 	router.GET("/opml", controllers.GetOmpl)
 	router.GET("/player", controllers.PlayerPage)
+	router.GET("/playlists", controllers.PlaylistsPage)
 	router.GET("/rss", controllers.GetRss)
+	router.GET("/metrics", gin.WrapH(metrics.Handler()))
 
 	r.GET("/ws", func(c *gin.Context) {
 		controllers.Wshandler(c.Writer, c.Request)
@@ -202,12 +239,118 @@ func main() {
 	go controllers.HandleWebsocketMessages()
 
 	go assetEnv()
-	go intiCron()
+	intiCron()
+
+	srv := &http.Server{
+		Addr:              listenAddress(),
+		Handler:           r,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		logger.Log.Infow("Listening", "address", srv.Addr)
+		serveErr <- srv.ListenAndServe()
+	}()
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+	// A second signal stops the process immediately.
+	stop()
+	return shutdown(srv)
+}
+
+// listenAddress returns the address to listen on, from the port setting.
+func listenAddress() string {
+	return ":" + strconv.Itoa(config.Get().Port)
+}
 
-	if err := r.Run(); err != nil {
-		logger.Log.Fatalw("Failed to start server", "error", err)
+// shutdown stops the HTTP server, websocket connections and background work,
+// giving them SHUTDOWN_TIMEOUT seconds to finish.
+func shutdown(srv *http.Server) error {
+	timeout := time.Duration(config.Get().ShutdownTimeout) * time.Second
+	logger.Log.Infow("Shutting down", "timeout", timeout.String())
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		if err := srv.Shutdown(ctx); err != nil {
+			logger.Log.Warnw("HTTP requests still running at the shutdown deadline", "error", err)
+			if closeErr := srv.Close(); closeErr != nil {
+				logger.Log.Errorw("Closing HTTP server", "error", closeErr)
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		controllers.CloseWebsockets(ctx)
+	}()
+	go func() {
+		defer wg.Done()
+		if err := service.Shutdown(ctx); err != nil {
+			logger.Log.Warnw("Background work interrupted at the shutdown deadline", "error", err)
+		}
+	}()
+	wg.Wait()
+
+	if db.DB != nil {
+		if sqlDB, err := db.DB.DB(); err == nil {
+			if err := sqlDB.Close(); err != nil {
+				logger.Log.Errorw("Closing database", "error", err)
+			}
+		}
+	}
+	logger.Log.Info("Shutdown complete")
+	return nil
+}
+
+// formatFileSize renders a byte count with a human readable unit.
+func formatFileSize(inputSize int64) string {
+	size := float64(inputSize)
+	const divisor float64 = 1024
+	if size < divisor {
+		return fmt.Sprintf("%.0f bytes", size)
+	}
+	size /= divisor
+	if size < divisor {
+		return fmt.Sprintf("%.2f KB", size)
+	}
+	size /= divisor
+	if size < divisor {
+		return fmt.Sprintf("%.2f MB", size)
+	}
+	size /= divisor
+	if size < divisor {
+		return fmt.Sprintf("%.2f GB", size)
 	}
+	size /= divisor
+	return fmt.Sprintf("%.2f TB", size)
 }
+
+// requestLogger logs requests like gin's default logger, with credentials
+// masked: playlist files and their episodes take the playlist token in the
+// query string.
+func requestLogger() gin.HandlerFunc {
+	return gin.LoggerWithFormatter(func(param gin.LogFormatterParams) string {
+		return fmt.Sprintf("[GIN] %v | %3d | %13v | %15s | %-7s %#v\n%s",
+			param.TimeStamp.Format("2006/01/02 - 15:04:05"),
+			param.StatusCode,
+			param.Latency,
+			param.ClientIP,
+			param.Method,
+			redact.RequestURI(param.Path),
+			redact.String(param.ErrorMessage),
+		)
+	})
+}
+
 func setupSettings() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		setting := db.GetOrCreateSetting()
@@ -219,37 +362,16 @@ func setupSettings() gin.HandlerFunc {
 }
 
 func intiCron() {
-	checkFrequency, err := strconv.Atoi(os.Getenv("CHECK_FREQUENCY"))
-	if err != nil || checkFrequency <= 0 {
-		checkFrequency = 30
-		logger.Log.Warnw("Invalid CHECK_FREQUENCY, using default", "error", err, "default", 30)
-	}
-	freq := uint64(checkFrequency) //nolint:gosec // G115: Safe conversion - checkFrequency validated to be positive
-	service.UnlockMissedJobs()
-	if err := gocron.Every(freq).Minutes().Do(service.RefreshEpisodes); err != nil {
-		logger.Log.Errorw("Failed to schedule RefreshEpisodes", "error", err)
-	}
-	if err := gocron.Every(freq).Minutes().Do(service.CheckMissingFiles); err != nil {
-		logger.Log.Errorw("Failed to schedule CheckMissingFiles", "error", err)
-	}
-	if err := gocron.Every(freq * 2).Minutes().Do(service.UnlockMissedJobs); err != nil {
-		logger.Log.Errorw("Failed to schedule UnlockMissedJobs", "error", err)
-	}
-	if err := gocron.Every(freq * 3).Minutes().Do(service.UpdateAllFileSizes); err != nil {
-		logger.Log.Errorw("Failed to schedule UpdateAllFileSizes", "error", err)
-	}
-	if err := gocron.Every(freq).Minutes().Do(service.DownloadMissingImages); err != nil {
-		logger.Log.Errorw("Failed to schedule DownloadMissingImages", "error", err)
-	}
-	if err := gocron.Every(2).Days().Do(service.CreateBackup); err != nil {
-		logger.Log.Errorw("Failed to schedule CreateBackup", "error", err)
+	if err := service.StartScheduler(service.DefaultJobs(config.Get().CheckFrequency)); err != nil {
+		logger.Log.Errorw("Failed to start scheduler", "error", err)
 	}
-	<-gocron.Start()
 }
 
 func assetEnv() {
+	cfg := config.Get()
 	logger.Log.Infow("Configuration",
-		"config_dir", os.Getenv("CONFIG"),
-		"assets_dir", os.Getenv("DATA"),
-		"check_frequency_mins", os.Getenv("CHECK_FREQUENCY"))
+		"config_file", cfg.File,
+		"config_dir", cfg.ConfigDir,
+		"assets_dir", cfg.DataDir,
+		"check_frequency_mins", cfg.CheckFrequency)
 }
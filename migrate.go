@@ -0,0 +1,77 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/akhilrex/podgrab/db"
+)
+
+// migrateCommand handles "podgrab migrate <status|up|down>". It opens the
+// database without migrating it so the schema can be inspected and rolled back.
+func migrateCommand(args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+
+	var err error
+	if db.DB, err = db.Init(); err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	if err = db.DB.AutoMigrate(&db.Migration{}); err != nil {
+		return fmt.Errorf("failed to prepare migrations table: %w", err)
+	}
+
+	switch args[0] {
+	case "status":
+		return printMigrationStatus()
+	case "up":
+		flags := flag.NewFlagSet("migrate up", flag.ContinueOnError)
+		target := flags.Int("to", db.LatestSchemaVersion(), "schema version to migrate to")
+		if _, err = parseFlags(flags, args[1:], 0); err != nil {
+			return err
+		}
+		if err = db.CheckSchemaVersion(); err != nil {
+			return err
+		}
+		return db.MigrateTo(*target)
+	case "down":
+		flags := flag.NewFlagSet("migrate down", flag.ContinueOnError)
+		steps := flags.Int("steps", 1, "number of migrations to roll back")
+		if _, err = parseFlags(flags, args[1:], 0); err != nil {
+			return err
+		}
+		return db.RollbackMigrations(*steps)
+	default:
+		return errUsage
+	}
+}
+
+func printMigrationStatus() error {
+	statuses, err := db.GetMigrationStatus()
+	if err != nil {
+		return err
+	}
+	current, err := db.GetSchemaVersion()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Schema version %d (latest known %d)\n\n", current, db.LatestSchemaVersion())
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED\tDOWN")
+	for i := range statuses {
+		applied := "pending"
+		if statuses[i].Applied {
+			applied = statuses[i].AppliedAt.Format("2006-01-02 15:04:05")
+		}
+		down := "yes"
+		if !statuses[i].Reversible {
+			down = "irreversible"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", statuses[i].Version, statuses[i].Name, applied, down)
+	}
+	return w.Flush()
+}
@@ -1,7 +1,11 @@
 // Package model defines data structures for external API responses and RSS feeds.
 package model
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
 
 // PodcastAlreadyExistsError represents podcast already exists error data.
 type PodcastAlreadyExistsError struct {
@@ -20,3 +24,85 @@ type TagAlreadyExistsError struct {
 func (e *TagAlreadyExistsError) Error() string {
 	return fmt.Sprintf("Tag with this label already exists : %s", e.Label)
 }
+
+// SchemaVersionError is returned when the database schema is newer than this build supports.
+type SchemaVersionError struct {
+	Current   int
+	Supported int
+}
+
+func (e *SchemaVersionError) Error() string {
+	return fmt.Sprintf("database schema version %d is newer than the supported version %d, upgrade Podgrab before starting it against this database", e.Current, e.Supported)
+}
+
+// Error codes of the versioned API.
+const (
+	ErrCodeInvalidRequest = "invalid_request"
+	ErrCodeNotFound       = "not_found"
+	ErrCodeConflict       = "conflict"
+	ErrCodeUnavailable    = "unavailable"
+	ErrCodeInternal       = "internal_error"
+)
+
+// APIError is an error of the versioned API. Status is the HTTP status it
+// responds with.
+type APIError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Status  int    `json:"-"`
+}
+
+func (e *APIError) Error() string {
+	return e.Message
+}
+
+// ErrorResponse is the body of every error response of the versioned API.
+type ErrorResponse struct {
+	Error *APIError `json:"error"`
+}
+
+// NewInvalidRequestError returns an error for a request that failed validation.
+func NewInvalidRequestError(message string) *APIError {
+	return &APIError{Status: http.StatusBadRequest, Code: ErrCodeInvalidRequest, Message: message}
+}
+
+// NewNotFoundError returns an error for a missing resource, such as "Podcast".
+func NewNotFoundError(resource string) *APIError {
+	return &APIError{Status: http.StatusNotFound, Code: ErrCodeNotFound, Message: resource + " not found"}
+}
+
+// NewConflictError returns an error for a request conflicting with the
+// current state.
+func NewConflictError(message string) *APIError {
+	return &APIError{Status: http.StatusConflict, Code: ErrCodeConflict, Message: message}
+}
+
+// NewUnavailableError returns an error for a request that cannot be served
+// right now.
+func NewUnavailableError(message string) *APIError {
+	return &APIError{Status: http.StatusServiceUnavailable, Code: ErrCodeUnavailable, Message: message}
+}
+
+// NewInternalError returns an error for an unexpected failure. The message
+// is sent to clients.
+func NewInternalError(message string) *APIError {
+	return &APIError{Status: http.StatusInternalServerError, Code: ErrCodeInternal, Message: message}
+}
+
+// AsAPIError returns err as an API error if it is one or one of the errors
+// of this package, or nil.
+func AsAPIError(err error) *APIError {
+	var apiErr *APIError
+	var podcastExists *PodcastAlreadyExistsError
+	var tagExists *TagAlreadyExistsError
+	switch {
+	case errors.As(err, &apiErr):
+		return apiErr
+	case errors.As(err, &podcastExists):
+		return NewConflictError(podcastExists.Error())
+	case errors.As(err, &tagExists):
+		return NewConflictError(tagExists.Error())
+	default:
+		return nil
+	}
+}
@@ -36,33 +36,48 @@ type EpisodesFilter struct {
 	TagIDs       []string    `uri:"tagIDs" query:"tagIds[]" json:"tagIDs" form:"tagIds[]"`
 	PodcastIDs   []string    `uri:"podcastIDs" query:"podcastIDs[]" json:"podcastIDs" form:"podcastIDs[]"`
 	Pagination
+	// MaxAgeDays selects the episodes published in the last days.
+	MaxAgeDays int `uri:"maxAgeDays" query:"maxAgeDays" json:"maxAgeDays" form:"maxAgeDays"`
+	// MinDuration and MaxDuration select episodes by their length in seconds.
+	MinDuration int `uri:"minDuration" query:"minDuration" json:"minDuration" form:"minDuration"`
+	MaxDuration int `uri:"maxDuration" query:"maxDuration" json:"maxDuration" form:"maxDuration"`
 }
 
 // VerifyPaginationValues sets default values for pagination parameters.
 func (filter *EpisodesFilter) VerifyPaginationValues() {
-	if filter.Count == 0 {
-		filter.Count = 20
-	}
-	if filter.Page == 0 {
-		filter.Page = 1
-	}
+	filter.SetDefaults()
 	if filter.Sorting == "" {
 		filter.Sorting = ReleaseDesc
 	}
 }
 
+// SetDefaults sets the default page and count when they are not positive.
+func (pagination *Pagination) SetDefaults() {
+	if pagination.Count <= 0 {
+		pagination.Count = 20
+	}
+	if pagination.Page <= 0 {
+		pagination.Page = 1
+	}
+}
+
+// Offset returns the number of items before the page.
+func (pagination *Pagination) Offset() int {
+	return (pagination.Page - 1) * pagination.Count
+}
+
 // SetCounts calculates and sets pagination metadata based on total count.
-func (filter *EpisodesFilter) SetCounts(totalCount int64) {
-	totalPages := int(math.Ceil(float64(totalCount) / float64(filter.Count)))
+func (pagination *Pagination) SetCounts(totalCount int64) {
+	totalPages := int(math.Ceil(float64(totalCount) / float64(pagination.Count)))
 	nextPage, previousPage := 0, 0
-	if filter.Page < totalPages {
-		nextPage = filter.Page + 1
+	if pagination.Page < totalPages {
+		nextPage = pagination.Page + 1
 	}
-	if filter.Page > 1 {
-		previousPage = filter.Page - 1
+	if pagination.Page > 1 {
+		previousPage = pagination.Page - 1
 	}
-	filter.NextPage = nextPage
-	filter.PreviousPage = previousPage
-	filter.TotalCount = int(totalCount)
-	filter.TotalPages = totalPages
+	pagination.NextPage = nextPage
+	pagination.PreviousPage = previousPage
+	pagination.TotalCount = int(totalCount)
+	pagination.TotalPages = totalPages
 }
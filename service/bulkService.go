@@ -0,0 +1,289 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/akhilrex/podgrab/db"
+	"github.com/akhilrex/podgrab/internal/logger"
+	"github.com/akhilrex/podgrab/model"
+	"gorm.io/gorm"
+)
+
+// Bulk episode actions.
+const (
+	BulkMarkPlayed   = "mark_played"
+	BulkMarkUnplayed = "mark_unplayed"
+	BulkDownload     = "download"
+	BulkDeleteFile   = "delete_file"
+	BulkBookmark     = "bookmark"
+	BulkUnbookmark   = "unbookmark"
+	// BulkTag tags the podcasts of the episodes, as tags apply to podcasts.
+	BulkTag = "tag"
+	// BulkQueue adds the episodes to the end of the up next queue.
+	BulkQueue = "queue"
+	// BulkAddToPlaylist adds the episodes to the end of a playlist.
+	BulkAddToPlaylist = "add_to_playlist"
+)
+
+// ErrInvalidBulkRequest is returned for bulk requests with an unknown action,
+// tag or selection.
+var ErrInvalidBulkRequest = errors.New("invalid bulk request")
+
+// BulkRequest selects episodes, by IDs or by a filter, and the action to run
+// on them. TagID is the tag of BulkTag and PlaylistID the playlist of
+// BulkAddToPlaylist.
+type BulkRequest struct {
+	Filter     *model.EpisodesFilter
+	Action     string
+	TagID      string
+	PlaylistID string
+	IDs        []string
+}
+
+// BulkResult summarizes a bulk action. Changed episodes were updated and
+// unchanged ones already were in the requested state. Failed lists the
+// episodes the action could not be completed for.
+type BulkResult struct {
+	Failed    []BulkFailure `json:"failed"`
+	Action    string        `json:"action"`
+	Selected  int           `json:"selected"`
+	Changed   int           `json:"changed"`
+	Unchanged int           `json:"unchanged"`
+}
+
+// BulkFailure is an episode a bulk action failed for.
+type BulkFailure struct {
+	ID    string `json:"id"`
+	Error string `json:"error"`
+}
+
+// RunBulkAction runs the action of request on the episodes it selects. The
+// changes to the database are made in one transaction, so either every
+// selected episode changes or none does. Downloads are only queued, and
+// files are removed once the episodes are marked deleted.
+func RunBulkAction(request *BulkRequest) (*BulkResult, error) {
+	items, err := selectBulkEpisodes(request)
+	if err != nil {
+		return nil, err
+	}
+	result := &BulkResult{Action: request.Action, Selected: len(items), Failed: []BulkFailure{}}
+	switch request.Action {
+	case BulkMarkPlayed, BulkMarkUnplayed:
+		played := request.Action == BulkMarkPlayed
+		err = updateBulkEpisodes(result, items, map[string]interface{}{"is_played": played}, func(item *db.PodcastItem) bool {
+			return item.IsPlayed != played
+		})
+	case BulkBookmark, BulkUnbookmark:
+		bookmarkDate := time.Time{}
+		if request.Action == BulkBookmark {
+			bookmarkDate = time.Now()
+		}
+		err = updateBulkEpisodes(result, items, map[string]interface{}{"bookmark_date": bookmarkDate}, func(item *db.PodcastItem) bool {
+			return item.BookmarkDate.IsZero() != bookmarkDate.IsZero()
+		})
+	case BulkDownload:
+		err = queueBulkDownloads(result, items)
+	case BulkDeleteFile:
+		err = deleteBulkFiles(result, items)
+	case BulkTag:
+		err = tagBulkPodcasts(result, items, request.TagID)
+	case BulkQueue:
+		err = addBulkToPlaylist(result, items, db.QueuePlaylistID)
+	case BulkAddToPlaylist:
+		var playlist db.Playlist
+		err = db.GetPlaylistByID(request.PlaylistID, &playlist)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: unknown playlist %q", ErrInvalidBulkRequest, request.PlaylistID)
+		}
+		if err == nil {
+			err = addBulkToPlaylist(result, items, playlist.ID)
+		}
+	default:
+		return nil, fmt.Errorf("%w: unknown action %q", ErrInvalidBulkRequest, request.Action)
+	}
+	if err != nil {
+		return nil, err
+	}
+	logger.Log.Infow("Ran bulk episode action", "action", request.Action,
+		"selected", result.Selected, "changed", result.Changed, "failed", len(result.Failed))
+	return result, nil
+}
+
+// selectBulkEpisodes returns the episodes request selects. Every ID must be
+// an episode.
+func selectBulkEpisodes(request *BulkRequest) ([]db.PodcastItem, error) {
+	if (len(request.IDs) == 0) == (request.Filter == nil) {
+		return nil, fmt.Errorf("%w: select episodes by either ids or a filter", ErrInvalidBulkRequest)
+	}
+	if request.Filter != nil {
+		items, err := db.GetPodcastItemsByFilter(request.Filter)
+		if err != nil {
+			return nil, err
+		}
+		return *items, nil
+	}
+	return getEpisodesByIDs(request.IDs)
+}
+
+// getEpisodesByIDs returns the episodes of ids in order, without repeats.
+// Every ID must be an episode.
+func getEpisodesByIDs(requested []string) ([]db.PodcastItem, error) {
+	ids := make([]string, 0, len(requested))
+	seen := make(map[string]bool, len(requested))
+	for _, id := range requested {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	items, err := db.GetAllPodcastItemsByIDs(ids)
+	if err != nil {
+		return nil, err
+	}
+	if len(*items) != len(ids) {
+		return nil, fmt.Errorf("%d of %d episodes: %w", len(ids)-len(*items), len(ids), gorm.ErrRecordNotFound)
+	}
+	return *items, nil
+}
+
+// updateBulkEpisodes sets values on the episodes of items that needsChange.
+func updateBulkEpisodes(result *BulkResult, items []db.PodcastItem, values map[string]interface{}, needsChange func(*db.PodcastItem) bool) error {
+	ids := make([]string, 0, len(items))
+	for i := range items {
+		if needsChange(&items[i]) {
+			ids = append(ids, items[i].ID)
+		}
+	}
+	if err := db.UpdatePodcastItemsByIDs(ids, values); err != nil {
+		return err
+	}
+	result.Changed = len(ids)
+	result.Unchanged = len(items) - len(ids)
+	return nil
+}
+
+// queueBulkDownloads queues the episodes of items that are neither
+// downloaded nor queued. Episodes removed from their feed fail, as the
+// download job skips them.
+func queueBulkDownloads(result *BulkResult, items []db.PodcastItem) error {
+	queueable := make([]db.PodcastItem, 0, len(items))
+	for i := range items {
+		if items[i].RemovedUpstreamAt != nil {
+			result.Failed = append(result.Failed, BulkFailure{ID: items[i].ID, Error: "episode was removed from its feed"})
+			continue
+		}
+		queueable = append(queueable, items[i])
+	}
+	return updateBulkEpisodes(result, queueable, map[string]interface{}{"download_status": db.NotDownloaded}, func(item *db.PodcastItem) bool {
+		return item.DownloadStatus != db.Downloaded && item.DownloadStatus != db.NotDownloaded
+	})
+}
+
+// deleteBulkFiles marks the episodes of items deleted, stopping their
+// downloads, then removes their files. Episodes of local podcasts fail, as
+// their files are the episodes.
+func deleteBulkFiles(result *BulkResult, items []db.PodcastItem) error {
+	var podcasts []db.Podcast
+	if err := db.GetAllPodcasts(&podcasts, ""); err != nil {
+		return err
+	}
+	local := make(map[string]bool)
+	for i := range podcasts {
+		if podcasts[i].IsLocal {
+			local[podcasts[i].ID] = true
+		}
+	}
+	deletable := make([]db.PodcastItem, 0, len(items))
+	for i := range items {
+		if local[items[i].PodcastID] {
+			result.Failed = append(result.Failed, BulkFailure{ID: items[i].ID, Error: "episode belongs to a local podcast"})
+			continue
+		}
+		deletable = append(deletable, items[i])
+	}
+	items = deletable
+	deleting := make(map[string]bool, len(items))
+	for i := range items {
+		if items[i].DownloadStatus != db.Deleted {
+			deleting[items[i].ID] = true
+		}
+	}
+	cancelWork(errEpisodeDeleted, func(work *inFlight) bool {
+		return deleting[work.itemID]
+	})
+	err := updateBulkEpisodes(result, items, map[string]interface{}{
+		"download_status": db.Deleted,
+		"download_path":   "",
+		"download_date":   time.Time{},
+	}, func(item *db.PodcastItem) bool {
+		return deleting[item.ID]
+	})
+	if err != nil {
+		return err
+	}
+	for i := range items {
+		if !deleting[items[i].ID] {
+			continue
+		}
+		for _, file := range []string{items[i].DownloadPath, items[i].LocalImage} {
+			if file == "" {
+				continue
+			}
+			if err := DeleteFile(file); err != nil && !os.IsNotExist(err) {
+				logger.Log.Errorw("deleting file", "episode", items[i].ID, "error", err)
+				result.Failed = append(result.Failed, BulkFailure{ID: items[i].ID, Error: "could not delete " + file})
+			}
+		}
+	}
+	return nil
+}
+
+// tagBulkPodcasts tags the podcasts of the episodes of items with tagID.
+// Episodes of podcasts that already had the tag are unchanged.
+func tagBulkPodcasts(result *BulkResult, items []db.PodcastItem, tagID string) error {
+	tag, err := db.GetTagByID(tagID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("%w: unknown tag %q", ErrInvalidBulkRequest, tagID)
+	}
+	if err != nil {
+		return err
+	}
+	tagged := make(map[string]bool, len(tag.Podcasts))
+	for _, podcast := range tag.Podcasts {
+		tagged[podcast.ID] = true
+	}
+	var podcastIDs []string
+	adding := make(map[string]bool)
+	for i := range items {
+		podcastID := items[i].PodcastID
+		if tagged[podcastID] {
+			result.Unchanged++
+			continue
+		}
+		if !adding[podcastID] {
+			adding[podcastID] = true
+			podcastIDs = append(podcastIDs, podcastID)
+		}
+		result.Changed++
+	}
+	return db.AddTagToPodcasts(podcastIDs, tagID)
+}
+
+// addBulkToPlaylist adds the episodes of items to the end of a playlist, or
+// of the up next queue for db.QueuePlaylistID. Episodes already in it are
+// unchanged.
+func addBulkToPlaylist(result *BulkResult, items []db.PodcastItem, playlistID string) error {
+	added, err := addPlaylistEpisodes(playlistID, items, false)
+	if err != nil {
+		return err
+	}
+	result.Changed = added
+	result.Unchanged = len(items) - added
+	return nil
+}
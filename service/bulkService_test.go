@@ -0,0 +1,135 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/akhilrex/podgrab/db"
+	"github.com/akhilrex/podgrab/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// TestRunBulkAction tests running actions on episodes selected by IDs and by
+// filter.
+func TestRunBulkAction(t *testing.T) {
+	useTestDataDir(t)
+	podcast := db.CreateTestPodcast(t, db.DB)
+	played := db.CreateTestPodcastItem(t, db.DB, podcast.ID, &db.PodcastItem{Title: "Played", IsPlayed: true})
+	unplayed := db.CreateTestPodcastItem(t, db.DB, podcast.ID, &db.PodcastItem{Title: "Unplayed"})
+
+	reload := func(id string) *db.PodcastItem {
+		var item db.PodcastItem
+		require.NoError(t, db.GetPodcastItemByID(id, &item))
+		return &item
+	}
+
+	t.Run("mark_played", func(t *testing.T) {
+		result, err := RunBulkAction(&BulkRequest{Action: BulkMarkPlayed, IDs: []string{played.ID, unplayed.ID, unplayed.ID}})
+		require.NoError(t, err)
+		assert.Equal(t, BulkResult{Action: BulkMarkPlayed, Selected: 2, Changed: 1, Unchanged: 1, Failed: []BulkFailure{}}, *result)
+		assert.True(t, reload(unplayed.ID).IsPlayed)
+	})
+
+	t.Run("bookmark_by_filter", func(t *testing.T) {
+		result, err := RunBulkAction(&BulkRequest{Action: BulkBookmark, Filter: &model.EpisodesFilter{Q: "unplayed"}})
+		require.NoError(t, err)
+		assert.Equal(t, 1, result.Changed)
+		assert.False(t, reload(unplayed.ID).BookmarkDate.IsZero())
+		assert.True(t, reload(played.ID).BookmarkDate.IsZero(), "Episodes outside the filter should not change")
+
+		result, err = RunBulkAction(&BulkRequest{Action: BulkUnbookmark, Filter: &model.EpisodesFilter{}})
+		require.NoError(t, err)
+		assert.Equal(t, 1, result.Changed)
+		assert.Equal(t, 1, result.Unchanged)
+		assert.True(t, reload(unplayed.ID).BookmarkDate.IsZero())
+	})
+
+	t.Run("delete_file_and_download", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "episode.mp3")
+		require.NoError(t, os.WriteFile(file, []byte("audio"), 0o600))
+		require.NoError(t, db.DB.Model(played).Updates(map[string]interface{}{
+			"download_status": db.Downloaded, "download_path": file, "download_date": time.Now(),
+		}).Error)
+
+		result, err := RunBulkAction(&BulkRequest{Action: BulkDeleteFile, IDs: []string{played.ID}})
+		require.NoError(t, err)
+		assert.Equal(t, 1, result.Changed)
+		assert.Empty(t, result.Failed)
+		assert.NoFileExists(t, file)
+		deleted := reload(played.ID)
+		assert.Equal(t, db.Deleted, deleted.DownloadStatus)
+		assert.Empty(t, deleted.DownloadPath)
+
+		removed := time.Now()
+		gone := db.CreateTestPodcastItem(t, db.DB, podcast.ID, &db.PodcastItem{Title: "Gone", DownloadStatus: db.Deleted})
+		require.NoError(t, db.DB.Model(gone).Update("removed_upstream_at", removed).Error)
+
+		result, err = RunBulkAction(&BulkRequest{Action: BulkDownload, IDs: []string{played.ID, unplayed.ID, gone.ID}})
+		require.NoError(t, err)
+		assert.Equal(t, 1, result.Changed, "Only the deleted episode should be queued")
+		assert.Equal(t, 1, result.Unchanged, "Queued episodes are unchanged")
+		assert.Equal(t, []BulkFailure{{ID: gone.ID, Error: "episode was removed from its feed"}}, result.Failed)
+		assert.Equal(t, db.NotDownloaded, reload(played.ID).DownloadStatus)
+		assert.Equal(t, db.Deleted, reload(gone.ID).DownloadStatus)
+	})
+
+	t.Run("tag", func(t *testing.T) {
+		tag := db.CreateTestTag(t, db.DB, "Backlog")
+		other := db.CreateTestPodcast(t, db.DB, &db.Podcast{Title: "Other"})
+		otherItem := db.CreateTestPodcastItem(t, db.DB, other.ID)
+
+		result, err := RunBulkAction(&BulkRequest{Action: BulkTag, TagID: tag.ID, IDs: []string{played.ID, unplayed.ID}})
+		require.NoError(t, err)
+		assert.Equal(t, 2, result.Changed)
+		tagIDs, err := db.GetTagIDsForPodcast(podcast.ID)
+		require.NoError(t, err)
+		assert.Equal(t, []string{tag.ID}, tagIDs)
+
+		result, err = RunBulkAction(&BulkRequest{Action: BulkTag, TagID: tag.ID, IDs: []string{played.ID, otherItem.ID}})
+		require.NoError(t, err)
+		assert.Equal(t, 1, result.Changed)
+		assert.Equal(t, 1, result.Unchanged)
+	})
+
+	t.Run("queue_and_playlist", func(t *testing.T) {
+		require.NoError(t, db.SetPlaylistEpisodes(db.QueuePlaylistID, []string{unplayed.ID}))
+		result, err := RunBulkAction(&BulkRequest{Action: BulkQueue, IDs: []string{played.ID, unplayed.ID}})
+		require.NoError(t, err)
+		assert.Equal(t, 1, result.Changed)
+		assert.Equal(t, 1, result.Unchanged, "Queued episodes are unchanged")
+		queue, err := db.GetPlaylistEpisodes(db.QueuePlaylistID)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"Unplayed", "Played"}, itemTitles(queue))
+
+		playlist := &db.Playlist{Name: "Favorites"}
+		require.NoError(t, db.CreatePlaylist(playlist))
+		result, err = RunBulkAction(&BulkRequest{Action: BulkAddToPlaylist, PlaylistID: playlist.ID, Filter: &model.EpisodesFilter{Q: "unplayed"}})
+		require.NoError(t, err)
+		assert.Equal(t, 1, result.Changed)
+		items, err := db.GetPlaylistEpisodes(playlist.ID)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"Unplayed"}, itemTitles(items))
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := RunBulkAction(&BulkRequest{Action: "archive", IDs: []string{played.ID}})
+		assert.ErrorIs(t, err, ErrInvalidBulkRequest)
+		_, err = RunBulkAction(&BulkRequest{Action: BulkMarkPlayed})
+		assert.ErrorIs(t, err, ErrInvalidBulkRequest, "Should require a selection")
+		_, err = RunBulkAction(&BulkRequest{Action: BulkTag, TagID: "missing", IDs: []string{played.ID}})
+		assert.ErrorIs(t, err, ErrInvalidBulkRequest)
+		_, err = RunBulkAction(&BulkRequest{Action: BulkAddToPlaylist, PlaylistID: "missing", IDs: []string{played.ID}})
+		assert.ErrorIs(t, err, ErrInvalidBulkRequest)
+	})
+
+	t.Run("missing_episode_changes_nothing", func(t *testing.T) {
+		require.NoError(t, SetPodcastItemPlayedStatus(unplayed.ID, false))
+		_, err := RunBulkAction(&BulkRequest{Action: BulkMarkPlayed, IDs: []string{unplayed.ID, "missing"}})
+		assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+		assert.False(t, reload(unplayed.ID).IsPlayed)
+	})
+}
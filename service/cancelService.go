@@ -0,0 +1,143 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/akhilrex/podgrab/db"
+	"github.com/akhilrex/podgrab/internal/logger"
+)
+
+var (
+	// ErrDownloadCancelled is the cause of downloads stopped on request.
+	ErrDownloadCancelled = errors.New("download cancelled")
+	// ErrNotDownloading is returned when cancelling an episode that is neither
+	// downloading nor queued for download.
+	ErrNotDownloading = errors.New("episode is not downloading")
+
+	errPodcastPaused  = fmt.Errorf("%w: podcast paused", ErrDownloadCancelled)
+	errEpisodeDeleted = fmt.Errorf("%w: episode deleted", ErrDownloadCancelled)
+	errPodcastDeleted = errors.New("podcast deleted")
+	// errPodcastMoved stops the downloads of a podcast whose folder is being
+	// moved. They stay queued and resume from their moved partial files.
+	errPodcastMoved = fmt.Errorf("%w: podcast folder moved", errDownloadsPaused)
+)
+
+// inFlight is a feed fetch or episode download that can be cancelled.
+type inFlight struct {
+	cancel    context.CancelCauseFunc
+	done      chan struct{}
+	podcastID string
+	// itemID is empty for feed fetches.
+	itemID string
+}
+
+var (
+	inFlightWork  = make(map[*inFlight]struct{})
+	inFlightMutex sync.Mutex
+	// blockedPodcasts holds the causes cancelling the downloads of podcasts
+	// as soon as they start.
+	blockedPodcasts = make(map[string]error)
+)
+
+// trackWork registers work on a podcast, or on one of its episodes when itemID
+// is set, so it can be cancelled. finish must be called when the work ends.
+func trackWork(ctx context.Context, podcastID, itemID string) (_ context.Context, finish func()) {
+	ctx, cancel := context.WithCancelCause(context.WithValue(ctx, podcastKey{}, podcastID))
+	work := &inFlight{
+		cancel:    cancel,
+		done:      make(chan struct{}),
+		podcastID: podcastID,
+		itemID:    itemID,
+	}
+	inFlightMutex.Lock()
+	inFlightWork[work] = struct{}{}
+	if cause, blocked := blockedPodcasts[podcastID]; blocked && itemID != "" {
+		cancel(cause)
+	}
+	inFlightMutex.Unlock()
+
+	return ctx, func() {
+		inFlightMutex.Lock()
+		delete(inFlightWork, work)
+		inFlightMutex.Unlock()
+		cancel(nil)
+		close(work.done)
+	}
+}
+
+// cancelWork cancels the tracked work selected by match and waits for it to
+// stop, so that files can be removed without a download writing them again.
+// It reports whether any work was cancelled.
+func cancelWork(cause error, match func(*inFlight) bool) bool {
+	var stopped []chan struct{}
+	inFlightMutex.Lock()
+	for work := range inFlightWork {
+		if match(work) {
+			work.cancel(cause)
+			stopped = append(stopped, work.done)
+		}
+	}
+	inFlightMutex.Unlock()
+
+	timeout := time.After(checkpointTimeout)
+	for _, done := range stopped {
+		select {
+		case <-done:
+		case <-timeout:
+			logger.Log.Warnw("Cancelled work is still running", "cause", cause)
+			return true
+		}
+	}
+	return len(stopped) > 0
+}
+
+// cancelPodcastDownloads cancels the running downloads of a podcast's episodes.
+func cancelPodcastDownloads(podcastID string, cause error) {
+	cancelWork(cause, func(work *inFlight) bool {
+		return work.podcastID == podcastID && work.itemID != ""
+	})
+}
+
+// blockPodcastDownloads cancels the downloads of a podcast's episodes with
+// cause, including those starting before unblock is called.
+func blockPodcastDownloads(podcastID string, cause error) (unblock func()) {
+	inFlightMutex.Lock()
+	blockedPodcasts[podcastID] = cause
+	inFlightMutex.Unlock()
+	cancelPodcastDownloads(podcastID, cause)
+	return func() {
+		inFlightMutex.Lock()
+		delete(blockedPodcasts, podcastID)
+		inFlightMutex.Unlock()
+	}
+}
+
+// isCancelled reports whether err comes from work that was cancelled rather
+// than work that failed.
+func isCancelled(err error) bool {
+	return errors.Is(err, ErrShuttingDown) ||
+		errors.Is(err, ErrDownloadCancelled) ||
+		errors.Is(err, errDownloadsPaused) ||
+		errors.Is(err, errPodcastDeleted)
+}
+
+// CancelDownload stops the download of an episode, or takes it off the
+// download queue if it has not started. The episode is then not downloaded
+// again unless requested.
+func CancelDownload(podcastItemID string) error {
+	var podcastItem db.PodcastItem
+	if err := db.GetPodcastItemByID(podcastItemID, &podcastItem); err != nil {
+		return err
+	}
+	cancelled := cancelWork(ErrDownloadCancelled, func(work *inFlight) bool {
+		return work.itemID == podcastItemID
+	})
+	if !cancelled && podcastItem.DownloadStatus != db.NotDownloaded {
+		return ErrNotDownloading
+	}
+	return SetPodcastItemAsNotDownloaded(podcastItemID, db.Deleted)
+}
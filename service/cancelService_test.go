@@ -0,0 +1,134 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/akhilrex/podgrab/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// startStalledDownload starts downloading an episode from a server that stops
+// halfway, and waits until the first half is written.
+func startStalledDownload(t *testing.T, content []byte) (*db.PodcastItem, string, <-chan error, func() []string) {
+	t.Helper()
+	server, ranges := rangeServer(t, content, true)
+	podcast := db.CreateTestPodcast(t, db.DB, &db.Podcast{Title: "Podcast"})
+	item := db.CreateTestPodcastItem(t, db.DB, podcast.ID, &db.PodcastItem{
+		Title:   "Stalled",
+		FileURL: server.URL + "/episode.mp3",
+	})
+
+	result := make(chan error, 1)
+	go func() {
+		result <- DownloadSingleEpisode(context.Background(), item.ID)
+	}()
+
+	partPath := partFilePath(item.FileURL, item.Title)
+	require.Eventually(t, func() bool {
+		info, err := os.Stat(partPath)
+		return err == nil && info.Size() == int64(len(content)/2)
+	}, 5*time.Second, 10*time.Millisecond, "Should write the first half")
+	return item, partPath, result, ranges
+}
+
+// TestCancelDownload tests cancelling running and queued downloads.
+func TestCancelDownload(t *testing.T) {
+	useTestDataDir(t)
+	content := []byte(strings.Repeat("podcast audio ", 4096))
+
+	t.Run("running", func(t *testing.T) {
+		item, partPath, result, _ := startStalledDownload(t, content)
+
+		require.NoError(t, CancelDownload(item.ID))
+		assert.ErrorIs(t, <-result, ErrDownloadCancelled)
+		assert.NoFileExists(t, partPath, "Cancelled download should not leave a partial file")
+
+		var updated db.PodcastItem
+		require.NoError(t, db.GetPodcastItemByID(item.ID, &updated))
+		assert.Equal(t, db.Deleted, updated.DownloadStatus, "Cancelled episode should not be downloaded again")
+		assert.Zero(t, updated.DownloadFailureCount, "Cancelling is not a failure")
+
+		assert.ErrorIs(t, CancelDownload(item.ID), ErrNotDownloading)
+	})
+
+	t.Run("queued", func(t *testing.T) {
+		podcast := db.CreateTestPodcast(t, db.DB)
+		item := db.CreateTestPodcastItem(t, db.DB, podcast.ID)
+
+		require.NoError(t, CancelDownload(item.ID))
+		var updated db.PodcastItem
+		require.NoError(t, db.GetPodcastItemByID(item.ID, &updated))
+		assert.Equal(t, db.Deleted, updated.DownloadStatus, "Queued episode should leave the queue")
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		assert.ErrorIs(t, CancelDownload("missing"), gorm.ErrRecordNotFound)
+	})
+}
+
+// TestTogglePodcastPause_CancelsDownloads tests that pausing stops downloads,
+// which resume from their partial files once the podcast is resumed.
+func TestTogglePodcastPause_CancelsDownloads(t *testing.T) {
+	useTestDataDir(t)
+	content := []byte(strings.Repeat("podcast audio ", 4096))
+	item, partPath, result, ranges := startStalledDownload(t, content)
+
+	require.NoError(t, TogglePodcastPause(item.PodcastID, true))
+	assert.ErrorIs(t, <-result, errPodcastPaused)
+	assert.FileExists(t, partPath, "Paused download should keep its partial file")
+
+	var updated db.PodcastItem
+	require.NoError(t, db.GetPodcastItemByID(item.ID, &updated))
+	assert.Equal(t, db.NotDownloaded, updated.DownloadStatus, "Paused episode should stay queued")
+	assert.Zero(t, updated.DownloadFailureCount, "Pausing is not a failure")
+
+	require.NoError(t, DownloadMissingEpisodes(context.Background()))
+	assert.Len(t, ranges(), 1, "Episodes of a paused podcast should not be downloaded")
+
+	require.NoError(t, TogglePodcastPause(item.PodcastID, false))
+	require.NoError(t, DownloadMissingEpisodes(context.Background()))
+	require.NoError(t, db.GetPodcastItemByID(item.ID, &updated))
+	assert.Equal(t, db.Downloaded, updated.DownloadStatus)
+	assert.Equal(t, []string{"", fmt.Sprintf("bytes=%d-", len(content)/2)}, ranges(), "Download should resume")
+}
+
+// TestDeletePodcast_CancelsWork tests that deleting a podcast stops its feed
+// fetches and downloads before removing its files.
+func TestDeletePodcast_CancelsWork(t *testing.T) {
+	useTestDataDir(t)
+	content := []byte(strings.Repeat("podcast audio ", 4096))
+	item, partPath, download, _ := startStalledDownload(t, content)
+
+	fetching := make(chan struct{})
+	feed := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		close(fetching)
+		<-r.Context().Done()
+	}))
+	defer feed.Close()
+	var podcast db.Podcast
+	require.NoError(t, db.GetPodcastByID(item.PodcastID, &podcast))
+	podcast.URL = feed.URL
+	refresh := make(chan error, 1)
+	go func() {
+		refresh <- AddPodcastItems(context.Background(), &podcast, false)
+	}()
+	<-fetching
+
+	require.NoError(t, DeletePodcast(podcast.ID, true))
+	assert.ErrorIs(t, <-download, errPodcastDeleted)
+	assert.ErrorIs(t, <-refresh, errPodcastDeleted)
+	assert.NoFileExists(t, partPath)
+
+	var items []db.PodcastItem
+	require.NoError(t, db.GetAllPodcastItemsByPodcastID(podcast.ID, &items))
+	assert.Empty(t, items, "Refresh should not add episodes to a deleted podcast")
+}
@@ -0,0 +1,256 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/akhilrex/podgrab/db"
+	"github.com/akhilrex/podgrab/internal/logger"
+)
+
+// Dedup sensitivities, from trusting GUIDs alone to matching on titles.
+const (
+	// DedupOff matches feed entries to episodes by GUID only.
+	DedupOff = "off"
+	// DedupStrict also matches entries with the same enclosure URL.
+	DedupStrict = "strict"
+	// DedupNormal also matches entries with the same title and publication day.
+	DedupNormal = "normal"
+	// DedupLoose also matches entries with the same title or file name and
+	// the same file size or duration.
+	DedupLoose = "loose"
+)
+
+// Strategies recorded in an episode's history.
+const (
+	matchedByGUID      = "guid"
+	matchedByEnclosure = "enclosure"
+	matchedByTitleDate = "title_date"
+	matchedByTitleSize = "title_size"
+	matchedByFileName  = "file_name"
+)
+
+// ErrInvalidDedupSensitivity is returned for unknown dedup sensitivities.
+var ErrInvalidDedupSensitivity = errors.New("invalid dedup sensitivity")
+
+var dedupLevels = map[string]int{DedupOff: 0, DedupStrict: 1, DedupNormal: 2, DedupLoose: 3}
+
+// durationTolerance is how far the durations of matching episodes may differ,
+// as publishers re-encoding files shift them slightly.
+const durationTolerance = 5
+
+// trackingPrefixes match the analytics redirects publishers put in front of
+// enclosure URLs, which change when they switch providers.
+var trackingPrefixes = regexp.MustCompile(`^(` +
+	`dts\.podtrac\.com/redirect\.[a-z0-9]+|podtrac\.com/pts/redirect\.[a-z0-9]+|` +
+	`chtbl\.com/track/[^/]+|chrt\.fm/track/[^/]+|pdst\.fm/e|op3\.dev/e(,[^/]*)?|` +
+	`pfx\.vpixl\.com/[^/]+|mgln\.ai/e/[^/]+|arttrk\.com/p/[^/]+|verifi\.podscribe\.com/rss/p` +
+	`)/`)
+
+// validateDedupSensitivity checks that sensitivity is known. Empty uses the default.
+func validateDedupSensitivity(sensitivity string) error {
+	if _, ok := dedupLevels[sensitivity]; !ok && sensitivity != "" {
+		return fmt.Errorf("%w: %q", ErrInvalidDedupSensitivity, sensitivity)
+	}
+	return nil
+}
+
+func dedupLevel(setting *db.Setting) int {
+	if level, ok := dedupLevels[setting.DedupSensitivity]; ok {
+		return level
+	}
+	return dedupLevels[DedupNormal]
+}
+
+// normaliseEnclosureURL reduces an enclosure URL to its host and path without
+// tracking redirects, so the same file matches across schemes, query tokens
+// and analytics providers.
+func normaliseEnclosureURL(raw string) string {
+	parsed, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || parsed.Host == "" {
+		return ""
+	}
+	location := strings.ToLower(parsed.Host) + parsed.EscapedPath()
+	for {
+		location = strings.TrimPrefix(location, "www.")
+		stripped := trackingPrefixes.ReplaceAllString(location, "")
+		if stripped == location {
+			break
+		}
+		// Some redirects embed the scheme of the target
+		location = strings.TrimPrefix(strings.TrimPrefix(stripped, "https://"), "http://")
+	}
+	host, rest, _ := strings.Cut(location, "/")
+	return strings.ToLower(host) + "/" + rest
+}
+
+// normaliseTitle ignores case, punctuation and spacing in episode titles.
+func normaliseTitle(title string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(title), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	}), " ")
+}
+
+// episodeMatcher finds the existing episode a feed entry with an unknown GUID
+// duplicates.
+type episodeMatcher struct {
+	level       int
+	byEnclosure map[string]*db.PodcastItem
+	byTitleDate map[string]*db.PodcastItem
+	byTitle     map[string][]*db.PodcastItem
+	byFileName  map[string][]*db.PodcastItem
+	// matched holds the episodes already merged in this refresh, so that
+	// each episode takes at most one entry.
+	matched map[string]bool
+}
+
+// newEpisodeMatcher indexes the episodes of existing that entries can be
+// merged into.
+func newEpisodeMatcher(level int, existing []db.PodcastItem) *episodeMatcher {
+	matcher := &episodeMatcher{
+		level:       level,
+		byEnclosure: make(map[string]*db.PodcastItem),
+		byTitleDate: make(map[string]*db.PodcastItem),
+		byTitle:     make(map[string][]*db.PodcastItem),
+		byFileName:  make(map[string][]*db.PodcastItem),
+		matched:     make(map[string]bool),
+	}
+	for i := range existing {
+		item := &existing[i]
+		if enclosure := normaliseEnclosureURL(item.FileURL); enclosure != "" {
+			matcher.byEnclosure[enclosure] = item
+			if name := path.Base(enclosure); name != "" && name != "/" {
+				matcher.byFileName[name] = append(matcher.byFileName[name], item)
+			}
+		}
+		if title := normaliseTitle(item.Title); title != "" {
+			if !item.PubDate.IsZero() {
+				matcher.byTitleDate[titleDateKey(title, item.PubDate)] = item
+			}
+			matcher.byTitle[title] = append(matcher.byTitle[title], item)
+		}
+	}
+	return matcher
+}
+
+func titleDateKey(title string, pubDate time.Time) string {
+	return title + "|" + pubDate.UTC().Format("2006-01-02")
+}
+
+// newPodcastMatcher indexes the episodes of a podcast that are missing from
+// its feed, skipping those in current, which the feed still lists by GUID.
+func newPodcastMatcher(podcastID string, setting *db.Setting, current map[string]*db.PodcastItem) *episodeMatcher {
+	level := dedupLevel(setting)
+	if level == dedupLevels[DedupOff] {
+		return newEpisodeMatcher(level, nil)
+	}
+	var items []db.PodcastItem
+	if err := db.GetAllPodcastItemsByPodcastID(podcastID, &items); err != nil {
+		logger.Log.Errorw("loading episodes to match", "error", err)
+		return newEpisodeMatcher(dedupLevels[DedupOff], nil)
+	}
+	missing := items[:0]
+	for i := range items {
+		if _, listed := current[items[i].GUID]; !listed {
+			missing = append(missing, items[i])
+		}
+	}
+	return newEpisodeMatcher(level, missing)
+}
+
+// match returns the existing episode entry duplicates and the strategy that
+// matched it.
+func (matcher *episodeMatcher) match(entry *db.PodcastItem, size int64) (*db.PodcastItem, string) {
+	if matcher.level < dedupLevels[DedupStrict] {
+		return nil, ""
+	}
+	enclosure := normaliseEnclosureURL(entry.FileURL)
+	if item := matcher.byEnclosure[enclosure]; enclosure != "" && matcher.take(item) {
+		return item, matchedByEnclosure
+	}
+	if matcher.level < dedupLevels[DedupNormal] {
+		return nil, ""
+	}
+	title := normaliseTitle(entry.Title)
+	if title != "" && !entry.PubDate.IsZero() {
+		if item := matcher.byTitleDate[titleDateKey(title, entry.PubDate)]; matcher.take(item) {
+			return item, matchedByTitleDate
+		}
+	}
+	if matcher.level < dedupLevels[DedupLoose] {
+		return nil, ""
+	}
+	for _, item := range matcher.byTitle[title] {
+		if title != "" && sameFile(item, entry, size) && matcher.take(item) {
+			return item, matchedByTitleSize
+		}
+	}
+	if enclosure != "" {
+		for _, item := range matcher.byFileName[path.Base(enclosure)] {
+			if sameFile(item, entry, size) && matcher.take(item) {
+				return item, matchedByFileName
+			}
+		}
+	}
+	return nil, ""
+}
+
+// take claims item for an entry unless it already took another.
+func (matcher *episodeMatcher) take(item *db.PodcastItem) bool {
+	if item == nil || matcher.matched[item.ID] {
+		return false
+	}
+	matcher.matched[item.ID] = true
+	return true
+}
+
+// sameFile reports whether entry, with an enclosure of size bytes, has the
+// file size or duration of item.
+func sameFile(item, entry *db.PodcastItem, size int64) bool {
+	if size > 0 && item.FileSize > 0 && size == item.FileSize {
+		return true
+	}
+	if entry.Duration > 0 && item.Duration > 0 {
+		diff := entry.Duration - item.Duration
+		return diff >= -durationTolerance && diff <= durationTolerance
+	}
+	return false
+}
+
+// enclosureLength parses the length attribute of an enclosure. Missing or
+// invalid lengths are zero.
+func enclosureLength(length string) int64 {
+	size, err := strconv.ParseInt(strings.TrimSpace(length), 10, 64)
+	if err != nil || size < 0 {
+		return 0
+	}
+	return size
+}
+
+// mergeEpisode moves entry's GUID, enclosure and details into item, keeping
+// its download, and records the change.
+func mergeEpisode(item, entry *db.PodcastItem, matchedBy string) error {
+	oldGUID := item.GUID
+	if err := applyFeedEntry(item, entry, feedHistory(item, entry, matchedBy)); err != nil {
+		return err
+	}
+	logger.Log.Infow("Merged changed feed entry into episode",
+		"episode", item.Title, "matched_by", matchedBy, "old_guid", oldGUID, "new_guid", entry.GUID)
+	return nil
+}
+
+// GetEpisodeHistory returns the GUID and enclosure changes of an episode.
+func GetEpisodeHistory(podcastItemID string) ([]db.PodcastItemHistory, error) {
+	var item db.PodcastItem
+	if err := db.GetPodcastItemByID(podcastItemID, &item); err != nil {
+		return nil, err
+	}
+	return db.GetPodcastItemHistory(podcastItemID)
+}
@@ -0,0 +1,170 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/akhilrex/podgrab/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestNormaliseEnclosureURL tests reducing enclosure URLs to the file they
+// point to.
+func TestNormaliseEnclosureURL(t *testing.T) {
+	tests := []struct {
+		name     string
+		url      string
+		expected string
+	}{
+		{name: "plain", url: "https://cdn.example.com/ep1.mp3", expected: "cdn.example.com/ep1.mp3"},
+		{name: "scheme_and_query", url: "http://WWW.cdn.example.com/ep1.mp3?token=abc", expected: "cdn.example.com/ep1.mp3"},
+		{name: "podtrac", url: "https://dts.podtrac.com/redirect.mp3/cdn.example.com/ep1.mp3", expected: "cdn.example.com/ep1.mp3"},
+		{
+			name:     "chained",
+			url:      "https://chtbl.com/track/ABC123/dts.podtrac.com/redirect.mp3/https://cdn.example.com/ep1.mp3",
+			expected: "cdn.example.com/ep1.mp3",
+		},
+		{name: "invalid", url: "not a url", expected: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, normaliseEnclosureURL(tt.url))
+		})
+	}
+}
+
+// TestEpisodeMatcher tests which strategies each sensitivity applies.
+func TestEpisodeMatcher(t *testing.T) {
+	pubDate := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	existing := []db.PodcastItem{{
+		Base:     db.Base{ID: "episode-1"},
+		Title:    "Episode 1: The Start",
+		PubDate:  pubDate,
+		FileURL:  "https://old-host.example.com/files/ep1.mp3",
+		FileSize: 1000,
+		Duration: 1800,
+	}}
+	tests := []struct {
+		name      string
+		entry     db.PodcastItem
+		size      int64
+		matchedBy map[string]string
+	}{
+		{
+			name:      "enclosure",
+			entry:     db.PodcastItem{Title: "Renamed", FileURL: "https://dts.podtrac.com/redirect.mp3/old-host.example.com/files/ep1.mp3"},
+			matchedBy: map[string]string{DedupStrict: matchedByEnclosure, DedupNormal: matchedByEnclosure, DedupLoose: matchedByEnclosure},
+		},
+		{
+			name:      "title_date",
+			entry:     db.PodcastItem{Title: "episode 1 - the start", PubDate: pubDate.Add(3 * time.Hour), FileURL: "https://new-host.example.com/a.mp3"},
+			matchedBy: map[string]string{DedupNormal: matchedByTitleDate, DedupLoose: matchedByTitleDate},
+		},
+		{
+			name:      "title_size",
+			entry:     db.PodcastItem{Title: "Episode 1: The Start", PubDate: pubDate.AddDate(0, 0, 7), FileURL: "https://new-host.example.com/a.mp3"},
+			size:      1000,
+			matchedBy: map[string]string{DedupLoose: matchedByTitleSize},
+		},
+		{
+			name:      "file_name_duration",
+			entry:     db.PodcastItem{Title: "Pilot", Duration: 1803, FileURL: "https://new-host.example.com/ep1.mp3"},
+			matchedBy: map[string]string{DedupLoose: matchedByFileName},
+		},
+		{
+			name:  "different_episode",
+			entry: db.PodcastItem{Title: "Episode 2", PubDate: pubDate, Duration: 1800, FileURL: "https://old-host.example.com/files/ep2.mp3"},
+		},
+	}
+	for _, tt := range tests {
+		for _, sensitivity := range []string{DedupOff, DedupStrict, DedupNormal, DedupLoose} {
+			t.Run(tt.name+"_"+sensitivity, func(t *testing.T) {
+				matcher := newEpisodeMatcher(dedupLevels[sensitivity], existing)
+				item, matchedBy := matcher.match(&tt.entry, tt.size)
+				assert.Equal(t, tt.matchedBy[sensitivity], matchedBy)
+				if matchedBy != "" {
+					assert.Equal(t, "episode-1", item.ID)
+					again, _ := matcher.match(&tt.entry, tt.size)
+					assert.Nil(t, again, "An episode should take at most one entry")
+				}
+			})
+		}
+	}
+}
+
+// TestAddPodcastItems_Dedup tests that a publisher regenerating GUIDs and
+// moving hosts does not add the episodes again, and that the changes are
+// recorded.
+func TestAddPodcastItems_Dedup(t *testing.T) {
+	useTestDB(t)
+	db.CreateTestSetting(t, db.DB)
+
+	var mu sync.Mutex
+	feed := `<item><title>Episode 1</title><guid>old-1</guid><pubDate>Fri, 01 Mar 2024 10:00:00 +0000</pubDate>
+<enclosure url="https://old-host.example.com/ep1.mp3" type="audio/mpeg"/></item>
+<item><title>Episode 2</title><guid>old-2</guid><pubDate>Fri, 08 Mar 2024 10:00:00 +0000</pubDate>
+<enclosure url="https://old-host.example.com/ep2.mp3" type="audio/mpeg"/></item>`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		_, _ = fmt.Fprintf(w, `<?xml version="1.0"?><rss version="2.0"><channel><title>Moved</title>%s</channel></rss>`, feed)
+	}))
+	defer server.Close()
+
+	podcast := db.CreateTestPodcast(t, db.DB, &db.Podcast{URL: server.URL + "/feed.xml"})
+	require.NoError(t, AddPodcastItems(context.Background(), podcast, false))
+	var items []db.PodcastItem
+	require.NoError(t, db.GetAllPodcastItemsByPodcastID(podcast.ID, &items))
+	require.Len(t, items, 2)
+
+	mu.Lock()
+	feed = `<item><title>Episode 1</title><guid>new-1</guid><pubDate>Fri, 01 Mar 2024 12:00:00 +0000</pubDate>
+<enclosure url="https://new-host.example.com/media/ep1.mp3" type="audio/mpeg"/></item>
+<item><title>Episode 2 (remastered)</title><guid>new-2</guid><pubDate>Fri, 08 Mar 2024 10:00:00 +0000</pubDate>
+<enclosure url="https://dts.podtrac.com/redirect.mp3/old-host.example.com/ep2.mp3" type="audio/mpeg"/></item>
+<item><title>Episode 3</title><guid>new-3</guid><pubDate>Fri, 15 Mar 2024 10:00:00 +0000</pubDate>
+<enclosure url="https://new-host.example.com/media/ep3.mp3" type="audio/mpeg"/></item>`
+	mu.Unlock()
+	require.NoError(t, AddPodcastItems(context.Background(), podcast, false))
+
+	items = nil
+	require.NoError(t, db.GetAllPodcastItemsByPodcastID(podcast.ID, &items))
+	assert.Len(t, items, 3, "Only the new episode should be added")
+	byGUID := make(map[string]db.PodcastItem)
+	for _, item := range items {
+		byGUID[item.GUID] = item
+	}
+	require.Contains(t, byGUID, "new-1")
+	require.Contains(t, byGUID, "new-2")
+	assert.Equal(t, "https://new-host.example.com/media/ep1.mp3", byGUID["new-1"].FileURL)
+	assert.Equal(t, "Episode 2 (remastered)", byGUID["new-2"].Title)
+
+	history, err := GetEpisodeHistory(byGUID["new-1"].ID)
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	assert.Equal(t, "old-1", history[0].OldGUID)
+	assert.Equal(t, "https://old-host.example.com/ep1.mp3", history[0].OldFileURL)
+	assert.Equal(t, matchedByTitleDate, history[0].MatchedBy)
+	history, err = GetEpisodeHistory(byGUID["new-2"].ID)
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	assert.Equal(t, matchedByEnclosure, history[0].MatchedBy)
+
+	// An enclosure moving under the same GUID is recorded too
+	mu.Lock()
+	feed = `<item><title>Episode 3</title><guid>new-3</guid><pubDate>Fri, 15 Mar 2024 10:00:00 +0000</pubDate>
+<enclosure url="https://cdn.example.com/ep3.mp3?token=abc" type="audio/mpeg"/></item>`
+	mu.Unlock()
+	require.NoError(t, AddPodcastItems(context.Background(), podcast, false))
+	history, err = GetEpisodeHistory(byGUID["new-3"].ID)
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	assert.Equal(t, matchedByGUID, history[0].MatchedBy)
+	assert.Equal(t, "https://cdn.example.com/ep3.mp3?token=abc", history[0].NewFileURL)
+}
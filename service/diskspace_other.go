@@ -0,0 +1,8 @@
+//go:build !linux && !darwin
+
+package service
+
+// diskFree is not implemented on this platform.
+func diskFree(_ string) (uint64, error) {
+	return 0, errDiskStatsUnsupported
+}
@@ -0,0 +1,249 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/akhilrex/podgrab/db"
+	"github.com/akhilrex/podgrab/internal/logger"
+	"golang.org/x/time/rate"
+)
+
+// downloadWindowLayout is the format of the download window times.
+const downloadWindowLayout = "15:04"
+
+var (
+	// ErrInvalidDownloadLimits is returned for download limits that cannot be applied.
+	ErrInvalidDownloadLimits = errors.New("invalid download limits")
+
+	// errDownloadsPaused is the cause of queued downloads stopped by the
+	// download window or the metered connection setting. They stay queued.
+	errDownloadsPaused   = errors.New("downloads paused")
+	errMeteredConnection = fmt.Errorf("%w: metered connection", errDownloadsPaused)
+	errOutsideWindow     = fmt.Errorf("%w: outside the download window", errDownloadsPaused)
+)
+
+// downloadWindowCheck is how often running queued downloads check that they
+// may continue.
+var downloadWindowCheck = 30 * time.Second
+
+// DownloadLimits controls when queued episodes are downloaded and how much
+// bandwidth downloads use. Rates are in KB/s, zero meaning unlimited. The host
+// limits apply to every request to a remote host, zero using the defaults.
+type DownloadLimits struct {
+	WindowStart           string `json:"windowStart"`
+	WindowEnd             string `json:"windowEnd"`
+	MaxRate               int    `json:"maxRate"`
+	MaxHostRate           int    `json:"maxHostRate"`
+	HostConnections       int    `json:"hostConnections"`
+	HostRequestsPerMinute int    `json:"hostRequestsPerMinute"`
+	Metered               bool   `json:"metered"`
+}
+
+var (
+	bandwidthMutex sync.Mutex
+	globalLimiter  = rate.NewLimiter(rate.Inf, 0)
+	hostLimiters   = make(map[string]*rate.Limiter)
+	hostLimit      = rate.Inf
+	hostBurst      int
+	// limitsChanged is closed and replaced when the download limits change.
+	limitsChanged = make(chan struct{})
+)
+
+// GetDownloadLimits returns the current download limits.
+func GetDownloadLimits() DownloadLimits {
+	setting := db.GetOrCreateSetting()
+	return DownloadLimits{
+		WindowStart:           setting.DownloadWindowStart,
+		WindowEnd:             setting.DownloadWindowEnd,
+		MaxRate:               setting.MaxDownloadRate,
+		MaxHostRate:           setting.MaxHostDownloadRate,
+		HostConnections:       setting.HostConnections,
+		HostRequestsPerMinute: setting.HostRequestsPerMinute,
+		Metered:               setting.MeteredConnection,
+	}
+}
+
+// UpdateDownloadLimits stores new download limits and applies them to running
+// downloads.
+func UpdateDownloadLimits(limits DownloadLimits) error {
+	if limits.MaxRate < 0 || limits.MaxHostRate < 0 || limits.HostConnections < 0 || limits.HostRequestsPerMinute < 0 {
+		return fmt.Errorf("%w: limits cannot be negative", ErrInvalidDownloadLimits)
+	}
+	if (limits.WindowStart == "") != (limits.WindowEnd == "") {
+		return fmt.Errorf("%w: set both ends of the download window or neither", ErrInvalidDownloadLimits)
+	}
+	for _, value := range []string{limits.WindowStart, limits.WindowEnd} {
+		if _, err := time.Parse(downloadWindowLayout, value); value != "" && err != nil {
+			return fmt.Errorf("%w: %q is not a time like 01:30", ErrInvalidDownloadLimits, value)
+		}
+	}
+
+	setting := db.GetOrCreateSetting()
+	setting.DownloadWindowStart = limits.WindowStart
+	setting.DownloadWindowEnd = limits.WindowEnd
+	setting.MaxDownloadRate = limits.MaxRate
+	setting.MaxHostDownloadRate = limits.MaxHostRate
+	setting.HostConnections = limits.HostConnections
+	setting.HostRequestsPerMinute = limits.HostRequestsPerMinute
+	setting.MeteredConnection = limits.Metered
+	if err := db.UpdateSettings(setting); err != nil {
+		return err
+	}
+	applyBandwidthLimits(setting)
+	applyHostLimits(setting)
+
+	bandwidthMutex.Lock()
+	close(limitsChanged)
+	limitsChanged = make(chan struct{})
+	bandwidthMutex.Unlock()
+	return nil
+}
+
+// ApplyDownloadLimits applies the stored bandwidth and per-host limits. It is
+// called once the database is open; UpdateDownloadLimits applies changes.
+func ApplyDownloadLimits() {
+	setting := db.GetOrCreateSetting()
+	applyBandwidthLimits(setting)
+	applyHostLimits(setting)
+}
+
+// applyBandwidthLimits sets the download rate limiters from the settings.
+func applyBandwidthLimits(setting *db.Setting) {
+	limit, burst := bandwidthLimit(setting.MaxDownloadRate)
+	perHost, perHostBurst := bandwidthLimit(setting.MaxHostDownloadRate)
+
+	bandwidthMutex.Lock()
+	defer bandwidthMutex.Unlock()
+	globalLimiter.SetLimit(limit)
+	globalLimiter.SetBurst(burst)
+	hostLimit, hostBurst = perHost, perHostBurst
+	for _, limiter := range hostLimiters {
+		limiter.SetLimit(perHost)
+		limiter.SetBurst(perHostBurst)
+	}
+}
+
+// bandwidthLimit converts a rate in KB/s to a limiter rate in bytes per second
+// with a burst of one second.
+func bandwidthLimit(kbPerSecond int) (rate.Limit, int) {
+	if kbPerSecond <= 0 {
+		return rate.Inf, 0
+	}
+	bytes := kbPerSecond * 1024
+	return rate.Limit(bytes), bytes
+}
+
+// hostLimiter returns the rate limiter shared by downloads from host.
+func hostLimiter(host string) *rate.Limiter {
+	bandwidthMutex.Lock()
+	defer bandwidthMutex.Unlock()
+	limiter, ok := hostLimiters[host]
+	if !ok {
+		limiter = rate.NewLimiter(hostLimit, hostBurst)
+		hostLimiters[host] = limiter
+	}
+	return limiter
+}
+
+// throttledReader reads no faster than its limiters allow.
+type throttledReader struct {
+	ctx      context.Context
+	reader   io.Reader
+	limiters []*rate.Limiter
+}
+
+// throttle limits reading a download from host to the global and per-host rates.
+func throttle(ctx context.Context, host string, reader io.Reader) io.Reader {
+	return &throttledReader{
+		ctx:      ctx,
+		reader:   reader,
+		limiters: []*rate.Limiter{globalLimiter, hostLimiter(host)},
+	}
+}
+
+func (r *throttledReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	for _, limiter := range r.limiters {
+		if waitErr := waitBytes(r.ctx, limiter, n); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
+
+// waitBytes waits until limiter allows n bytes, in steps no larger than its burst.
+func waitBytes(ctx context.Context, limiter *rate.Limiter, n int) error {
+	for n > 0 {
+		step := n
+		if burst := limiter.Burst(); limiter.Limit() != rate.Inf && step > burst {
+			step = burst
+		}
+		if err := limiter.WaitN(ctx, step); err != nil {
+			return err
+		}
+		n -= step
+	}
+	return nil
+}
+
+// downloadsPaused returns why queued downloads may not run at now, or nil if
+// they may.
+func downloadsPaused(setting *db.Setting, now time.Time) error {
+	if setting.MeteredConnection {
+		return errMeteredConnection
+	}
+	if !inDownloadWindow(setting.DownloadWindowStart, setting.DownloadWindowEnd, now) {
+		return errOutsideWindow
+	}
+	return nil
+}
+
+// inDownloadWindow reports whether now falls in the daily window from start to
+// end, which may span midnight. An empty or invalid window allows any time.
+func inDownloadWindow(start, end string, now time.Time) bool {
+	from, startErr := time.Parse(downloadWindowLayout, start)
+	to, endErr := time.Parse(downloadWindowLayout, end)
+	if startErr != nil || endErr != nil {
+		return true
+	}
+	minute := now.Hour()*60 + now.Minute()
+	fromMinute := from.Hour()*60 + from.Minute()
+	toMinute := to.Hour()*60 + to.Minute()
+	switch {
+	case fromMinute == toMinute:
+		return true
+	case fromMinute < toMinute:
+		return minute >= fromMinute && minute < toMinute
+	default:
+		return minute >= fromMinute || minute < toMinute
+	}
+}
+
+// watchDownloadWindow cancels queued downloads once the download window closes
+// or the connection is marked as metered.
+func watchDownloadWindow(ctx context.Context, cancel context.CancelCauseFunc) {
+	ticker := time.NewTicker(downloadWindowCheck)
+	defer ticker.Stop()
+	for {
+		bandwidthMutex.Lock()
+		changed := limitsChanged
+		bandwidthMutex.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-changed:
+		}
+		if err := downloadsPaused(db.GetOrCreateSetting(), time.Now()); err != nil {
+			logger.Log.Infow("Pausing queued downloads", "reason", err)
+			cancel(err)
+			return
+		}
+	}
+}
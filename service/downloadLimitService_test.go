@@ -0,0 +1,176 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/akhilrex/podgrab/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// resetBandwidthLimits removes the limits set by a test.
+func resetBandwidthLimits(t *testing.T) {
+	t.Helper()
+	t.Cleanup(func() {
+		applyBandwidthLimits(&db.Setting{})
+		applyHostLimits(&db.Setting{})
+	})
+}
+
+// TestInDownloadWindow tests windows within a day and across midnight.
+func TestInDownloadWindow(t *testing.T) {
+	at := func(clock string) time.Time {
+		parsed, err := time.Parse("15:04", clock)
+		require.NoError(t, err)
+		return parsed
+	}
+
+	tests := []struct {
+		name       string
+		start, end string
+		now        string
+		expected   bool
+	}{
+		{name: "no_window", now: "12:00", expected: true},
+		{name: "inside", start: "01:00", end: "06:00", now: "03:30", expected: true},
+		{name: "at_start", start: "01:00", end: "06:00", now: "01:00", expected: true},
+		{name: "at_end", start: "01:00", end: "06:00", now: "06:00", expected: false},
+		{name: "before", start: "01:00", end: "06:00", now: "00:59", expected: false},
+		{name: "overnight_late", start: "22:00", end: "06:00", now: "23:15", expected: true},
+		{name: "overnight_early", start: "22:00", end: "06:00", now: "05:59", expected: true},
+		{name: "overnight_outside", start: "22:00", end: "06:00", now: "12:00", expected: false},
+		{name: "whole_day", start: "04:00", end: "04:00", now: "12:00", expected: true},
+		{name: "invalid", start: "late", end: "06:00", now: "12:00", expected: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, inDownloadWindow(tt.start, tt.end, at(tt.now)))
+		})
+	}
+}
+
+// TestUpdateDownloadLimits tests validating and storing download limits.
+func TestUpdateDownloadLimits(t *testing.T) {
+	useTestDB(t)
+	db.CreateTestSetting(t, db.DB)
+	resetBandwidthLimits(t)
+
+	invalid := []DownloadLimits{
+		{MaxRate: -1},
+		{MaxHostRate: -5},
+		{HostConnections: -1},
+		{HostRequestsPerMinute: -1},
+		{WindowStart: "01:00"},
+		{WindowStart: "1am", WindowEnd: "06:00"},
+		{WindowStart: "01:00", WindowEnd: "25:00"},
+	}
+	for _, limits := range invalid {
+		assert.ErrorIs(t, UpdateDownloadLimits(limits), ErrInvalidDownloadLimits, "%+v", limits)
+	}
+
+	limits := DownloadLimits{
+		WindowStart:           "01:00",
+		WindowEnd:             "06:00",
+		MaxRate:               512,
+		MaxHostRate:           128,
+		HostConnections:       2,
+		HostRequestsPerMinute: 30,
+		Metered:               true,
+	}
+	require.NoError(t, UpdateDownloadLimits(limits))
+	assert.Equal(t, limits, GetDownloadLimits())
+	assert.Equal(t, 5, db.GetOrCreateSetting().MaxDownloadConcurrency, "Other settings should be kept")
+	assert.Equal(t, float64(512*1024), float64(globalLimiter.Limit()), "Limits should apply immediately")
+	assert.Equal(t, float64(128*1024), float64(hostLimiter("example.com").Limit()))
+	assert.Equal(t, 2, hostConnections)
+
+	require.NoError(t, UpdateDownloadLimits(DownloadLimits{}))
+	assert.Equal(t, DownloadLimits{}, GetDownloadLimits())
+}
+
+// TestApplyDownloadLimits tests that stored limits apply at startup.
+func TestApplyDownloadLimits(t *testing.T) {
+	useTestDB(t)
+	resetBandwidthLimits(t)
+	t.Cleanup(func() { applyHostLimits(&db.Setting{}) })
+	setting := db.GetOrCreateSetting()
+	setting.MaxDownloadRate = 256
+	setting.HostConnections = 3
+	require.NoError(t, db.UpdateSettings(setting))
+
+	ApplyDownloadLimits()
+	assert.Equal(t, float64(256*1024), float64(globalLimiter.Limit()))
+	assert.Equal(t, 3, hostConnections)
+}
+
+// TestThrottle tests that reads are limited to the configured rate.
+func TestThrottle(t *testing.T) {
+	resetBandwidthLimits(t)
+	applyBandwidthLimits(&db.Setting{MaxHostDownloadRate: 64})
+
+	content := bytes.Repeat([]byte("x"), 128*1024)
+	start := time.Now()
+	read, err := io.ReadAll(throttle(context.Background(), "slow.example.com", bytes.NewReader(content)))
+	require.NoError(t, err)
+	assert.Equal(t, content, read)
+	assert.GreaterOrEqual(t, time.Since(start), 900*time.Millisecond, "128 KB at 64 KB/s should take about a second")
+
+	start = time.Now()
+	_, err = io.ReadAll(throttle(context.Background(), "other.example.com", bytes.NewReader(content[:64*1024])))
+	require.NoError(t, err)
+	assert.Less(t, time.Since(start), 500*time.Millisecond, "Each host should have its own limit")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err = io.ReadAll(throttle(ctx, "slow.example.com", bytes.NewReader(content)))
+	assert.Error(t, err, "Waiting should stop with the context")
+}
+
+// TestDownloadMissingEpisodes_Paused tests that queued episodes wait while
+// downloads are paused, and that running downloads stop when a pause begins.
+func TestDownloadMissingEpisodes_Paused(t *testing.T) {
+	useTestDataDir(t)
+	resetBandwidthLimits(t)
+	content := []byte(strings.Repeat("podcast audio ", 4096))
+	server, ranges := rangeServer(t, content, true)
+	podcast := db.CreateTestPodcast(t, db.DB, &db.Podcast{Title: "Podcast"})
+	item := db.CreateTestPodcastItem(t, db.DB, podcast.ID, &db.PodcastItem{
+		Title:   "Queued",
+		FileURL: server.URL + "/episode.mp3",
+	})
+
+	require.NoError(t, UpdateDownloadLimits(DownloadLimits{Metered: true}))
+	require.NoError(t, DownloadMissingEpisodes(context.Background()))
+	assert.Empty(t, ranges(), "Nothing should be downloaded on a metered connection")
+
+	require.NoError(t, UpdateDownloadLimits(DownloadLimits{}))
+	result := make(chan error, 1)
+	go func() {
+		result <- DownloadMissingEpisodes(context.Background())
+	}()
+	partPath := partFilePath(item.FileURL, item.Title)
+	require.Eventually(t, func() bool {
+		info, err := os.Stat(partPath)
+		return err == nil && info.Size() == int64(len(content)/2)
+	}, 5*time.Second, 10*time.Millisecond, "Should write the first half")
+
+	require.NoError(t, UpdateDownloadLimits(DownloadLimits{Metered: true}))
+	select {
+	case err := <-result:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Download should stop once the connection is metered")
+	}
+	assert.FileExists(t, partPath, "Paused download should keep its partial file")
+
+	var updated db.PodcastItem
+	require.NoError(t, db.GetPodcastItemByID(item.ID, &updated))
+	assert.Equal(t, db.NotDownloaded, updated.DownloadStatus, "Episode should stay queued")
+	assert.Zero(t, updated.DownloadFailureCount, "Pausing is not a failure")
+}
@@ -0,0 +1,289 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/akhilrex/podgrab/db"
+	"github.com/akhilrex/podgrab/internal/logger"
+	"github.com/akhilrex/podgrab/internal/redact"
+	"github.com/akhilrex/podgrab/internal/secrets"
+	"golang.org/x/net/http/httpguts"
+)
+
+// ErrInvalidFeedAuth is returned for feed credentials that cannot be used.
+var ErrInvalidFeedAuth = errors.New("invalid feed credentials")
+
+// reservedHeaders cannot be set as extra headers because Podgrab sets them itself.
+var reservedHeaders = map[string]bool{
+	"Authorization":     true,
+	"Connection":        true,
+	"Content-Length":    true,
+	"Host":              true,
+	"Range":             true,
+	"Transfer-Encoding": true,
+}
+
+// FeedAuth is the credentials and extra headers sent with the requests for a
+// private feed and its episodes. Token is sent as a bearer token, otherwise
+// Username and Password as basic auth. They are only sent to the feed's host.
+// Query holds the secret parameters of the feed URL, added back when the feed
+// itself is fetched.
+type FeedAuth struct {
+	Headers  map[string]string `json:"headers,omitempty"`
+	Query    map[string]string `json:"query,omitempty"`
+	Username string            `json:"username,omitempty"`
+	Password string            `json:"password,omitempty"`
+	Token    string            `json:"token,omitempty"`
+}
+
+// IsEmpty reports whether auth adds nothing to requests.
+func (auth *FeedAuth) IsEmpty() bool {
+	return auth.Username == "" && auth.Password == "" && auth.Token == "" &&
+		len(auth.Headers) == 0 && len(auth.Query) == 0
+}
+
+// merged returns auth with the fields it leaves empty taken from other.
+func (auth *FeedAuth) merged(other *FeedAuth) FeedAuth {
+	result := *auth
+	if result.Username == "" && result.Token == "" {
+		result.Username, result.Password, result.Token = other.Username, other.Password, other.Token
+	}
+	if len(other.Query) > 0 {
+		result.Query = make(map[string]string, len(auth.Query)+len(other.Query))
+		for name, value := range other.Query {
+			result.Query[name] = value
+		}
+		for name, value := range auth.Query {
+			result.Query[name] = value
+		}
+	}
+	return result
+}
+
+// Validate checks that auth can be sent.
+func (auth *FeedAuth) Validate() error {
+	if auth.Token != "" && auth.Username != "" {
+		return fmt.Errorf("%w: use either a token or a username and password", ErrInvalidFeedAuth)
+	}
+	if auth.Password != "" && auth.Username == "" {
+		return fmt.Errorf("%w: a password needs a username", ErrInvalidFeedAuth)
+	}
+	for name, value := range auth.Headers {
+		if !httpguts.ValidHeaderFieldName(name) || reservedHeaders[http.CanonicalHeaderKey(name)] {
+			return fmt.Errorf("%w: %q cannot be used as a header", ErrInvalidFeedAuth, name)
+		}
+		if !httpguts.ValidHeaderFieldValue(value) {
+			return fmt.Errorf("%w: invalid value for header %s", ErrInvalidFeedAuth, name)
+		}
+	}
+	for name := range auth.Query {
+		if name == "" {
+			return fmt.Errorf("%w: empty query parameter name", ErrInvalidFeedAuth)
+		}
+	}
+	return nil
+}
+
+// splitFeedURL removes the username, password and secret query parameters
+// from feedURL, returning them as credentials so that they are stored
+// encrypted rather than in the podcast's URL.
+func splitFeedURL(feedURL string) (string, FeedAuth) {
+	var auth FeedAuth
+	parsed, err := url.Parse(feedURL)
+	if err != nil || parsed.Host == "" {
+		return feedURL, auth
+	}
+	changed := false
+	if parsed.User != nil {
+		auth.Username = parsed.User.Username()
+		auth.Password, _ = parsed.User.Password()
+		parsed.User = nil
+		changed = true
+	}
+	if parsed.RawQuery != "" {
+		query := parsed.Query()
+		for name, values := range query {
+			if redact.IsSecretParam(name) && len(values) > 0 {
+				if auth.Query == nil {
+					auth.Query = make(map[string]string)
+				}
+				auth.Query[name] = values[0]
+				query.Del(name)
+			}
+		}
+		if len(auth.Query) > 0 {
+			parsed.RawQuery = query.Encode()
+			changed = true
+		}
+	}
+	if !changed {
+		return feedURL, auth
+	}
+	return parsed.String(), auth
+}
+
+// MoveFeedURLSecrets moves credentials embedded in the URLs of existing
+// podcasts into their encrypted credentials.
+func MoveFeedURLSecrets() error {
+	var podcasts []db.Podcast
+	if err := db.GetAllPodcasts(&podcasts, ""); err != nil {
+		return err
+	}
+	for i := range podcasts {
+		podcast := &podcasts[i]
+		feedURL, embedded := splitFeedURL(podcast.URL)
+		if embedded.IsEmpty() {
+			continue
+		}
+		auth, err := openFeedAuth(podcast.FeedAuth)
+		if err != nil {
+			logger.Log.Errorw("reading feed credentials", "podcast", podcast.Title, "error", err)
+			continue
+		}
+		auth = auth.merged(&embedded)
+		sealed, err := sealFeedAuth(&auth)
+		if err != nil {
+			return err
+		}
+		if err := db.UpdatePodcastURLAndFeedAuth(podcast.ID, feedURL, sealed); err != nil {
+			logger.Log.Errorw("moving feed credentials out of the URL", "podcast", podcast.Title, "error", err)
+			continue
+		}
+		logger.Log.Infow("Moved feed credentials out of the URL", "podcast", podcast.Title)
+	}
+	return nil
+}
+
+// sealFeedAuth encrypts auth for storage. Empty credentials are stored empty.
+func sealFeedAuth(auth *FeedAuth) (string, error) {
+	if auth.IsEmpty() {
+		return "", nil
+	}
+	content, err := json.Marshal(auth)
+	if err != nil {
+		return "", err
+	}
+	return secrets.Encrypt(string(content))
+}
+
+func openFeedAuth(sealed string) (FeedAuth, error) {
+	var auth FeedAuth
+	content, err := secrets.Decrypt(sealed)
+	if err != nil || content == "" {
+		return auth, err
+	}
+	err = json.Unmarshal([]byte(content), &auth)
+	return auth, err
+}
+
+// GetFeedAuth returns the credentials of a podcast.
+func GetFeedAuth(podcastID string) (FeedAuth, error) {
+	var podcast db.Podcast
+	if err := db.GetPodcastByID(podcastID, &podcast); err != nil {
+		return FeedAuth{}, err
+	}
+	return openFeedAuth(podcast.FeedAuth)
+}
+
+// UpdateFeedAuth stores the credentials of a podcast. Empty credentials
+// remove them.
+func UpdateFeedAuth(podcastID string, auth *FeedAuth) error {
+	if err := auth.Validate(); err != nil {
+		return err
+	}
+	sealed, err := sealFeedAuth(auth)
+	if err != nil {
+		return err
+	}
+	return db.UpdatePodcastFeedAuth(podcastID, sealed)
+}
+
+// feedAuthKey is the context key of the credentials sent with requests.
+type feedAuthKey struct{}
+
+// requestAuth is the credentials sent with requests to host. The query
+// parameters are only added to the feed at feedPath.
+type requestAuth struct {
+	auth     FeedAuth
+	host     string
+	feedPath string
+}
+
+// withFeedAuth makes requests made with ctx to the host of feedURL carry auth.
+func withFeedAuth(ctx context.Context, feedURL string, auth *FeedAuth) context.Context {
+	if auth.IsEmpty() {
+		return ctx
+	}
+	parsed, err := url.Parse(feedURL)
+	if err != nil {
+		return ctx
+	}
+	return context.WithValue(ctx, feedAuthKey{}, &requestAuth{auth: *auth, host: parsed.Host, feedPath: parsed.Path})
+}
+
+// withPodcastAuth makes requests made with ctx carry the stored credentials
+// of podcast.
+func withPodcastAuth(ctx context.Context, podcast *db.Podcast) context.Context {
+	if podcast.FeedAuth == "" {
+		return ctx
+	}
+	auth, err := openFeedAuth(podcast.FeedAuth)
+	if err != nil {
+		logger.Log.Errorw("reading feed credentials", "podcast", podcast.Title, "error", err)
+		return ctx
+	}
+	return withFeedAuth(ctx, podcast.URL, &auth)
+}
+
+// feedAuthFor returns the credentials to send with req, if it goes to the
+// host they belong to.
+func feedAuthFor(req *http.Request) (*requestAuth, bool) {
+	auth, ok := req.Context().Value(feedAuthKey{}).(*requestAuth)
+	if !ok {
+		return nil, false
+	}
+	return auth, strings.EqualFold(req.URL.Host, auth.host)
+}
+
+// applyFeedAuth adds the credentials in the request's context.
+func applyFeedAuth(req *http.Request) {
+	auth, sameHost := feedAuthFor(req)
+	if !sameHost {
+		return
+	}
+	for name, value := range auth.auth.Headers {
+		req.Header.Set(name, value)
+	}
+	if len(auth.auth.Query) > 0 && req.URL.Path == auth.feedPath {
+		query := req.URL.Query()
+		for name, value := range auth.auth.Query {
+			query.Set(name, value)
+		}
+		req.URL.RawQuery = query.Encode()
+	}
+	switch {
+	case auth.auth.Token != "":
+		req.Header.Set("Authorization", "Bearer "+auth.auth.Token)
+	case auth.auth.Username != "":
+		req.SetBasicAuth(auth.auth.Username, auth.auth.Password)
+	}
+}
+
+// stripFeedAuth removes the credentials from a redirected request that
+// leaves the feed's host.
+func stripFeedAuth(req *http.Request) {
+	auth, sameHost := feedAuthFor(req)
+	if auth == nil || sameHost {
+		return
+	}
+	for name := range auth.auth.Headers {
+		req.Header.Del(name)
+	}
+	req.Header.Del("Authorization")
+}
@@ -0,0 +1,171 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/akhilrex/podgrab/db"
+	"github.com/akhilrex/podgrab/internal/logger"
+	"github.com/akhilrex/podgrab/internal/redact"
+	"github.com/akhilrex/podgrab/model"
+	"gorm.io/gorm"
+)
+
+// ErrInvalidFeedURL is returned when a podcast is moved to a URL that does
+// not serve a podcast feed.
+var ErrInvalidFeedURL = errors.New("invalid feed URL")
+
+// FeedMove summarizes moving a podcast to a new feed URL.
+type FeedMove struct {
+	// Matched counts the entries of the new feed matched to episodes.
+	Matched int `json:"matched"`
+	// Added counts the entries that matched no episode, added as new
+	// episodes.
+	Added int `json:"added"`
+	// Unlisted counts the episodes missing from the new feed, which are
+	// flagged as removed from it.
+	Unlisted int `json:"unlisted"`
+}
+
+// ChangePodcastURL moves a podcast to the feed at feedURL, keeping its ID,
+// files, tags and the played state and bookmarks of its episodes. Episodes
+// are matched to the new feed's entries by GUID, then enclosure and title as
+// the dedup sensitivity allows, but at least by title and publication day.
+// Matched episodes take the entries' GUIDs and enclosures without being
+// downloaded again. A nil auth keeps the stored credentials if the feed's
+// host is unchanged, as they are sent to the feed's host.
+func ChangePodcastURL(ctx context.Context, podcastID, feedURL string, auth *FeedAuth) (*FeedMove, error) {
+	var podcast db.Podcast
+	if err := db.GetPodcastByID(podcastID, &podcast); err != nil {
+		return nil, err
+	}
+	if podcast.IsLocal {
+		return nil, ErrLocalPodcast
+	}
+	feedURL, embedded := splitFeedURL(strings.TrimSpace(feedURL))
+	parsed, err := url.Parse(feedURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return nil, fmt.Errorf("%w: %q is not an http or https URL", ErrInvalidFeedURL, redact.URL(feedURL))
+	}
+	if auth == nil {
+		auth = &FeedAuth{}
+		if current, parseErr := url.Parse(podcast.URL); parseErr == nil && strings.EqualFold(current.Host, parsed.Host) {
+			stored, openErr := openFeedAuth(podcast.FeedAuth)
+			if openErr != nil {
+				return nil, openErr
+			}
+			auth = &stored
+		}
+	}
+	merged := auth.merged(&embedded)
+	if err := merged.Validate(); err != nil {
+		return nil, err
+	}
+	sealed, err := sealFeedAuth(&merged)
+	if err != nil {
+		return nil, err
+	}
+	var existing db.Podcast
+	err = db.GetPodcastByURL(feedURL, &existing)
+	if err == nil && existing.ID != podcast.ID {
+		return nil, &model.PodcastAlreadyExistsError{URL: redact.URL(feedURL)}
+	}
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	move, err := moveFeed(ctx, &podcast, feedURL, sealed, &merged)
+	if err != nil {
+		return nil, err
+	}
+	logger.Log.Infow("Moved podcast to a new feed", "podcast", podcast.Title, "url", redact.URL(feedURL),
+		"matched", move.Matched, "added", move.Added, "unlisted", move.Unlisted)
+
+	// The refresh adds the new entries and flags the unlisted episodes
+	podcast.URL, podcast.FeedAuth = feedURL, sealed
+	if err := AddPodcastItems(ctx, &podcast, false); err != nil {
+		logger.Log.Errorw("refreshing moved podcast", "podcast", podcast.Title, "error", err)
+	}
+	return move, nil
+}
+
+// moveFeed fetches the feed at feedURL and stores it as the feed of podcast,
+// merging its episodes into the entries they match.
+func moveFeed(ctx context.Context, podcast *db.Podcast, feedURL, sealed string, auth *FeedAuth) (*FeedMove, error) {
+	ctx, finish := trackWork(ctx, podcast.ID, "")
+	defer finish()
+	data, _, err := FetchURL(withFeedAuth(ctx, feedURL, auth), feedURL)
+	if ctx.Err() != nil {
+		return nil, context.Cause(ctx)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidFeedURL, err)
+	}
+	if data.Channel.Title == "" && len(data.Channel.Item) == 0 {
+		return nil, fmt.Errorf("%w: %q is not a podcast feed", ErrInvalidFeedURL, redact.URL(feedURL))
+	}
+
+	var items []db.PodcastItem
+	if err := db.GetAllPodcastItemsByPodcastID(podcast.ID, &items); err != nil {
+		return nil, err
+	}
+	merges, move := matchFeedEntries(&data, items)
+	if err := db.MovePodcastFeed(podcast.ID, feedURL, sealed, merges); err != nil {
+		return nil, err
+	}
+	return move, nil
+}
+
+// matchFeedEntries matches the entries of a podcast's new feed to its
+// episodes, returning the episodes to update. Episodes are matched by GUID
+// first, so that other strategies cannot take an episode an entry lists.
+func matchFeedEntries(data *model.PodcastData, items []db.PodcastItem) ([]db.PodcastItemMerge, *FeedMove) {
+	level := max(dedupLevel(db.GetOrCreateSetting()), dedupLevels[DedupNormal])
+	matcher := newEpisodeMatcher(level, items)
+	byGUID := make(map[string]*db.PodcastItem, len(items))
+	for i := range items {
+		if items[i].GUID != "" {
+			byGUID[items[i].GUID] = &items[i]
+		}
+	}
+
+	entries := make([]db.PodcastItem, len(data.Channel.Item))
+	matched := make([]*db.PodcastItem, len(entries))
+	matchedBy := make([]string, len(entries))
+	for i := range entries {
+		entries[i] = feedEntry("", data, i)
+		if item := byGUID[entries[i].GUID]; entries[i].GUID != "" && matcher.take(item) {
+			matched[i], matchedBy[i] = item, matchedByGUID
+		}
+	}
+	for i := range entries {
+		if matched[i] == nil {
+			matched[i], matchedBy[i] = matcher.match(&entries[i], enclosureLength(data.Channel.Item[i].Enclosure.Length))
+		}
+	}
+
+	move := &FeedMove{}
+	var merges []db.PodcastItemMerge
+	for i := range entries {
+		item, entry := matched[i], &entries[i]
+		if item == nil {
+			move.Added++
+			continue
+		}
+		move.Matched++
+		if item.Fingerprint == feedFingerprint(entry) && item.RemovedUpstreamAt == nil {
+			continue
+		}
+		var history *db.PodcastItemHistory
+		if item.GUID != entry.GUID || enclosureChanged(item, entry) {
+			history = feedHistory(item, entry, matchedBy[i])
+		}
+		updated := withFeedEntry(item, entry)
+		merges = append(merges, db.PodcastItemMerge{PodcastItem: &updated, History: history})
+	}
+	move.Unlisted = len(items) - move.Matched
+	return merges, move
+}
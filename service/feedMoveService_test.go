@@ -0,0 +1,112 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/akhilrex/podgrab/db"
+	testhelpers "github.com/akhilrex/podgrab/internal/testing"
+	"github.com/akhilrex/podgrab/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestChangePodcastURL tests that moving a podcast to a new feed keeps its
+// episodes, files and user state.
+func TestChangePodcastURL(t *testing.T) {
+	useTestDataDir(t)
+	setting := db.GetOrCreateSetting()
+	setting.RedownloadChangedEnclosures = true
+	require.NoError(t, db.UpdateSettings(setting))
+
+	oldFeed, _ := changingFeed(t,
+		feedItem("ep-1", "Episode 1", "https://old.example.com/ep1.mp3")+
+			feedItem("ep-2", "Episode 2", "https://old.example.com/ep2.mp3")+
+			feedItem("ep-3", "Episode 3", "https://old.example.com/ep3.mp3"))
+	podcast := db.CreateTestPodcast(t, db.DB, &db.Podcast{URL: oldFeed.URL + "/feed.xml"})
+	require.NoError(t, AddPodcastItems(context.Background(), podcast, false))
+	episodes := episodesByGUID(t, podcast.ID)
+	require.NoError(t, SetPodcastItemPlayedStatus(episodes["ep-1"].ID, true))
+	require.NoError(t, SetPodcastItemBookmarkStatus(episodes["ep-2"].ID, true))
+	downloaded := filepath.Join(t.TempDir(), "ep2.mp3")
+	require.NoError(t, os.WriteFile(downloaded, []byte("audio"), 0o600))
+	require.NoError(t, SetPodcastItemAsDownloaded(episodes["ep-2"].ID, downloaded))
+
+	newFeed, _ := changingFeed(t,
+		feedItem("ep-1", "Episode 1", "https://new.example.com/ep1.mp3")+
+			feedItem("new-2", "Episode 2", "https://new.example.com/ep2.mp3")+
+			feedItem("ep-4", "Episode 4", "https://new.example.com/ep4.mp3"))
+	move, err := ChangePodcastURL(context.Background(), podcast.ID, newFeed.URL+"/feed.xml", nil)
+	require.NoError(t, err)
+	assert.Equal(t, FeedMove{Matched: 2, Added: 1, Unlisted: 1}, *move)
+	assert.Equal(t, newFeed.URL+"/feed.xml", reloadPodcast(t, podcast.ID).URL)
+
+	moved := episodesByGUID(t, podcast.ID)
+	require.Len(t, moved, 4)
+	assert.Equal(t, episodes["ep-1"].ID, moved["ep-1"].ID)
+	assert.True(t, moved["ep-1"].IsPlayed)
+	assert.Equal(t, "https://new.example.com/ep1.mp3", moved["ep-1"].FileURL)
+
+	ep2 := moved["new-2"]
+	assert.Equal(t, episodes["ep-2"].ID, ep2.ID, "Episode should match by title and date")
+	assert.False(t, ep2.BookmarkDate.IsZero())
+	assert.Equal(t, db.Downloaded, ep2.DownloadStatus, "Moved episodes should not be downloaded again")
+	assert.Equal(t, downloaded, ep2.DownloadPath)
+	assert.FileExists(t, downloaded)
+	history, err := GetEpisodeHistory(ep2.ID)
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	assert.Equal(t, "ep-2", history[0].OldGUID)
+	assert.Equal(t, matchedByTitleDate, history[0].MatchedBy)
+
+	assert.NotNil(t, moved["ep-3"].RemovedUpstreamAt, "Unlisted episodes should be flagged")
+	assert.Nil(t, moved["ep-4"].RemovedUpstreamAt)
+}
+
+// TestChangePodcastURL_Rejects tests that feeds of other podcasts and URLs
+// that do not serve a feed leave the podcast unchanged.
+func TestChangePodcastURL_Rejects(t *testing.T) {
+	useTestDataDir(t)
+	podcast := db.CreateTestPodcast(t, db.DB, &db.Podcast{URL: "https://example.com/feed.xml"})
+	other := db.CreateTestPodcast(t, db.DB, &db.Podcast{Title: "Other", URL: "https://example.com/other.xml"})
+	page := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("<html><body>Not a feed</body></html>"))
+	}))
+	t.Cleanup(page.Close)
+
+	_, err := ChangePodcastURL(context.Background(), podcast.ID, other.URL, nil)
+	var exists *model.PodcastAlreadyExistsError
+	assert.ErrorAs(t, err, &exists)
+	_, err = ChangePodcastURL(context.Background(), podcast.ID, page.URL, nil)
+	assert.ErrorIs(t, err, ErrInvalidFeedURL)
+	_, err = ChangePodcastURL(context.Background(), podcast.ID, "ftp://example.com/feed.xml", nil)
+	assert.ErrorIs(t, err, ErrInvalidFeedURL)
+	assert.Equal(t, podcast.URL, reloadPodcast(t, podcast.ID).URL)
+}
+
+// TestChangePodcastURL_Credentials tests that stored credentials are only
+// kept for the same host.
+func TestChangePodcastURL_Credentials(t *testing.T) {
+	useTestDataDir(t)
+	testhelpers.UseTestSecretKey(t)
+	server, _ := changingFeed(t, feedItem("ep-1", "Episode 1", "https://cdn.example.com/ep1.mp3"))
+	other, _ := changingFeed(t, feedItem("ep-1", "Episode 1", "https://cdn.example.com/ep1.mp3"))
+	podcast := db.CreateTestPodcast(t, db.DB, &db.Podcast{URL: server.URL + "/feed.xml"})
+	require.NoError(t, UpdateFeedAuth(podcast.ID, &FeedAuth{Username: "user", Password: "secret"}))
+
+	_, err := ChangePodcastURL(context.Background(), podcast.ID, server.URL+"/moved.xml", nil)
+	require.NoError(t, err)
+	auth, err := GetFeedAuth(podcast.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "user", auth.Username, "Credentials should be kept on the same host")
+
+	_, err = ChangePodcastURL(context.Background(), podcast.ID, other.URL+"/feed.xml", nil)
+	require.NoError(t, err)
+	auth, err = GetFeedAuth(podcast.ID)
+	require.NoError(t, err)
+	assert.True(t, auth.IsEmpty(), "Credentials should not be sent to another host")
+}
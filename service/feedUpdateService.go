@@ -0,0 +1,139 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"strconv"
+
+	"github.com/akhilrex/podgrab/db"
+	"github.com/akhilrex/podgrab/internal/logger"
+)
+
+// feedFingerprint hashes the details of a feed entry that are stored with
+// its episode. Enclosure URLs are normalised so rotating tokens do not count
+// as changed files; updateEpisode compares the URLs themselves.
+func feedFingerprint(entry *db.PodcastItem) string {
+	hash := sha256.New()
+	for _, field := range []string{
+		entry.Title,
+		entry.Summary,
+		normaliseEnclosureURL(entry.FileURL),
+		entry.Image,
+		entry.EpisodeType,
+		strconv.FormatInt(entry.PubDate.Unix(), 10),
+		strconv.Itoa(entry.Duration),
+	} {
+		hash.Write([]byte(field))
+		hash.Write([]byte{0})
+	}
+	return hex.EncodeToString(hash.Sum(nil)[:16])
+}
+
+// applyFeedEntry stores the GUID, enclosure and details of entry in item,
+// recording history unless it is nil. Missing enclosures, dates and durations
+// keep the stored values.
+func applyFeedEntry(item, entry *db.PodcastItem, history *db.PodcastItemHistory) error {
+	updated := withFeedEntry(item, entry)
+	if err := db.MergePodcastItem(&updated, history); err != nil {
+		return err
+	}
+	*item = updated
+	return nil
+}
+
+// withFeedEntry returns item with the GUID, enclosure and details of entry.
+func withFeedEntry(item, entry *db.PodcastItem) db.PodcastItem {
+	updated := *item
+	updated.GUID = entry.GUID
+	updated.Title = entry.Title
+	updated.Summary = entry.Summary
+	updated.Image = entry.Image
+	updated.EpisodeType = entry.EpisodeType
+	if entry.FileURL != "" {
+		updated.FileURL = entry.FileURL
+	}
+	if !entry.PubDate.IsZero() {
+		updated.PubDate = entry.PubDate
+	}
+	if entry.Duration > 0 {
+		updated.Duration = entry.Duration
+	}
+	updated.Fingerprint = feedFingerprint(entry)
+	updated.RemovedUpstreamAt = nil
+	return updated
+}
+
+// updateEpisode stores the changes of an episode's feed entry, including a
+// new link to the same file, such as a re-tokenised enclosure URL, so that
+// downloads do not use a stale link. A changed enclosure is recorded in the
+// episode's history and, if the setting asks for it, downloaded again.
+func updateEpisode(item, entry *db.PodcastItem, setting *db.Setting) {
+	if item.Fingerprint == feedFingerprint(entry) && (entry.FileURL == "" || entry.FileURL == item.FileURL) {
+		return
+	}
+	changed := enclosureChanged(item, entry)
+	var history *db.PodcastItemHistory
+	if changed {
+		history = feedHistory(item, entry, matchedByGUID)
+	}
+	downloaded := item.DownloadStatus == db.Downloaded
+	oldPath := item.DownloadPath
+	if err := applyFeedEntry(item, entry, history); err != nil {
+		logger.Log.Errorw("updating episode from feed", "episode", item.Title, "error", err)
+		return
+	}
+	if changed && downloaded && setting.RedownloadChangedEnclosures {
+		redownloadEpisode(item, oldPath)
+	}
+}
+
+// feedHistory records item taking the GUID and enclosure of entry, which
+// matchedBy matched it to.
+func feedHistory(item, entry *db.PodcastItem, matchedBy string) *db.PodcastItemHistory {
+	return &db.PodcastItemHistory{
+		OldGUID:    item.GUID,
+		NewGUID:    entry.GUID,
+		OldFileURL: item.FileURL,
+		NewFileURL: entry.FileURL,
+		MatchedBy:  matchedBy,
+	}
+}
+
+// enclosureChanged reports whether entry points to another file than item.
+func enclosureChanged(item, entry *db.PodcastItem) bool {
+	return entry.FileURL != "" &&
+		normaliseEnclosureURL(entry.FileURL) != normaliseEnclosureURL(item.FileURL)
+}
+
+// redownloadEpisode queues an episode whose file changed, removing the file
+// downloaded before.
+func redownloadEpisode(item *db.PodcastItem, oldPath string) {
+	if oldPath != "" {
+		if err := DeleteFile(oldPath); err != nil && !os.IsNotExist(err) {
+			logger.Log.Errorw("deleting replaced episode file", "error", err)
+		}
+	}
+	if err := SetPodcastItemAsNotDownloaded(item.ID, db.NotDownloaded); err != nil {
+		logger.Log.Errorw("queueing changed episode", "error", err)
+		return
+	}
+	logger.Log.Infow("Episode file changed in the feed, downloading it again", "episode", item.Title)
+}
+
+// recordRemovedUpstream flags the episodes of podcast missing from its feed,
+// which lists guids, and clears the flag of those back in it.
+func recordRemovedUpstream(podcast *db.Podcast, guids []string) {
+	// An empty feed is more likely broken than emptied
+	if len(guids) == 0 {
+		return
+	}
+	removed, err := db.UpdateRemovedUpstream(podcast.ID, guids)
+	if err != nil {
+		logger.Log.Errorw("flagging episodes removed from the feed", "error", err)
+		return
+	}
+	if removed > 0 {
+		logger.Log.Infow("Episodes removed from the feed", "podcast", podcast.Title, "count", removed)
+	}
+}
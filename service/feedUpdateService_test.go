@@ -0,0 +1,167 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/akhilrex/podgrab/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// changingFeed serves a feed whose items can be replaced between refreshes.
+func changingFeed(t *testing.T, items string) (*httptest.Server, func(string)) {
+	t.Helper()
+	var mu sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		_, _ = fmt.Fprintf(w, `<?xml version="1.0"?><rss version="2.0"><channel><title>Changing</title>%s</channel></rss>`, items)
+	}))
+	t.Cleanup(server.Close)
+	return server, func(updated string) {
+		mu.Lock()
+		items = updated
+		mu.Unlock()
+	}
+}
+
+func feedItem(guid, title, enclosure string) string {
+	return fmt.Sprintf(`<item><title>%s</title><guid>%s</guid><description>Notes for %s</description>
+<pubDate>Fri, 01 Mar 2024 10:00:00 +0000</pubDate><enclosure url="%s" type="audio/mpeg"/></item>`, title, guid, title, enclosure)
+}
+
+// TestAddPodcastItems_FeedUpdates tests that refreshes update changed
+// entries, download changed files again when asked to, and flag entries
+// removed from the feed.
+func TestAddPodcastItems_FeedUpdates(t *testing.T) {
+	for _, redownload := range []bool{false, true} {
+		t.Run(fmt.Sprintf("redownload_%t", redownload), func(t *testing.T) {
+			useTestDataDir(t)
+			setting := db.GetOrCreateSetting()
+			setting.RedownloadChangedEnclosures = redownload
+			require.NoError(t, db.UpdateSettings(setting))
+
+			server, setItems := changingFeed(t,
+				feedItem("ep-1", "Episode 1", "https://cdn.example.com/ep1.mp3")+
+					feedItem("ep-2", "Episode 2", "https://cdn.example.com/ep2.mp3")+
+					feedItem("ep-3", "Episode 3", "https://cdn.example.com/ep3.mp3"))
+			podcast := db.CreateTestPodcast(t, db.DB, &db.Podcast{URL: server.URL + "/feed.xml"})
+			require.NoError(t, AddPodcastItems(context.Background(), podcast, false))
+			episodes := episodesByGUID(t, podcast.ID)
+			require.Len(t, episodes, 3)
+
+			downloaded := filepath.Join(t.TempDir(), "ep2.mp3")
+			require.NoError(t, os.WriteFile(downloaded, []byte("old audio"), 0o600))
+			ep2 := episodes["ep-2"]
+			require.NoError(t, SetPodcastItemAsDownloaded(ep2.ID, downloaded))
+
+			setItems(feedItem("ep-1", "Episode 1: Corrected", "https://cdn.example.com/ep1.mp3?token=rotated") +
+				feedItem("ep-2", "Episode 2", "https://cdn.example.com/ep2-fixed.mp3"))
+			require.NoError(t, AddPodcastItems(context.Background(), podcast, false))
+			episodes = episodesByGUID(t, podcast.ID)
+
+			assert.Equal(t, "Episode 1: Corrected", episodes["ep-1"].Title)
+			assert.Equal(t, "Notes for Episode 1: Corrected", episodes["ep-1"].Summary)
+			history, err := GetEpisodeHistory(episodes["ep-1"].ID)
+			require.NoError(t, err)
+			assert.Empty(t, history, "Rotating tokens should not count as an enclosure change")
+
+			assert.Equal(t, "https://cdn.example.com/ep2-fixed.mp3", episodes["ep-2"].FileURL)
+			history, err = GetEpisodeHistory(episodes["ep-2"].ID)
+			require.NoError(t, err)
+			require.Len(t, history, 1)
+			assert.Equal(t, "https://cdn.example.com/ep2.mp3", history[0].OldFileURL)
+			if redownload {
+				assert.Equal(t, db.NotDownloaded, episodes["ep-2"].DownloadStatus, "Changed file should be queued")
+				assert.NoFileExists(t, downloaded)
+			} else {
+				assert.Equal(t, db.Downloaded, episodes["ep-2"].DownloadStatus)
+				assert.FileExists(t, downloaded)
+			}
+
+			assert.Nil(t, episodes["ep-1"].RemovedUpstreamAt)
+			require.NotNil(t, episodes["ep-3"].RemovedUpstreamAt, "Missing entry should be flagged")
+			queue, err := db.GetAllPodcastItemsToBeDownloaded()
+			require.NoError(t, err)
+			for _, item := range *queue {
+				assert.NotEqual(t, "ep-3", item.GUID, "Removed episodes should not be downloaded")
+			}
+
+			setItems(feedItem("ep-3", "Episode 3", "https://cdn.example.com/ep3.mp3"))
+			require.NoError(t, AddPodcastItems(context.Background(), podcast, false))
+			episodes = episodesByGUID(t, podcast.ID)
+			assert.Nil(t, episodes["ep-3"].RemovedUpstreamAt, "Returning entry should be unflagged")
+			assert.NotNil(t, episodes["ep-1"].RemovedUpstreamAt)
+
+			setItems("")
+			require.NoError(t, AddPodcastItems(context.Background(), podcast, false))
+			episodes = episodesByGUID(t, podcast.ID)
+			assert.Nil(t, episodes["ep-3"].RemovedUpstreamAt, "An empty feed should not flag everything")
+		})
+	}
+}
+
+// TestAddPodcastItems_RefreshesEnclosureURL tests that an episode matched by
+// GUID takes a new link to the same file without counting as a changed file.
+func TestAddPodcastItems_RefreshesEnclosureURL(t *testing.T) {
+	useTestDataDir(t)
+	server, setItems := changingFeed(t, feedItem("ep-1", "Episode 1", "http://cdn.example.com/ep1.mp3?token=old"))
+	podcast := db.CreateTestPodcast(t, db.DB, &db.Podcast{URL: server.URL + "/feed.xml"})
+	require.NoError(t, AddPodcastItems(context.Background(), podcast, false))
+
+	setItems(feedItem("ep-1", "Episode 1", "https://cdn.example.com/ep1.mp3?token=new"))
+	require.NoError(t, AddPodcastItems(context.Background(), podcast, false))
+
+	episode := episodesByGUID(t, podcast.ID)["ep-1"]
+	assert.Equal(t, "https://cdn.example.com/ep1.mp3?token=new", episode.FileURL, "Downloads should use the current link")
+	history, err := GetEpisodeHistory(episode.ID)
+	require.NoError(t, err)
+	assert.Empty(t, history, "A new link to the same file is not an enclosure change")
+}
+
+func episodesByGUID(t *testing.T, podcastID string) map[string]db.PodcastItem {
+	t.Helper()
+	var items []db.PodcastItem
+	require.NoError(t, db.GetAllPodcastItemsByPodcastID(podcastID, &items))
+	episodes := make(map[string]db.PodcastItem, len(items))
+	for _, item := range items {
+		episodes[item.GUID] = item
+	}
+	return episodes
+}
+
+// TestRefreshPodcast_DownloadsOnlyItsQueue tests that refreshing a podcast
+// leaves the episodes queued for other podcasts to the download job.
+func TestRefreshPodcast_DownloadsOnlyItsQueue(t *testing.T) {
+	useTestDataDir(t)
+	var mu sync.Mutex
+	var requested []string
+	audio := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requested = append(requested, r.URL.Path)
+		mu.Unlock()
+		_, _ = w.Write([]byte("audio"))
+	}))
+	t.Cleanup(audio.Close)
+
+	server, _ := changingFeed(t, feedItem("ep-1", "Episode 1", audio.URL+"/refreshed.mp3"))
+	refreshed := db.CreateTestPodcast(t, db.DB, &db.Podcast{URL: server.URL + "/feed.xml"})
+	other := db.CreateTestPodcast(t, db.DB)
+	queued := db.CreateTestPodcastItem(t, db.DB, other.ID, &db.PodcastItem{FileURL: audio.URL + "/other.mp3"})
+
+	require.NoError(t, RefreshPodcast(context.Background(), refreshed.ID))
+
+	mu.Lock()
+	assert.Equal(t, []string{"/refreshed.mp3"}, requested, "Only the refreshed podcast's episode should be downloaded")
+	mu.Unlock()
+	var item db.PodcastItem
+	require.NoError(t, db.GetPodcastItemByID(queued.ID, &item))
+	assert.Equal(t, db.NotDownloaded, item.DownloadStatus, "Other podcasts' episodes should stay queued")
+}
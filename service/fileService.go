@@ -4,6 +4,7 @@ package service
 import (
 	"archive/tar"
 	"compress/gzip"
+	"context"
 	"encoding/xml"
 	"errors"
 	"fmt"
@@ -19,13 +20,16 @@ import (
 	"time"
 
 	"github.com/akhilrex/podgrab/db"
+	"github.com/akhilrex/podgrab/internal/config"
 	"github.com/akhilrex/podgrab/internal/logger"
+	"github.com/akhilrex/podgrab/internal/metrics"
 	"github.com/akhilrex/podgrab/internal/sanitize"
+	"github.com/akhilrex/podgrab/internal/secrets"
 	stringy "github.com/gobeam/stringy"
 )
 
 // Download download.
-func Download(link, episodeTitle, podcastName, prefix string) (string, error) {
+func Download(ctx context.Context, link, episodeTitle, podcastName, prefix string) (_ string, err error) {
 	if link == "" {
 		return "", errors.New("Download path empty")
 	}
@@ -45,23 +49,16 @@ func Download(link, episodeTitle, podcastName, prefix string) (string, error) {
 	}
 
 	// File doesn't exist, proceed with download
-	client := httpClient()
-
-	req, err := getRequest(link)
-	if err != nil {
-		logger.Log.Errorw("Error creating request: "+link, err)
-	}
-
-	resp, err := client.Do(req) //nolint:gosec // G704: URL comes from user-provided podcast RSS feeds
-	if err != nil {
-		logger.Log.Errorw("Error getting response: "+link, err)
-		return "", err
+	if !startWork(&activeDownloads) {
+		return "", ErrShuttingDown
 	}
+	defer activeDownloads.Done()
 
-	// Check HTTP status code
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return "", fmt.Errorf("HTTP error: %d %s", resp.StatusCode, resp.Status)
-	}
+	start := time.Now()
+	var written int64
+	defer func() {
+		metrics.ObserveDownload(start, written, err)
+	}()
 
 	// Validate and clean path to prevent directory traversal
 	if validateErr := validatePath(finalPath, folder); validateErr != nil {
@@ -69,9 +66,29 @@ func Download(link, episodeTitle, podcastName, prefix string) (string, error) {
 	}
 	cleanPath := filepath.Clean(finalPath)
 
-	file, err := os.Create(cleanPath)
+	// Downloads are written to a partial file that is renamed when complete,
+	// so an interrupted download resumes where it stopped.
+	partPath := cleanPath + ".part"
+	var offset int64
+	if info, statErr := os.Stat(partPath); statErr == nil {
+		offset = info.Size()
+	}
+
+	req, err := getRequest(ctx, link)
 	if err != nil {
-		logger.Log.Errorw("Error creating file"+link, err)
+		logger.Log.Errorw("Error creating request: "+link, err)
+		return "", err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	resp, err := politeDo(httpClient(), req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return "", stopDownload(ctx, partPath, offset)
+		}
+		logger.Log.Errorw("Error getting response: "+link, err)
 		return "", err
 	}
 	defer func() {
@@ -79,20 +96,67 @@ func Download(link, episodeTitle, podcastName, prefix string) (string, error) {
 			logger.Log.Errorw("Error closing response body", closeErr)
 		}
 	}()
-	_, erra := io.Copy(file, resp.Body)
-	defer func() {
-		if closeErr := file.Close(); closeErr != nil {
-			logger.Log.Errorw("Error closing file", closeErr)
+
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	complete := false
+	contentRange := resp.Header.Get("Content-Range")
+	switch {
+	case offset > 0 && resp.StatusCode == http.StatusPartialContent && strings.HasPrefix(contentRange, fmt.Sprintf("bytes %d-", offset)):
+		flags = os.O_WRONLY | os.O_APPEND
+	case offset > 0 && resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && contentRange == fmt.Sprintf("bytes */%d", offset):
+		// The partial file already holds the whole episode.
+		complete = true
+	case resp.StatusCode < 200 || resp.StatusCode >= 300 || resp.StatusCode == http.StatusPartialContent:
+		if offset > 0 {
+			// Start over next time rather than resume from an unusable partial file.
+			if removeErr := os.Remove(partPath); removeErr != nil {
+				logger.Log.Errorw("Error removing partial file", "path", partPath, "error", removeErr)
+			}
 		}
-	}()
-	if erra != nil {
-		logger.Log.Errorw("Error saving file"+link, err)
-		return "", erra
+		return "", fmt.Errorf("HTTP error: %d %s", resp.StatusCode, resp.Status)
+	}
+
+	if !complete {
+		file, openErr := os.OpenFile(partPath, flags, 0o644) //nolint:gosec // G302: episode files are shared with media servers
+		if openErr != nil {
+			logger.Log.Errorw("Error creating file"+link, openErr)
+			return "", openErr
+		}
+		written, err = io.Copy(file, throttle(ctx, hostKey(resp.Request.URL), resp.Body))
+		if closeErr := file.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return "", stopDownload(ctx, partPath, offset+written)
+			}
+			logger.Log.Errorw("Error saving file"+link, err)
+			return "", err
+		}
+	}
+	if err = os.Rename(partPath, cleanPath); err != nil {
+		return "", err
 	}
 	changeOwnership(finalPath)
 	return finalPath, nil
 }
 
+// stopDownload handles a download stopped through its context. The partial
+// file is kept when the download will resume, after a shutdown, once its
+// podcast is resumed or when downloads may run again, and removed otherwise.
+func stopDownload(ctx context.Context, partPath string, size int64) error {
+	cause := context.Cause(ctx)
+	if errors.Is(cause, ErrShuttingDown) || errors.Is(cause, errPodcastPaused) || errors.Is(cause, errDownloadsPaused) {
+		logger.Log.Infow("Download interrupted, partial file kept", "path", partPath, "bytes", size, "reason", cause)
+		return fmt.Errorf("download interrupted: %w", cause)
+	}
+	if err := os.Remove(partPath); err != nil && !os.IsNotExist(err) {
+		logger.Log.Errorw("Error removing partial file", "path", partPath, "error", err)
+	}
+	logger.Log.Infow("Download stopped", "path", partPath, "reason", cause)
+	return fmt.Errorf("download stopped: %w", cause)
+}
+
 // GetPodcastLocalImagePath get podcast local image path.
 func GetPodcastLocalImagePath(link, podcastName string) string {
 	fileName := getFileName(link, "folder", ".jpg")
@@ -105,7 +169,7 @@ func GetPodcastLocalImagePath(link, podcastName string) string {
 // CreateNfoFile create nfo file.
 func CreateNfoFile(podcast *db.Podcast) error {
 	fileName := "album.nfo"
-	folder := createDataFolderIfNotExists(podcast.Title)
+	folder := createDataFolderIfNotExists(podcast.DataFolder())
 
 	finalPath := path.Join(folder, fileName)
 
@@ -130,22 +194,27 @@ func CreateNfoFile(podcast *db.Podcast) error {
 }
 
 // DownloadPodcastCoverImage download podcast cover image.
-func DownloadPodcastCoverImage(link, podcastName string) (string, error) {
+func DownloadPodcastCoverImage(ctx context.Context, link, podcastName string) (string, error) {
 	if link == "" {
 		return "", errors.New("Download path empty")
 	}
 	client := httpClient()
-	req, err := getRequest(link)
+	req, err := getRequest(ctx, link)
 	if err != nil {
 		logger.Log.Errorw("Error creating request: "+link, err)
 		return "", err
 	}
 
-	resp, err := client.Do(req) //nolint:gosec // G704: URL comes from user-provided podcast RSS feeds
+	resp, err := politeDo(client, req)
 	if err != nil {
 		logger.Log.Errorw("Error getting response: "+link, err)
 		return "", err
 	}
+	defer func() {
+		if closeErr := resp.Body.Close(); closeErr != nil {
+			logger.Log.Errorw("Error closing response body", closeErr)
+		}
+	}()
 
 	fileName := getFileName(link, "folder", ".jpg")
 	folder := createDataFolderIfNotExists(podcastName)
@@ -168,11 +237,6 @@ func DownloadPodcastCoverImage(link, podcastName string) (string, error) {
 		logger.Log.Errorw("Error creating file"+link, err)
 		return "", err
 	}
-	defer func() {
-		if closeErr := resp.Body.Close(); closeErr != nil {
-			logger.Log.Errorw("Error closing response body", closeErr)
-		}
-	}()
 	_, erra := io.Copy(file, resp.Body)
 	defer func() {
 		if closeErr := file.Close(); closeErr != nil {
@@ -188,22 +252,27 @@ func DownloadPodcastCoverImage(link, podcastName string) (string, error) {
 }
 
 // DownloadImage download image.
-func DownloadImage(link, episodeID, podcastName string) (string, error) {
+func DownloadImage(ctx context.Context, link, episodeID, podcastName string) (string, error) {
 	if link == "" {
 		return "", errors.New("Download path empty")
 	}
 	client := httpClient()
-	req, err := getRequest(link)
+	req, err := getRequest(ctx, link)
 	if err != nil {
 		logger.Log.Errorw("Error creating request: "+link, err)
 		return "", err
 	}
 
-	resp, err := client.Do(req) //nolint:gosec // G704: URL comes from user-provided podcast RSS feeds
+	resp, err := politeDo(client, req)
 	if err != nil {
 		logger.Log.Errorw("Error getting response: "+link, err)
 		return "", err
 	}
+	defer func() {
+		if closeErr := resp.Body.Close(); closeErr != nil {
+			logger.Log.Errorw("Error closing response body", closeErr)
+		}
+	}()
 
 	fileName := getFileName(link, episodeID, ".jpg")
 	folder := createDataFolderIfNotExists(podcastName)
@@ -226,11 +295,6 @@ func DownloadImage(link, episodeID, podcastName string) (string, error) {
 		logger.Log.Errorw("Error creating file"+link, err)
 		return "", err
 	}
-	defer func() {
-		if closeErr := resp.Body.Close(); closeErr != nil {
-			logger.Log.Errorw("Error closing response body", closeErr)
-		}
-	}()
 	_, erra := io.Copy(file, resp.Body)
 	defer func() {
 		if closeErr := file.Close(); closeErr != nil {
@@ -245,10 +309,10 @@ func DownloadImage(link, episodeID, podcastName string) (string, error) {
 	return finalPath, nil
 }
 func changeOwnership(filePath string) {
-	uid, err1 := strconv.Atoi(os.Getenv("PUID"))
-	gid, err2 := strconv.Atoi(os.Getenv("PGID"))
+	cfg := config.Get()
+	uid, gid := cfg.PUID, cfg.PGID
 	logger.Log.Debugw("Debug", "value", filePath)
-	if err1 == nil && err2 == nil {
+	if uid != -1 && gid != -1 {
 		logger.Log.Debugw("Debug", "value", filePath+" : Attempting change")
 		if err := os.Chown(filePath, uid, gid); err != nil { //nolint:gosec // G703: filePath validated via validatePath() before calling changeOwnership
 			logger.Log.Errorw("changing ownership", "error", err)
@@ -311,14 +375,19 @@ func deleteOldBackup() {
 	}
 }
 
-// GetFileSizeFromURL get file size from url.
-func GetFileSizeFromURL(urlString string) (int64, error) {
+// GetFileSizeFromURL get file size from url. Requests made with ctx carry the
+// configured User-Agent and the feed credentials in ctx.
+func GetFileSizeFromURL(ctx context.Context, urlString string) (int64, error) {
 	// Validate URL to prevent SSRF attacks
 	if err := validateURL(urlString); err != nil {
 		return 0, err
 	}
 
-	resp, err := http.Head(urlString) //nolint:gosec // G107: URL validated by validateURL function above
+	req, err := newRequest(ctx, http.MethodHead, urlString)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := politeDo(httpClient(), req)
 	if err != nil {
 		return 0, err
 	}
@@ -346,7 +415,7 @@ func GetFileSizeFromURL(urlString string) (int64, error) {
 func CreateBackup() (string, error) {
 	backupFileName := "podgrab_backup_" + time.Now().Format("2006.01.02_150405") + ".tar.gz"
 	folder := createConfigFolderIfNotExists("backups")
-	configPath := os.Getenv("CONFIG")
+	configPath := config.Get().ConfigDir
 	tarballFilePath := path.Join(folder, backupFileName)
 	file, err := os.Create(tarballFilePath) //nolint:gosec // G304: path constructed from config folder and timestamp
 	if err != nil {
@@ -378,12 +447,112 @@ func CreateBackup() (string, error) {
 	}()
 
 	err = addFileToTarWriter(dbPath, tarWriter)
+	// The credentials in the database can only be read with the key they
+	// were encrypted with.
+	keyPath := path.Join(configPath, secrets.KeyFileName)
+	if _, statErr := os.Stat(keyPath); err == nil && statErr == nil {
+		err = addFileToTarWriter(keyPath, tarWriter)
+	}
 	if err == nil {
 		deleteOldBackup()
 	}
 	return backupFileName, err
 }
 
+// RestoreBackup replaces the current database, and the key its credentials
+// are encrypted with, with those stored in a backup archive. The archive may
+// be given as a path or as a file name inside the backups folder. The
+// database must not be open while restoring.
+func RestoreBackup(archive string) error {
+	if _, err := os.Stat(archive); os.IsNotExist(err) {
+		archive = path.Join(createConfigFolderIfNotExists("backups"), filepath.Base(archive))
+	}
+	file, err := os.Open(archive) //nolint:gosec // G304: archive is an operator-supplied backup path
+	if err != nil {
+		return fmt.Errorf("could not open backup '%s', got error '%s'", archive, err.Error())
+	}
+	defer func() {
+		if closeErr := file.Close(); closeErr != nil {
+			logger.Log.Errorw("closing file", "error", closeErr)
+		}
+	}()
+
+	gzipReader, err := gzip.NewReader(file)
+	if err != nil {
+		return fmt.Errorf("could not read backup '%s', got error '%s'", archive, err.Error())
+	}
+	tarReader := tar.NewReader(gzipReader)
+
+	cfg := config.Get()
+	dbPath := path.Join(cfg.ConfigDir, "podgrab.db")
+	keyPath := path.Join(cfg.ConfigDir, secrets.KeyFileName)
+	restored := make(map[string]string)
+	defer func() {
+		for _, tmpPath := range restored {
+			_ = os.Remove(tmpPath) //nolint:errcheck // best effort cleanup of files not moved into place
+		}
+	}()
+	for {
+		header, err := tarReader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("could not read backup '%s', got error '%s'", archive, err.Error())
+		}
+		target, mode := "", os.FileMode(0o644)
+		switch filepath.Base(header.Name) {
+		case "podgrab.db":
+			target = dbPath
+		case secrets.KeyFileName:
+			target, mode = keyPath, 0o600
+		default:
+			continue
+		}
+		tmpPath := target + ".restore"
+		restored[target] = tmpPath
+		if err := extractTarFile(tarReader, header.Size, tmpPath, mode); err != nil {
+			return fmt.Errorf("could not extract %s from '%s', got error '%s'", filepath.Base(target), archive, err.Error())
+		}
+	}
+	if _, ok := restored[dbPath]; !ok {
+		return fmt.Errorf("backup '%s' does not contain podgrab.db", archive)
+	}
+	if _, ok := restored[keyPath]; !ok && cfg.SecretKey == "" {
+		logger.Log.Warnw("Backup holds no secret key; credentials stored in it may not be readable with the current key", "backup", archive)
+	}
+	// The key goes first, so the database is never in place without it.
+	for _, target := range []string{keyPath, dbPath} {
+		tmpPath, ok := restored[target]
+		if !ok {
+			continue
+		}
+		if err := os.Rename(tmpPath, target); err != nil {
+			return err
+		}
+		delete(restored, target)
+	}
+	return nil
+}
+
+// extractTarFile writes the size bytes of the current entry of tarReader to
+// dest.
+func extractTarFile(tarReader *tar.Reader, size int64, dest string, mode os.FileMode) error {
+	out, err := os.OpenFile(dest, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode) //nolint:gosec // G304: path constructed from config folder and fixed filename
+	if err != nil {
+		return err
+	}
+	_, err = io.CopyN(out, tarReader, size)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	changeOwnership(dest)
+	return nil
+}
+
 func addFileToTarWriter(filePath string, tarWriter *tar.Writer) error {
 	file, err := os.Open(filePath) //nolint:gosec // G304: filePath is from backup process, constructed from config path
 	if err != nil {
@@ -419,18 +588,12 @@ func addFileToTarWriter(filePath string, tarWriter *tar.Writer) error {
 
 	return nil
 }
-func httpClient() *http.Client {
-	client := http.Client{
-		CheckRedirect: func(_ *http.Request, _ []*http.Request) error {
-			return nil
-		},
-	}
-
-	return &client
+func getRequest(ctx context.Context, urlStr string) (*http.Request, error) {
+	return newRequest(ctx, http.MethodGet, urlStr)
 }
 
-func getRequest(urlStr string) (*http.Request, error) {
-	req, err := http.NewRequest("GET", urlStr, http.NoBody)
+func newRequest(ctx context.Context, method, urlStr string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, urlStr, http.NoBody)
 	if err != nil {
 		return nil, err
 	}
@@ -439,6 +602,7 @@ func getRequest(urlStr string) (*http.Request, error) {
 	if setting.UserAgent != "" {
 		req.Header.Add("User-Agent", setting.UserAgent)
 	}
+	applyFeedAuth(req)
 
 	return req, nil
 }
@@ -456,12 +620,10 @@ func createFolder(folder, parent string) string {
 }
 
 func createDataFolderIfNotExists(folder string) string {
-	dataPath := os.Getenv("DATA")
-	return createFolder(folder, dataPath)
+	return createFolder(folder, config.Get().DataDir)
 }
 func createConfigFolderIfNotExists(folder string) string {
-	dataPath := os.Getenv("CONFIG")
-	return createFolder(folder, dataPath)
+	return createFolder(folder, config.Get().ConfigDir)
 }
 
 func deletePodcastFolder(folder string) error {
@@ -2,6 +2,7 @@
 package service
 
 import (
+	"context"
 	"net/http"
 	"net/http/httptest"
 	"os"
@@ -10,7 +11,10 @@ import (
 	"testing"
 
 	"github.com/akhilrex/podgrab/db"
+	"github.com/akhilrex/podgrab/internal/metrics"
+	"github.com/akhilrex/podgrab/internal/secrets"
 	testhelpers "github.com/akhilrex/podgrab/internal/testing"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -248,7 +252,7 @@ func TestGetFileSizeFromUrl(t *testing.T) {
 			defer server.Close()
 
 			// Test
-			size, err := GetFileSizeFromURL(server.URL)
+			size, err := GetFileSizeFromURL(context.Background(), server.URL)
 
 			if tt.wantError {
 				assert.Error(t, err, "Expected error")
@@ -261,6 +265,36 @@ func TestGetFileSizeFromUrl(t *testing.T) {
 	}
 }
 
+// TestGetFileSizeFromUrl_RequestSettings tests that size checks send the
+// configured User-Agent and the podcast's credentials.
+func TestGetFileSizeFromUrl_RequestSettings(t *testing.T) {
+	useTestDB(t)
+	useHostState(t)
+	setting := db.GetOrCreateSetting()
+	setting.UserAgent = "CustomAgent/1.0"
+	require.NoError(t, db.UpdateSettings(setting))
+
+	var userAgent, token string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgent = r.Header.Get("User-Agent")
+		token = r.Header.Get("Authorization")
+		w.Header().Set("Content-Length", "1000")
+	}))
+	defer server.Close()
+
+	ctx := withFeedAuth(context.Background(), server.URL+"/feed.xml", &FeedAuth{Token: "abc"})
+	size, err := GetFileSizeFromURL(ctx, server.URL+"/episode.mp3")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1000), size)
+	assert.Equal(t, "CustomAgent/1.0", userAgent, "Should send the configured User-Agent")
+	assert.Equal(t, "Bearer abc", token, "Should send the feed credentials")
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = GetFileSizeFromURL(cancelled, server.URL+"/episode.mp3")
+	assert.ErrorIs(t, err, context.Canceled, "Should stop when the context is cancelled")
+}
+
 // TestCreateDataFolderIfNotExists tests podcast folder creation.
 func TestCreateDataFolderIfNotExists(t *testing.T) {
 	dataDir, cleanup := testhelpers.SetupTestDataDir(t)
@@ -358,7 +392,7 @@ func TestDownload(t *testing.T) {
 			defer server.Close()
 
 			// Download
-			filePath, err := Download(server.URL, tt.episodeTitle, tt.podcastName, tt.prefix)
+			filePath, err := Download(context.Background(), server.URL, tt.episodeTitle, tt.podcastName, tt.prefix)
 
 			if tt.wantError {
 				assert.Error(t, err, "Expected error on failed download")
@@ -385,7 +419,7 @@ func TestDownload(t *testing.T) {
 
 // TestDownload_EmptyLink tests error handling for empty download link.
 func TestDownload_EmptyLink(t *testing.T) {
-	_, err := Download("", "Episode", "Podcast", "")
+	_, err := Download(context.Background(), "", "Episode", "Podcast", "")
 	assert.Error(t, err, "Should error on empty link")
 	assert.Contains(t, err.Error(), "empty", "Error should mention empty path")
 }
@@ -415,17 +449,53 @@ func TestDownload_ExistingFile(t *testing.T) {
 	defer server.Close()
 
 	// First download
-	filePath1, err := Download(server.URL, "Episode", "Podcast", "")
+	filePath1, err := Download(context.Background(), server.URL, "Episode", "Podcast", "")
 	require.NoError(t, err)
 	assert.Equal(t, 1, callCount, "Should make HTTP request on first download")
 
 	// Second download (should skip because file exists)
-	filePath2, err := Download(server.URL, "Episode", "Podcast", "")
+	filePath2, err := Download(context.Background(), server.URL, "Episode", "Podcast", "")
 	require.NoError(t, err)
 	assert.Equal(t, filePath1, filePath2, "Should return same path")
 	assert.Equal(t, 1, callCount, "Should not make HTTP request for existing file")
 }
 
+// TestDownload_RecordsMetrics tests that downloads update the download metrics.
+func TestDownload_RecordsMetrics(t *testing.T) {
+	_, cleanup := testhelpers.SetupTestDataDir(t)
+	defer cleanup()
+
+	database := testhelpers.SetupTestDB(t)
+	defer testhelpers.TeardownTestDB(t, database)
+
+	originalDB := db.DB
+	db.DB = database
+	defer func() { db.DB = originalDB }()
+
+	db.CreateTestSetting(t, database)
+
+	content := []byte("fake mp3 content")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing.mp3" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write(content) // Test server - error handling not required
+	}))
+	defer server.Close()
+
+	bytesBefore := testutil.ToFloat64(metrics.DownloadedBytes)
+	failuresBefore := testutil.ToFloat64(metrics.DownloadFailures)
+
+	_, err := Download(context.Background(), server.URL+"/episode.mp3", "Metrics Episode", "Metrics Podcast", "")
+	require.NoError(t, err)
+	assert.Equal(t, bytesBefore+float64(len(content)), testutil.ToFloat64(metrics.DownloadedBytes), "Should count downloaded bytes")
+
+	_, err = Download(context.Background(), server.URL+"/missing.mp3", "Missing Episode", "Metrics Podcast", "")
+	require.Error(t, err)
+	assert.Equal(t, failuresBefore+1, testutil.ToFloat64(metrics.DownloadFailures), "Should count failed download")
+}
+
 // TestDownloadPodcastCoverImage tests podcast image download.
 func TestDownloadPodcastCoverImage(t *testing.T) {
 	_, cleanup := testhelpers.SetupTestDataDir(t)
@@ -450,7 +520,7 @@ func TestDownloadPodcastCoverImage(t *testing.T) {
 	defer server.Close()
 
 	// Download image
-	imagePath, err := DownloadPodcastCoverImage(server.URL, "Test Podcast")
+	imagePath, err := DownloadPodcastCoverImage(context.Background(), server.URL, "Test Podcast")
 	require.NoError(t, err, "Should download image without error")
 	assert.NotEmpty(t, imagePath, "Should return image path")
 	assert.FileExists(t, imagePath, "Should create image file")
@@ -463,7 +533,7 @@ func TestDownloadPodcastCoverImage(t *testing.T) {
 
 // TestDownloadPodcastCoverImage_EmptyLink tests error handling.
 func TestDownloadPodcastCoverImage_EmptyLink(t *testing.T) {
-	_, err := DownloadPodcastCoverImage("", "Podcast")
+	_, err := DownloadPodcastCoverImage(context.Background(), "", "Podcast")
 	assert.Error(t, err, "Should error on empty link")
 }
 
@@ -491,7 +561,7 @@ func TestDownloadImage(t *testing.T) {
 	defer server.Close()
 
 	// Download episode image
-	imagePath, err := DownloadImage(server.URL, "episode-id-123", "Test Podcast")
+	imagePath, err := DownloadImage(context.Background(), server.URL, "episode-id-123", "Test Podcast")
 	require.NoError(t, err, "Should download image without error")
 	assert.NotEmpty(t, imagePath, "Should return image path")
 	assert.FileExists(t, imagePath, "Should create image file")
@@ -595,7 +665,7 @@ func TestGetRequest(t *testing.T) {
 	require.NoError(t, err, "Should update settings")
 
 	// Create request
-	req, err := getRequest("https://example.com/feed.xml")
+	req, err := getRequest(context.Background(), "https://example.com/feed.xml")
 	require.NoError(t, err, "Should create request without error")
 	assert.NotNil(t, req, "Should return request")
 
@@ -640,3 +710,47 @@ func TestGetAllBackupFiles(t *testing.T) {
 		assert.True(t, files[i] > files[i+1], "Files should be sorted in reverse order")
 	}
 }
+
+// TestRestoreBackup tests restoring the database from a backup archive.
+func TestRestoreBackup(t *testing.T) {
+	configDir := t.TempDir()
+	oldConfigDir := os.Getenv("CONFIG")
+	_ = os.Setenv("CONFIG", configDir) // Test setup - error unlikely
+	defer func() { _ = os.Setenv("CONFIG", oldConfigDir) }()
+
+	dbPath := filepath.Join(configDir, "podgrab.db")
+	keyPath := filepath.Join(configDir, secrets.KeyFileName)
+	require.NoError(t, os.WriteFile(dbPath, []byte("original"), 0o600))
+	require.NoError(t, os.WriteFile(keyPath, []byte("original key"), 0o600))
+
+	name, err := CreateBackup()
+	require.NoError(t, err, "Should create backup")
+
+	require.NoError(t, os.WriteFile(dbPath, []byte("changed"), 0o600))
+	require.NoError(t, os.WriteFile(keyPath, []byte("changed key"), 0o600))
+
+	err = RestoreBackup(name)
+	require.NoError(t, err, "Should restore backup by file name")
+
+	content, err := os.ReadFile(dbPath) //nolint:gosec // G304: test file in temp dir
+	require.NoError(t, err)
+	assert.Equal(t, "original", string(content), "Should restore database contents")
+	content, err = os.ReadFile(keyPath) //nolint:gosec // G304: test file in temp dir
+	require.NoError(t, err)
+	assert.Equal(t, "original key", string(content), "Should restore the key the credentials are encrypted with")
+	info, err := os.Stat(keyPath)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm(), "Restored key should stay private")
+
+	require.NoError(t, os.Remove(keyPath))
+	name, err = CreateBackup()
+	require.NoError(t, err, "Should create backup without a key file")
+	require.NoError(t, os.WriteFile(keyPath, []byte("current key"), 0o600))
+	require.NoError(t, RestoreBackup(name), "Should restore backups without a key file")
+	content, err = os.ReadFile(keyPath) //nolint:gosec // G304: test file in temp dir
+	require.NoError(t, err)
+	assert.Equal(t, "current key", string(content), "Should keep the current key when the backup has none")
+
+	err = RestoreBackup(filepath.Join(configDir, "missing.tar.gz"))
+	assert.Error(t, err, "Should error on missing backup")
+}
@@ -2,6 +2,7 @@
 package service
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/url"
@@ -20,7 +21,7 @@ const BASE = "https://gpodder.net"
 func Query(q string) []*model.CommonSearchResultModel {
 	searchURL := fmt.Sprintf("%s/search.json?q=%s", BASE, url.QueryEscape(q))
 
-	body, err := makeQuery(searchURL)
+	body, err := makeQuery(context.Background(), searchURL)
 	if err != nil {
 		logger.Log.Errorw("making query", "error", err)
 		return []*model.CommonSearchResultModel{}
@@ -43,7 +44,7 @@ func Query(q string) []*model.CommonSearchResultModel {
 func ByTag(tag string, count int) []model.GPodcast {
 	tagURL := fmt.Sprintf("%s/api/2/tag/%s/%d.json", BASE, url.QueryEscape(tag), count)
 
-	body, err := makeQuery(tagURL)
+	body, err := makeQuery(context.Background(), tagURL)
 	if err != nil {
 		logger.Log.Errorw("making query", "error", err)
 		return []model.GPodcast{}
@@ -59,7 +60,7 @@ func ByTag(tag string, count int) []model.GPodcast {
 func Top(count int) []model.GPodcast {
 	topURL := fmt.Sprintf("%s/toplist/%d.json", BASE, count)
 
-	body, err := makeQuery(topURL)
+	body, err := makeQuery(context.Background(), topURL)
 	if err != nil {
 		logger.Log.Errorw("making query", "error", err)
 		return []model.GPodcast{}
@@ -75,7 +76,7 @@ func Top(count int) []model.GPodcast {
 func Tags(count int) []model.GPodcastTag {
 	tagsURL := fmt.Sprintf("%s/api/2/tags/%d.json", BASE, count)
 
-	body, err := makeQuery(tagsURL)
+	body, err := makeQuery(context.Background(), tagsURL)
 	if err != nil {
 		logger.Log.Errorw("making query", "error", err)
 		return []model.GPodcastTag{}
@@ -0,0 +1,266 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/akhilrex/podgrab/db"
+	"github.com/akhilrex/podgrab/internal/config"
+	"github.com/akhilrex/podgrab/internal/logger"
+)
+
+// Health check statuses.
+const (
+	HealthOK      = "ok"
+	HealthFailing = "failing"
+	HealthUnknown = "unknown"
+)
+
+// jobGracePeriod is added to twice a job's interval before a missed run is reported.
+const jobGracePeriod = time.Minute
+
+var errDiskStatsUnsupported = errors.New("free space is not available on this platform")
+
+// HealthCheck is the result of a single readiness check.
+type HealthCheck struct {
+	Details interface{} `json:"details,omitempty"`
+	Name    string      `json:"name"`
+	Status  string      `json:"status"`
+	Message string      `json:"message,omitempty"`
+}
+
+// HealthReport is the combined result of every readiness check.
+type HealthReport struct {
+	CheckedAt time.Time     `json:"checkedAt"`
+	Status    string        `json:"status"`
+	Checks    []HealthCheck `json:"checks"`
+}
+
+// Ready reports whether no check is failing.
+func (report *HealthReport) Ready() bool {
+	return report.Status != HealthFailing
+}
+
+// JobStatus describes the recent runs of a scheduled job.
+type JobStatus struct {
+	RegisteredAt time.Time `json:"registeredAt"`
+	LastRun      time.Time `json:"lastRun"`
+	LastSuccess  time.Time `json:"lastSuccess"`
+	Name         string    `json:"name"`
+	LastError    string    `json:"lastError,omitempty"`
+	Interval     string    `json:"interval"`
+	interval     time.Duration
+	Running      bool `json:"running"`
+}
+
+var (
+	jobStatuses = make(map[string]*JobStatus)
+	jobMutex    sync.RWMutex
+)
+
+// TrackJob registers a scheduled job and returns a wrapper that records each
+// run, so readiness can tell when a job has stopped succeeding. Runs that
+// found nothing to do count as successes. Registering a
+// job again updates its interval and keeps its history.
+func TrackJob(name string, interval time.Duration, job func() error) func() error {
+	jobMutex.Lock()
+	if status, ok := jobStatuses[name]; ok {
+		status.Interval = interval.String()
+		status.interval = interval
+	} else {
+		jobStatuses[name] = &JobStatus{
+			Name:         name,
+			Interval:     interval.String(),
+			interval:     interval,
+			RegisteredAt: time.Now(),
+		}
+	}
+	jobMutex.Unlock()
+
+	return func() error {
+		jobMutex.Lock()
+		if status, ok := jobStatuses[name]; ok {
+			status.Running = true
+			status.LastRun = time.Now()
+		}
+		jobMutex.Unlock()
+
+		err := job()
+
+		jobMutex.Lock()
+		defer jobMutex.Unlock()
+		status, ok := jobStatuses[name]
+		if !ok {
+			return err
+		}
+		status.Running = false
+		if err != nil && !errors.Is(err, errNothingToDo) {
+			status.LastError = err.Error()
+			return err
+		}
+		status.LastError = ""
+		status.LastSuccess = time.Now()
+		return err
+	}
+}
+
+// untrackJob stops reporting a job that is no longer scheduled.
+func untrackJob(name string) {
+	jobMutex.Lock()
+	delete(jobStatuses, name)
+	jobMutex.Unlock()
+}
+
+// GetJobStatuses returns the tracked scheduled jobs ordered by name.
+func GetJobStatuses() []JobStatus {
+	jobMutex.RLock()
+	defer jobMutex.RUnlock()
+	statuses := make([]JobStatus, 0, len(jobStatuses))
+	for _, status := range jobStatuses {
+		statuses = append(statuses, *status)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Name < statuses[j].Name
+	})
+	return statuses
+}
+
+// CheckReadiness runs every dependency check.
+func CheckReadiness(ctx context.Context) HealthReport {
+	cfg := config.Get()
+	minFree := uint64(cfg.MinFreeSpaceMB) * 1024 * 1024 //nolint:gosec // G115: validated to be non-negative
+	checks := []HealthCheck{
+		checkDatabase(ctx),
+		checkDirectory("data_dir", cfg.DataDir, minFree),
+		checkDirectory("config_dir", cfg.ConfigDir, minFree),
+		checkScheduler(time.Now()),
+		checkJobLocks(time.Now()),
+	}
+
+	report := HealthReport{Status: HealthOK, Checks: checks, CheckedAt: time.Now()}
+	for i := range checks {
+		if checks[i].Status == HealthFailing {
+			report.Status = HealthFailing
+		}
+	}
+	return report
+}
+
+func checkDatabase(ctx context.Context) HealthCheck {
+	check := HealthCheck{Name: "database", Status: HealthOK}
+	if db.DB == nil {
+		check.Status = HealthFailing
+		check.Message = "database is not initialized"
+		return check
+	}
+	sqlDB, err := db.DB.DB()
+	if err == nil {
+		ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+		defer cancel()
+		err = sqlDB.PingContext(ctx)
+	}
+	if err != nil {
+		check.Status = HealthFailing
+		check.Message = err.Error()
+	}
+	return check
+}
+
+func checkDirectory(name, dir string, minFree uint64) HealthCheck {
+	check := HealthCheck{Name: name, Status: HealthOK}
+	probe, err := os.CreateTemp(dir, ".podgrab-health-*")
+	if err != nil {
+		check.Status = HealthFailing
+		check.Message = fmt.Sprintf("%s is not writable: %v", dir, err)
+		return check
+	}
+	if closeErr := probe.Close(); closeErr != nil {
+		logger.Log.Errorw("closing health probe file", "error", closeErr)
+	}
+	if removeErr := os.Remove(probe.Name()); removeErr != nil {
+		logger.Log.Errorw("removing health probe file", "error", removeErr)
+	}
+
+	free, err := diskFree(dir)
+	switch {
+	case errors.Is(err, errDiskStatsUnsupported):
+		check.Details = map[string]interface{}{"path": dir}
+	case err != nil:
+		check.Status = HealthFailing
+		check.Message = err.Error()
+	default:
+		check.Details = map[string]interface{}{"path": dir, "freeBytes": free, "minFreeBytes": minFree}
+		if free < minFree {
+			check.Status = HealthFailing
+			check.Message = fmt.Sprintf("%s has %d MB free, below the %d MB minimum", dir, free/1024/1024, minFree/1024/1024)
+		}
+	}
+	return check
+}
+
+func checkScheduler(now time.Time) HealthCheck {
+	check := HealthCheck{Name: "scheduler", Status: HealthOK}
+	statuses := GetJobStatuses()
+	if len(statuses) == 0 {
+		check.Status = HealthUnknown
+		check.Message = "no scheduled jobs registered"
+		return check
+	}
+	for i := range statuses {
+		since := statuses[i].RegisteredAt
+		if statuses[i].LastSuccess.After(since) {
+			since = statuses[i].LastSuccess
+		}
+		if jobAlive(&statuses[i], now) || now.Sub(since) <= 2*statuses[i].interval+jobGracePeriod {
+			continue
+		}
+		check.Status = HealthFailing
+		check.Message = fmt.Sprintf("%s has not succeeded since %s", statuses[i].Name, since.Format(time.RFC3339))
+	}
+	check.Details = statuses
+	return check
+}
+
+// jobAlive reports whether a job is running, renewing its lock and within its
+// maximum runtime. A job that hangs or lost its lock is judged by its last
+// success like a job that is not running.
+func jobAlive(status *JobStatus, now time.Time) bool {
+	if !status.Running || now.Sub(status.LastRun) > jobMaxRuntime*time.Minute {
+		return false
+	}
+	return db.GetLock(status.Name).LeaseUntil.After(now)
+}
+
+func checkJobLocks(now time.Time) HealthCheck {
+	check := HealthCheck{Name: "job_locks", Status: HealthOK}
+	if db.DB == nil {
+		check.Status = HealthUnknown
+		return check
+	}
+	locks, err := db.GetAllJobLocks()
+	if err != nil {
+		check.Status = HealthFailing
+		check.Message = err.Error()
+		return check
+	}
+	var stuck []string
+	for i := range *locks {
+		lock := (*locks)[i]
+		// A held lock whose lease expired was not released by a run that
+		// stopped renewing it.
+		if lock.Owner != "" && !lock.LeaseUntil.After(now) {
+			stuck = append(stuck, lock.Name)
+		}
+	}
+	if len(stuck) > 0 {
+		check.Status = HealthFailing
+		check.Message = "locks no longer renewed by their holder"
+		check.Details = stuck
+	}
+	return check
+}
@@ -0,0 +1,179 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/akhilrex/podgrab/db"
+	testhelpers "github.com/akhilrex/podgrab/internal/testing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// resetJobStatuses clears tracked jobs so tests do not see each other's registrations.
+func resetJobStatuses(t *testing.T) {
+	t.Helper()
+	jobMutex.Lock()
+	jobStatuses = make(map[string]*JobStatus)
+	jobMutex.Unlock()
+}
+
+func findCheck(report *HealthReport, name string) HealthCheck {
+	for _, check := range report.Checks {
+		if check.Name == name {
+			return check
+		}
+	}
+	return HealthCheck{}
+}
+
+// TestTrackJob tests that job runs are recorded.
+func TestTrackJob(t *testing.T) {
+	resetJobStatuses(t)
+	defer resetJobStatuses(t)
+
+	fail := true
+	run := TrackJob("TestJob", time.Minute, func() error {
+		if fail {
+			return errors.New("boom")
+		}
+		return nil
+	})
+
+	statuses := GetJobStatuses()
+	require.Len(t, statuses, 1)
+	assert.True(t, statuses[0].LastRun.IsZero(), "Job should not have run yet")
+
+	run()
+	statuses = GetJobStatuses()
+	assert.False(t, statuses[0].LastRun.IsZero(), "Should record the run")
+	assert.True(t, statuses[0].LastSuccess.IsZero(), "Failed run should not count as success")
+	assert.Equal(t, "boom", statuses[0].LastError)
+
+	fail = false
+	run()
+	statuses = GetJobStatuses()
+	assert.False(t, statuses[0].LastSuccess.IsZero(), "Should record the success")
+	assert.Empty(t, statuses[0].LastError, "Should clear the last error")
+}
+
+// TestCheckReadiness tests the combined readiness report.
+func TestCheckReadiness(t *testing.T) {
+	resetJobStatuses(t)
+	defer resetJobStatuses(t)
+
+	database := testhelpers.SetupTestDB(t)
+	defer testhelpers.TeardownTestDB(t, database)
+
+	originalDB := db.DB
+	db.DB = database
+	defer func() { db.DB = originalDB }()
+
+	_, cleanup := testhelpers.SetupTestDataDir(t)
+	defer cleanup()
+	t.Setenv("CONFIG", t.TempDir())
+	t.Setenv("MIN_FREE_SPACE_MB", "0")
+
+	TrackJob("RefreshEpisodes", time.Minute, func() error { return nil })()
+
+	report := CheckReadiness(context.Background())
+	assert.True(t, report.Ready(), "Should be ready: %+v", report.Checks)
+	assert.Equal(t, HealthOK, findCheck(&report, "database").Status)
+	assert.Equal(t, HealthOK, findCheck(&report, "data_dir").Status)
+	assert.Equal(t, HealthOK, findCheck(&report, "config_dir").Status)
+	assert.Equal(t, HealthOK, findCheck(&report, "scheduler").Status)
+	assert.Equal(t, HealthOK, findCheck(&report, "job_locks").Status)
+}
+
+// TestCheckReadiness_Failures tests that each failing dependency is reported.
+func TestCheckReadiness_Failures(t *testing.T) {
+	t.Run("missing_directory", func(t *testing.T) {
+		check := checkDirectory("data_dir", filepath.Join(t.TempDir(), "missing"), 0)
+		assert.Equal(t, HealthFailing, check.Status)
+		assert.Contains(t, check.Message, "not writable")
+	})
+
+	t.Run("not_enough_free_space", func(t *testing.T) {
+		dir := t.TempDir()
+		if _, err := diskFree(dir); errors.Is(err, errDiskStatsUnsupported) {
+			t.Skip("free space is not available on this platform")
+		}
+		check := checkDirectory("data_dir", dir, ^uint64(0))
+		assert.Equal(t, HealthFailing, check.Status)
+		assert.Contains(t, check.Message, "below")
+	})
+
+	t.Run("database_not_initialized", func(t *testing.T) {
+		originalDB := db.DB
+		db.DB = nil
+		defer func() { db.DB = originalDB }()
+
+		assert.Equal(t, HealthFailing, checkDatabase(context.Background()).Status)
+	})
+
+	t.Run("overdue_job", func(t *testing.T) {
+		resetJobStatuses(t)
+		defer resetJobStatuses(t)
+
+		TrackJob("RefreshEpisodes", time.Minute, func() error { return nil })
+		check := checkScheduler(time.Now().Add(time.Hour))
+		assert.Equal(t, HealthFailing, check.Status)
+		assert.Contains(t, check.Message, "RefreshEpisodes")
+	})
+
+	t.Run("hung_job", func(t *testing.T) {
+		resetJobStatuses(t)
+		defer resetJobStatuses(t)
+		database := testhelpers.SetupTestDB(t)
+		defer testhelpers.TeardownTestDB(t, database)
+
+		originalDB := db.DB
+		db.DB = database
+		defer func() { db.DB = originalDB }()
+
+		release, err := holdJobLock("RefreshEpisodes", jobMaxRuntime)
+		require.NoError(t, err)
+		defer release()
+		started := make(chan struct{})
+		finish := make(chan struct{})
+		defer close(finish)
+		go func() {
+			_ = TrackJob("RefreshEpisodes", time.Minute, func() error {
+				close(started)
+				<-finish
+				return nil
+			})()
+		}()
+		<-started
+
+		assert.Equal(t, HealthOK, checkScheduler(time.Now().Add(time.Minute)).Status, "Running job renewing its lock is not overdue")
+		check := checkScheduler(time.Now().Add(3 * time.Hour))
+		assert.Equal(t, HealthFailing, check.Status, "Job running past its lease and maximum runtime should be overdue")
+		assert.Contains(t, check.Message, "RefreshEpisodes")
+	})
+
+	t.Run("stuck_lock", func(t *testing.T) {
+		database := testhelpers.SetupTestDB(t)
+		defer testhelpers.TeardownTestDB(t, database)
+
+		originalDB := db.DB
+		db.DB = database
+		defer func() { db.DB = originalDB }()
+
+		acquired, err := db.AcquireLock("DownloadMissingEpisodes", "run-1", jobMaxRuntime, jobLease)
+		require.NoError(t, err)
+		require.True(t, acquired)
+		acquired, err = db.AcquireLock("RefreshEpisodes", "run-2", jobMaxRuntime, jobLease)
+		require.NoError(t, err)
+		require.True(t, acquired)
+		require.NoError(t, db.ReleaseLock("RefreshEpisodes", "run-2"))
+		assert.Equal(t, HealthOK, checkJobLocks(time.Now()).Status, "Lock with a live lease is not stuck")
+
+		check := checkJobLocks(time.Now().Add(jobLease + time.Minute))
+		assert.Equal(t, HealthFailing, check.Status)
+		assert.Equal(t, []string{"DownloadMissingEpisodes"}, check.Details, "Only the lock left held past its lease is stuck")
+	})
+}
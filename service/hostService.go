@@ -0,0 +1,282 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/akhilrex/podgrab/db"
+	"github.com/akhilrex/podgrab/internal/logger"
+	"github.com/akhilrex/podgrab/internal/metrics"
+	"golang.org/x/time/rate"
+)
+
+// Defaults for the per-host limits, used when the settings are zero.
+const (
+	defaultHostConnections       = 4
+	defaultHostRequestsPerMinute = 120
+)
+
+// maxThrottledAttempts is how many times a request is sent to a host that
+// keeps asking Podgrab to slow down.
+const maxThrottledAttempts = 3
+
+// ErrHostThrottled is returned when a remote host asks Podgrab to slow down
+// for longer than a request waits.
+var ErrHostThrottled = errors.New("remote host is throttling requests")
+
+var (
+	// maxRetryAfterWait is the longest a request waits for a host that asked
+	// Podgrab to slow down. Requests fail rather than wait longer.
+	maxRetryAfterWait = time.Minute
+	// defaultRetryAfter is the wait after a 429 response without Retry-After.
+	defaultRetryAfter = 30 * time.Second
+)
+
+// hostState is the politeness state shared by requests to a remote host.
+type hostState struct {
+	limiter *rate.Limiter
+	// freed is closed and replaced when a connection is released.
+	freed   chan struct{}
+	retryAt time.Time
+	active  int
+}
+
+var (
+	hostsMutex      sync.Mutex
+	hosts           = make(map[string]*hostState)
+	hostConnections = defaultHostConnections
+	hostRequestRate = requestRate(defaultHostRequestsPerMinute)
+)
+
+// podcastKey is the context key of the podcast that work is done for.
+type podcastKey struct{}
+
+// hostKey returns the host that the per-host limits of a request to u apply
+// to. Ports are ignored, so that a host's ports share its limits.
+func hostKey(u *url.URL) string {
+	return strings.ToLower(u.Hostname())
+}
+
+// hostLimits returns the per-host connection and request limits of the settings.
+func hostLimits(setting *db.Setting) (connections, perMinute int) {
+	connections, perMinute = setting.HostConnections, setting.HostRequestsPerMinute
+	if connections <= 0 {
+		connections = defaultHostConnections
+	}
+	if perMinute <= 0 {
+		perMinute = defaultHostRequestsPerMinute
+	}
+	return connections, perMinute
+}
+
+func requestRate(perMinute int) rate.Limit {
+	return rate.Limit(float64(perMinute) / 60)
+}
+
+// applyHostLimits sets the per-host limits from the settings.
+func applyHostLimits(setting *db.Setting) {
+	connections, perMinute := hostLimits(setting)
+
+	hostsMutex.Lock()
+	defer hostsMutex.Unlock()
+	if connections == hostConnections && requestRate(perMinute) == hostRequestRate {
+		return
+	}
+	hostConnections, hostRequestRate = connections, requestRate(perMinute)
+	for _, state := range hosts {
+		state.limiter.SetLimit(hostRequestRate)
+		state.limiter.SetBurst(hostConnections)
+		close(state.freed)
+		state.freed = make(chan struct{})
+	}
+}
+
+// hostFor returns the state of host, creating it on first use.
+func hostFor(host string) *hostState {
+	hostsMutex.Lock()
+	defer hostsMutex.Unlock()
+	state, ok := hosts[host]
+	if !ok {
+		state = &hostState{
+			limiter: rate.NewLimiter(hostRequestRate, hostConnections),
+			freed:   make(chan struct{}),
+		}
+		hosts[host] = state
+	}
+	return state
+}
+
+// acquire waits until a request may be sent to host and returns the function
+// releasing its connection.
+func (state *hostState) acquire(ctx context.Context, host string) (release func(), err error) {
+	for {
+		hostsMutex.Lock()
+		if wait := time.Until(state.retryAt); wait > 0 {
+			retryAt := state.retryAt
+			hostsMutex.Unlock()
+			if wait > maxRetryAfterWait {
+				return nil, fmt.Errorf("%w: %s asked to wait until %s", ErrHostThrottled, host, retryAt.Format(time.RFC3339))
+			}
+			if err := sleep(ctx, wait); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if state.active < hostConnections {
+			state.active++
+			hostsMutex.Unlock()
+			break
+		}
+		freed := state.freed
+		hostsMutex.Unlock()
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-freed:
+		}
+	}
+
+	var once sync.Once
+	release = func() {
+		once.Do(func() {
+			hostsMutex.Lock()
+			defer hostsMutex.Unlock()
+			state.active--
+			close(state.freed)
+			state.freed = make(chan struct{})
+		})
+	}
+	if err := state.limiter.Wait(ctx); err != nil {
+		release()
+		return nil, err
+	}
+	return release, nil
+}
+
+// throttle holds back requests to the host until retryAt.
+func (state *hostState) throttle(retryAt time.Time) {
+	hostsMutex.Lock()
+	defer hostsMutex.Unlock()
+	if retryAt.After(state.retryAt) {
+		state.retryAt = retryAt
+	}
+}
+
+// politeDo sends req with client within the limits of its host. Each request
+// of a redirect chain is held to the limits of the host it goes to. A
+// connection stays in use until the response body is closed. Responses asking
+// Podgrab to slow down are retried after the wait the host asked for, so req
+// must not have a body.
+func politeDo(client *http.Client, req *http.Request) (*http.Response, error) {
+	polite := *client
+	polite.Transport = &politeTransport{base: client.Transport}
+	return polite.Do(req) //nolint:gosec // G704: URL comes from user-provided podcast RSS feeds
+}
+
+// politeTransport sends requests within the limits of their host.
+type politeTransport struct {
+	base http.RoundTripper
+}
+
+func (t *politeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	ctx := req.Context()
+	host := hostKey(req.URL)
+	state := hostFor(host)
+	for attempt := 1; ; attempt++ {
+		release, err := state.acquire(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := base.RoundTrip(req)
+		if err != nil {
+			release()
+			return nil, err
+		}
+		wait, throttled := retryAfter(resp, time.Now())
+		if !throttled {
+			resp.Body = &releasingBody{ReadCloser: resp.Body, release: release}
+			return resp, nil
+		}
+
+		if _, err := io.Copy(io.Discard, io.LimitReader(resp.Body, 4096)); err != nil {
+			logger.Log.Debugw("draining throttled response", "error", err)
+		}
+		if err := resp.Body.Close(); err != nil {
+			logger.Log.Errorw("closing response body", "error", err)
+		}
+		release()
+		state.throttle(time.Now().Add(wait))
+		recordThrottled(ctx, host, resp.Status, wait)
+		if attempt == maxThrottledAttempts {
+			return nil, fmt.Errorf("%w: %s answered %s", ErrHostThrottled, host, resp.Status)
+		}
+	}
+}
+
+// retryAfter reports whether resp asks Podgrab to slow down and for how long.
+// Service Unavailable responses only count when they carry Retry-After.
+func retryAfter(resp *http.Response, now time.Time) (time.Duration, bool) {
+	header := resp.Header.Get("Retry-After")
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+	case resp.StatusCode == http.StatusServiceUnavailable && header != "":
+	default:
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(header); err == nil {
+		return max(time.Duration(seconds)*time.Second, 0), true
+	}
+	if date, err := http.ParseTime(header); err == nil {
+		return max(date.Sub(now), 0), true
+	}
+	return defaultRetryAfter, true
+}
+
+// recordThrottled logs a throttled request and counts it in the feed health of
+// the podcast it was made for.
+func recordThrottled(ctx context.Context, host, status string, wait time.Duration) {
+	logger.Log.Warnw("Remote host asked to slow down", "host", host, "status", status, "retryAfter", wait)
+	metrics.HostThrottles.WithLabelValues(host).Inc()
+	podcastID, ok := ctx.Value(podcastKey{}).(string)
+	if !ok || db.DB == nil {
+		return
+	}
+	if err := db.RecordFeedThrottled(podcastID); err != nil {
+		logger.Log.Errorw("recording feed throttling", "error", err)
+	}
+}
+
+// sleep waits for d or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// releasingBody releases a host connection when the response body is closed.
+type releasingBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (body *releasingBody) Close() error {
+	defer body.release()
+	return body.ReadCloser.Close()
+}
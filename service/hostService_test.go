@@ -0,0 +1,234 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/akhilrex/podgrab/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// useHostLimits stores and applies per-host limits for a test.
+func useHostLimits(t *testing.T, connections, perMinute int) {
+	t.Helper()
+	setting := db.GetOrCreateSetting()
+	setting.HostConnections = connections
+	setting.HostRequestsPerMinute = perMinute
+	require.NoError(t, db.UpdateSettings(setting))
+	applyHostLimits(setting)
+	t.Cleanup(func() {
+		applyHostLimits(&db.Setting{})
+	})
+}
+
+// useHostState forgets the state of remote hosts after a test. Test servers
+// all run on 127.0.0.1, so a host throttled by one test would hold back the
+// requests of the next.
+func useHostState(t *testing.T) {
+	t.Helper()
+	t.Cleanup(func() {
+		hostsMutex.Lock()
+		hosts = make(map[string]*hostState)
+		hostsMutex.Unlock()
+	})
+}
+
+// politeGet sends a GET request through the per-host limits.
+func politeGet(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, http.NoBody)
+	if err != nil {
+		return nil, err
+	}
+	return politeDo(http.DefaultClient, req)
+}
+
+// TestHostKey tests that the ports and case of a host share its limits.
+func TestHostKey(t *testing.T) {
+	for _, raw := range []string{"https://cdn.example.com/ep.mp3", "http://CDN.example.com:8080/feed", "https://cdn.example.com:443"} {
+		u, err := url.Parse(raw)
+		require.NoError(t, err)
+		assert.Equal(t, "cdn.example.com", hostKey(u), raw)
+	}
+}
+
+// TestRetryAfter tests recognising responses that ask to slow down.
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2024, 9, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		status    int
+		header    string
+		wait      time.Duration
+		throttled bool
+	}{
+		{name: "ok", status: http.StatusOK},
+		{name: "seconds", status: http.StatusTooManyRequests, header: "120", wait: 2 * time.Minute, throttled: true},
+		{name: "date", status: http.StatusTooManyRequests, header: now.Add(time.Minute).Format(http.TimeFormat), wait: time.Minute, throttled: true},
+		{name: "past_date", status: http.StatusTooManyRequests, header: now.Add(-time.Minute).Format(http.TimeFormat), throttled: true},
+		{name: "missing", status: http.StatusTooManyRequests, wait: defaultRetryAfter, throttled: true},
+		{name: "unavailable", status: http.StatusServiceUnavailable, header: "5", wait: 5 * time.Second, throttled: true},
+		{name: "unavailable_without_header", status: http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{StatusCode: tt.status, Header: http.Header{}}
+			if tt.header != "" {
+				resp.Header.Set("Retry-After", tt.header)
+			}
+			wait, throttled := retryAfter(resp, now)
+			assert.Equal(t, tt.throttled, throttled)
+			assert.Equal(t, tt.wait, wait)
+		})
+	}
+}
+
+// TestPoliteDo_LimitsConnections tests that requests to a host wait for a free
+// connection until the response body is closed.
+func TestPoliteDo_LimitsConnections(t *testing.T) {
+	useTestDB(t)
+	useHostState(t)
+	db.CreateTestSetting(t, db.DB)
+	useHostLimits(t, 2, 6000)
+
+	var active, peak int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		current := atomic.AddInt32(&active, 1)
+		for {
+			previous := atomic.LoadInt32(&peak)
+			if current <= previous || atomic.CompareAndSwapInt32(&peak, previous, current) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		atomic.AddInt32(&active, -1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := politeGet(context.Background(), server.URL)
+			if assert.NoError(t, err) {
+				assert.NoError(t, resp.Body.Close())
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(2), atomic.LoadInt32(&peak), "At most two requests should reach the host at once")
+
+	held, err := politeGet(context.Background(), server.URL)
+	require.NoError(t, err)
+	second, err := politeGet(context.Background(), server.URL)
+	require.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = politeGet(ctx, server.URL)
+	assert.ErrorIs(t, err, context.DeadlineExceeded, "Open bodies should hold their connections")
+	require.NoError(t, held.Body.Close())
+	require.NoError(t, second.Body.Close())
+}
+
+// TestPoliteDo_Redirect tests that a redirected request is held to the
+// limits of the host it is redirected to.
+func TestPoliteDo_Redirect(t *testing.T) {
+	useTestDB(t)
+	useHostState(t)
+	db.CreateTestSetting(t, db.DB)
+	useHostLimits(t, 1, 6000)
+
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer target.Close()
+	targetURL, err := url.Parse(target.URL)
+	require.NoError(t, err)
+	targetURL.Host = "localhost:" + targetURL.Port()
+	redirect := httptest.NewServer(http.RedirectHandler(targetURL.String(), http.StatusFound))
+	defer redirect.Close()
+
+	held, err := politeGet(context.Background(), targetURL.String())
+	require.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = politeGet(ctx, redirect.URL)
+	assert.ErrorIs(t, err, context.DeadlineExceeded, "The redirect should wait for a connection to its target")
+	require.NoError(t, held.Body.Close())
+
+	resp, err := politeGet(context.Background(), redirect.URL)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+// TestPoliteDo_RetryAfter tests waiting and retrying when a host asks to slow
+// down, and counting it in the podcast's feed health.
+func TestPoliteDo_RetryAfter(t *testing.T) {
+	useTestDB(t)
+	useHostState(t)
+	db.CreateTestSetting(t, db.DB)
+	podcast := db.CreateTestPodcast(t, db.DB)
+
+	var hits int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if atomic.AddInt32(&hits, 1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	start := time.Now()
+	ctx := context.WithValue(context.Background(), podcastKey{}, podcast.ID)
+	resp, err := politeGet(ctx, server.URL)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&hits))
+	assert.GreaterOrEqual(t, time.Since(start), 900*time.Millisecond, "Retry should wait for Retry-After")
+
+	var updated db.Podcast
+	require.NoError(t, db.GetPodcastByID(podcast.ID, &updated))
+	assert.Equal(t, 1, updated.FeedThrottleCount)
+	assert.NotNil(t, updated.LastFeedThrottled)
+}
+
+// TestAddPodcastItems_Throttled tests that a refresh throttled for longer than
+// requests wait fails without counting as a feed failure, and that the host
+// gets no further requests until the time it asked for.
+func TestAddPodcastItems_Throttled(t *testing.T) {
+	useTestDB(t)
+	useHostState(t)
+	db.CreateTestSetting(t, db.DB)
+
+	var hits int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+	podcast := db.CreateTestPodcast(t, db.DB, &db.Podcast{URL: server.URL + "/feed.xml"})
+
+	err := AddPodcastItems(context.Background(), podcast, false)
+	assert.ErrorIs(t, err, ErrHostThrottled)
+	err = AddPodcastItems(context.Background(), podcast, false)
+	assert.ErrorIs(t, err, ErrHostThrottled)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&hits), "Host should not be asked again before Retry-After")
+
+	var updated db.Podcast
+	require.NoError(t, db.GetPodcastByID(podcast.ID, &updated))
+	assert.Equal(t, 1, updated.FeedThrottleCount)
+	assert.Zero(t, updated.FeedFailureCount, "Throttling is not a feed failure")
+}
@@ -0,0 +1,144 @@
+package service
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/akhilrex/podgrab/internal/config"
+	"github.com/akhilrex/podgrab/internal/logger"
+)
+
+var (
+	transportMutex sync.Mutex
+	transport      http.RoundTripper
+	// transportConfig is the configuration transport was built from.
+	transportConfig config.HTTP
+)
+
+// httpClient returns the client for feed fetches and downloads, using the
+// proxy, CA bundle and timeouts of the deployment configuration.
+func httpClient() *http.Client {
+	client := http.Client{
+		Transport: sharedTransport(),
+		CheckRedirect: func(req *http.Request, _ []*http.Request) error {
+			stripFeedAuth(req)
+			return nil
+		},
+	}
+
+	return &client
+}
+
+// sharedTransport returns the transport for the current configuration,
+// rebuilding it when the configuration changed.
+func sharedTransport() http.RoundTripper {
+	cfg := config.Get().HTTP
+
+	transportMutex.Lock()
+	defer transportMutex.Unlock()
+	if transport != nil && cfg == transportConfig {
+		return transport
+	}
+	built, err := newTransport(cfg)
+	if err != nil {
+		logger.Log.Errorw("Invalid HTTP client configuration, using defaults", "error", err)
+		built, _ = newTransport(config.Default().HTTP)
+	}
+	transport, transportConfig = built, cfg
+	return transport
+}
+
+func newTransport(cfg config.HTTP) (http.RoundTripper, error) {
+	connectTimeout := time.Duration(cfg.ConnectTimeout) * time.Second
+	readTimeout := time.Duration(cfg.ReadTimeout) * time.Second
+
+	base := http.DefaultTransport.(*http.Transport).Clone()
+	dialer := &net.Dialer{Timeout: connectTimeout, KeepAlive: 30 * time.Second}
+	base.DialContext = dialer.DialContext
+	base.TLSHandshakeTimeout = connectTimeout
+	base.ResponseHeaderTimeout = readTimeout
+
+	if cfg.Proxy != "" {
+		proxy, err := url.Parse(cfg.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("proxy: %w", err)
+		}
+		base.Proxy = http.ProxyURL(proxy)
+	}
+	if cfg.CABundle != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		pem, err := os.ReadFile(cfg.CABundle)
+		if err != nil {
+			return nil, fmt.Errorf("CA bundle: %w", err)
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("CA bundle: %s holds no PEM certificates", cfg.CABundle)
+		}
+		base.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	}
+
+	if readTimeout <= 0 {
+		return base, nil
+	}
+	return &readTimeoutTransport{base: base, timeout: readTimeout}, nil
+}
+
+// readTimeoutTransport fails responses that stop sending data for longer
+// than timeout. Slow responses that keep sending are not cut off, and time
+// the reader spends between reads, such as waiting for a rate limit, does not
+// count.
+type readTimeoutTransport struct {
+	base    http.RoundTripper
+	timeout time.Duration
+}
+
+func (t *readTimeoutTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body := &idleTimeoutBody{ReadCloser: resp.Body, timeout: t.timeout}
+	body.timer = time.AfterFunc(t.timeout, func() {
+		body.expired.Store(true)
+		_ = resp.Body.Close() // Unblocks the read in progress
+	})
+	body.timer.Stop() // Only runs while a read waits for data
+	resp.Body = body
+	return resp, nil
+}
+
+// idleTimeoutBody closes a response body when a read receives no data for
+// timeout.
+type idleTimeoutBody struct {
+	io.ReadCloser
+	timer   *time.Timer
+	timeout time.Duration
+	expired atomic.Bool
+}
+
+func (body *idleTimeoutBody) Read(p []byte) (int, error) {
+	body.timer.Reset(body.timeout)
+	n, err := body.ReadCloser.Read(p)
+	body.timer.Stop()
+	if body.expired.Load() {
+		return n, fmt.Errorf("no data received for %s: %w", body.timeout, os.ErrDeadlineExceeded)
+	}
+	return n, err
+}
+
+func (body *idleTimeoutBody) Close() error {
+	body.timer.Stop()
+	return body.ReadCloser.Close()
+}
@@ -0,0 +1,105 @@
+package service
+
+import (
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestHTTPClient_Proxy tests sending requests through the configured proxy.
+func TestHTTPClient_Proxy(t *testing.T) {
+	requested := make(chan string, 1)
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested <- r.URL.String()
+		_, _ = w.Write([]byte("via proxy"))
+	}))
+	defer proxy.Close()
+	t.Setenv("PROXY_URL", proxy.URL)
+
+	resp, err := httpClient().Get("http://feeds.example.invalid/feed.xml")
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, "via proxy", string(body))
+	assert.Equal(t, "http://feeds.example.invalid/feed.xml", <-requested)
+}
+
+// TestHTTPClient_CABundle tests trusting servers signed by the configured CA bundle.
+func TestHTTPClient_CABundle(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	_, err := httpClient().Get(server.URL)
+	require.Error(t, err, "Self-signed certificate should not be trusted by default")
+
+	bundle := filepath.Join(t.TempDir(), "ca.pem")
+	certificate := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	require.NoError(t, os.WriteFile(bundle, certificate, 0o600))
+	t.Setenv("CA_BUNDLE", bundle)
+
+	resp, err := httpClient().Get(server.URL)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+// TestHTTPClient_ReadTimeout tests that responses stalling for longer than the
+// read timeout fail, while responses that keep sending data or are read
+// slowly do not.
+func TestHTTPClient_ReadTimeout(t *testing.T) {
+	t.Setenv("READ_TIMEOUT", "1")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		flusher := w.(http.Flusher)
+		for i := 0; i < 3; i++ {
+			_, _ = w.Write([]byte("data"))
+			flusher.Flush()
+			if r.URL.Path == "/stall" {
+				break
+			}
+			time.Sleep(600 * time.Millisecond)
+		}
+		if r.URL.Path == "/stall" {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+		}
+	}))
+	defer server.Close()
+
+	resp, err := httpClient().Get(server.URL + "/slow")
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err, "Slow responses that keep sending should not time out")
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, "datadatadata", string(body))
+
+	resp, err = httpClient().Get(server.URL + "/slow")
+	require.NoError(t, err)
+	first := make([]byte, 4)
+	_, err = io.ReadFull(resp.Body, first)
+	require.NoError(t, err)
+	time.Sleep(1200 * time.Millisecond)
+	_, err = io.ReadAll(resp.Body)
+	require.NoError(t, err, "Time between reads, such as waiting for a rate limit, should not count")
+	require.NoError(t, resp.Body.Close())
+
+	start := time.Now()
+	resp, err = httpClient().Get(server.URL + "/stall")
+	require.NoError(t, err)
+	_, err = io.ReadAll(resp.Body)
+	require.NoError(t, resp.Body.Close())
+	assert.ErrorIs(t, err, os.ErrDeadlineExceeded)
+	assert.Less(t, time.Since(start), 3*time.Second)
+}
@@ -2,12 +2,13 @@
 package service
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/url"
-	"os"
 
 	"github.com/TheHippo/podcastindex"
+	"github.com/akhilrex/podgrab/internal/config"
 	"github.com/akhilrex/podgrab/internal/logger"
 	"github.com/akhilrex/podgrab/model"
 )
@@ -28,7 +29,7 @@ const ItunesBase = "https://itunes.apple.com"
 func (service ItunesService) Query(q string) []*model.CommonSearchResultModel {
 	searchURL := fmt.Sprintf("%s/search?term=%s&entity=podcast", ItunesBase, url.QueryEscape(q))
 
-	body, err := makeQuery(searchURL)
+	body, err := makeQuery(context.Background(), searchURL)
 	if err != nil {
 		logger.Log.Errorw("making iTunes query", "error", err)
 		return []*model.CommonSearchResultModel{}
@@ -52,10 +53,10 @@ type PodcastIndexService struct {
 }
 
 func getPodcastIndexCredentials() (apiKey, apiSecret string) {
-	apiKey = os.Getenv("PODCASTINDEX_KEY")
-	apiSecret = os.Getenv("PODCASTINDEX_SECRET")
+	apiKey = config.Get().PodcastIndex.Key
+	apiSecret = config.Get().PodcastIndex.Secret
 
-	// Use demo credentials if environment variables are not set
+	// Use demo credentials if no credentials are configured
 	// These are public demo credentials from podcastindex.org
 	if apiKey == "" {
 		apiKey = getDefaultPodcastIndexKey()
@@ -0,0 +1,652 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/akhilrex/podgrab/db"
+	"github.com/akhilrex/podgrab/internal/config"
+	"github.com/akhilrex/podgrab/internal/logger"
+	"github.com/dhowden/tag"
+)
+
+var (
+	// ErrInvalidLocalPodcast is returned for folders and files a local
+	// podcast cannot be made from.
+	ErrInvalidLocalPodcast = errors.New("invalid local podcast")
+	// ErrNotLocalPodcast is returned when uploading files to a podcast
+	// subscribed to a feed.
+	ErrNotLocalPodcast = errors.New("podcast is not made from a local folder")
+	// ErrLocalPodcast is returned for feed operations on a local podcast,
+	// and for deleting its files, which are its episodes.
+	ErrLocalPodcast = errors.New("not possible for a local podcast")
+)
+
+// localArtworkNames are the file names, without extension, of the artwork
+// in the folder of a local podcast outside the data directory. In the data
+// directory folder.jpg is the downloaded artwork override.
+var localArtworkNames = []string{"cover", "folder"}
+
+// localArtworkExtensions are the image types recognised as artwork.
+var localArtworkExtensions = []string{".jpg", ".jpeg", ".png"}
+
+// fileNameDate matches a date such as 2024-03-15 or 20240315 in a file name.
+var fileNameDate = regexp.MustCompile(`(\d{4})[-_.]?(\d{2})[-_.]?(\d{2})`)
+
+// tagDateLayouts are the date formats found in the date tags of audio files.
+var tagDateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+// localUploadMu serializes choosing the names of uploaded files.
+var localUploadMu sync.Mutex
+
+// localScanMu serializes scans, so that the scheduled scan and a refresh do
+// not both add a new file.
+var localScanMu sync.Mutex
+
+// LocalPodcast describes a podcast made from a folder of audio files.
+type LocalPodcast struct {
+	// Title defaults to the name of the folder.
+	Title   string
+	Author  string
+	Summary string
+	// Path is the folder of audio files, absolute or relative to the local
+	// directory. Empty creates the podcast's folder in the data directory
+	// for uploaded files.
+	Path string
+}
+
+// localEpisode is what the tags and name of an audio file say about it.
+type localEpisode struct {
+	pubDate  time.Time
+	picture  *tag.Picture
+	title    string
+	summary  string
+	author   string
+	duration int
+}
+
+// AddLocalPodcast creates a podcast from a folder of audio files. Its
+// episodes are added by the next refresh.
+func AddLocalPodcast(details *LocalPodcast) (db.Podcast, error) {
+	dir := ""
+	if strings.TrimSpace(details.Path) != "" {
+		resolved, err := resolveLocalFolder(strings.TrimSpace(details.Path))
+		if err != nil {
+			return db.Podcast{}, err
+		}
+		dir = resolved
+	}
+	title := strings.TrimSpace(details.Title)
+	if title == "" && dir != "" {
+		title = filepath.Base(dir)
+	}
+	if title == "" {
+		return db.Podcast{}, fmt.Errorf("%w: a title or folder is required", ErrInvalidLocalPodcast)
+	}
+	folder := cleanFileName(title)
+	if strings.Trim(folder, ".-") == "" {
+		return db.Podcast{}, fmt.Errorf("%w: title %q", ErrInvalidLocalPodcast, title)
+	}
+
+	var podcasts []db.Podcast
+	if err := db.GetAllPodcasts(&podcasts, ""); err != nil {
+		return db.Podcast{}, err
+	}
+	for i := range podcasts {
+		other := &podcasts[i]
+		if strings.EqualFold(cleanFileName(other.DataFolder()), folder) {
+			return db.Podcast{}, fmt.Errorf("%w: %q is the folder of %s", ErrPodcastFolderInUse, folder, other.Title)
+		}
+		if dir != "" && ((other.IsLocal && other.LocalPath == dir) || inDataFolder(dir, other)) {
+			return db.Podcast{}, fmt.Errorf("%w: %s is the folder of %s", ErrPodcastFolderInUse, dir, other.Title)
+		}
+	}
+
+	podcast := db.Podcast{
+		IsLocal:     true,
+		LocalPath:   dir,
+		FeedTitle:   title,
+		FeedAuthor:  strings.TrimSpace(details.Author),
+		FeedSummary: strings.TrimSpace(details.Summary),
+		Folder:      title,
+	}
+	applyPodcastOverrides(&podcast)
+	if err := db.CreatePodcast(&podcast); err != nil {
+		return db.Podcast{}, err
+	}
+	logger.Log.Infow("Added local podcast", "podcast", podcast.Title, "folder", localPodcastDir(&podcast))
+	return podcast, nil
+}
+
+// resolveLocalFolder returns the absolute path of the folder of a local
+// podcast, which must be in the local or the data directory.
+func resolveLocalFolder(folder string) (string, error) {
+	cfg := config.Get()
+	roots := []string{cfg.DataDir}
+	if cfg.LocalDir != "" {
+		roots = []string{cfg.LocalDir, cfg.DataDir}
+	}
+	if !filepath.IsAbs(folder) {
+		folder = filepath.Join(roots[0], folder)
+	}
+	resolved, err := realPath(folder)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidLocalPodcast, err)
+	}
+	info, err := os.Stat(resolved)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidLocalPodcast, err)
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("%w: %s is not a folder", ErrInvalidLocalPodcast, folder)
+	}
+	for _, root := range roots {
+		base, err := realPath(root)
+		if err != nil {
+			continue
+		}
+		if !withinDir(base, resolved) {
+			continue
+		}
+		// The data directory holds the folders of every podcast
+		if base == resolved && root == cfg.DataDir {
+			continue
+		}
+		return resolved, nil
+	}
+	if cfg.LocalDir == "" {
+		return "", fmt.Errorf("%w: %s is not in the data directory", ErrInvalidLocalPodcast, folder)
+	}
+	return "", fmt.Errorf("%w: %s is not in the local or data directory", ErrInvalidLocalPodcast, folder)
+}
+
+func realPath(name string) (string, error) {
+	abs, err := filepath.Abs(name)
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(abs)
+}
+
+// withinDir reports whether name is dir or inside it.
+func withinDir(dir, name string) bool {
+	rel, err := filepath.Rel(dir, name)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// inDataFolder reports whether the folder of a local podcast is in the data
+// folder of other, whose removal would take the local podcast's files.
+func inDataFolder(dir string, other *db.Podcast) bool {
+	dataFolder, err := realPath(path.Join(config.Get().DataDir, cleanFileName(other.DataFolder())))
+	return err == nil && withinDir(dataFolder, dir)
+}
+
+// localPodcastDir returns the folder the episodes of a local podcast are
+// read from, creating it in the data directory if the podcast has no path.
+func localPodcastDir(podcast *db.Podcast) string {
+	if podcast.LocalPath != "" {
+		return podcast.LocalPath
+	}
+	return createDataFolderIfNotExists(podcast.DataFolder())
+}
+
+// ScanLocalPodcasts picks up new, changed and removed files in the folders
+// of local podcasts.
+func ScanLocalPodcasts(ctx context.Context) error {
+	_, err := scanLocalPodcasts(ctx)
+	return err
+}
+
+// scanLocalPodcasts scans every local podcast and returns how many episodes
+// were added, changed or removed.
+func scanLocalPodcasts(ctx context.Context) (int, error) {
+	var podcasts []db.Podcast
+	if err := db.GetLocalPodcasts(&podcasts); err != nil {
+		return 0, err
+	}
+	changed := 0
+	for i := range podcasts {
+		if ctx.Err() != nil {
+			return changed, context.Cause(ctx)
+		}
+		count, err := scanPodcast(ctx, &podcasts[i])
+		if err != nil {
+			logger.Log.Errorw("scanning local podcast", "podcast", podcasts[i].Title, "error", err)
+		}
+		changed += count
+	}
+	return changed, nil
+}
+
+// ScanLocalPodcast picks up new, changed and removed files in the folder of
+// a local podcast.
+func ScanLocalPodcast(ctx context.Context, podcastID string) error {
+	var podcast db.Podcast
+	if err := db.GetPodcastByID(podcastID, &podcast); err != nil {
+		return err
+	}
+	if !podcast.IsLocal {
+		return ErrNotLocalPodcast
+	}
+	_, err := scanPodcast(ctx, &podcast)
+	return err
+}
+
+// scanPodcast scans the folder of a local podcast and returns how many
+// episodes were added, changed or removed. Like a feed's first refresh, its
+// first scan does not announce the episodes found.
+func scanPodcast(ctx context.Context, podcast *db.Podcast) (changed int, err error) {
+	isNewPodcast := podcast.LastEpisode == nil
+	if isNewPodcast {
+		db.ForceSetLastEpisodeDate(podcast.ID)
+	}
+	ctx, done := startFeedRefresh(ctx, podcast)
+	defer func() { done(err) }()
+	return scanLocalPodcast(ctx, podcast, isNewPodcast)
+}
+
+// scanLocalPodcast adds the audio files in the folder of a local podcast as
+// its episodes. Changed files are read again and episodes whose files are
+// gone are flagged as removed upstream until the files return. It returns how
+// many episodes were added, changed or removed.
+func scanLocalPodcast(ctx context.Context, podcast *db.Podcast, newPodcast bool) (int, error) {
+	localScanMu.Lock()
+	defer localScanMu.Unlock()
+	dir := localPodcastDir(podcast)
+	files, err := listLocalEpisodes(dir)
+	if err != nil {
+		return 0, err
+	}
+	var existing []db.PodcastItem
+	if err := db.GetAllPodcastItemsByPodcastID(podcast.ID, &existing); err != nil {
+		return 0, err
+	}
+	byGUID := make(map[string]*db.PodcastItem, len(existing))
+	for i := range existing {
+		byGUID[existing[i].GUID] = &existing[i]
+	}
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var latestDate time.Time
+	var itemsAdded []db.PodcastItem
+	var artwork *tag.Picture
+	author := ""
+	updated := 0
+	for _, name := range names {
+		if ctx.Err() != nil {
+			return len(itemsAdded) + updated, context.Cause(ctx)
+		}
+		info := files[name]
+		location := filepath.Join(dir, name)
+		item, known := byGUID[name]
+		if known && item.DownloadStatus == db.Downloaded && item.RemovedUpstreamAt == nil &&
+			item.DownloadPath == location && item.FileSize == info.Size() && item.DownloadDate.Equal(info.ModTime()) {
+			continue
+		}
+		episode := readLocalEpisode(location, info)
+		if artwork == nil {
+			artwork = episode.picture
+		}
+		if author == "" {
+			author = episode.author
+		}
+		if !known {
+			item = &db.PodcastItem{PodcastID: podcast.ID, GUID: name}
+		}
+		item.Title = episode.title
+		item.Summary = episode.summary
+		item.PubDate = episode.pubDate
+		item.Duration = episode.duration
+		item.Image = fmt.Sprintf("/podcasts/%s/image", podcast.ID)
+		item.FileURL = (&url.URL{Scheme: "file", Path: filepath.ToSlash(location)}).String()
+		item.DownloadPath = location
+		item.DownloadDate = info.ModTime()
+		item.DownloadStatus = db.Downloaded
+		item.FileSize = info.Size()
+		item.RemovedUpstreamAt = nil
+		if !known {
+			if err := db.CreatePodcastItem(item); err != nil {
+				logger.Log.Errorw("creating podcast item", "file", location, "error", err)
+				continue
+			}
+			itemsAdded = append(itemsAdded, *item)
+			if latestDate.Before(item.PubDate) {
+				latestDate = item.PubDate
+			}
+		}
+		if episode.picture != nil {
+			saveLocalEpisodeImage(podcast, item, episode.picture)
+		}
+		if err := db.UpdatePodcastItem(item); err != nil {
+			logger.Log.Errorw("updating podcast item", "file", location, "error", err)
+		} else if known {
+			updated++
+		}
+	}
+
+	now := time.Now()
+	removed := 0
+	for i := range existing {
+		item := &existing[i]
+		if _, ok := files[item.GUID]; ok || item.RemovedUpstreamAt != nil {
+			continue
+		}
+		item.RemovedUpstreamAt = &now
+		if item.DownloadStatus != db.Deleted {
+			item.DownloadStatus = db.Deleted
+			item.DownloadPath = ""
+		}
+		if err := db.UpdatePodcastItem(item); err != nil {
+			logger.Log.Errorw("updating podcast item", "error", err)
+			continue
+		}
+		removed++
+	}
+	if removed > 0 {
+		logger.Log.Infow("Episodes removed from the local folder", "podcast", podcast.Title, "count", removed)
+	}
+
+	updateLocalPodcastDetails(podcast, dir, artwork, author)
+	if !newPodcast {
+		notifyNewEpisodes(podcast, itemsAdded)
+	}
+	if !latestDate.IsZero() {
+		if err := db.UpdateLastEpisodeDateForPodcast(podcast.ID, latestDate); err != nil {
+			logger.Log.Errorw("updating last episode date", "error", err)
+		}
+	}
+	if len(itemsAdded) > 0 || removed > 0 {
+		refreshPlaylistFile(podcast.ID, db.GetOrCreateSetting())
+	}
+	return len(itemsAdded) + updated + removed, nil
+}
+
+// listLocalEpisodes returns the audio files in dir and its subfolders by
+// their path relative to dir. Hidden files and folders are skipped.
+func listLocalEpisodes(dir string) (map[string]fs.FileInfo, error) {
+	files := make(map[string]fs.FileInfo)
+	err := filepath.WalkDir(dir, func(location string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if location == dir {
+				return err
+			}
+			logger.Log.Warnw("reading local podcast folder", "path", location, "error", err)
+			return nil
+		}
+		if location != dir && strings.HasPrefix(entry.Name(), ".") {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if entry.IsDir() || !isLocalEpisodeFile(entry.Name()) {
+			return nil
+		}
+		// Stat follows symbolic links to files
+		info, statErr := os.Stat(location)
+		if statErr != nil || !info.Mode().IsRegular() {
+			return nil //nolint:nilerr // broken links are skipped
+		}
+		rel, relErr := filepath.Rel(dir, location)
+		if relErr != nil {
+			return relErr
+		}
+		files[filepath.ToSlash(rel)] = info
+		return nil
+	})
+	return files, err
+}
+
+// isLocalEpisodeFile reports whether name is an audio or video file.
+func isLocalEpisodeFile(name string) bool {
+	_, ok := enclosureTypes[strings.ToLower(filepath.Ext(name))]
+	return ok
+}
+
+// readLocalEpisode reads the details of an episode from the tags of its
+// file, falling back to the file's name and modification time.
+func readLocalEpisode(location string, info fs.FileInfo) localEpisode {
+	var episode localEpisode
+	if file, err := os.Open(location); err == nil { //nolint:gosec // G304: files listed from the podcast's folder
+		metadata, tagErr := tag.ReadFrom(file)
+		if closeErr := file.Close(); closeErr != nil {
+			logger.Log.Errorw("closing file", "error", closeErr)
+		}
+		if tagErr == nil {
+			episode.title = strings.TrimSpace(metadata.Title())
+			episode.summary = strings.TrimSpace(metadata.Comment())
+			episode.author = strings.TrimSpace(metadata.AlbumArtist())
+			if episode.author == "" {
+				episode.author = strings.TrimSpace(metadata.Artist())
+			}
+			episode.pubDate = tagDate(metadata.Raw())
+			episode.duration = tagDuration(metadata.Raw())
+			if picture := metadata.Picture(); picture != nil && len(picture.Data) > 0 {
+				episode.picture = picture
+			}
+		} else if !errors.Is(tagErr, tag.ErrNoTagsFound) {
+			logger.Log.Debugw("reading tags", "file", location, "error", tagErr)
+		}
+	}
+
+	name := strings.TrimSuffix(filepath.Base(location), filepath.Ext(location))
+	date, rest := fileNameDateOf(name)
+	if episode.title == "" {
+		episode.title = strings.TrimSpace(strings.ReplaceAll(rest, "_", " "))
+	}
+	if episode.pubDate.IsZero() {
+		episode.pubDate = date
+	}
+	if episode.pubDate.IsZero() {
+		episode.pubDate = info.ModTime()
+	}
+	return episode
+}
+
+// fileNameDateOf returns the date in a file name and the name without it.
+// Names without a date are returned whole.
+func fileNameDateOf(name string) (time.Time, string) {
+	match := fileNameDate.FindStringSubmatchIndex(name)
+	if match == nil {
+		return time.Time{}, name
+	}
+	date, err := time.Parse("2006-01-02", name[match[2]:match[3]]+"-"+name[match[4]:match[5]]+"-"+name[match[6]:match[7]])
+	if err != nil {
+		return time.Time{}, name
+	}
+	rest := strings.Trim(name[:match[0]]+" "+name[match[1]:], " -_.")
+	if rest == "" {
+		rest = name
+	}
+	return date, rest
+}
+
+// tagDate returns the recording or release date in the raw tags of a file.
+// Tags holding only a year are ignored as too coarse to order episodes.
+func tagDate(raw map[string]interface{}) time.Time {
+	for _, key := range []string{"TDRC", "TDRL", "TDOR", "date", "DATE", "\xa9day"} {
+		value, ok := raw[key].(string)
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		for _, layout := range tagDateLayouts {
+			if date, err := time.Parse(layout, value); err == nil {
+				return date
+			}
+		}
+	}
+	return time.Time{}
+}
+
+// tagDuration returns the length in seconds of an ID3 tagged file, zero
+// when the tags do not say.
+func tagDuration(raw map[string]interface{}) int {
+	for _, key := range []string{"TLEN", "TLE"} {
+		if value, ok := raw[key].(string); ok {
+			if millis, err := strconv.Atoi(strings.TrimSpace(value)); err == nil && millis > 0 {
+				return millis / 1000
+			}
+		}
+	}
+	return 0
+}
+
+// saveLocalEpisodeImage stores the picture embedded in an episode's file as
+// the episode's image.
+func saveLocalEpisodeImage(podcast *db.Podcast, item *db.PodcastItem, picture *tag.Picture) {
+	imageFolder := createFolder("images", createDataFolderIfNotExists(podcast.DataFolder()))
+	location := filepath.Join(imageFolder, item.ID+pictureExtension(picture))
+	if err := os.WriteFile(location, picture.Data, 0o644); err != nil { //nolint:gosec // G306: images are served to players
+		logger.Log.Errorw("saving episode image", "file", location, "error", err)
+		return
+	}
+	changeOwnership(location)
+	item.LocalImage = location
+}
+
+func pictureExtension(picture *tag.Picture) string {
+	if strings.EqualFold(picture.Ext, "png") || strings.EqualFold(picture.MIMEType, "image/png") {
+		return ".png"
+	}
+	return ".jpg"
+}
+
+// LocalPodcastArtwork returns the path of the artwork of a local podcast,
+// empty when it has none. A cover image in the podcast's folder is used, or
+// one extracted from its files into its data folder.
+func LocalPodcastArtwork(podcast *db.Podcast) string {
+	dataFolder := createDataFolderIfNotExists(podcast.DataFolder())
+	if podcast.LocalPath != "" {
+		if artwork := findArtwork(podcast.LocalPath, localArtworkNames); artwork != "" {
+			return artwork
+		}
+	}
+	return findArtwork(dataFolder, localArtworkNames[:1])
+}
+
+// findArtwork returns the first image in dir with one of names, matched
+// regardless of case.
+func findArtwork(dir string, names []string) string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return ""
+	}
+	for _, name := range names {
+		for _, extension := range localArtworkExtensions {
+			for _, entry := range entries {
+				if !entry.IsDir() && strings.EqualFold(entry.Name(), name+extension) {
+					return filepath.Join(dir, entry.Name())
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// updateLocalPodcastDetails sets the artwork and author of a local podcast
+// from its folder and the tags of its files, keeping details already set.
+func updateLocalPodcastDetails(podcast *db.Podcast, dir string, picture *tag.Picture, author string) {
+	previous := *podcast
+	if LocalPodcastArtwork(podcast) == "" && picture != nil {
+		location := filepath.Join(createDataFolderIfNotExists(podcast.DataFolder()), "cover"+pictureExtension(picture))
+		if err := os.WriteFile(location, picture.Data, 0o644); err != nil { //nolint:gosec // G306: artwork is served to players
+			logger.Log.Errorw("saving podcast artwork", "file", location, "error", err)
+		} else {
+			changeOwnership(location)
+		}
+	}
+	if LocalPodcastArtwork(podcast) != "" {
+		podcast.FeedImage = fmt.Sprintf("/podcasts/%s/image", podcast.ID)
+	}
+	if podcast.FeedAuthor == "" {
+		podcast.FeedAuthor = author
+	}
+	applyPodcastOverrides(podcast)
+	if podcast.FeedImage == previous.FeedImage && podcast.FeedAuthor == previous.FeedAuthor {
+		return
+	}
+	if err := db.UpdatePodcastMetadata(podcast); err != nil {
+		logger.Log.Errorw("updating local podcast details", "folder", dir, "error", err)
+		return
+	}
+	podcastMetadataChanged(&previous, podcast)
+}
+
+// SaveLocalEpisode stores a file uploaded to a local podcast in its folder
+// and returns the file's path. A number is added to the name of the file if
+// the folder already has a file by that name.
+func SaveLocalEpisode(podcastID, name string, content io.Reader) (string, error) {
+	var podcast db.Podcast
+	if err := db.GetPodcastByID(podcastID, &podcast); err != nil {
+		return "", err
+	}
+	if !podcast.IsLocal {
+		return "", ErrNotLocalPodcast
+	}
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	if name == "" || strings.HasPrefix(name, ".") || !isLocalEpisodeFile(name) {
+		return "", fmt.Errorf("%w: %q is not an audio file", ErrInvalidLocalPodcast, name)
+	}
+	dir := localPodcastDir(&podcast)
+
+	// Hidden files are skipped by scans until they are complete
+	tmp, err := os.CreateTemp(dir, ".upload-*.part")
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		if removeErr := os.Remove(tmp.Name()); removeErr != nil && !os.IsNotExist(removeErr) {
+			logger.Log.Errorw("removing upload", "file", tmp.Name(), "error", removeErr)
+		}
+	}()
+	_, err = io.Copy(tmp, content)
+	if err == nil {
+		err = tmp.Chmod(0o644) //nolint:gosec // G302: episodes are served to players
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", err
+	}
+
+	localUploadMu.Lock()
+	defer localUploadMu.Unlock()
+	extension := filepath.Ext(name)
+	base := strings.TrimSuffix(name, extension)
+	location := filepath.Join(dir, name)
+	for i := 2; FileExists(location); i++ {
+		location = filepath.Join(dir, fmt.Sprintf("%s-%d%s", base, i, extension))
+	}
+	if err := os.Rename(tmp.Name(), location); err != nil {
+		return "", err
+	}
+	changeOwnership(location)
+	logger.Log.Infow("Saved uploaded episode", "podcast", podcast.Title, "file", location)
+	return location, nil
+}
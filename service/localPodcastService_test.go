@@ -0,0 +1,315 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/akhilrex/podgrab/db"
+	"github.com/akhilrex/podgrab/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// pngPicture is the smallest PNG header, enough to be recognised as one.
+var pngPicture = []byte("\x89PNG\r\n\x1a\n")
+
+// id3File returns an MP3 file whose ID3v2.4 tag holds the text frames and,
+// when picture is set, a front cover.
+func id3File(frames map[string]string, picture []byte) []byte {
+	var body bytes.Buffer
+	frame := func(id string, data []byte) {
+		body.WriteString(id)
+		body.Write(synchsafe(len(data)))
+		body.Write([]byte{0, 0})
+		body.Write(data)
+	}
+	for id, text := range frames {
+		frame(id, append([]byte{3}, text...))
+	}
+	if picture != nil {
+		data := append([]byte{3}, "image/png\x00"...)
+		data = append(data, 3, 0)
+		frame("APIC", append(data, picture...))
+	}
+	var file bytes.Buffer
+	file.WriteString("ID3\x04\x00\x00")
+	file.Write(synchsafe(body.Len()))
+	file.Write(body.Bytes())
+	file.Write(bytes.Repeat([]byte{0xff, 0xfb, 0x90, 0x00}, 64))
+	return file.Bytes()
+}
+
+func synchsafe(n int) []byte {
+	size := make([]byte, 4)
+	binary.BigEndian.PutUint32(size, uint32(n&0x7f|n<<1&0x7f00|n<<2&0x7f0000|n<<3&0x7f000000)) //nolint:gosec // G115: test tags are small
+	return size
+}
+
+func writeLocalFile(t *testing.T, name string, content []byte) {
+	t.Helper()
+	require.NoError(t, os.MkdirAll(filepath.Dir(name), 0o750))
+	require.NoError(t, os.WriteFile(name, content, 0o600))
+}
+
+// TestAddLocalPodcast tests the folders local podcasts may be made from.
+func TestAddLocalPodcast(t *testing.T) {
+	useTestDataDir(t)
+	dataDir := config.Get().DataDir
+	localDir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dataDir, "Recordings"), 0o750))
+	require.NoError(t, os.MkdirAll(filepath.Join(localDir, "Meetings"), 0o750))
+	db.CreateTestPodcast(t, db.DB, &db.Podcast{Title: "Feed Show", Folder: "Feed Show"})
+
+	podcast, err := AddLocalPodcast(&LocalPodcast{Path: "Recordings", Author: "Team"})
+	require.NoError(t, err)
+	assert.True(t, podcast.IsLocal)
+	assert.Equal(t, "Recordings", podcast.Title, "The title should default to the folder's name")
+	assert.Equal(t, "Team", podcast.Author)
+	resolved, err := filepath.EvalSymlinks(filepath.Join(dataDir, "Recordings"))
+	require.NoError(t, err)
+	assert.Equal(t, resolved, podcast.LocalPath)
+
+	uploads, err := AddLocalPodcast(&LocalPodcast{Title: "Uploads"})
+	require.NoError(t, err)
+	assert.Empty(t, uploads.LocalPath, "Podcasts without a path use their data folder")
+	assert.DirExists(t, filepath.Join(dataDir, "Uploads"))
+
+	tests := []struct {
+		name    string
+		podcast LocalPodcast
+		want    error
+	}{
+		{"no_title_or_folder", LocalPodcast{}, ErrInvalidLocalPodcast},
+		{"missing_folder", LocalPodcast{Path: "Missing"}, ErrInvalidLocalPodcast},
+		{"outside_data_directory", LocalPodcast{Path: filepath.Join(localDir, "Meetings")}, ErrInvalidLocalPodcast},
+		{"escaping_data_directory", LocalPodcast{Path: "../" + filepath.Base(dataDir)}, ErrInvalidLocalPodcast},
+		{"whole_data_directory", LocalPodcast{Title: "All", Path: dataDir}, ErrInvalidLocalPodcast},
+		{"folder_of_local_podcast", LocalPodcast{Title: "Again", Path: "Recordings"}, ErrPodcastFolderInUse},
+		{"folder_of_feed_podcast", LocalPodcast{Title: "Feed Show"}, ErrPodcastFolderInUse},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := AddLocalPodcast(&tt.podcast)
+			assert.ErrorIs(t, err, tt.want)
+		})
+	}
+
+	t.Setenv("LOCAL_DIR", localDir)
+	meetings, err := AddLocalPodcast(&LocalPodcast{Path: "Meetings"})
+	require.NoError(t, err, "Relative paths should be found in the local directory")
+	assert.Equal(t, "Meetings", meetings.Title)
+}
+
+// TestScanLocalPodcast tests reading episodes from the tags and names of the
+// files in a local podcast's folder.
+func TestScanLocalPodcast(t *testing.T) {
+	useTestDataDir(t)
+	dir := filepath.Join(config.Get().DataDir, "Recordings")
+	tagged := filepath.Join(dir, "episode1.mp3")
+	writeLocalFile(t, tagged, id3File(map[string]string{
+		"TIT2": "All hands", "TPE1": "Team", "TDRC": "2024-05-02", "TLEN": "90000",
+	}, pngPicture))
+	writeLocalFile(t, filepath.Join(dir, "2024-03-15 Team sync.mp3"), []byte("untagged audio"))
+	writeLocalFile(t, filepath.Join(dir, "archive", "Old_talk.m4a"), []byte("audio"))
+	writeLocalFile(t, filepath.Join(dir, ".incomplete.mp3"), []byte("audio"))
+	writeLocalFile(t, filepath.Join(dir, "notes.txt"), []byte("notes"))
+
+	created, err := AddLocalPodcast(&LocalPodcast{Path: dir})
+	require.NoError(t, err)
+	podcast := &created
+	scan := func() map[string]db.PodcastItem {
+		t.Helper()
+		require.NoError(t, AddPodcastItems(context.Background(), podcast, false))
+		var items []db.PodcastItem
+		require.NoError(t, db.GetAllPodcastItemsByPodcastID(podcast.ID, &items))
+		byGUID := make(map[string]db.PodcastItem, len(items))
+		for i := range items {
+			byGUID[items[i].GUID] = items[i]
+		}
+		return byGUID
+	}
+
+	items := scan()
+	require.Len(t, items, 3, "Hidden files and other files should be skipped")
+	episode := items["episode1.mp3"]
+	assert.Equal(t, "All hands", episode.Title)
+	assert.Equal(t, time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC), episode.PubDate.UTC())
+	assert.Equal(t, 90, episode.Duration)
+	assert.Equal(t, db.Downloaded, episode.DownloadStatus)
+	assert.Equal(t, filepath.Join(podcast.LocalPath, "episode1.mp3"), episode.DownloadPath)
+	assert.True(t, strings.HasPrefix(episode.FileURL, "file:///"), "Enclosures should be file URLs")
+	assert.FileExists(t, episode.LocalImage, "Embedded pictures should be the episode's image")
+	assert.Equal(t, "Team sync", items["2024-03-15 Team sync.mp3"].Title, "Titles should fall back to the file name")
+	assert.Equal(t, time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC), items["2024-03-15 Team sync.mp3"].PubDate.UTC())
+	assert.Equal(t, "Old talk", items["archive/Old_talk.m4a"].Title)
+
+	require.NoError(t, db.GetPodcastByID(podcast.ID, podcast))
+	assert.Equal(t, "Team", podcast.Author, "The author should come from the tags")
+	assert.Equal(t, "/podcasts/"+podcast.ID+"/image", podcast.Image)
+	assert.NotEmpty(t, LocalPodcastArtwork(podcast), "The first embedded picture should be the artwork")
+
+	require.NoError(t, os.Remove(tagged))
+	removed := scan()["episode1.mp3"]
+	assert.NotNil(t, removed.RemovedUpstreamAt, "Episodes of removed files should be flagged")
+	assert.Equal(t, db.Deleted, removed.DownloadStatus)
+
+	writeLocalFile(t, tagged, id3File(map[string]string{"TIT2": "All hands (edited)"}, nil))
+	restored := scan()["episode1.mp3"]
+	assert.Nil(t, restored.RemovedUpstreamAt, "Returned files should be restored")
+	assert.Equal(t, db.Downloaded, restored.DownloadStatus)
+	assert.Equal(t, "All hands (edited)", restored.Title, "Changed files should be read again")
+	assert.Equal(t, removed.ID, restored.ID)
+}
+
+// TestScanLocalPodcasts_CountsChanges tests that the scan job reports the
+// episodes it added, changed or removed, so idle scans are not recorded.
+func TestScanLocalPodcasts_CountsChanges(t *testing.T) {
+	useTestDataDir(t)
+	dir := filepath.Join(config.Get().DataDir, "Recordings")
+	first := filepath.Join(dir, "first.mp3")
+	writeLocalFile(t, first, []byte("audio"))
+	writeLocalFile(t, filepath.Join(dir, "second.mp3"), []byte("audio"))
+	_, err := AddLocalPodcast(&LocalPodcast{Path: dir})
+	require.NoError(t, err)
+
+	changed, err := scanLocalPodcasts(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 2, changed, "New files should be counted")
+
+	changed, err = scanLocalPodcasts(context.Background())
+	require.NoError(t, err)
+	assert.Zero(t, changed, "Unchanged files should not be counted")
+
+	writeLocalFile(t, first, []byte("longer audio"))
+	require.NoError(t, os.Remove(filepath.Join(dir, "second.mp3")))
+	changed, err = scanLocalPodcasts(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 2, changed, "Changed and removed files should be counted")
+}
+
+// TestFileNameDateOf tests finding dates in file names.
+func TestFileNameDateOf(t *testing.T) {
+	tests := []struct {
+		name     string
+		wantDate time.Time
+		wantRest string
+	}{
+		{"2024-03-15 Team sync", time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC), "Team sync"},
+		{"standup_20240102", time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), "standup"},
+		{"2024-03-15", time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC), "2024-03-15"},
+		{"episode 12", time.Time{}, "episode 12"},
+		{"take 2024-13-45", time.Time{}, "take 2024-13-45"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			date, rest := fileNameDateOf(tt.name)
+			assert.Equal(t, tt.wantDate, date)
+			assert.Equal(t, tt.wantRest, rest)
+		})
+	}
+}
+
+// TestSaveLocalEpisode tests storing uploaded files in a local podcast's
+// folder.
+func TestSaveLocalEpisode(t *testing.T) {
+	useTestDataDir(t)
+	feed := db.CreateTestPodcast(t, db.DB)
+	podcast, err := AddLocalPodcast(&LocalPodcast{Title: "Uploads"})
+	require.NoError(t, err)
+
+	_, err = SaveLocalEpisode(feed.ID, "talk.mp3", strings.NewReader("audio"))
+	assert.ErrorIs(t, err, ErrNotLocalPodcast)
+	for _, name := range []string{"notes.txt", ".hidden.mp3", ""} {
+		_, err = SaveLocalEpisode(podcast.ID, name, strings.NewReader("audio"))
+		assert.ErrorIs(t, err, ErrInvalidLocalPodcast, name)
+	}
+
+	first, err := SaveLocalEpisode(podcast.ID, "../talk.mp3", strings.NewReader("first"))
+	require.NoError(t, err)
+	second, err := SaveLocalEpisode(podcast.ID, "talk.mp3", strings.NewReader("second"))
+	require.NoError(t, err)
+	dir := filepath.Join(config.Get().DataDir, "Uploads")
+	assert.Equal(t, filepath.Join(dir, "talk.mp3"), first, "Names should not leave the folder")
+	assert.Equal(t, filepath.Join(dir, "talk-2.mp3"), second, "Existing files should be kept")
+	content, err := os.ReadFile(second)
+	require.NoError(t, err)
+	assert.Equal(t, "second", string(content))
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 2, "Partial uploads should be cleaned up")
+}
+
+// TestDeletePodcast_LocalFolder tests that deleting a podcast made from a
+// folder outside its data folder leaves the folder's files in place.
+func TestDeletePodcast_LocalFolder(t *testing.T) {
+	useTestDataDir(t)
+	dir := filepath.Join(config.Get().DataDir, "Recordings")
+	file := filepath.Join(dir, "talk.mp3")
+	writeLocalFile(t, file, []byte("audio"))
+	podcast, err := AddLocalPodcast(&LocalPodcast{Path: dir})
+	require.NoError(t, err)
+	require.NoError(t, AddPodcastItems(context.Background(), &podcast, true))
+
+	require.NoError(t, DeletePodcast(podcast.ID, true))
+	assert.FileExists(t, file)
+	var deleted db.Podcast
+	assert.Error(t, db.GetPodcastByID(podcast.ID, &deleted))
+}
+
+// TestDeleteFiles_LocalPodcast tests that deleting the files of episodes
+// leaves the files of local podcasts, which are their episodes, in place.
+func TestDeleteFiles_LocalPodcast(t *testing.T) {
+	useTestDataDir(t)
+	dir := filepath.Join(config.Get().DataDir, "Recordings")
+	file := filepath.Join(dir, "talk.mp3")
+	writeLocalFile(t, file, []byte("audio"))
+	podcast, err := AddLocalPodcast(&LocalPodcast{Path: dir})
+	require.NoError(t, err)
+	require.NoError(t, AddPodcastItems(context.Background(), &podcast, true))
+	var items []db.PodcastItem
+	require.NoError(t, db.GetAllPodcastItemsByPodcastID(podcast.ID, &items))
+	require.Len(t, items, 1)
+
+	assert.ErrorIs(t, DeleteEpisodeFile(items[0].ID), ErrLocalPodcast)
+	assert.ErrorIs(t, DeletePodcastEpisodes(podcast.ID), ErrLocalPodcast)
+	result, err := RunBulkAction(&BulkRequest{Action: BulkDeleteFile, IDs: []string{items[0].ID}})
+	require.NoError(t, err)
+	assert.Zero(t, result.Changed)
+	require.Len(t, result.Failed, 1)
+	assert.Equal(t, items[0].ID, result.Failed[0].ID)
+
+	assert.FileExists(t, file)
+	var item db.PodcastItem
+	require.NoError(t, db.GetPodcastItemByID(items[0].ID, &item))
+	assert.Equal(t, db.Downloaded, item.DownloadStatus, "The episode should stay available")
+}
+
+// TestMovePodcastFolder_LocalPodcast tests that moving the data folder a
+// local podcast is made from keeps its episodes.
+func TestMovePodcastFolder_LocalPodcast(t *testing.T) {
+	useTestDataDir(t)
+	dir := filepath.Join(config.Get().DataDir, "Recordings")
+	writeLocalFile(t, filepath.Join(dir, "talk.mp3"), []byte("audio"))
+	podcast, err := AddLocalPodcast(&LocalPodcast{Path: dir})
+	require.NoError(t, err)
+	require.NoError(t, AddPodcastItems(context.Background(), &podcast, true))
+
+	require.NoError(t, UpdatePodcastOverrides(podcast.ID, &PodcastOverrides{Folder: ptr("Talks")}))
+
+	var moved db.Podcast
+	require.NoError(t, db.GetPodcastByID(podcast.ID, &moved))
+	newDir := filepath.Join(config.Get().DataDir, "Talks")
+	assert.Equal(t, newDir, moved.LocalPath, "The podcast should be scanned in its new folder")
+	require.NoError(t, AddPodcastItems(context.Background(), &moved, true))
+	var items []db.PodcastItem
+	require.NoError(t, db.GetAllPodcastItemsByPodcastID(podcast.ID, &items))
+	require.Len(t, items, 1)
+	assert.Equal(t, filepath.Join(newDir, "talk.mp3"), items[0].DownloadPath)
+	assert.Equal(t, db.Downloaded, items[0].DownloadStatus, "The episode should not be marked removed")
+}
@@ -0,0 +1,526 @@
+package service
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/akhilrex/podgrab/db"
+	"github.com/akhilrex/podgrab/internal/logger"
+	"github.com/akhilrex/podgrab/internal/secrets"
+)
+
+// Notification events.
+const (
+	EventNewEpisode       = "new_episode"
+	EventDownloadComplete = "download_complete"
+	EventDownloadFailed   = "download_failed"
+	EventFeedDead         = "feed_dead"
+	EventTest             = "test"
+)
+
+// Notification target kinds.
+const (
+	TargetWebhook = "webhook"
+	TargetNtfy    = "ntfy"
+	TargetGotify  = "gotify"
+	TargetSMTP    = "smtp"
+	TargetApprise = "apprise"
+)
+
+// maxDeliveryAttempts is how many times a notification is tried before it is marked failed.
+const maxDeliveryAttempts = 5
+
+const defaultFailureThreshold = 3
+
+// NotificationEvents lists the events a target can subscribe to.
+var NotificationEvents = []string{EventNewEpisode, EventDownloadComplete, EventDownloadFailed, EventFeedDead}
+
+// NotificationTargetKinds lists the supported target kinds.
+var NotificationTargetKinds = []string{TargetWebhook, TargetNtfy, TargetGotify, TargetSMTP, TargetApprise}
+
+// Notification is a single event to be sent to every matching target.
+type Notification struct {
+	Time         time.Time `json:"time"`
+	Event        string    `json:"event"`
+	Title        string    `json:"title"`
+	Message      string    `json:"message"`
+	PodcastID    string    `json:"podcastId,omitempty"`
+	PodcastTitle string    `json:"podcastTitle,omitempty"`
+	EpisodeID    string    `json:"episodeId,omitempty"`
+	EpisodeTitle string    `json:"episodeTitle,omitempty"`
+	// Count is the consecutive failure count for download_failed and feed_dead.
+	Count int `json:"count,omitempty"`
+}
+
+var (
+	notificationClient = &http.Client{Timeout: 15 * time.Second}
+	pendingDeliveries  sync.WaitGroup
+	// smtpTimeout bounds connecting to an SMTP server and the whole
+	// conversation, so a stalled server cannot hold up deliveries.
+	smtpTimeout = 30 * time.Second
+)
+
+// Notify records a delivery for every enabled target subscribed to the
+// notification and sends them in the background.
+func Notify(notification *Notification) {
+	if db.DB == nil {
+		return
+	}
+	if notification.Time.IsZero() {
+		notification.Time = time.Now()
+	}
+	targets, err := db.GetEnabledNotificationTargets()
+	if err != nil {
+		logger.Log.Errorw("loading notification targets", "error", err)
+		return
+	}
+
+	var tagIDs []string
+	tagsLoaded := false
+	for i := range *targets {
+		target := (*targets)[i]
+		if target.TagIDs != "" && !tagsLoaded && notification.PodcastID != "" {
+			tagsLoaded = true
+			if tagIDs, err = db.GetTagIDsForPodcast(notification.PodcastID); err != nil {
+				logger.Log.Errorw("loading podcast tags", "error", err)
+			}
+		}
+		if !targetMatches(&target, notification, tagIDs) {
+			continue
+		}
+		if subjectID := alertSubject(notification); subjectID != "" {
+			sent, err := db.MarkNotificationAlertSent(target.ID, notification.Event, subjectID)
+			if err != nil {
+				logger.Log.Errorw("recording notification alert", "error", err)
+				continue
+			}
+			if !sent {
+				continue
+			}
+		}
+		delivery, err := newDelivery(&target, notification)
+		if err != nil {
+			logger.Log.Errorw("recording notification delivery", "error", err)
+			continue
+		}
+		// Deliveries not started before shutdown stay pending and are retried
+		// after the next start.
+		if !startWork(&pendingDeliveries) {
+			continue
+		}
+		go func() {
+			defer pendingDeliveries.Done()
+			attemptDelivery(delivery)
+		}()
+	}
+}
+
+// targetMatches reports whether target is subscribed to notification.
+func targetMatches(target *db.NotificationTarget, notification *Notification, podcastTagIDs []string) bool {
+	if !containsValue(target.Events, notification.Event) {
+		return false
+	}
+	if target.PodcastIDs != "" || target.TagIDs != "" {
+		matched := notification.PodcastID != "" && containsValue(target.PodcastIDs, notification.PodcastID)
+		for _, tagID := range podcastTagIDs {
+			matched = matched || containsValue(target.TagIDs, tagID)
+		}
+		if !matched {
+			return false
+		}
+	}
+	if notification.Event == EventDownloadFailed || notification.Event == EventFeedDead {
+		threshold := target.FailureThreshold
+		if threshold <= 0 {
+			threshold = defaultFailureThreshold
+		}
+		return notification.Count >= threshold
+	}
+	return true
+}
+
+// alertSubject returns the podcast or episode a failure alert is about, which
+// is alerted once per run of failures, or "" for other notifications.
+func alertSubject(notification *Notification) string {
+	switch notification.Event {
+	case EventFeedDead:
+		return notification.PodcastID
+	case EventDownloadFailed:
+		return notification.EpisodeID
+	default:
+		return ""
+	}
+}
+
+// clearFailureAlerts lets the next run of failures of subjectID be alerted
+// again once the current one has ended.
+func clearFailureAlerts(event, subjectID string) {
+	if err := db.ClearNotificationAlerts(event, subjectID); err != nil {
+		logger.Log.Errorw("clearing notification alerts", "error", err)
+	}
+}
+
+func containsValue(list, value string) bool {
+	for _, item := range strings.Split(list, ",") {
+		if strings.TrimSpace(item) == value {
+			return true
+		}
+	}
+	return false
+}
+
+func newDelivery(target *db.NotificationTarget, notification *Notification) (*db.NotificationDelivery, error) {
+	payload, err := json.Marshal(notification)
+	if err != nil {
+		return nil, err
+	}
+	delivery := db.NotificationDelivery{
+		NotificationTargetID: target.ID,
+		NotificationTarget:   *target,
+		Event:                notification.Event,
+		Title:                notification.Title,
+		Message:              notification.Message,
+		Payload:              string(payload),
+		Status:               db.DeliveryPending,
+		// The first attempt is made right away by the caller. The retry job
+		// only picks the delivery up if that attempt never completes.
+		NextAttemptAt: time.Now().Add(time.Minute),
+	}
+	if err := db.CreateNotificationDelivery(&delivery); err != nil {
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+// attemptDelivery sends a delivery once and schedules a retry with
+// exponential backoff when it fails.
+func attemptDelivery(delivery *db.NotificationDelivery) {
+	delivery.Attempts++
+	target, err := openNotificationTarget(&delivery.NotificationTarget)
+	if err == nil {
+		err = sendNotification(&target, delivery)
+	}
+	if err == nil {
+		now := time.Now()
+		delivery.Status = db.DeliveryDelivered
+		delivery.DeliveredAt = &now
+		delivery.LastError = ""
+	} else {
+		logger.Log.Warnw("Notification delivery failed",
+			"target", delivery.NotificationTarget.Name, "event", delivery.Event, "attempt", delivery.Attempts, "error", err)
+		delivery.LastError = err.Error()
+		// Secrets that cannot be decrypted will not decrypt on a retry either.
+		if delivery.Attempts >= maxDeliveryAttempts || errors.Is(err, secrets.ErrDecrypt) {
+			delivery.Status = db.DeliveryFailed
+		} else {
+			delivery.NextAttemptAt = time.Now().Add(time.Minute << (delivery.Attempts - 1))
+		}
+	}
+	if updateErr := db.UpdateNotificationDelivery(delivery); updateErr != nil {
+		logger.Log.Errorw("updating notification delivery", "error", updateErr)
+	}
+}
+
+// RetryNotifications resends pending deliveries whose retry is due.
+func RetryNotifications() error {
+	_, err := retryNotifications()
+	return err
+}
+
+// retryNotifications resends the deliveries due and returns how many there were.
+func retryNotifications() (int, error) {
+	if db.DB == nil {
+		return 0, nil
+	}
+	deliveries, err := db.GetNotificationDeliveriesDue(time.Now())
+	if err != nil {
+		return 0, err
+	}
+	for i := range *deliveries {
+		delivery := &(*deliveries)[i]
+		if !delivery.NotificationTarget.Enabled {
+			delivery.Status = db.DeliveryFailed
+			delivery.LastError = "target disabled"
+			if updateErr := db.UpdateNotificationDelivery(delivery); updateErr != nil {
+				logger.Log.Errorw("updating notification delivery", "error", updateErr)
+			}
+			continue
+		}
+		attemptDelivery(delivery)
+	}
+	return len(*deliveries), nil
+}
+
+// SendTestNotification sends a test notification to a target synchronously.
+func SendTestNotification(targetID string) (*db.NotificationDelivery, error) {
+	var target db.NotificationTarget
+	if err := db.GetNotificationTargetByID(targetID, &target); err != nil {
+		return nil, err
+	}
+	delivery, err := newDelivery(&target, &Notification{
+		Event:   EventTest,
+		Title:   "Podgrab test notification",
+		Message: fmt.Sprintf("Notifications to %s are working.", target.Name),
+		Time:    time.Now(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	attemptDelivery(delivery)
+	return delivery, nil
+}
+
+// SealNotificationSecret encrypts a notification target token or password for
+// storage. An empty value stays empty.
+func SealNotificationSecret(value string) (string, error) {
+	return secrets.Encrypt(value)
+}
+
+// openNotificationTarget returns a copy of target with its token and password
+// decrypted for sending.
+func openNotificationTarget(target *db.NotificationTarget) (db.NotificationTarget, error) {
+	opened := *target
+	var err error
+	if opened.Token, err = secrets.Decrypt(target.Token); err != nil {
+		return opened, fmt.Errorf("decrypting token: %w", err)
+	}
+	if opened.Password, err = secrets.Decrypt(target.Password); err != nil {
+		return opened, fmt.Errorf("decrypting password: %w", err)
+	}
+	return opened, nil
+}
+
+// EncryptNotificationSecrets encrypts the tokens and passwords of notification
+// targets stored before they were encrypted.
+func EncryptNotificationSecrets() error {
+	targets, err := db.GetAllNotificationTargets()
+	if err != nil {
+		return err
+	}
+	for i := range *targets {
+		target := &(*targets)[i]
+		changed := false
+		for _, value := range []*string{&target.Token, &target.Password} {
+			if *value == "" || secrets.IsSealed(*value) {
+				continue
+			}
+			if *value, err = secrets.Encrypt(*value); err != nil {
+				return err
+			}
+			changed = true
+		}
+		if !changed {
+			continue
+		}
+		if err := db.UpdateNotificationTarget(target); err != nil {
+			logger.Log.Errorw("encrypting notification target secrets", "target", target.Name, "error", err)
+			continue
+		}
+		logger.Log.Infow("Encrypted notification target secrets", "target", target.Name)
+	}
+	return nil
+}
+
+// ValidateNotificationTarget checks a target's kind, events and required fields.
+func ValidateNotificationTarget(target *db.NotificationTarget) error {
+	var problems []string
+	if strings.TrimSpace(target.Name) == "" {
+		problems = append(problems, "name is required")
+	}
+	switch target.Kind {
+	case TargetWebhook, TargetNtfy, TargetGotify, TargetApprise:
+		if parsed, err := url.Parse(target.URL); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+			problems = append(problems, "url must be an http or https URL")
+		}
+		if target.Kind == TargetGotify && target.Token == "" {
+			problems = append(problems, "token is required for gotify")
+		}
+	case TargetSMTP:
+		if _, _, err := net.SplitHostPort(target.URL); err != nil {
+			problems = append(problems, "url must be the SMTP server as host:port")
+		}
+		if target.From == "" || target.To == "" {
+			problems = append(problems, "from and to are required for smtp")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("kind must be one of %s", strings.Join(NotificationTargetKinds, ", ")))
+	}
+	if target.Events == "" {
+		problems = append(problems, "at least one event is required")
+	}
+	for _, event := range strings.Split(target.Events, ",") {
+		event = strings.TrimSpace(event)
+		if event != "" && !containsValue(strings.Join(NotificationEvents, ","), event) {
+			problems = append(problems, fmt.Sprintf("unknown event %q", event))
+		}
+	}
+	if target.FailureThreshold < 0 {
+		problems = append(problems, "failureThreshold must not be negative")
+	}
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+func sendNotification(target *db.NotificationTarget, delivery *db.NotificationDelivery) error {
+	switch target.Kind {
+	case TargetWebhook:
+		return postNotification(target.URL, "application/json", []byte(delivery.Payload), nil)
+	case TargetNtfy:
+		headers := map[string]string{"Title": headerSafe(delivery.Title), "Tags": delivery.Event}
+		if delivery.Event == EventDownloadFailed || delivery.Event == EventFeedDead {
+			headers["Priority"] = "high"
+		}
+		if target.Token != "" {
+			headers["Authorization"] = "Bearer " + target.Token
+		}
+		return postNotification(target.URL, "text/plain", []byte(delivery.Message), headers)
+	case TargetGotify:
+		body, err := json.Marshal(map[string]interface{}{
+			"title":    delivery.Title,
+			"message":  delivery.Message,
+			"priority": notificationPriority(delivery.Event),
+		})
+		if err != nil {
+			return err
+		}
+		endpoint := strings.TrimRight(target.URL, "/") + "/message"
+		return postNotification(endpoint, "application/json", body, map[string]string{"X-Gotify-Key": target.Token})
+	case TargetApprise:
+		request := map[string]string{
+			"title": delivery.Title,
+			"body":  delivery.Message,
+			"type":  "info",
+		}
+		if delivery.Event == EventDownloadFailed || delivery.Event == EventFeedDead {
+			request["type"] = "failure"
+		}
+		if target.Token != "" {
+			request["urls"] = target.Token
+		}
+		body, err := json.Marshal(request)
+		if err != nil {
+			return err
+		}
+		return postNotification(target.URL, "application/json", body, nil)
+	case TargetSMTP:
+		return sendMail(target, delivery)
+	default:
+		return fmt.Errorf("unknown notification target kind %q", target.Kind)
+	}
+}
+
+func notificationPriority(event string) int {
+	if event == EventDownloadFailed || event == EventFeedDead {
+		return 8
+	}
+	return 5
+}
+
+func postNotification(endpoint, contentType string, body []byte, headers map[string]string) error {
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("User-Agent", "Podgrab")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := notificationClient.Do(req) //nolint:gosec // G107: URL is configured by the operator
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := resp.Body.Close(); closeErr != nil {
+			logger.Log.Errorw("closing notification response body", "error", closeErr)
+		}
+	}()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512)) //nolint:errcheck // best effort error detail
+		return fmt.Errorf("HTTP error: %s %s", resp.Status, strings.TrimSpace(string(detail)))
+	}
+	return nil
+}
+
+func sendMail(target *db.NotificationTarget, delivery *db.NotificationDelivery) error {
+	host, _, err := net.SplitHostPort(target.URL)
+	if err != nil {
+		return err
+	}
+	var auth smtp.Auth
+	if target.Username != "" {
+		auth = smtp.PlainAuth("", target.Username, target.Password, host)
+	}
+	recipients := strings.Split(target.To, ",")
+	for i := range recipients {
+		recipients[i] = strings.TrimSpace(recipients[i])
+	}
+	message := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nDate: %s\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n%s\r\n",
+		target.From, strings.Join(recipients, ", "), headerSafe(delivery.Title), time.Now().Format(time.RFC1123Z), delivery.Message)
+
+	// Like smtp.SendMail, which has no timeouts.
+	conn, err := net.DialTimeout("tcp", target.URL, smtpTimeout)
+	if err != nil {
+		return err
+	}
+	if err := conn.SetDeadline(time.Now().Add(smtpTimeout)); err != nil {
+		_ = conn.Close() //nolint:errcheck // already failing
+		return err
+	}
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		_ = conn.Close() //nolint:errcheck // already failing
+		return err
+	}
+	defer func() {
+		_ = client.Close() //nolint:errcheck // closed by Quit on success
+	}()
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: host, MinVersion: tls.VersionTLS12}); err != nil {
+			return err
+		}
+	}
+	if auth != nil {
+		if err := client.Auth(auth); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(target.From); err != nil {
+		return err
+	}
+	for _, recipient := range recipients {
+		if err := client.Rcpt(recipient); err != nil {
+			return err
+		}
+	}
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := writer.Write([]byte(message)); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// headerSafe strips line breaks so feed-provided text cannot add mail or HTTP
+// headers, or make the request invalid.
+func headerSafe(value string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(value)
+}
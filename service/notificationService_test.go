@@ -0,0 +1,526 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/akhilrex/podgrab/db"
+	testhelpers "github.com/akhilrex/podgrab/internal/testing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// receivedRequest is a request captured by a notification stand-in server.
+type receivedRequest struct {
+	Header http.Header
+	Path   string
+	Body   string
+}
+
+// newNotificationServer starts a stand-in HTTP notification receiver.
+func newNotificationServer(t *testing.T, status int) (server *httptest.Server, received func() []receivedRequest) {
+	t.Helper()
+	var mu sync.Mutex
+	var requests []receivedRequest
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body) //nolint:errcheck // Test server
+		mu.Lock()
+		requests = append(requests, receivedRequest{Path: r.URL.Path, Header: r.Header.Clone(), Body: string(body)})
+		mu.Unlock()
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+	return server, func() []receivedRequest {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]receivedRequest(nil), requests...)
+	}
+}
+
+func createTarget(t *testing.T, target *db.NotificationTarget) *db.NotificationTarget {
+	t.Helper()
+	target.Enabled = true
+	require.NoError(t, db.CreateNotificationTarget(target))
+	return target
+}
+
+func useTestDB(t *testing.T) {
+	t.Helper()
+	database := testhelpers.SetupTestDB(t)
+	originalDB := db.DB
+	db.DB = database
+	t.Cleanup(func() {
+		pendingDeliveries.Wait()
+		db.DB = originalDB
+		testhelpers.TeardownTestDB(t, database)
+	})
+}
+
+// TestTargetMatches tests event, podcast, tag and threshold filtering.
+func TestTargetMatches(t *testing.T) {
+	tests := []struct {
+		name         string
+		target       db.NotificationTarget
+		notification Notification
+		tagIDs       []string
+		want         bool
+	}{
+		{
+			name:         "subscribed_event",
+			target:       db.NotificationTarget{Events: "new_episode,download_complete"},
+			notification: Notification{Event: EventDownloadComplete},
+			want:         true,
+		},
+		{
+			name:         "other_event",
+			target:       db.NotificationTarget{Events: "new_episode"},
+			notification: Notification{Event: EventDownloadComplete},
+			want:         false,
+		},
+		{
+			name:         "podcast_filter_match",
+			target:       db.NotificationTarget{Events: "new_episode", PodcastIDs: "a,b"},
+			notification: Notification{Event: EventNewEpisode, PodcastID: "b"},
+			want:         true,
+		},
+		{
+			name:         "podcast_filter_miss",
+			target:       db.NotificationTarget{Events: "new_episode", PodcastIDs: "a"},
+			notification: Notification{Event: EventNewEpisode, PodcastID: "b"},
+			want:         false,
+		},
+		{
+			name:         "tag_filter_match",
+			target:       db.NotificationTarget{Events: "new_episode", TagIDs: "news"},
+			notification: Notification{Event: EventNewEpisode, PodcastID: "b"},
+			tagIDs:       []string{"comedy", "news"},
+			want:         true,
+		},
+		{
+			name:         "below_threshold",
+			target:       db.NotificationTarget{Events: "download_failed", FailureThreshold: 3},
+			notification: Notification{Event: EventDownloadFailed, Count: 2},
+			want:         false,
+		},
+		{
+			name:         "at_threshold",
+			target:       db.NotificationTarget{Events: "download_failed", FailureThreshold: 3},
+			notification: Notification{Event: EventDownloadFailed, Count: 3},
+			want:         true,
+		},
+		{
+			name:         "past_threshold",
+			target:       db.NotificationTarget{Events: "feed_dead"},
+			notification: Notification{Event: EventFeedDead, Count: defaultFailureThreshold + 1},
+			want:         true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, targetMatches(&tt.target, &tt.notification, tt.tagIDs))
+		})
+	}
+}
+
+// TestNotify_Webhook tests delivering a notification to a webhook and logging it.
+func TestNotify_Webhook(t *testing.T) {
+	useTestDB(t)
+	server, received := newNotificationServer(t, http.StatusOK)
+	target := createTarget(t, &db.NotificationTarget{Name: "hook", Kind: TargetWebhook, URL: server.URL, Events: EventNewEpisode})
+	createTarget(t, &db.NotificationTarget{Name: "other", Kind: TargetWebhook, URL: server.URL, Events: EventFeedDead})
+
+	Notify(&Notification{Event: EventNewEpisode, Title: "New episode", EpisodeTitle: "Episode 1"})
+	pendingDeliveries.Wait()
+
+	requests := received()
+	require.Len(t, requests, 1, "Only the subscribed target should be called")
+	var payload Notification
+	require.NoError(t, json.Unmarshal([]byte(requests[0].Body), &payload))
+	assert.Equal(t, EventNewEpisode, payload.Event)
+	assert.Equal(t, "Episode 1", payload.EpisodeTitle)
+
+	var deliveries []db.NotificationDelivery
+	var total int64
+	require.NoError(t, db.GetPaginatedNotificationDeliveries(1, 10, &deliveries, &total))
+	require.Len(t, deliveries, 1)
+	assert.Equal(t, target.ID, deliveries[0].NotificationTargetID)
+	assert.Equal(t, db.DeliveryDelivered, deliveries[0].Status)
+	assert.Equal(t, 1, deliveries[0].Attempts)
+	assert.NotNil(t, deliveries[0].DeliveredAt)
+}
+
+// TestNotify_FailureAlertedOnce tests that a failure alert is sent once the
+// threshold is reached and again only after the failures have stopped.
+func TestNotify_FailureAlertedOnce(t *testing.T) {
+	useTestDB(t)
+	server, received := newNotificationServer(t, http.StatusOK)
+	createTarget(t, &db.NotificationTarget{Name: "hook", Kind: TargetWebhook, URL: server.URL, Events: EventFeedDead})
+
+	for count := 1; count <= defaultFailureThreshold+2; count++ {
+		Notify(&Notification{Event: EventFeedDead, PodcastID: "podcast", Count: count})
+	}
+	pendingDeliveries.Wait()
+	assert.Len(t, received(), 1, "Failure run should be alerted once")
+
+	clearFailureAlerts(EventFeedDead, "podcast")
+	Notify(&Notification{Event: EventFeedDead, PodcastID: "podcast", Count: defaultFailureThreshold + 1})
+	pendingDeliveries.Wait()
+	assert.Len(t, received(), 2, "New failure run should be alerted again")
+}
+
+// TestNotify_RetriesFailedDelivery tests that failed deliveries are retried with backoff.
+func TestNotify_RetriesFailedDelivery(t *testing.T) {
+	useTestDB(t)
+	failing := true
+	var mu sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if failing {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+	createTarget(t, &db.NotificationTarget{Name: "hook", Kind: TargetWebhook, URL: server.URL, Events: EventDownloadComplete})
+
+	Notify(&Notification{Event: EventDownloadComplete, Title: "Downloaded"})
+	pendingDeliveries.Wait()
+
+	var deliveries []db.NotificationDelivery
+	var total int64
+	require.NoError(t, db.GetPaginatedNotificationDeliveries(1, 10, &deliveries, &total))
+	require.Len(t, deliveries, 1)
+	delivery := deliveries[0]
+	assert.Equal(t, db.DeliveryPending, delivery.Status, "Should wait for a retry")
+	assert.Contains(t, delivery.LastError, "503")
+	assert.True(t, delivery.NextAttemptAt.After(time.Now()), "Retry should be scheduled with backoff")
+
+	require.NoError(t, RetryNotifications())
+	require.NoError(t, db.GetPaginatedNotificationDeliveries(1, 10, &deliveries, &total))
+	assert.Equal(t, 1, deliveries[0].Attempts, "Retry should wait for its backoff")
+
+	mu.Lock()
+	failing = false
+	mu.Unlock()
+	delivery.NextAttemptAt = time.Now().Add(-time.Second)
+	require.NoError(t, db.UpdateNotificationDelivery(&delivery))
+	require.NoError(t, RetryNotifications())
+
+	require.NoError(t, db.GetPaginatedNotificationDeliveries(1, 10, &deliveries, &total))
+	assert.Equal(t, db.DeliveryDelivered, deliveries[0].Status)
+	assert.Equal(t, 2, deliveries[0].Attempts)
+	assert.Empty(t, deliveries[0].LastError)
+}
+
+// TestAttemptDelivery_GivesUp tests that a delivery is marked failed after the last attempt.
+func TestAttemptDelivery_GivesUp(t *testing.T) {
+	useTestDB(t)
+	server, _ := newNotificationServer(t, http.StatusInternalServerError)
+	target := createTarget(t, &db.NotificationTarget{Name: "hook", Kind: TargetWebhook, URL: server.URL, Events: EventDownloadComplete})
+
+	delivery, err := newDelivery(target, &Notification{Event: EventDownloadComplete})
+	require.NoError(t, err)
+	delivery.Attempts = maxDeliveryAttempts - 1
+	attemptDelivery(delivery)
+	assert.Equal(t, db.DeliveryFailed, delivery.Status)
+}
+
+// TestAttemptDelivery_SealedSecrets tests that stored secrets are decrypted
+// for sending and that a secret that cannot be decrypted fails the delivery.
+func TestAttemptDelivery_SealedSecrets(t *testing.T) {
+	useTestDB(t)
+	testhelpers.UseTestSecretKey(t)
+	server, received := newNotificationServer(t, http.StatusOK)
+	token, err := SealNotificationSecret("tk")
+	require.NoError(t, err)
+	target := createTarget(t, &db.NotificationTarget{Name: "ntfy", Kind: TargetNtfy, URL: server.URL, Token: token, Events: EventDownloadComplete})
+
+	delivery, err := newDelivery(target, &Notification{Event: EventDownloadComplete})
+	require.NoError(t, err)
+	attemptDelivery(delivery)
+	assert.Equal(t, db.DeliveryDelivered, delivery.Status)
+	assert.Equal(t, "Bearer tk", received()[0].Header.Get("Authorization"))
+
+	target.Token = "v1:not-a-sealed-value"
+	require.NoError(t, db.UpdateNotificationTarget(target))
+	delivery, err = newDelivery(target, &Notification{Event: EventDownloadComplete})
+	require.NoError(t, err)
+	attemptDelivery(delivery)
+	assert.Equal(t, db.DeliveryFailed, delivery.Status, "Retrying cannot decrypt the token")
+	assert.Contains(t, delivery.LastError, "decrypting token")
+	assert.Len(t, received(), 1, "The target should not be called")
+}
+
+// TestEncryptNotificationSecrets tests encrypting the secrets of targets
+// stored before they were encrypted.
+func TestEncryptNotificationSecrets(t *testing.T) {
+	useTestDB(t)
+	testhelpers.UseTestSecretKey(t)
+	plain := createTarget(t, &db.NotificationTarget{Name: "smtp", Kind: TargetSMTP, Password: "hunter2"})
+	sealedToken, err := SealNotificationSecret("tk")
+	require.NoError(t, err)
+	sealed := createTarget(t, &db.NotificationTarget{Name: "ntfy", Kind: TargetNtfy, Token: sealedToken})
+
+	require.NoError(t, EncryptNotificationSecrets())
+
+	var stored db.NotificationTarget
+	require.NoError(t, db.GetNotificationTargetByID(plain.ID, &stored))
+	assert.NotEqual(t, "hunter2", stored.Password)
+	assert.Empty(t, stored.Token)
+	opened, err := openNotificationTarget(&stored)
+	require.NoError(t, err)
+	assert.Equal(t, "hunter2", opened.Password)
+
+	var kept db.NotificationTarget
+	require.NoError(t, db.GetNotificationTargetByID(sealed.ID, &kept))
+	assert.Equal(t, sealedToken, kept.Token, "Encrypted secrets should be kept")
+}
+
+// TestSendNotification_Kinds tests the request made for each push service.
+func TestSendNotification_Kinds(t *testing.T) {
+	server, received := newNotificationServer(t, http.StatusOK)
+	delivery := &db.NotificationDelivery{Event: EventDownloadFailed, Title: "Download failed", Message: "Episode 1 failed"}
+
+	t.Run("ntfy", func(t *testing.T) {
+		target := &db.NotificationTarget{Kind: TargetNtfy, URL: server.URL + "/podgrab", Token: "tk"}
+		require.NoError(t, sendNotification(target, delivery))
+		request := received()[len(received())-1]
+		assert.Equal(t, "/podgrab", request.Path)
+		assert.Equal(t, "Episode 1 failed", request.Body)
+		assert.Equal(t, "Download failed", request.Header.Get("Title"))
+		assert.Equal(t, "high", request.Header.Get("Priority"))
+		assert.Equal(t, "Bearer tk", request.Header.Get("Authorization"))
+
+		injected := *delivery
+		injected.Title = "Episode\r\nX-Injected: 1"
+		require.NoError(t, sendNotification(target, &injected), "Line breaks in titles should not break the request")
+		request = received()[len(received())-1]
+		assert.Equal(t, "Episode  X-Injected: 1", request.Header.Get("Title"))
+		assert.Empty(t, request.Header.Get("X-Injected"))
+	})
+
+	t.Run("gotify", func(t *testing.T) {
+		target := &db.NotificationTarget{Kind: TargetGotify, URL: server.URL + "/", Token: "app-token"}
+		require.NoError(t, sendNotification(target, delivery))
+		request := received()[len(received())-1]
+		assert.Equal(t, "/message", request.Path)
+		assert.Equal(t, "app-token", request.Header.Get("X-Gotify-Key"))
+		assert.JSONEq(t, `{"title":"Download failed","message":"Episode 1 failed","priority":8}`, request.Body)
+	})
+
+	t.Run("apprise", func(t *testing.T) {
+		target := &db.NotificationTarget{Kind: TargetApprise, URL: server.URL + "/notify", Token: "tgram://bot/chat"}
+		require.NoError(t, sendNotification(target, delivery))
+		request := received()[len(received())-1]
+		assert.Equal(t, "/notify", request.Path)
+		assert.JSONEq(t, `{"title":"Download failed","body":"Episode 1 failed","type":"failure","urls":"tgram://bot/chat"}`, request.Body)
+	})
+
+	t.Run("smtp", func(t *testing.T) {
+		address, message := startSMTPServer(t)
+		target := &db.NotificationTarget{Kind: TargetSMTP, URL: address, From: "podgrab@example.com", To: "me@example.com"}
+		injected := *delivery
+		injected.Title = "Bad\r\nBcc: victim@example.com"
+		require.NoError(t, sendNotification(target, &injected))
+		mail := <-message
+		assert.Contains(t, mail, "Subject: Bad  Bcc: victim@example.com")
+		assert.Contains(t, mail, "Episode 1 failed")
+	})
+}
+
+// TestSendMail_Timeout tests that a stalled SMTP server fails the delivery
+// instead of blocking it.
+func TestSendMail_Timeout(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = listener.Close() })
+	go func() {
+		conn, acceptErr := listener.Accept()
+		if acceptErr != nil {
+			return
+		}
+		// Never greet the client.
+		t.Cleanup(func() { _ = conn.Close() })
+	}()
+	original := smtpTimeout
+	smtpTimeout = 100 * time.Millisecond
+	t.Cleanup(func() { smtpTimeout = original })
+
+	target := &db.NotificationTarget{Kind: TargetSMTP, URL: listener.Addr().String(), From: "podgrab@example.com", To: "me@example.com"}
+	done := make(chan error, 1)
+	go func() {
+		done <- sendNotification(target, &db.NotificationDelivery{Title: "Title", Message: "Message"})
+	}()
+	select {
+	case err := <-done:
+		assert.Error(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Sending should time out")
+	}
+}
+
+// startSMTPServer runs a minimal SMTP stand-in that accepts one message.
+func startSMTPServer(t *testing.T) (address string, message <-chan string) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = listener.Close() })
+
+	messages := make(chan string, 1)
+	go func() {
+		conn, acceptErr := listener.Accept()
+		if acceptErr != nil {
+			return
+		}
+		defer func() { _ = conn.Close() }()
+		reader := bufio.NewReader(conn)
+		reply := func(line string) { _, _ = conn.Write([]byte(line + "\r\n")) }
+		reply("220 localhost ESMTP")
+		var data strings.Builder
+		inData := false
+		for {
+			line, readErr := reader.ReadString('\n')
+			if readErr != nil {
+				return
+			}
+			if inData {
+				if line == ".\r\n" {
+					inData = false
+					messages <- data.String()
+					reply("250 OK")
+					continue
+				}
+				data.WriteString(line)
+				continue
+			}
+			switch command := strings.ToUpper(strings.TrimSpace(line)); {
+			case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+				reply("250 localhost")
+			case command == "DATA":
+				inData = true
+				reply("354 End data with <CR><LF>.<CR><LF>")
+			case command == "QUIT":
+				reply("221 Bye")
+				return
+			default:
+				reply("250 OK")
+			}
+		}
+	}()
+	return listener.Addr().String(), messages
+}
+
+// TestValidateNotificationTarget tests target validation.
+func TestValidateNotificationTarget(t *testing.T) {
+	valid := db.NotificationTarget{Name: "hook", Kind: TargetWebhook, URL: "https://example.com/hook", Events: "new_episode"}
+	require.NoError(t, ValidateNotificationTarget(&valid))
+
+	tests := []struct {
+		modify  func(target *db.NotificationTarget)
+		name    string
+		wantErr string
+	}{
+		{name: "unknown_kind", modify: func(target *db.NotificationTarget) { target.Kind = "pager" }, wantErr: "kind must be one of"},
+		{name: "bad_url", modify: func(target *db.NotificationTarget) { target.URL = "ftp://example.com" }, wantErr: "http or https"},
+		{name: "unknown_event", modify: func(target *db.NotificationTarget) { target.Events = "new_episode,exploded" }, wantErr: `unknown event "exploded"`},
+		{name: "no_events", modify: func(target *db.NotificationTarget) { target.Events = "" }, wantErr: "at least one event"},
+		{name: "gotify_without_token", modify: func(target *db.NotificationTarget) { target.Kind = TargetGotify }, wantErr: "token is required"},
+		{name: "smtp_without_port", modify: func(target *db.NotificationTarget) {
+			target.Kind = TargetSMTP
+			target.URL = "mail.example.com"
+		}, wantErr: "host:port"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := valid
+			tt.modify(&target)
+			err := ValidateNotificationTarget(&target)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+// TestAddPodcastItems_Notifications tests that refreshes notify about new episodes and dead feeds.
+func TestAddPodcastItems_Notifications(t *testing.T) {
+	useTestDB(t)
+	db.CreateTestSetting(t, db.DB)
+
+	hook, received := newNotificationServer(t, http.StatusOK)
+	createTarget(t, &db.NotificationTarget{Name: "hook", Kind: TargetWebhook, URL: hook.URL, Events: "new_episode,feed_dead", FailureThreshold: 2})
+
+	feed := httptest.NewServer(testhelpers.CreateMockRSSHandler(testhelpers.ValidRSSFeed))
+	podcast := db.CreateTestPodcast(t, db.DB, &db.Podcast{URL: feed.URL})
+
+	require.NoError(t, AddPodcastItems(context.Background(), podcast, false))
+	pendingDeliveries.Wait()
+	var items []db.PodcastItem
+	require.NoError(t, db.GetAllPodcastItemsByPodcastID(podcast.ID, &items))
+	assert.Len(t, received(), len(items), "Should notify once per new episode")
+
+	feed.Close()
+	require.Error(t, AddPodcastItems(context.Background(), podcast, false))
+	require.Error(t, AddPodcastItems(context.Background(), podcast, false))
+	require.Error(t, AddPodcastItems(context.Background(), podcast, false))
+	pendingDeliveries.Wait()
+
+	requests := received()
+	require.Len(t, requests, len(items)+1, "Should notify once when the threshold is reached")
+	assert.Contains(t, requests[len(requests)-1].Body, `"event":"feed_dead"`)
+
+	var stored db.Podcast
+	require.NoError(t, db.GetPodcastByID(podcast.ID, &stored))
+	assert.Equal(t, 3, stored.FeedFailureCount)
+	assert.NotEmpty(t, stored.LastFeedError)
+}
+
+// TestDownloadSingleEpisode_Failures tests that failed downloads are counted and notified.
+func TestDownloadSingleEpisode_Failures(t *testing.T) {
+	useTestDB(t)
+	db.CreateTestSetting(t, db.DB)
+	_, cleanup := testhelpers.SetupTestDataDir(t)
+	defer cleanup()
+
+	hook, received := newNotificationServer(t, http.StatusOK)
+	createTarget(t, &db.NotificationTarget{Name: "hook", Kind: TargetWebhook, URL: hook.URL, Events: "download_failed,download_complete", FailureThreshold: 1})
+
+	failing := true
+	episodes := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if failing {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte("audio")) // Test server - error handling not required
+	}))
+	defer episodes.Close()
+
+	podcast := db.CreateTestPodcast(t, db.DB)
+	item := db.CreateTestPodcastItem(t, db.DB, podcast.ID, &db.PodcastItem{FileURL: episodes.URL + "/episode.mp3"})
+
+	require.Error(t, DownloadSingleEpisode(context.Background(), item.ID))
+	pendingDeliveries.Wait()
+	var stored db.PodcastItem
+	require.NoError(t, db.GetPodcastItemByID(item.ID, &stored))
+	assert.Equal(t, 1, stored.DownloadFailureCount)
+
+	failing = false
+	require.NoError(t, DownloadSingleEpisode(context.Background(), item.ID))
+	pendingDeliveries.Wait()
+	require.NoError(t, db.GetPodcastItemByID(item.ID, &stored))
+	assert.Equal(t, 0, stored.DownloadFailureCount, "Success should reset the failure count")
+
+	requests := received()
+	require.Len(t, requests, 2)
+	assert.Contains(t, requests[0].Body, `"event":"download_failed"`)
+	assert.Contains(t, requests[1].Body, `"event":"download_complete"`)
+}
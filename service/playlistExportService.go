@@ -0,0 +1,230 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/akhilrex/podgrab/db"
+	"github.com/akhilrex/podgrab/internal/logger"
+	"github.com/akhilrex/podgrab/model"
+)
+
+// Playlist file formats.
+const (
+	PlaylistM3U  = "m3u"
+	PlaylistM3U8 = "m3u8"
+	PlaylistPLS  = "pls"
+	PlaylistXSPF = "xspf"
+)
+
+// PlaylistFormats lists the playlist file formats episodes can be exported in.
+var PlaylistFormats = []string{PlaylistM3U, PlaylistM3U8, PlaylistPLS, PlaylistXSPF}
+
+// PodcastPlaylistFile names the playlist written to the folder of a podcast
+// when the WritePlaylistFiles setting is on.
+const PodcastPlaylistFile = "playlist.m3u8"
+
+// playlistFileMu serializes writing playlist files, so that downloads that
+// finish together do not overwrite a newer playlist with an older one.
+var playlistFileMu sync.Mutex
+
+// playlistContentTypes are the media types of the playlist file formats.
+var playlistContentTypes = map[string]string{
+	PlaylistM3U:  "audio/x-mpegurl",
+	PlaylistM3U8: "audio/x-mpegurl; charset=utf-8",
+	PlaylistPLS:  "audio/x-scpls",
+	PlaylistXSPF: "application/xspf+xml",
+}
+
+// PlaylistEntry is an episode in a playlist file.
+type PlaylistEntry struct {
+	Title  string
+	Artist string
+	URL    string
+	// Image is the URL of the episode's artwork, only written to XSPF.
+	Image string
+	// Duration is in seconds, zero when it is unknown.
+	Duration int
+}
+
+// PlaylistContentType returns the media type of a playlist file format.
+func PlaylistContentType(format string) string {
+	return playlistContentTypes[format]
+}
+
+// WritePlaylist writes entries to w as a playlist file in format. The title
+// names the playlist in formats that support it and may be empty.
+func WritePlaylist(w io.Writer, format, title string, entries []PlaylistEntry) error {
+	buffered := bufio.NewWriter(w)
+	switch format {
+	case PlaylistM3U, PlaylistM3U8:
+		writeM3U(buffered, title, entries)
+	case PlaylistPLS:
+		writePLS(buffered, entries)
+	case PlaylistXSPF:
+		if err := writeXSPF(buffered, title, entries); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown playlist format %q", format)
+	}
+	return buffered.Flush()
+}
+
+func writeM3U(w *bufio.Writer, title string, entries []PlaylistEntry) {
+	fmt.Fprintln(w, "#EXTM3U")
+	if title = singleLine(title); title != "" {
+		fmt.Fprintf(w, "#PLAYLIST:%s\n", title)
+	}
+	for i := range entries {
+		fmt.Fprintf(w, "#EXTINF:%d,%s\n%s\n", playlistLength(entries[i].Duration), playlistTitle(&entries[i]), entries[i].URL)
+	}
+}
+
+func writePLS(w *bufio.Writer, entries []PlaylistEntry) {
+	fmt.Fprintln(w, "[playlist]")
+	for i := range entries {
+		fmt.Fprintf(w, "File%d=%s\nTitle%d=%s\nLength%d=%d\n",
+			i+1, entries[i].URL, i+1, playlistTitle(&entries[i]), i+1, playlistLength(entries[i].Duration))
+	}
+	fmt.Fprintf(w, "NumberOfEntries=%d\nVersion=2\n", len(entries))
+}
+
+// xspfPlaylist is an XSPF playlist, see https://xspf.org/spec.
+type xspfPlaylist struct {
+	XMLName   xml.Name `xml:"http://xspf.org/ns/0/ playlist"`
+	Version   string   `xml:"version,attr"`
+	Title     string   `xml:"title,omitempty"`
+	TrackList struct {
+		Tracks []xspfTrack `xml:"track"`
+	} `xml:"trackList"`
+}
+
+type xspfTrack struct {
+	Location string `xml:"location"`
+	Title    string `xml:"title,omitempty"`
+	Creator  string `xml:"creator,omitempty"`
+	Image    string `xml:"image,omitempty"`
+	// Duration is in milliseconds.
+	Duration int `xml:"duration,omitempty"`
+}
+
+func writeXSPF(w *bufio.Writer, title string, entries []PlaylistEntry) error {
+	playlist := xspfPlaylist{Version: "1", Title: singleLine(title)}
+	playlist.TrackList.Tracks = make([]xspfTrack, 0, len(entries))
+	for i := range entries {
+		track := xspfTrack{
+			Location: entries[i].URL,
+			Title:    singleLine(entries[i].Title),
+			Creator:  singleLine(entries[i].Artist),
+			Image:    entries[i].Image,
+		}
+		if entries[i].Duration > 0 {
+			track.Duration = entries[i].Duration * 1000
+		}
+		playlist.TrackList.Tracks = append(playlist.TrackList.Tracks, track)
+	}
+	if _, err := w.WriteString(xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(playlist); err != nil {
+		return err
+	}
+	return w.WriteByte('\n')
+}
+
+// playlistTitle returns the display title of an entry on a single line.
+func playlistTitle(entry *PlaylistEntry) string {
+	title := entry.Title
+	if entry.Artist != "" {
+		title = entry.Artist + " - " + title
+	}
+	return singleLine(title)
+}
+
+// singleLine collapses the whitespace in text, including line breaks.
+func singleLine(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// playlistLength returns the length of an entry, -1 when it is unknown.
+func playlistLength(duration int) int {
+	if duration <= 0 {
+		return -1
+	}
+	return duration
+}
+
+// WritePodcastPlaylistFile writes the downloaded episodes of a podcast, oldest
+// first, to PodcastPlaylistFile in its folder with paths relative to it, and
+// removes the file when no episodes are downloaded.
+func WritePodcastPlaylistFile(podcastID string) error {
+	playlistFileMu.Lock()
+	defer playlistFileMu.Unlock()
+
+	folder, err := db.GetPodcastDataFolder(podcastID)
+	if err != nil {
+		return err
+	}
+	downloaded := "true"
+	items, err := db.GetPlaylistPodcastItems(&model.EpisodesFilter{
+		PodcastIDs:   []string{podcastID},
+		IsDownloaded: &downloaded,
+		Sorting:      model.ReleaseAsc,
+	}, 0)
+	if err != nil {
+		return err
+	}
+	dir := createDataFolderIfNotExists(folder)
+	target := filepath.Join(dir, PodcastPlaylistFile)
+	if len(*items) == 0 {
+		if err := os.Remove(target); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+
+	entries := make([]PlaylistEntry, 0, len(*items))
+	for i := range *items {
+		item := &(*items)[i]
+		location, relErr := filepath.Rel(dir, item.DownloadPath)
+		if relErr != nil || strings.HasPrefix(location, "..") {
+			location = item.DownloadPath
+		}
+		entries = append(entries, PlaylistEntry{
+			Title:    item.Title,
+			Artist:   item.Podcast.Title,
+			URL:      filepath.ToSlash(location),
+			Duration: item.Duration,
+		})
+	}
+	var out bytes.Buffer
+	if err := WritePlaylist(&out, PlaylistM3U8, (*items)[0].Podcast.Title, entries); err != nil {
+		return err
+	}
+	temp := target + ".tmp"
+	if err := os.WriteFile(temp, out.Bytes(), 0o600); err != nil {
+		return err
+	}
+	return os.Rename(temp, target)
+}
+
+// refreshPlaylistFile rewrites the playlist file of a podcast after its
+// downloads changed, when the WritePlaylistFiles setting is on.
+func refreshPlaylistFile(podcastID string, setting *db.Setting) {
+	if !setting.WritePlaylistFiles {
+		return
+	}
+	if err := WritePodcastPlaylistFile(podcastID); err != nil {
+		logger.Log.Errorw("writing playlist file", "podcast", podcastID, "error", err)
+	}
+}
@@ -0,0 +1,120 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/akhilrex/podgrab/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var playlistEntries = []PlaylistEntry{
+	{Title: "Episode 1", Artist: "Show", URL: "http://podgrab/podcastitems/1/file", Duration: 1800},
+	{Title: "Episode\n2", URL: "http://podgrab/podcastitems/2/file"},
+}
+
+// TestWritePlaylist_M3U tests extended M3U playlists.
+func TestWritePlaylist_M3U(t *testing.T) {
+	var out strings.Builder
+	require.NoError(t, WritePlaylist(&out, PlaylistM3U, "", playlistEntries))
+	assert.Equal(t, "#EXTM3U\n"+
+		"#EXTINF:1800,Show - Episode 1\nhttp://podgrab/podcastitems/1/file\n"+
+		"#EXTINF:-1,Episode 2\nhttp://podgrab/podcastitems/2/file\n", out.String())
+	assert.Equal(t, "audio/x-mpegurl", PlaylistContentType(PlaylistM3U))
+}
+
+// TestWritePlaylist_PLS tests PLS playlists.
+func TestWritePlaylist_PLS(t *testing.T) {
+	var out strings.Builder
+	require.NoError(t, WritePlaylist(&out, PlaylistPLS, "", playlistEntries))
+	assert.Equal(t, "[playlist]\n"+
+		"File1=http://podgrab/podcastitems/1/file\nTitle1=Show - Episode 1\nLength1=1800\n"+
+		"File2=http://podgrab/podcastitems/2/file\nTitle2=Episode 2\nLength2=-1\n"+
+		"NumberOfEntries=2\nVersion=2\n", out.String())
+	assert.Error(t, WritePlaylist(&out, "wpl", "", playlistEntries))
+}
+
+// TestWritePlaylist_M3U8 tests that M3U8 playlists are named after their title.
+func TestWritePlaylist_M3U8(t *testing.T) {
+	var out strings.Builder
+	require.NoError(t, WritePlaylist(&out, PlaylistM3U8, "Morning\nShows", playlistEntries[:1]))
+	assert.Equal(t, "#EXTM3U\n#PLAYLIST:Morning Shows\n"+
+		"#EXTINF:1800,Show - Episode 1\nhttp://podgrab/podcastitems/1/file\n", out.String())
+	assert.Equal(t, "audio/x-mpegurl; charset=utf-8", PlaylistContentType(PlaylistM3U8))
+}
+
+// TestWritePlaylist_XSPF tests XSPF playlists.
+func TestWritePlaylist_XSPF(t *testing.T) {
+	entries := append([]PlaylistEntry{}, playlistEntries...)
+	entries[0].Image = "http://podgrab/podcastitems/1/image"
+	entries[0].Title = "Q&A"
+
+	var out strings.Builder
+	require.NoError(t, WritePlaylist(&out, PlaylistXSPF, "Shows", entries))
+	assert.Equal(t, `<?xml version="1.0" encoding="UTF-8"?>
+<playlist xmlns="http://xspf.org/ns/0/" version="1">
+  <title>Shows</title>
+  <trackList>
+    <track>
+      <location>http://podgrab/podcastitems/1/file</location>
+      <title>Q&amp;A</title>
+      <creator>Show</creator>
+      <image>http://podgrab/podcastitems/1/image</image>
+      <duration>1800000</duration>
+    </track>
+    <track>
+      <location>http://podgrab/podcastitems/2/file</location>
+      <title>Episode 2</title>
+    </track>
+  </trackList>
+</playlist>
+`, out.String())
+	assert.Equal(t, "application/xspf+xml", PlaylistContentType(PlaylistXSPF))
+
+	out.Reset()
+	require.NoError(t, WritePlaylist(&out, PlaylistXSPF, "", nil))
+	assert.Contains(t, out.String(), "<trackList></trackList>", "The track list is required even when empty")
+}
+
+// TestWritePodcastPlaylistFile tests the playlist file kept in the folder of
+// a podcast.
+func TestWritePodcastPlaylistFile(t *testing.T) {
+	useTestDataDir(t)
+	podcast := db.CreateTestPodcast(t, db.DB, &db.Podcast{Title: "Show"})
+	folder := createDataFolderIfNotExists(podcast.DataFolder())
+	target := filepath.Join(folder, PodcastPlaylistFile)
+	older := db.CreateTestPodcastItem(t, db.DB, podcast.ID, &db.PodcastItem{
+		Title: "Older", PubDate: time.Now().Add(-48 * time.Hour), Duration: 60,
+	})
+	newer := db.CreateTestPodcastItem(t, db.DB, podcast.ID, &db.PodcastItem{Title: "Newer"})
+	db.CreateTestPodcastItem(t, db.DB, podcast.ID, &db.PodcastItem{Title: "Not downloaded"})
+
+	setting := db.GetOrCreateSetting()
+	refreshPlaylistFile(podcast.ID, setting)
+	assert.NoFileExists(t, target, "Nothing is written unless the setting is on")
+
+	for _, item := range []*db.PodcastItem{newer, older} {
+		file := filepath.Join(folder, item.Title+".mp3")
+		require.NoError(t, os.WriteFile(file, []byte("audio"), 0o600))
+		require.NoError(t, SetPodcastItemAsDownloaded(item.ID, file))
+	}
+	setting.WritePlaylistFiles = true
+	refreshPlaylistFile(podcast.ID, setting)
+	content, err := os.ReadFile(target)
+	require.NoError(t, err)
+	assert.Equal(t, "#EXTM3U\n#PLAYLIST:Show\n"+
+		"#EXTINF:60,Show - Older\nOlder.mp3\n"+
+		"#EXTINF:1800,Show - Newer\nNewer.mp3\n", string(content))
+
+	require.NoError(t, db.UpdateSettings(setting))
+	require.NoError(t, DeleteEpisodeFile(older.ID))
+	content, err = os.ReadFile(target)
+	require.NoError(t, err)
+	assert.NotContains(t, string(content), "Older", "Deleted episodes are removed from the playlist")
+	require.NoError(t, DeleteEpisodeFile(newer.ID))
+	assert.NoFileExists(t, target, "The playlist is removed when no episodes are downloaded")
+}
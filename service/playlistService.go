@@ -0,0 +1,57 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/akhilrex/podgrab/db"
+)
+
+// ErrInvalidPlaylist is returned for playlists without a name.
+var ErrInvalidPlaylist = errors.New("invalid playlist")
+
+// ValidatePlaylist checks the name of a playlist, trimming it.
+func ValidatePlaylist(playlist *db.Playlist) error {
+	playlist.Name = strings.TrimSpace(playlist.Name)
+	if playlist.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidPlaylist)
+	}
+	return nil
+}
+
+// SetPlaylistEpisodes arranges the episodes of a playlist, or of the up next
+// queue for db.QueuePlaylistID, in the order of ids. Every ID must be an
+// episode, and repeated IDs keep their first position.
+func SetPlaylistEpisodes(playlistID string, ids []string) error {
+	items, err := getEpisodesByIDs(ids)
+	if err != nil {
+		return err
+	}
+	return db.SetPlaylistEpisodes(playlistID, episodeIDs(items))
+}
+
+// AddPlaylistEpisodes adds episodes to the end of a playlist, or of the up
+// next queue for db.QueuePlaylistID, or to its start when next is set.
+// Episodes already in it keep their position. It returns the number of
+// episodes added.
+func AddPlaylistEpisodes(playlistID string, ids []string, next bool) (int, error) {
+	items, err := getEpisodesByIDs(ids)
+	if err != nil {
+		return 0, err
+	}
+	return addPlaylistEpisodes(playlistID, items, next)
+}
+
+func addPlaylistEpisodes(playlistID string, items []db.PodcastItem, next bool) (int, error) {
+	return db.AddPlaylistEpisodes(playlistID, episodeIDs(items), next)
+}
+
+// episodeIDs returns the IDs of items in order.
+func episodeIDs(items []db.PodcastItem) []string {
+	ids := make([]string, 0, len(items))
+	for i := range items {
+		ids = append(ids, items[i].ID)
+	}
+	return ids
+}
@@ -0,0 +1,50 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/akhilrex/podgrab/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// TestValidatePlaylist tests the names playlists accept.
+func TestValidatePlaylist(t *testing.T) {
+	playlist := &db.Playlist{Name: "  Favorites  "}
+	require.NoError(t, ValidatePlaylist(playlist))
+	assert.Equal(t, "Favorites", playlist.Name)
+	assert.ErrorIs(t, ValidatePlaylist(&db.Playlist{Name: " "}), ErrInvalidPlaylist)
+}
+
+// TestPlaylistEpisodes tests adding and arranging the episodes of the up
+// next queue.
+func TestPlaylistEpisodes(t *testing.T) {
+	useTestDB(t)
+	podcast := db.CreateTestPodcast(t, db.DB)
+	first := db.CreateTestPodcastItem(t, db.DB, podcast.ID, &db.PodcastItem{Title: "First"})
+	second := db.CreateTestPodcastItem(t, db.DB, podcast.ID, &db.PodcastItem{Title: "Second"})
+	third := db.CreateTestPodcastItem(t, db.DB, podcast.ID, &db.PodcastItem{Title: "Third"})
+	queue := func() []string {
+		items, err := db.GetPlaylistEpisodes(db.QueuePlaylistID)
+		require.NoError(t, err)
+		return itemTitles(items)
+	}
+
+	added, err := AddPlaylistEpisodes(db.QueuePlaylistID, []string{first.ID, second.ID, first.ID}, false)
+	require.NoError(t, err)
+	assert.Equal(t, 2, added)
+	added, err = AddPlaylistEpisodes(db.QueuePlaylistID, []string{third.ID, second.ID}, true)
+	require.NoError(t, err)
+	assert.Equal(t, 1, added, "Queued episodes should keep their position")
+	assert.Equal(t, []string{"Third", "First", "Second"}, queue())
+
+	require.NoError(t, SetPlaylistEpisodes(db.QueuePlaylistID, []string{second.ID, first.ID, second.ID}))
+	assert.Equal(t, []string{"Second", "First"}, queue())
+
+	assert.ErrorIs(t, SetPlaylistEpisodes(db.QueuePlaylistID, []string{third.ID, "missing"}), gorm.ErrRecordNotFound)
+	assert.Equal(t, []string{"Second", "First"}, queue(), "A missing episode should change nothing")
+
+	require.NoError(t, SetPlaylistEpisodes(db.QueuePlaylistID, nil))
+	assert.Empty(t, queue())
+}
@@ -0,0 +1,223 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/akhilrex/podgrab/db"
+	"github.com/akhilrex/podgrab/internal/config"
+	"github.com/akhilrex/podgrab/internal/logger"
+	"github.com/akhilrex/podgrab/model"
+	strip "github.com/grokify/html-strip-tags-go"
+)
+
+var (
+	// ErrInvalidPodcastOverrides is returned for artwork URLs and folder
+	// names that cannot be used.
+	ErrInvalidPodcastOverrides = errors.New("invalid podcast overrides")
+	// ErrPodcastFolderInUse is returned when moving a podcast to a folder
+	// that another podcast or file already uses.
+	ErrPodcastFolderInUse = errors.New("podcast folder is in use")
+)
+
+// PodcastOverrides changes the details shown for a podcast and the name of
+// its folder. Nil fields are unchanged and empty ones revert to the feed's
+// values.
+type PodcastOverrides struct {
+	Title   *string
+	Summary *string
+	Author  *string
+	Image   *string
+	Folder  *string
+}
+
+// setFeedMetadata stores the details of a podcast's feed. Details missing
+// from the feed keep their previous values.
+func setFeedMetadata(podcast *db.Podcast, data *model.PodcastData, body []byte) {
+	image := data.Channel.Image.URL
+	if image == "" {
+		image = getItunesImageURL(body)
+	}
+	for _, field := range []struct {
+		target *string
+		value  string
+	}{
+		{&podcast.FeedTitle, data.Channel.Title},
+		{&podcast.FeedSummary, strip.StripTags(data.Channel.Summary)},
+		{&podcast.FeedAuthor, data.Channel.Author},
+		{&podcast.FeedImage, image},
+	} {
+		if field.value != "" {
+			*field.target = field.value
+		}
+	}
+}
+
+// applyPodcastOverrides sets the details shown for a podcast from its
+// overrides and feed.
+func applyPodcastOverrides(podcast *db.Podcast) {
+	podcast.Title = overridden(podcast.TitleOverride, podcast.FeedTitle)
+	podcast.Summary = overridden(podcast.SummaryOverride, podcast.FeedSummary)
+	podcast.Author = overridden(podcast.AuthorOverride, podcast.FeedAuthor)
+	podcast.Image = overridden(podcast.ImageOverride, podcast.FeedImage)
+}
+
+func overridden(override, feed string) string {
+	if override != "" {
+		return override
+	}
+	return feed
+}
+
+// UpdatePodcastOverrides changes the details shown for a podcast and moves
+// its folder when the folder name changes.
+func UpdatePodcastOverrides(podcastID string, overrides *PodcastOverrides) error {
+	var podcast db.Podcast
+	if err := db.GetPodcastByID(podcastID, &podcast); err != nil {
+		return err
+	}
+	previous := podcast
+	for _, field := range []struct {
+		target *string
+		value  *string
+	}{
+		{&podcast.TitleOverride, overrides.Title},
+		{&podcast.SummaryOverride, overrides.Summary},
+		{&podcast.AuthorOverride, overrides.Author},
+		{&podcast.ImageOverride, overrides.Image},
+	} {
+		if field.value != nil {
+			*field.target = strings.TrimSpace(*field.value)
+		}
+	}
+	if podcast.ImageOverride != "" && podcast.ImageOverride != previous.ImageOverride {
+		if parsed, err := url.Parse(podcast.ImageOverride); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return fmt.Errorf("%w: artwork must be an http or https URL", ErrInvalidPodcastOverrides)
+		}
+	}
+	applyPodcastOverrides(&podcast)
+
+	if overrides.Folder != nil {
+		folder := strings.TrimSpace(*overrides.Folder)
+		if folder == "" {
+			folder = podcast.FeedTitle
+		}
+		if err := movePodcastFolder(&podcast, folder); err != nil {
+			return err
+		}
+	}
+	if err := db.UpdatePodcastMetadata(&podcast); err != nil {
+		return err
+	}
+	podcastMetadataChanged(&previous, &podcast)
+	return nil
+}
+
+// RefreshPodcastMetadata fetches the details of a podcast from its feed. The
+// user's overrides are kept.
+func RefreshPodcastMetadata(ctx context.Context, podcastID string) error {
+	var podcast db.Podcast
+	if err := db.GetPodcastByID(podcastID, &podcast); err != nil {
+		return err
+	}
+	if podcast.IsLocal {
+		return ErrLocalPodcast
+	}
+	data, body, err := FetchURL(withPodcastAuth(ctx, &podcast), podcast.URL)
+	if err != nil {
+		return err
+	}
+	previous := podcast
+	setFeedMetadata(&podcast, &data, body)
+	applyPodcastOverrides(&podcast)
+	if err := db.UpdatePodcastMetadata(&podcast); err != nil {
+		return err
+	}
+	logger.Log.Infow("Refreshed podcast details from the feed", "podcast", podcast.Title)
+	podcastMetadataChanged(&previous, &podcast)
+	return nil
+}
+
+// podcastMetadataChanged downloads a podcast's new artwork and rewrites its
+// NFO file after its details changed.
+func podcastMetadataChanged(previous, podcast *db.Podcast) {
+	// The artwork of local podcasts is served from their folders
+	if podcast.Image != "" && podcast.Image != previous.Image && (!podcast.IsLocal || podcast.ImageOverride != "") {
+		go func() {
+			ctx := BackgroundContext()
+			// Only the feed's artwork is fetched with the feed's credentials
+			if podcast.ImageOverride == "" {
+				ctx = withPodcastAuth(ctx, podcast)
+			}
+			if _, err := DownloadPodcastCoverImage(ctx, podcast.Image, podcast.DataFolder()); err != nil {
+				logger.Log.Errorw("downloading podcast cover image", "error", err)
+			}
+		}()
+	}
+	if db.GetOrCreateSetting().GenerateNFOFile {
+		go func() {
+			if err := CreateNfoFile(podcast); err != nil {
+				logger.Log.Errorw("creating NFO file", "error", err)
+			}
+		}()
+	}
+}
+
+// movePodcastFolder renames a podcast's folder in the data directory to
+// folder, with the paths of its episodes' files. Its downloads are stopped
+// while the folder moves and resume afterwards.
+func movePodcastFolder(podcast *db.Podcast, folder string) error {
+	name := cleanFileName(folder)
+	if strings.Trim(name, ".-") == "" {
+		return fmt.Errorf("%w: folder name %q", ErrInvalidPodcastOverrides, folder)
+	}
+	dataDir := config.Get().DataDir
+	oldDir := path.Join(dataDir, cleanFileName(podcast.DataFolder()))
+	newDir := path.Join(dataDir, name)
+	if newDir == oldDir {
+		podcast.Folder = name
+		return db.UpdatePodcastFolder(podcast.ID, name, oldDir, newDir)
+	}
+
+	var podcasts []db.Podcast
+	if err := db.GetAllPodcasts(&podcasts, ""); err != nil {
+		return err
+	}
+	for i := range podcasts {
+		if podcasts[i].ID != podcast.ID && strings.EqualFold(cleanFileName(podcasts[i].DataFolder()), name) {
+			return fmt.Errorf("%w: %q is the folder of %s", ErrPodcastFolderInUse, name, podcasts[i].Title)
+		}
+	}
+	// Case-insensitive file systems find the old folder under the new name
+	if _, err := os.Stat(newDir); err == nil && !strings.EqualFold(newDir, oldDir) {
+		return fmt.Errorf("%w: %q already exists", ErrPodcastFolderInUse, name)
+	} else if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	unblock := blockPodcastDownloads(podcast.ID, errPodcastMoved)
+	defer unblock()
+	moved := false
+	if _, err := os.Stat(oldDir); err == nil {
+		if err := os.Rename(oldDir, newDir); err != nil {
+			return err
+		}
+		moved = true
+	}
+	if err := db.UpdatePodcastFolder(podcast.ID, name, oldDir, newDir); err != nil {
+		if moved {
+			if restoreErr := os.Rename(newDir, oldDir); restoreErr != nil {
+				logger.Log.Errorw("moving podcast folder back", "from", newDir, "to", oldDir, "error", restoreErr)
+			}
+		}
+		return err
+	}
+	podcast.Folder = name
+	logger.Log.Infow("Moved podcast folder", "podcast", podcast.Title, "from", oldDir, "to", newDir)
+	return nil
+}
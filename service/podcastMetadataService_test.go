@@ -0,0 +1,129 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/akhilrex/podgrab/db"
+	"github.com/akhilrex/podgrab/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func ptr(value string) *string {
+	return &value
+}
+
+// reloadPodcast reads a podcast again from the database.
+func reloadPodcast(t *testing.T, id string) *db.Podcast {
+	t.Helper()
+	var podcast db.Podcast
+	require.NoError(t, db.GetPodcastByID(id, &podcast))
+	return &podcast
+}
+
+// TestUpdatePodcastOverrides_RefreshKeepsOverrides tests that overrides are
+// shown instead of the feed's details, survive refreshing them and revert
+// when cleared.
+func TestUpdatePodcastOverrides_RefreshKeepsOverrides(t *testing.T) {
+	useTestDataDir(t)
+	var mu sync.Mutex
+	title := "Feed Title"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		_, _ = fmt.Fprintf(w, `<?xml version="1.0"?><rss version="2.0"><channel><title>%s</title>
+<summary>Feed summary</summary><author>Feed Author</author></channel></rss>`, title)
+	}))
+	t.Cleanup(server.Close)
+	podcast := db.CreateTestPodcast(t, db.DB, &db.Podcast{Title: "Old Title", URL: server.URL})
+
+	require.NoError(t, UpdatePodcastOverrides(podcast.ID, &PodcastOverrides{Title: ptr("  My Title "), Author: ptr("Me")}))
+	updated := reloadPodcast(t, podcast.ID)
+	assert.Equal(t, "My Title", updated.Title)
+	assert.Equal(t, "Me", updated.Author)
+	assert.Equal(t, "Old Title", updated.FeedTitle, "The feed's title should be kept")
+	assert.Equal(t, podcast.Summary, updated.Summary, "Details without overrides should be unchanged")
+
+	mu.Lock()
+	title = "New Feed Title"
+	mu.Unlock()
+	require.NoError(t, RefreshPodcastMetadata(t.Context(), podcast.ID))
+	updated = reloadPodcast(t, podcast.ID)
+	assert.Equal(t, "My Title", updated.Title, "Refreshing should keep the overrides")
+	assert.Equal(t, "New Feed Title", updated.FeedTitle)
+	assert.Equal(t, "Feed summary", updated.Summary)
+	assert.Equal(t, podcast.Image, updated.Image, "Details missing from the feed should be kept")
+
+	require.NoError(t, UpdatePodcastOverrides(podcast.ID, &PodcastOverrides{Title: ptr("")}))
+	updated = reloadPodcast(t, podcast.ID)
+	assert.Equal(t, "New Feed Title", updated.Title, "Clearing an override should show the feed's value")
+	assert.Equal(t, "Me", updated.Author)
+
+	err := UpdatePodcastOverrides(podcast.ID, &PodcastOverrides{Image: ptr("file:///etc/passwd")})
+	assert.ErrorIs(t, err, ErrInvalidPodcastOverrides)
+}
+
+// TestUpdatePodcastOverrides_MovesFolder tests renaming a podcast's folder
+// with its files.
+func TestUpdatePodcastOverrides_MovesFolder(t *testing.T) {
+	useTestDataDir(t)
+	dataDir := config.Get().DataDir
+	podcast := db.CreateTestPodcast(t, db.DB, &db.Podcast{Title: "Show"})
+	other := db.CreateTestPodcast(t, db.DB, &db.Podcast{Title: "Other", URL: "https://example.com/other.xml"})
+	oldFile := filepath.Join(createDataFolderIfNotExists("Show"), "episode.mp3")
+	require.NoError(t, os.WriteFile(oldFile, []byte("audio"), 0o600))
+	item := db.CreateTestPodcastItem(t, db.DB, podcast.ID, &db.PodcastItem{DownloadPath: oldFile, DownloadStatus: db.Downloaded})
+
+	require.NoError(t, UpdatePodcastOverrides(podcast.ID, &PodcastOverrides{Folder: ptr("Renamed")}))
+
+	newFile := filepath.Join(dataDir, "Renamed", "episode.mp3")
+	assert.FileExists(t, newFile)
+	assert.NoDirExists(t, filepath.Join(dataDir, "Show"))
+	var moved db.PodcastItem
+	require.NoError(t, db.GetPodcastItemByID(item.ID, &moved))
+	assert.Equal(t, newFile, moved.DownloadPath)
+	assert.Equal(t, "Renamed", reloadPodcast(t, podcast.ID).DataFolder())
+
+	t.Run("in_use", func(t *testing.T) {
+		err := UpdatePodcastOverrides(podcast.ID, &PodcastOverrides{Folder: ptr(other.Title)})
+		assert.ErrorIs(t, err, ErrPodcastFolderInUse)
+		require.NoError(t, os.MkdirAll(filepath.Join(dataDir, "Taken"), 0o750))
+		err = UpdatePodcastOverrides(podcast.ID, &PodcastOverrides{Folder: ptr("Taken")})
+		assert.ErrorIs(t, err, ErrPodcastFolderInUse)
+		assert.FileExists(t, newFile, "Failed moves should leave the files")
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		err := UpdatePodcastOverrides(podcast.ID, &PodcastOverrides{Folder: ptr("..")})
+		assert.ErrorIs(t, err, ErrInvalidPodcastOverrides)
+	})
+
+	t.Run("reset", func(t *testing.T) {
+		require.NoError(t, UpdatePodcastOverrides(podcast.ID, &PodcastOverrides{Folder: ptr("")}))
+		assert.FileExists(t, filepath.Join(dataDir, "Show", "episode.mp3"), "An empty folder should revert to the feed's title")
+	})
+}
+
+// TestMovePodcastFolder_StopsDownloads tests that moving a folder stops the
+// podcast's downloads, which stay queued and resume in the new folder.
+func TestMovePodcastFolder_StopsDownloads(t *testing.T) {
+	useTestDataDir(t)
+	content := []byte("podcast audio podcast audio podcast audio")
+	item, partPath, result, _ := startStalledDownload(t, content)
+
+	require.NoError(t, UpdatePodcastOverrides(item.PodcastID, &PodcastOverrides{Folder: ptr("Moved")}))
+	assert.ErrorIs(t, <-result, errDownloadsPaused)
+	assert.NoFileExists(t, partPath)
+	assert.FileExists(t, filepath.Join(config.Get().DataDir, "Moved", filepath.Base(partPath)), "The partial file should move with the folder")
+
+	var queued db.PodcastItem
+	require.NoError(t, db.GetPodcastItemByID(item.ID, &queued))
+	assert.Equal(t, db.NotDownloaded, queued.DownloadStatus, "Stopped downloads should stay queued")
+	assert.Zero(t, queued.DownloadFailureCount)
+}
@@ -2,6 +2,7 @@
 package service
 
 import (
+	"context"
 	"encoding/xml"
 	"errors"
 	"fmt"
@@ -16,6 +17,8 @@ import (
 	"github.com/TheHippo/podcastindex"
 	"github.com/akhilrex/podgrab/db"
 	"github.com/akhilrex/podgrab/internal/logger"
+	"github.com/akhilrex/podgrab/internal/metrics"
+	"github.com/akhilrex/podgrab/internal/redact"
 	"github.com/akhilrex/podgrab/model"
 	"github.com/antchfx/xmlquery"
 	strip "github.com/grokify/html-strip-tags-go"
@@ -30,8 +33,8 @@ func ParseOpml(content string) (model.OpmlModel, error) {
 }
 
 // FetchURL is
-func FetchURL(url string) (model.PodcastData, []byte, error) {
-	body, err := makeQuery(url)
+func FetchURL(ctx context.Context, url string) (model.PodcastData, []byte, error) {
+	body, err := makeQuery(ctx, url)
 	if err != nil {
 		return model.PodcastData{}, nil, err
 	}
@@ -93,7 +96,24 @@ func GetAllPodcasts(sorting string) *[]db.Podcast {
 	if err := db.GetAllPodcasts(&podcasts, sorting); err != nil {
 		logger.Log.Errorw("getting all podcasts", "error", err)
 	}
+	setEpisodeStats(podcasts)
+	return &podcasts
+}
+
+// GetPodcastWithStats returns a podcast with the counts and sizes of its
+// episodes.
+func GetPodcastWithStats(id string) (*db.Podcast, error) {
+	podcasts := make([]db.Podcast, 1)
+	if err := db.GetPodcastByID(id, &podcasts[0]); err != nil {
+		return nil, err
+	}
+	setEpisodeStats(podcasts)
+	return &podcasts[0], nil
+}
 
+// setEpisodeStats sets the counts and sizes of the episodes of podcasts by
+// download status.
+func setEpisodeStats(podcasts []db.Podcast) {
 	stats, err := db.GetPodcastEpisodeStats()
 	if err != nil {
 		logger.Log.Errorw("getting podcast episode stats", "error", err)
@@ -110,7 +130,6 @@ func GetAllPodcasts(sorting string) *[]db.Podcast {
 		countMap[Key{stat.PodcastID, stat.DownloadStatus}] = stat.Count
 		sizeMap[Key{stat.PodcastID, stat.DownloadStatus}] = stat.Size
 	}
-	toReturn := make([]db.Podcast, 0, len(podcasts))
 	for i := range podcasts {
 		podcasts[i].DownloadedEpisodesCount = countMap[Key{podcasts[i].ID, db.Downloaded}]
 		podcasts[i].DownloadingEpisodesCount = countMap[Key{podcasts[i].ID, db.NotDownloaded}]
@@ -119,50 +138,60 @@ func GetAllPodcasts(sorting string) *[]db.Podcast {
 		podcasts[i].DownloadedEpisodesSize = sizeMap[Key{podcasts[i].ID, db.Downloaded}]
 		podcasts[i].DownloadingEpisodesSize = sizeMap[Key{podcasts[i].ID, db.NotDownloaded}]
 		podcasts[i].AllEpisodesSize = podcasts[i].DownloadedEpisodesSize + podcasts[i].DownloadingEpisodesSize + sizeMap[Key{podcasts[i].ID, db.Deleted}]
-
-		toReturn = append(toReturn, podcasts[i])
 	}
-	return &toReturn
 }
 
 // AddOpml add opml.
-func AddOpml(content string) error {
+func AddOpml(ctx context.Context, content string) error {
+	if _, err := ImportOpml(ctx, content); err != nil {
+		return err
+	}
+	go func() {
+		if err := RefreshEpisodes(BackgroundContext()); err != nil {
+			logger.Log.Errorw("refreshing episodes", "error", err)
+		}
+	}()
+	return nil
+}
+
+// ImportOpml adds every feed found in an OPML document and returns the number
+// of podcasts that were added. Episodes are not refreshed.
+func ImportOpml(ctx context.Context, content string) (int, error) {
 	opmlModel, err := ParseOpml(content)
 	if err != nil {
 		logger.Log.Error(err.Error())
-		return errors.New("invalid file format")
+		return 0, errors.New("invalid file format")
 	}
-	var wg sync.WaitGroup
+	var urls []string
 	for _, outline := range opmlModel.Body.Outline {
 		if outline.XMLURL != "" {
-			wg.Add(1)
-			go func(url string) {
-				defer wg.Done()
-				if _, err := AddPodcast(url); err != nil {
-					logger.Log.Errorw("adding podcast from OPML", "error", err)
-				}
-			}(outline.XMLURL)
+			urls = append(urls, outline.XMLURL)
 		}
-
 		for _, innerOutline := range outline.Outline {
 			if innerOutline.XMLURL != "" {
-				wg.Add(1)
-				go func(url string) {
-					defer wg.Done()
-					if _, err := AddPodcast(url); err != nil {
-						logger.Log.Errorw("adding podcast from OPML", "error", err)
-					}
-				}(innerOutline.XMLURL)
+				urls = append(urls, innerOutline.XMLURL)
 			}
 		}
 	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	added := 0
+	for _, feedURL := range urls {
+		wg.Add(1)
+		go func(url string) {
+			defer wg.Done()
+			if _, err := AddPodcast(ctx, url); err != nil {
+				logger.Log.Errorw("adding podcast from OPML", "error", err)
+				return
+			}
+			mu.Lock()
+			added++
+			mu.Unlock()
+		}(feedURL)
+	}
 	wg.Wait()
-	go func() {
-		if err := RefreshEpisodes(); err != nil {
-			logger.Log.Errorw("refreshing episodes", "error", err)
-		}
-	}()
-	return nil
+	return added, nil
 }
 
 // ExportOmpl export ompl.
@@ -171,7 +200,10 @@ func ExportOmpl(usePodgrabLink bool, baseURL string) ([]byte, error) {
 
 	outlines := make([]model.OpmlOutline, 0, len(*podcasts))
 	for i := range *podcasts {
-		xmlURL := (*podcasts)[i].URL
+		if (*podcasts)[i].IsLocal && !usePodgrabLink {
+			continue
+		}
+		xmlURL := redact.URL((*podcasts)[i].URL)
 		if usePodgrabLink {
 			xmlURL = fmt.Sprintf("%s/podcasts/%s/rss", baseURL, (*podcasts)[i].ID)
 		}
@@ -227,32 +259,47 @@ func getItunesImageURL(body []byte) string {
 }
 
 // AddPodcast add podcast.
-func AddPodcast(url string) (db.Podcast, error) {
+func AddPodcast(ctx context.Context, url string) (db.Podcast, error) {
+	return AddPodcastWithAuth(ctx, url, &FeedAuth{})
+}
+
+// AddPodcastWithAuth adds a private podcast, fetching its feed and episodes
+// with auth. Credentials embedded in url are stored with auth instead of in
+// the podcast's URL.
+func AddPodcastWithAuth(ctx context.Context, url string, auth *FeedAuth) (db.Podcast, error) {
+	url, embedded := splitFeedURL(url)
+	merged := auth.merged(&embedded)
+	auth = &merged
+	if err := auth.Validate(); err != nil {
+		return db.Podcast{}, err
+	}
 	var podcast db.Podcast
 	err := db.GetPodcastByURL(url, &podcast)
 	setting := db.GetOrCreateSetting()
 	if errors.Is(err, gorm.ErrRecordNotFound) {
-		data, body, fetchErr := FetchURL(url)
+		sealed, sealErr := sealFeedAuth(auth)
+		if sealErr != nil {
+			return db.Podcast{}, sealErr
+		}
+		ctx = withFeedAuth(ctx, url, auth)
+		data, body, fetchErr := FetchURL(ctx, url)
 		if fetchErr != nil {
 			logger.Log.Errorw("Error adding podcast", "error", fetchErr)
 			return db.Podcast{}, fetchErr
 		}
 
 		podcastItem := db.Podcast{
-			Title:   data.Channel.Title,
-			Summary: strip.StripTags(data.Channel.Summary),
-			Author:  data.Channel.Author,
-			Image:   data.Channel.Image.URL,
-			URL:     url,
-		}
-
-		if podcastItem.Image == "" {
-			podcastItem.Image = getItunesImageURL(body)
+			URL:      url,
+			FeedAuth: sealed,
 		}
+		setFeedMetadata(&podcastItem, &data, body)
+		applyPodcastOverrides(&podcastItem)
+		podcastItem.Folder = podcastItem.Title
 
 		err = db.CreatePodcast(&podcastItem)
 		go func() {
-			if _, dlErr := DownloadPodcastCoverImage(podcastItem.Image, podcastItem.Title); dlErr != nil {
+			imageCtx := withFeedAuth(BackgroundContext(), url, auth)
+			if _, dlErr := DownloadPodcastCoverImage(imageCtx, podcastItem.Image, podcastItem.DataFolder()); dlErr != nil {
 				logger.Log.Errorw("downloading podcast cover image", "error", dlErr)
 			}
 		}()
@@ -335,9 +382,14 @@ func determineDownloadStatus(setting *db.Setting, podcast *db.Podcast, newPodcas
 
 // parseDuration safely parses a duration string to integer.
 func parseDuration(durationStr string) int {
+	if durationStr == "" {
+		return 0
+	}
+	// Every refresh parses the durations of all entries, so failures are not
+	// worth more than a debug message.
 	duration, parseErr := strconv.Atoi(durationStr)
 	if parseErr != nil {
-		logger.Log.Errorw("parsing duration", "error", parseErr)
+		logger.Log.Debugw("parsing duration", "error", parseErr)
 		return 0
 	}
 	return duration
@@ -352,9 +404,32 @@ func extractSummary(summary, description string) string {
 	return cleanSummary
 }
 
+// startFeedRefresh tracks a refresh of a podcast's episodes. The returned
+// function records the outcome of the refresh.
+func startFeedRefresh(ctx context.Context, podcast *db.Podcast) (context.Context, func(error)) {
+	start := time.Now()
+	ctx, finish := trackWork(ctx, podcast.ID, "")
+	ctx = withPodcastAuth(ctx, podcast)
+	return ctx, func(err error) {
+		metrics.ObserveFeedRefresh(podcast.ID, start, err)
+		recordFeedHealth(podcast, err)
+		finish()
+	}
+}
+
 // AddPodcastItems add podcast items.
-func AddPodcastItems(podcast *db.Podcast, newPodcast bool) error {
-	data, _, err := FetchURL(podcast.URL)
+func AddPodcastItems(ctx context.Context, podcast *db.Podcast, newPodcast bool) (err error) {
+	ctx, done := startFeedRefresh(ctx, podcast)
+	defer func() { done(err) }()
+
+	if podcast.IsLocal {
+		_, err = scanLocalPodcast(ctx, podcast, newPodcast)
+		return err
+	}
+	data, _, err := FetchURL(ctx, podcast.URL)
+	if ctx.Err() != nil {
+		return context.Cause(ctx)
+	}
 	if err != nil {
 		return err
 	}
@@ -369,50 +444,55 @@ func AddPodcastItems(podcast *db.Podcast, newPodcast bool) error {
 
 	// Build existing items map
 	existingItems, err := db.GetPodcastItemsByPodcastIDAndGUIDs(podcast.ID, allGuids)
-	keyMap := make(map[string]int)
+	keyMap := make(map[string]*db.PodcastItem)
 	for i := range *existingItems {
-		keyMap[(*existingItems)[i].GUID] = 1
+		keyMap[(*existingItems)[i].GUID] = &(*existingItems)[i]
 	}
 
 	var latestDate = time.Time{}
-	var itemsAdded = make(map[string]string)
+	var itemsAdded []db.PodcastItem
+	var matcher *episodeMatcher
 
 	// Process each RSS item
 	for i := 0; i < len(data.Channel.Item); i++ {
-		obj := data.Channel.Item[i]
-		_, keyExists := keyMap[obj.GUID.Text]
-		if keyExists {
+		// Stop adding episodes of a podcast that is being deleted.
+		if ctx.Err() != nil {
+			return context.Cause(ctx)
+		}
+		podcastItem := feedEntry(podcast.ID, &data, i)
+		if existing, keyExists := keyMap[podcastItem.GUID]; keyExists {
+			updateEpisode(existing, &podcastItem, setting)
 			continue
 		}
-
-		// Parse item fields
-		duration := parseDuration(obj.Duration)
-		pubDate := parsePubDate(obj.PubDate)
-		downloadStatus := determineDownloadStatus(setting, podcast, newPodcast, i, limit)
-		summary := extractSummary(obj.Summary, obj.Description)
+		podcastItem.Fingerprint = feedFingerprint(&podcastItem)
+		podcastItem.DownloadStatus = determineDownloadStatus(setting, podcast, newPodcast, i, limit)
 
 		// Track latest episode date
-		if latestDate.Before(pubDate) {
-			latestDate = pubDate
-		}
-
-		// Create podcast item
-		podcastItem := db.PodcastItem{
-			PodcastID:      podcast.ID,
-			Title:          obj.Title,
-			Summary:        summary,
-			EpisodeType:    obj.EpisodeType,
-			Duration:       duration,
-			PubDate:        pubDate,
-			FileURL:        obj.Enclosure.URL,
-			GUID:           obj.GUID.Text,
-			Image:          obj.Image.Href,
-			DownloadStatus: downloadStatus,
+		if latestDate.Before(podcastItem.PubDate) {
+			latestDate = podcastItem.PubDate
+		}
+
+		if matcher == nil {
+			matcher = newPodcastMatcher(podcast.ID, setting, keyMap)
+		}
+		if existing, matchedBy := matcher.match(&podcastItem, enclosureLength(data.Channel.Item[i].Enclosure.Length)); existing != nil {
+			if mergeErr := mergeEpisode(existing, &podcastItem, matchedBy); mergeErr != nil {
+				logger.Log.Errorw("merging podcast item", "error", mergeErr)
+			}
+			continue
 		}
 		if createErr := db.CreatePodcastItem(&podcastItem); createErr != nil {
 			logger.Log.Errorw("creating podcast item", "error", createErr)
+			continue
 		}
-		itemsAdded[podcastItem.ID] = podcastItem.FileURL
+		itemsAdded = append(itemsAdded, podcastItem)
+	}
+
+	recordRemovedUpstream(podcast, allGuids)
+
+	// A newly added podcast would announce its whole back catalogue
+	if !newPodcast {
+		notifyNewEpisodes(podcast, itemsAdded)
 	}
 
 	// Update podcast with latest episode date
@@ -424,10 +504,108 @@ func AddPodcastItems(podcast *db.Podcast, newPodcast bool) error {
 	return err
 }
 
+// notifyNewEpisodes announces the episodes added to a podcast.
+func notifyNewEpisodes(podcast *db.Podcast, items []db.PodcastItem) {
+	for i := range items {
+		Notify(&Notification{
+			Event:        EventNewEpisode,
+			Title:        "New episode: " + podcast.Title,
+			Message:      items[i].Title,
+			PodcastID:    podcast.ID,
+			PodcastTitle: podcast.Title,
+			EpisodeID:    items[i].ID,
+			EpisodeTitle: items[i].Title,
+		})
+	}
+}
+
+// feedEntry returns the episode of a podcast described by the i-th entry of
+// its feed.
+func feedEntry(podcastID string, data *model.PodcastData, i int) db.PodcastItem {
+	obj := &data.Channel.Item[i]
+	return db.PodcastItem{
+		PodcastID:   podcastID,
+		Title:       obj.Title,
+		Summary:     extractSummary(obj.Summary, obj.Description),
+		EpisodeType: obj.EpisodeType,
+		Duration:    parseDuration(obj.Duration),
+		PubDate:     parsePubDate(obj.PubDate),
+		FileURL:     obj.Enclosure.URL,
+		GUID:        obj.GUID.Text,
+		Image:       obj.Image.Href,
+	}
+}
+
+// recordFeedHealth updates a podcast's feed failure count after a refresh and
+// notifies when the feed looks dead. Throttled refreshes are counted when the
+// host asks to slow down rather than as failures.
+func recordFeedHealth(podcast *db.Podcast, refreshErr error) {
+	if db.DB == nil || podcast.ID == "" || isCancelled(refreshErr) || errors.Is(refreshErr, ErrHostThrottled) {
+		return
+	}
+	if refreshErr == nil {
+		if err := db.RecordFeedSuccess(podcast.ID); err != nil {
+			logger.Log.Errorw("recording feed success", "error", err)
+		}
+		clearFailureAlerts(EventFeedDead, podcast.ID)
+		return
+	}
+	count, err := db.RecordFeedFailure(podcast.ID, refreshErr.Error())
+	if err != nil {
+		logger.Log.Errorw("recording feed failure", "error", err)
+		return
+	}
+	Notify(&Notification{
+		Event:        EventFeedDead,
+		Title:        "Feed failing: " + podcast.Title,
+		Message:      fmt.Sprintf("The feed has failed %d times in a row: %s", count, refreshErr.Error()),
+		PodcastID:    podcast.ID,
+		PodcastTitle: podcast.Title,
+		Count:        count,
+	})
+}
+
+// recordDownloadFailure counts a failed episode download and notifies once
+// the failure threshold of a target is reached.
+func recordDownloadFailure(item *db.PodcastItem, downloadErr error) {
+	// Downloads stopped by shutdown resume on the next start, cancelled
+	// downloads did not fail and throttled downloads stay queued.
+	if isCancelled(downloadErr) || errors.Is(downloadErr, ErrHostThrottled) {
+		return
+	}
+	count, err := db.IncrementDownloadFailureCount(item.ID)
+	if err != nil {
+		logger.Log.Errorw("recording download failure", "error", err)
+		return
+	}
+	Notify(&Notification{
+		Event:        EventDownloadFailed,
+		Title:        "Download failed: " + item.Title,
+		Message:      fmt.Sprintf("%s has failed to download %d times: %s", item.Title, count, downloadErr.Error()),
+		PodcastID:    item.PodcastID,
+		PodcastTitle: item.Podcast.Title,
+		EpisodeID:    item.ID,
+		EpisodeTitle: item.Title,
+		Count:        count,
+	})
+}
+
+func notifyDownloadComplete(item *db.PodcastItem) {
+	Notify(&Notification{
+		Event:        EventDownloadComplete,
+		Title:        "Downloaded: " + item.Podcast.Title,
+		Message:      item.Title,
+		PodcastID:    item.PodcastID,
+		PodcastTitle: item.Podcast.Title,
+		EpisodeID:    item.ID,
+		EpisodeTitle: item.Title,
+	})
+}
+
 //nolint:unused // Function reserved for future use (see line 387)
 func updateSizeFromURL(itemURLMap map[string]string) {
 	for id, url := range itemURLMap {
-		size, err := GetFileSizeFromURL(url)
+		size, err := GetFileSizeFromURL(context.Background(), url)
 		if err != nil {
 			size = 1
 		}
@@ -439,7 +617,7 @@ func updateSizeFromURL(itemURLMap map[string]string) {
 }
 
 // UpdateAllFileSizes update all file sizes.
-func UpdateAllFileSizes() {
+func UpdateAllFileSizes(ctx context.Context) {
 	items, err := db.GetAllPodcastItemsWithoutSize()
 	if err != nil {
 		return
@@ -452,7 +630,7 @@ func UpdateAllFileSizes() {
 				logger.Log.Errorw("getting file size for %s", "error", (*items)[i].DownloadPath, err)
 			}
 		} else {
-			size, err = GetFileSizeFromURL((*items)[i].FileURL)
+			size, err = GetFileSizeFromURL(withPodcastAuth(ctx, &(*items)[i].Podcast), (*items)[i].FileURL)
 			if err != nil {
 				logger.Log.Errorw("getting file size from URL %s", "error", (*items)[i].FileURL, err)
 			}
@@ -476,7 +654,7 @@ func SetPodcastItemAsQueuedForDownload(id string) error {
 }
 
 // DownloadMissingImages download missing images.
-func DownloadMissingImages() error {
+func DownloadMissingImages(ctx context.Context) error {
 	setting := db.GetOrCreateSetting()
 	if !setting.DownloadEpisodeImages {
 		logger.Log.Info("No Need To Download Images")
@@ -487,21 +665,25 @@ func DownloadMissingImages() error {
 		return err
 	}
 	for i := range *items {
-		if err := downloadImageLocally((*items)[i].ID); err != nil {
+		if ctx.Err() != nil {
+			return context.Cause(ctx)
+		}
+		if err := downloadImageLocally(ctx, (*items)[i].ID); err != nil {
 			logger.Log.Errorw("downloading image locally", "error", err)
 		}
 	}
 	return nil
 }
 
-func downloadImageLocally(podcastItemID string) error {
+func downloadImageLocally(ctx context.Context, podcastItemID string) error {
 	var podcastItem db.PodcastItem
 	err := db.GetPodcastItemByID(podcastItemID, &podcastItem)
 	if err != nil {
 		return err
 	}
 
-	path, err := DownloadImage(podcastItem.Image, podcastItem.ID, podcastItem.Podcast.Title)
+	ctx = withPodcastAuth(ctx, &podcastItem.Podcast)
+	path, err := DownloadImage(ctx, podcastItem.Image, podcastItem.ID, podcastItem.Podcast.DataFolder())
 	if err != nil {
 		return err
 	}
@@ -544,6 +726,8 @@ func SetPodcastItemAsDownloaded(id, location string) error {
 	podcastItem.DownloadDate = time.Now()
 	podcastItem.DownloadPath = location
 	podcastItem.DownloadStatus = db.Downloaded
+	podcastItem.DownloadFailureCount = 0
+	clearFailureAlerts(EventDownloadFailed, podcastItem.ID)
 
 	return db.UpdatePodcastItem(&podcastItem)
 }
@@ -574,13 +758,13 @@ func SetPodcastItemPlayedStatus(id string, isPlayed bool) error {
 }
 
 // SetAllEpisodesToDownload set all episodes to download.
-func SetAllEpisodesToDownload(podcastID string) error {
+func SetAllEpisodesToDownload(ctx context.Context, podcastID string) error {
 	var podcast db.Podcast
 	err := db.GetPodcastByID(podcastID, &podcast)
 	if err != nil {
 		return err
 	}
-	if err := AddPodcastItems(&podcast, false); err != nil {
+	if err := AddPodcastItems(ctx, &podcast, false); err != nil {
 		logger.Log.Errorw("adding podcast items", "error", err)
 	}
 	return db.SetAllEpisodesToDownload(podcastID)
@@ -607,40 +791,70 @@ func GetPodcastPrefix(item *db.PodcastItem, setting *db.Setting) string {
 }
 
 // DownloadMissingEpisodes download missing episodes.
-func DownloadMissingEpisodes() error {
+func DownloadMissingEpisodes(ctx context.Context) error {
+	return downloadQueuedEpisodes(ctx, db.GetAllPodcastItemsToBeDownloaded)
+}
+
+// downloadQueuedEpisodes downloads the queued episodes returned by queued.
+func downloadQueuedEpisodes(ctx context.Context, queued func() (*[]db.PodcastItem, error)) error {
 	// Early return if database is not available (e.g., during test cleanup)
 	if db.DB == nil {
 		return nil
 	}
 
 	const jobName = "DownloadMissingEpisodes"
-	lock := db.GetLock(jobName)
-	if lock.IsLocked() {
+	release, err := holdJobLock(jobName, jobMaxRuntime)
+	if errors.Is(err, ErrJobLocked) {
 		logger.Log.Debugw("Job is locked", "job_name", jobName)
 		return nil
 	}
-	db.Lock(jobName, 120)
+	if err != nil {
+		return err
+	}
+	defer release()
 	setting := db.GetOrCreateSetting()
+	// Queued episodes wait for the download window rather than fail.
+	if pauseErr := downloadsPaused(setting, time.Now()); pauseErr != nil {
+		logger.Log.Infow("Downloads paused, episodes stay queued", "reason", pauseErr)
+		return nil
+	}
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	go watchDownloadWindow(ctx, cancel)
 
-	data, err := db.GetAllPodcastItemsToBeDownloaded()
+	data, err := queued()
 
-	logger.Log.Infow("Processing episodes", "count", len(*data))
 	if err != nil {
 		return err
 	}
+	logger.Log.Infow("Processing episodes", "count", len(*data))
+	metrics.DownloadQueueDepth.Set(float64(len(*data)))
 	var wg sync.WaitGroup
 	for index := range *data {
+		if ctx.Err() != nil {
+			// The episodes not started are no longer waiting in this job.
+			metrics.DownloadQueueDepth.Sub(float64(len(*data) - index))
+			break
+		}
 		wg.Add(1)
 		go func(item db.PodcastItem, setting db.Setting) {
 			defer wg.Done()
-			url, dlErr := Download(item.FileURL, item.Title, item.Podcast.Title, GetPodcastPrefix(&item, &setting))
+			defer metrics.DownloadQueueDepth.Dec()
+			if !stillQueued(item.ID) {
+				return
+			}
+			url, dlErr := downloadEpisode(ctx, &item, &setting)
 			if dlErr != nil {
 				logger.Log.Errorw("downloading episode", "error", dlErr)
+				recordDownloadFailure(&item, dlErr)
 				return
 			}
 			if err := SetPodcastItemAsDownloaded(item.ID, url); err != nil {
 				logger.Log.Errorw("setting podcast item as downloaded", "error", err)
+				return
 			}
+			notifyDownloadComplete(&item)
+			refreshPlaylistFile(item.PodcastID, &setting)
 		}((*data)[index], *setting)
 
 		if index%setting.MaxDownloadConcurrency == 0 {
@@ -648,10 +862,35 @@ func DownloadMissingEpisodes() error {
 		}
 	}
 	wg.Wait()
-	db.Unlock(jobName)
 	return nil
 }
 
+// stillQueued reports whether an episode read from the download queue should
+// still be downloaded. It may have been cancelled or its podcast paused since.
+func stillQueued(podcastItemID string) bool {
+	var podcastItem db.PodcastItem
+	if err := db.GetPodcastItemByID(podcastItemID, &podcastItem); err != nil {
+		return false
+	}
+	return podcastItem.DownloadStatus == db.NotDownloaded && !podcastItem.Podcast.IsPaused && !podcastItem.Podcast.IsLocal
+}
+
+// downloadEpisode downloads an episode's file. The download can be cancelled
+// through CancelDownload or by pausing or deleting the podcast.
+func downloadEpisode(ctx context.Context, podcastItem *db.PodcastItem, setting *db.Setting) (string, error) {
+	applyBandwidthLimits(setting)
+	ctx, finish := trackWork(ctx, podcastItem.PodcastID, podcastItem.ID)
+	defer finish()
+	// The folder is read once the download is tracked, as moving the folder
+	// stops tracked downloads.
+	folder, err := db.GetPodcastDataFolder(podcastItem.PodcastID)
+	if err != nil {
+		return "", err
+	}
+	ctx = withPodcastAuth(ctx, &podcastItem.Podcast)
+	return Download(ctx, podcastItem.FileURL, podcastItem.Title, folder, GetPodcastPrefix(podcastItem, setting))
+}
+
 // CheckMissingFiles check missing files.
 func CheckMissingFiles() error {
 	data, err := db.GetAllPodcastItemsAlreadyDownloaded()
@@ -685,6 +924,12 @@ func DeleteEpisodeFile(podcastItemID string) error {
 	if err != nil {
 		return err
 	}
+	if podcastItem.Podcast.IsLocal {
+		return fmt.Errorf("%w: its files are its episodes", ErrLocalPodcast)
+	}
+	cancelWork(errEpisodeDeleted, func(work *inFlight) bool {
+		return work.itemID == podcastItemID
+	})
 
 	err = DeleteFile(podcastItem.DownloadPath)
 
@@ -701,11 +946,15 @@ func DeleteEpisodeFile(podcastItemID string) error {
 		}()
 	}
 
-	return SetPodcastItemAsNotDownloaded(podcastItem.ID, db.Deleted)
+	if err := SetPodcastItemAsNotDownloaded(podcastItem.ID, db.Deleted); err != nil {
+		return err
+	}
+	refreshPlaylistFile(podcastItem.PodcastID, db.GetOrCreateSetting())
+	return nil
 }
 
 // DownloadSingleEpisode download single episode.
-func DownloadSingleEpisode(podcastItemID string) error {
+func DownloadSingleEpisode(ctx context.Context, podcastItemID string) error {
 	var podcastItem db.PodcastItem
 	err := db.GetPodcastItemByID(podcastItemID, &podcastItem)
 
@@ -718,16 +967,21 @@ func DownloadSingleEpisode(podcastItemID string) error {
 		logger.Log.Errorw("setting podcast item as queued for download", "error", queueErr)
 	}
 
-	url, dlErr := Download(podcastItem.FileURL, podcastItem.Title, podcastItem.Podcast.Title, GetPodcastPrefix(&podcastItem, setting))
+	url, dlErr := downloadEpisode(ctx, &podcastItem, setting)
 
 	if dlErr != nil {
 		logger.Log.Error(dlErr.Error())
+		recordDownloadFailure(&podcastItem, dlErr)
 		return dlErr
 	}
 	err = SetPodcastItemAsDownloaded(podcastItem.ID, url)
+	if err == nil {
+		notifyDownloadComplete(&podcastItem)
+		refreshPlaylistFile(podcastItem.PodcastID, setting)
+	}
 
 	if setting.DownloadEpisodeImages {
-		if imgErr := downloadImageLocally(podcastItem.ID); imgErr != nil {
+		if imgErr := downloadImageLocally(ctx, podcastItem.ID); imgErr != nil {
 			logger.Log.Errorw("downloading image locally", "error", imgErr)
 		}
 	}
@@ -735,7 +989,7 @@ func DownloadSingleEpisode(podcastItemID string) error {
 }
 
 // RefreshEpisodes refresh episodes.
-func RefreshEpisodes() error {
+func RefreshEpisodes(ctx context.Context) error {
 	var data []db.Podcast
 	err := db.GetAllPodcasts(&data, "")
 
@@ -743,24 +997,46 @@ func RefreshEpisodes() error {
 		return err
 	}
 	for i := range data {
+		if ctx.Err() != nil {
+			return context.Cause(ctx)
+		}
 		isNewPodcast := data[i].LastEpisode == nil
 		if isNewPodcast {
 			logger.Log.Infow("Processing new podcast", "title", data[i].Title)
 			db.ForceSetLastEpisodeDate(data[i].ID)
 		}
-		if err := AddPodcastItems(&data[i], isNewPodcast); err != nil {
+		if err := AddPodcastItems(ctx, &data[i], isNewPodcast); err != nil {
 			logger.Log.Errorw("adding podcast items", "error", err)
 		}
 	}
 
 	// Download missing episodes synchronously to avoid race conditions in tests
-	if err := DownloadMissingEpisodes(); err != nil {
+	if err := DownloadMissingEpisodes(ctx); err != nil {
 		logger.Log.Errorw("downloading missing episodes", "error", err)
 	}
 
 	return nil
 }
 
+// RefreshPodcast fetches new episodes for a single podcast and downloads its pending episodes.
+func RefreshPodcast(ctx context.Context, id string) error {
+	var podcast db.Podcast
+	if err := db.GetPodcastByID(id, &podcast); err != nil {
+		return err
+	}
+	isNewPodcast := podcast.LastEpisode == nil
+	if isNewPodcast {
+		db.ForceSetLastEpisodeDate(podcast.ID)
+	}
+	if err := AddPodcastItems(ctx, &podcast, isNewPodcast); err != nil {
+		return err
+	}
+	// Only this podcast's queue is downloaded; the others wait for the job.
+	return downloadQueuedEpisodes(ctx, func() (*[]db.PodcastItem, error) {
+		return db.GetPodcastItemsToBeDownloadedByPodcastID(podcast.ID)
+	})
+}
+
 // DeletePodcastEpisodes delete podcast episodes.
 func DeletePodcastEpisodes(id string) error {
 	var podcast db.Podcast
@@ -769,12 +1045,16 @@ func DeletePodcastEpisodes(id string) error {
 	if err != nil {
 		return err
 	}
+	if podcast.IsLocal {
+		return fmt.Errorf("%w: its files are its episodes", ErrLocalPodcast)
+	}
 	var podcastItems []db.PodcastItem
 
 	err = db.GetAllPodcastItemsByPodcastID(id, &podcastItems)
 	if err != nil {
 		return err
 	}
+	cancelPodcastDownloads(id, errEpisodeDeleted)
 	for i := range podcastItems {
 		if delErr := DeleteFile(podcastItems[i].DownloadPath); delErr != nil {
 			logger.Log.Errorw("deleting file", "error", delErr)
@@ -805,6 +1085,17 @@ func DeletePodcast(id string, deleteFiles bool) error {
 	if err != nil {
 		return err
 	}
+	// Stop feed fetches and downloads before their files and rows are removed.
+	cancelWork(errPodcastDeleted, func(work *inFlight) bool {
+		return work.podcastID == id
+	})
+	// The files in the folder of a local podcast are the user's own and stay
+	// in place, even when the folder is the podcast's data folder.
+	keepFolder := false
+	if podcast.IsLocal && podcast.LocalPath != "" {
+		deleteFiles = false
+		keepFolder = inDataFolder(podcast.LocalPath, &podcast)
+	}
 	for i := range podcastItems {
 		if deleteFiles {
 			if delErr := DeleteFile(podcastItems[i].DownloadPath); delErr != nil {
@@ -821,15 +1112,17 @@ func DeletePodcast(id string, deleteFiles bool) error {
 		}
 	}
 
-	err = deletePodcastFolder(podcast.Title)
-	if err != nil {
-		return err
+	if !keepFolder {
+		if err := deletePodcastFolder(podcast.DataFolder()); err != nil {
+			return err
+		}
 	}
 
 	err = db.DeletePodcastByID(id)
 	if err != nil {
 		return err
 	}
+	metrics.ForgetPodcast(id)
 	return nil
 }
 
@@ -845,16 +1138,18 @@ func DeleteTag(id string) error {
 	return nil
 }
 
-func makeQuery(url string) ([]byte, error) {
+func makeQuery(ctx context.Context, url string) ([]byte, error) {
 	// link := "https://www.goodreads.com/search/index.xml?q=Good%27s+Omens&key=" + "jCmNlIXjz29GoB8wYsrd0w"
 	// link := "https://www.goodreads.com/search/index.xml?key=jCmNlIXjz29GoB8wYsrd0w&q=Ender%27s+Game"
 	logger.Log.Debugw("Making query", "url", url)
-	req, err := http.NewRequest("GET", url, http.NoBody)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, http.NoBody)
 	if err != nil {
 		return nil, err
 	}
 
-	resp, err := http.DefaultClient.Do(req) //nolint:gosec // G704: URL is a user-provided podcast RSS feed URL, SSRF is by design
+	applyFeedAuth(req)
+
+	resp, err := politeDo(httpClient(), req)
 	if err != nil {
 		return nil, err
 	}
@@ -909,33 +1204,51 @@ func GetSearchFromPodcastIndex(pod *podcastindex.Podcast) *model.CommonSearchRes
 	return p
 }
 
+// SettingsUpdate is the settings changed from the settings page and the API.
+type SettingsUpdate struct {
+	BaseURL                       string
+	UserAgent                     string
+	DedupSensitivity              string
+	InitialDownloadCount          int
+	MaxDownloadConcurrency        int
+	DownloadOnAdd                 bool
+	AutoDownload                  bool
+	AppendDateToFileName          bool
+	AppendEpisodeNumberToFileName bool
+	DarkMode                      bool
+	DownloadEpisodeImages         bool
+	GenerateNFOFile               bool
+	DontDownloadDeletedFromDisk   bool
+	RedownloadChangedEnclosures   bool
+	WritePlaylistFiles            bool
+}
+
 // UpdateSettings update settings.
-func UpdateSettings(downloadOnAdd bool, initialDownloadCount int, autoDownload bool,
-	appendDateToFileName bool, appendEpisodeNumberToFileName bool, darkMode bool, downloadEpisodeImages bool,
-	generateNFOFile bool, dontDownloadDeletedFromDisk bool, baseURL string, maxDownloadConcurrency int, userAgent string) error {
+func UpdateSettings(update *SettingsUpdate) error {
+	if err := validateDedupSensitivity(update.DedupSensitivity); err != nil {
+		return err
+	}
 	setting := db.GetOrCreateSetting()
 
-	setting.AutoDownload = autoDownload
-	setting.DownloadOnAdd = downloadOnAdd
-	setting.InitialDownloadCount = initialDownloadCount
-	setting.AppendDateToFileName = appendDateToFileName
-	setting.AppendEpisodeNumberToFileName = appendEpisodeNumberToFileName
-	setting.DarkMode = darkMode
-	setting.DownloadEpisodeImages = downloadEpisodeImages
-	setting.GenerateNFOFile = generateNFOFile
-	setting.DontDownloadDeletedFromDisk = dontDownloadDeletedFromDisk
-	setting.BaseURL = baseURL
-	setting.MaxDownloadConcurrency = maxDownloadConcurrency
-	setting.UserAgent = userAgent
+	setting.AutoDownload = update.AutoDownload
+	setting.DownloadOnAdd = update.DownloadOnAdd
+	setting.InitialDownloadCount = update.InitialDownloadCount
+	setting.AppendDateToFileName = update.AppendDateToFileName
+	setting.AppendEpisodeNumberToFileName = update.AppendEpisodeNumberToFileName
+	setting.DarkMode = update.DarkMode
+	setting.DownloadEpisodeImages = update.DownloadEpisodeImages
+	setting.GenerateNFOFile = update.GenerateNFOFile
+	setting.DontDownloadDeletedFromDisk = update.DontDownloadDeletedFromDisk
+	setting.BaseURL = update.BaseURL
+	setting.MaxDownloadConcurrency = update.MaxDownloadConcurrency
+	setting.UserAgent = update.UserAgent
+	setting.DedupSensitivity = update.DedupSensitivity
+	setting.RedownloadChangedEnclosures = update.RedownloadChangedEnclosures
+	setting.WritePlaylistFiles = update.WritePlaylistFiles
 
 	return db.UpdateSettings(setting)
 }
 
-// UnlockMissedJobs unlock missed jobs.
-func UnlockMissedJobs() {
-	db.UnlockMissedJobs()
-}
-
 // AddTag add tag.
 func AddTag(label, description string) (db.Tag, error) {
 	tag, err := db.GetTagByLabel(label)
@@ -961,5 +1274,12 @@ func TogglePodcastPause(id string, isPaused bool) error {
 		return err
 	}
 
-	return db.TogglePodcastPauseStatus(id, isPaused)
+	if err := db.TogglePodcastPauseStatus(id, isPaused); err != nil {
+		return err
+	}
+	// Paused downloads keep their partial files and resume with the podcast.
+	if isPaused {
+		cancelPodcastDownloads(id, errPodcastPaused)
+	}
+	return nil
 }
@@ -2,6 +2,7 @@
 package service
 
 import (
+	"context"
 	"errors"
 	"net/http"
 	"net/http/httptest"
@@ -9,10 +10,13 @@ import (
 	"time"
 
 	"github.com/akhilrex/podgrab/db"
+	"github.com/akhilrex/podgrab/internal/metrics"
 	testhelpers "github.com/akhilrex/podgrab/internal/testing"
 	"github.com/akhilrex/podgrab/model"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
 )
 
 // TestParseOpml tests OPML file parsing.
@@ -156,7 +160,7 @@ func TestFetchURL(t *testing.T) {
 			defer server.Close()
 
 			// Fetch URL
-			data, body, err := FetchURL(server.URL)
+			data, body, err := FetchURL(context.Background(), server.URL)
 
 			if tt.wantError {
 				assert.Error(t, err, "Expected error fetching URL")
@@ -273,6 +277,14 @@ func TestGetAllPodcasts(t *testing.T) {
 	assert.Equal(t, 1, found.DownloadedEpisodesCount, "Should have correct downloaded count")
 	assert.Equal(t, 1, found.DownloadingEpisodesCount, "Should have correct downloading count")
 	assert.Equal(t, 2, found.AllEpisodesCount, "Should have correct total count")
+
+	single, err := GetPodcastWithStats(podcast1.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 2, single.AllEpisodesCount)
+	assert.Equal(t, int64(1000000), single.DownloadedEpisodesSize)
+
+	_, err = GetPodcastWithStats("missing")
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
 }
 
 // TestGetPodcastPrefix tests filename prefix generation.
@@ -337,20 +349,24 @@ func TestUpdateSettings(t *testing.T) {
 	db.CreateTestSetting(t, database)
 
 	// Update settings
-	err := UpdateSettings(
-		false,               // downloadOnAdd
-		10,                  // initialDownloadCount
-		false,               // autoDownload
-		true,                // appendDateToFileName
-		true,                // appendEpisodeNumberToFileName
-		true,                // darkMode
-		true,                // downloadEpisodeImages
-		false,               // generateNFOFile
-		true,                // dontDownloadDeletedFromDisk
-		"http://test.local", // baseURL
-		10,                  // maxDownloadConcurrency
-		"TestAgent/1.0",     // userAgent
-	)
+	update := SettingsUpdate{
+		DownloadOnAdd:                 false,
+		InitialDownloadCount:          10,
+		AutoDownload:                  false,
+		AppendDateToFileName:          true,
+		AppendEpisodeNumberToFileName: true,
+		DarkMode:                      true,
+		DownloadEpisodeImages:         true,
+		GenerateNFOFile:               false,
+		DontDownloadDeletedFromDisk:   true,
+		BaseURL:                       "http://test.local",
+		MaxDownloadConcurrency:        10,
+		UserAgent:                     "TestAgent/1.0",
+		DedupSensitivity:              DedupLoose,
+		RedownloadChangedEnclosures:   true,
+		WritePlaylistFiles:            true,
+	}
+	err := UpdateSettings(&update)
 
 	require.NoError(t, err, "Should update settings without error")
 
@@ -366,6 +382,13 @@ func TestUpdateSettings(t *testing.T) {
 	assert.Equal(t, "http://test.local", setting.BaseURL, "BaseURL should be updated")
 	assert.Equal(t, 10, setting.MaxDownloadConcurrency, "MaxDownloadConcurrency should be updated")
 	assert.Equal(t, "TestAgent/1.0", setting.UserAgent, "UserAgent should be updated")
+	assert.Equal(t, DedupLoose, setting.DedupSensitivity, "DedupSensitivity should be updated")
+	assert.True(t, setting.RedownloadChangedEnclosures, "RedownloadChangedEnclosures should be updated")
+	assert.True(t, setting.WritePlaylistFiles, "WritePlaylistFiles should be updated")
+
+	update.DedupSensitivity = "fuzzy"
+	err = UpdateSettings(&update)
+	assert.ErrorIs(t, err, ErrInvalidDedupSensitivity)
 }
 
 // TestSetPodcastItemPlayedStatus tests marking episodes as played/unplayed.
@@ -589,7 +612,7 @@ func TestGetPodcastItemById(t *testing.T) {
 // TestMakeQuery tests HTTP request making (network error cases).
 func TestMakeQuery_NetworkError(t *testing.T) {
 	// Test with invalid URL
-	_, err := makeQuery("http://invalid-domain-that-does-not-exist.local")
+	_, err := makeQuery(context.Background(), "http://invalid-domain-that-does-not-exist.local")
 	assert.Error(t, err, "Should error on network failure")
 }
 
@@ -616,6 +639,12 @@ func TestExportOmpl(t *testing.T) {
 		URL:     "https://example.com/feed2.xml",
 	})
 
+	db.CreateTestPodcast(t, database, &db.Podcast{
+		Title:   "Local Podcast",
+		URL:     "https://example.com/local.xml",
+		IsLocal: true,
+	})
+
 	tests := []struct {
 		name           string
 		baseURL        string
@@ -647,8 +676,10 @@ func TestExportOmpl(t *testing.T) {
 
 			if tt.usePodgrabLink {
 				assert.Contains(t, string(data), tt.baseURL, "Should use Podgrab base URL")
+				assert.Contains(t, string(data), "Local Podcast", "Should include local podcasts served by Podgrab")
 			} else {
 				assert.Contains(t, string(data), "https://example.com/feed1.xml", "Should use original URL")
+				assert.NotContains(t, string(data), "Local Podcast", "Should skip local podcasts, which have no feed")
 			}
 		})
 	}
@@ -733,7 +764,7 @@ func TestAddPodcast_NetworkError(t *testing.T) {
 	db.CreateTestSetting(t, database)
 
 	// Try to add podcast with invalid URL
-	_, err := AddPodcast("http://invalid-domain-that-does-not-exist.local/feed.xml")
+	_, err := AddPodcast(context.Background(), "http://invalid-domain-that-does-not-exist.local/feed.xml")
 	assert.Error(t, err, "Should error on network failure")
 }
 
@@ -755,7 +786,7 @@ func TestAddPodcast_DuplicateURL(t *testing.T) {
 	})
 
 	// Try to add duplicate
-	_, err := AddPodcast(existingURL)
+	_, err := AddPodcast(context.Background(), existingURL)
 	assert.Error(t, err, "Should error on duplicate URL")
 
 	// Verify it's the correct error type
@@ -831,3 +862,98 @@ func TestGetTagsByIds(t *testing.T) {
 	require.NotNil(t, tags, "Should return tags")
 	assert.Len(t, *tags, 2, "Should return both tags")
 }
+
+// TestImportOpml tests adding every feed from an OPML document.
+func TestImportOpml(t *testing.T) {
+	database := testhelpers.SetupTestDB(t)
+	defer testhelpers.TeardownTestDB(t, database)
+
+	originalDB := db.DB
+	db.DB = database
+	defer func() { db.DB = originalDB }()
+
+	_, cleanup := testhelpers.SetupTestDataDir(t)
+	defer cleanup()
+
+	db.CreateTestSetting(t, database)
+
+	server := httptest.NewServer(testhelpers.CreateMockRSSHandler(testhelpers.ValidRSSFeed))
+	defer server.Close()
+
+	content := `<?xml version="1.0" encoding="UTF-8"?>
+<opml version="2.0">
+  <body>
+    <outline text="Test Podcast" type="rss" xmlUrl="` + server.URL + `/feed.xml" />
+    <outline text="Category">
+      <outline text="Nested Podcast" type="rss" xmlUrl="` + server.URL + `/nested.xml" />
+    </outline>
+  </body>
+</opml>`
+
+	added, err := ImportOpml(context.Background(), content)
+	require.NoError(t, err, "Should import OPML")
+	assert.Equal(t, 2, added, "Should add both feeds")
+
+	var count int64
+	database.Model(&db.Podcast{}).Count(&count)
+	assert.Equal(t, int64(2), count, "Should store both podcasts")
+
+	added, err = ImportOpml(context.Background(), content)
+	require.NoError(t, err, "Should import OPML again")
+	assert.Equal(t, 0, added, "Should skip feeds that already exist")
+
+	_, err = ImportOpml(context.Background(), "not valid xml")
+	assert.Error(t, err, "Should error on invalid OPML")
+}
+
+// TestAddPodcastItems_RecordsMetrics tests that feed refreshes update the refresh metrics.
+func TestAddPodcastItems_RecordsMetrics(t *testing.T) {
+	database := testhelpers.SetupTestDB(t)
+	defer testhelpers.TeardownTestDB(t, database)
+
+	originalDB := db.DB
+	db.DB = database
+	defer func() { db.DB = originalDB }()
+
+	db.CreateTestSetting(t, database)
+
+	server := httptest.NewServer(testhelpers.CreateMockRSSHandler(testhelpers.ValidRSSFeed))
+	defer server.Close()
+
+	podcast := db.CreateTestPodcast(t, database)
+	podcast.URL = server.URL
+	success := metrics.FeedRefreshes.WithLabelValues(podcast.ID, metrics.ResultSuccess)
+	failure := metrics.FeedRefreshes.WithLabelValues(podcast.ID, metrics.ResultFailure)
+	successBefore := testutil.ToFloat64(success)
+	failureBefore := testutil.ToFloat64(failure)
+
+	require.NoError(t, AddPodcastItems(context.Background(), podcast, false))
+	assert.Equal(t, successBefore+1, testutil.ToFloat64(success), "Should count successful refresh")
+
+	server.Close()
+	require.Error(t, AddPodcastItems(context.Background(), podcast, false))
+	assert.Equal(t, failureBefore+1, testutil.ToFloat64(failure), "Should count failed refresh")
+}
+
+// TestDownloadMissingEpisodes_CancelledQueueDepth tests that episodes left
+// queued by a cancelled download job are not reported as waiting.
+func TestDownloadMissingEpisodes_CancelledQueueDepth(t *testing.T) {
+	database := testhelpers.SetupTestDB(t)
+	defer testhelpers.TeardownTestDB(t, database)
+
+	originalDB := db.DB
+	db.DB = database
+	defer func() { db.DB = originalDB }()
+
+	db.CreateTestSetting(t, database)
+	podcast := db.CreateTestPodcast(t, database)
+	for i := 0; i < 3; i++ {
+		db.CreateTestPodcastItem(t, database, podcast.ID)
+	}
+	metrics.DownloadQueueDepth.Set(0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.NoError(t, DownloadMissingEpisodes(ctx))
+	assert.Zero(t, testutil.ToFloat64(metrics.DownloadQueueDepth))
+}
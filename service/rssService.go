@@ -0,0 +1,222 @@
+package service
+
+import (
+	"encoding/xml"
+	"io"
+	"mime"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+// RssContentType is the media type of the RSS feeds Podgrab generates.
+const RssContentType = "application/rss+xml; charset=utf-8"
+
+// Namespaces of the elements in generated RSS feeds.
+const (
+	itunesNamespace = "http://www.itunes.com/dtds/podcast-1.0.dtd"
+	atomNamespace   = "http://www.w3.org/2005/Atom"
+)
+
+// enclosureTypes are the media types of episode files by extension, which
+// the mime package does not know on most systems.
+var enclosureTypes = map[string]string{
+	".mp3":  "audio/mpeg",
+	".m4a":  "audio/mp4",
+	".m4b":  "audio/mp4",
+	".aac":  "audio/aac",
+	".ogg":  "audio/ogg",
+	".oga":  "audio/ogg",
+	".opus": "audio/ogg",
+	".flac": "audio/flac",
+	".wav":  "audio/wav",
+	".mp4":  "video/mp4",
+	".m4v":  "video/x-m4v",
+	".mov":  "video/quicktime",
+	".webm": "video/webm",
+}
+
+// RssFeed is a feed generated from episodes.
+type RssFeed struct {
+	// LastBuildDate is when the content of the feed last changed, zero when
+	// it is unknown.
+	LastBuildDate time.Time
+	Title         string
+	Description   string
+	Link          string
+	Image         string
+	Author        string
+	// SelfURL is where the feed is published. FirstURL, PreviousURL and
+	// NextURL link the other pages of a paged feed and are empty otherwise.
+	SelfURL     string
+	FirstURL    string
+	PreviousURL string
+	NextURL     string
+	Items       []RssFeedItem
+}
+
+// RssFeedItem is an episode in a generated feed.
+type RssFeedItem struct {
+	PubDate      time.Time
+	GUID         string
+	Title        string
+	Description  string
+	Link         string
+	Image        string
+	EnclosureURL string
+	// EnclosureType is the media type of the episode file.
+	EnclosureType string
+	EpisodeType   string
+	Length        int64
+	// Duration is in seconds, zero when it is unknown.
+	Duration int
+}
+
+type rssDocument struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Itunes  string     `xml:"xmlns:itunes,attr"`
+	Atom    string     `xml:"xmlns:atom,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	ItunesImage   *rssHref      `xml:"itunes:image"`
+	Title         string        `xml:"title"`
+	Link          string        `xml:"link"`
+	Description   string        `xml:"description"`
+	Generator     string        `xml:"generator"`
+	LastBuildDate string        `xml:"lastBuildDate,omitempty"`
+	Author        string        `xml:"itunes:author,omitempty"`
+	Summary       string        `xml:"itunes:summary,omitempty"`
+	Explicit      string        `xml:"itunes:explicit"`
+	AtomLinks     []rssAtomLink `xml:"atom:link"`
+	Image         *rssImage     `xml:"image"`
+	Items         []rssItem     `xml:"item"`
+}
+
+type rssAtomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+	Type string `xml:"type,attr"`
+}
+
+type rssImage struct {
+	URL   string `xml:"url"`
+	Title string `xml:"title"`
+	Link  string `xml:"link"`
+}
+
+type rssHref struct {
+	Href string `xml:"href,attr"`
+}
+
+type rssItem struct {
+	ItunesImage *rssHref     `xml:"itunes:image"`
+	Title       string       `xml:"title"`
+	Link        string       `xml:"link,omitempty"`
+	Description string       `xml:"description"`
+	GUID        rssGUID      `xml:"guid"`
+	PubDate     string       `xml:"pubDate"`
+	Enclosure   rssEnclosure `xml:"enclosure"`
+	EpisodeType string       `xml:"itunes:episodeType,omitempty"`
+	Duration    int          `xml:"itunes:duration,omitempty"`
+}
+
+type rssGUID struct {
+	Value       string `xml:",chardata"`
+	IsPermaLink string `xml:"isPermaLink,attr"`
+}
+
+type rssEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Type   string `xml:"type,attr"`
+	Length int64  `xml:"length,attr"`
+}
+
+// WriteRss writes feed to w as an RSS 2.0 document with the iTunes podcast
+// and Atom extensions.
+func WriteRss(w io.Writer, feed *RssFeed) error {
+	channel := rssChannel{
+		Title:       feed.Title,
+		Link:        feed.Link,
+		Description: feed.Description,
+		Generator:   "Podgrab",
+		Author:      feed.Author,
+		Summary:     feed.Description,
+		Explicit:    "false",
+		AtomLinks:   feedLinks(feed),
+		Items:       make([]rssItem, 0, len(feed.Items)),
+	}
+	if !feed.LastBuildDate.IsZero() {
+		channel.LastBuildDate = feed.LastBuildDate.UTC().Format(time.RFC1123Z)
+	}
+	if feed.Image != "" {
+		channel.Image = &rssImage{URL: feed.Image, Title: feed.Title, Link: feed.Link}
+		channel.ItunesImage = &rssHref{Href: feed.Image}
+	}
+	for i := range feed.Items {
+		item := &feed.Items[i]
+		rss := rssItem{
+			Title:       item.Title,
+			Link:        item.Link,
+			Description: item.Description,
+			GUID:        rssGUID{Value: item.GUID, IsPermaLink: "false"},
+			PubDate:     item.PubDate.Format(time.RFC1123Z),
+			Enclosure:   rssEnclosure{URL: item.EnclosureURL, Type: item.EnclosureType, Length: item.Length},
+			EpisodeType: item.EpisodeType,
+			Duration:    item.Duration,
+		}
+		if item.Image != "" {
+			rss.ItunesImage = &rssHref{Href: item.Image}
+		}
+		channel.Items = append(channel.Items, rss)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	err := encoder.Encode(rssDocument{Version: "2.0", Itunes: itunesNamespace, Atom: atomNamespace, Channel: channel})
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "\n")
+	return err
+}
+
+// feedLinks returns the Atom links of a feed to itself and its other pages.
+func feedLinks(feed *RssFeed) []rssAtomLink {
+	links := make([]rssAtomLink, 0, 4)
+	for _, link := range []struct{ rel, href string }{
+		{"self", feed.SelfURL},
+		{"first", feed.FirstURL},
+		{"previous", feed.PreviousURL},
+		{"next", feed.NextURL},
+	} {
+		if link.href != "" {
+			links = append(links, rssAtomLink{Href: link.href, Rel: link.rel, Type: "application/rss+xml"})
+		}
+	}
+	return links
+}
+
+// EnclosureType returns the media type of an episode file from the extension
+// of its path or URL, audio/mpeg when it is unknown.
+func EnclosureType(location string) string {
+	if strings.Contains(location, "://") {
+		if parsed, err := url.Parse(location); err == nil {
+			location = parsed.Path
+		}
+	}
+	extension := strings.ToLower(path.Ext(location))
+	if contentType, ok := enclosureTypes[extension]; ok {
+		return contentType
+	}
+	if contentType := mime.TypeByExtension(extension); strings.HasPrefix(contentType, "audio/") || strings.HasPrefix(contentType, "video/") {
+		return contentType
+	}
+	return "audio/mpeg"
+}
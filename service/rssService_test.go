@@ -0,0 +1,96 @@
+package service
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestWriteRss tests that generated feeds use namespaced podcast elements and
+// link to themselves and their other pages.
+func TestWriteRss(t *testing.T) {
+	published := time.Date(2025, 3, 1, 8, 30, 0, 0, time.UTC)
+	feed := RssFeed{
+		LastBuildDate: published.Add(time.Hour),
+		Title:         "Show",
+		Description:   "About <things>",
+		Link:          "http://podgrab/podcasts/1/view",
+		Image:         "http://podgrab/podcasts/1/image",
+		Author:        "Host",
+		SelfURL:       "http://podgrab/podcasts/1/rss?page=2",
+		FirstURL:      "http://podgrab/podcasts/1/rss",
+		PreviousURL:   "http://podgrab/podcasts/1/rss",
+		Items: []RssFeedItem{{
+			PubDate:       published,
+			GUID:          "episode-1",
+			Title:         "Episode 1",
+			Link:          "http://podgrab/podcasts/1/view",
+			Image:         "http://podgrab/podcastitems/episode-1/image",
+			EnclosureURL:  "http://podgrab/podcastitems/episode-1/file",
+			EnclosureType: "audio/mp4",
+			EpisodeType:   "full",
+			Length:        1024,
+			Duration:      1800,
+		}},
+	}
+
+	var out strings.Builder
+	require.NoError(t, WriteRss(&out, &feed))
+	rss := out.String()
+	assert.True(t, strings.HasPrefix(rss, xml.Header))
+	assert.Contains(t, rss, `<rss version="2.0" xmlns:itunes="http://www.itunes.com/dtds/podcast-1.0.dtd" xmlns:atom="http://www.w3.org/2005/Atom">`)
+	assert.Contains(t, rss, "<description>About &lt;things&gt;</description>")
+	assert.Contains(t, rss, "<lastBuildDate>Sat, 01 Mar 2025 09:30:00 +0000</lastBuildDate>")
+	assert.Contains(t, rss, "<itunes:author>Host</itunes:author>")
+	assert.Contains(t, rss, `<itunes:image href="http://podgrab/podcasts/1/image"></itunes:image>`)
+	assert.Contains(t, rss, `<atom:link href="http://podgrab/podcasts/1/rss?page=2" rel="self" type="application/rss+xml"></atom:link>`)
+	assert.Contains(t, rss, `<atom:link href="http://podgrab/podcasts/1/rss" rel="previous" type="application/rss+xml"></atom:link>`)
+	assert.NotContains(t, rss, `rel="next"`, "The last page should not link a next page")
+	assert.Contains(t, rss, `<guid isPermaLink="false">episode-1</guid>`)
+	assert.Contains(t, rss, "<pubDate>Sat, 01 Mar 2025 08:30:00 +0000</pubDate>")
+	assert.Contains(t, rss, `<enclosure url="http://podgrab/podcastitems/episode-1/file" type="audio/mp4" length="1024"></enclosure>`)
+	assert.Contains(t, rss, "<itunes:episodeType>full</itunes:episodeType>")
+	assert.Contains(t, rss, "<itunes:duration>1800</itunes:duration>")
+
+	var parsed struct {
+		Channel struct {
+			Title string `xml:"title"`
+			Items []struct {
+				Title string `xml:"title"`
+			} `xml:"item"`
+		} `xml:"channel"`
+	}
+	require.NoError(t, xml.Unmarshal([]byte(rss), &parsed), "The feed should be well-formed")
+	assert.Equal(t, "Show", parsed.Channel.Title)
+	require.Len(t, parsed.Channel.Items, 1)
+}
+
+// TestWriteRss_Empty tests that optional elements are left out.
+func TestWriteRss_Empty(t *testing.T) {
+	var out strings.Builder
+	require.NoError(t, WriteRss(&out, &RssFeed{Title: "Podgrab", SelfURL: "http://podgrab/rss"}))
+	rss := out.String()
+	assert.NotContains(t, rss, "lastBuildDate")
+	assert.NotContains(t, rss, "<image>")
+	assert.NotContains(t, rss, "<item>")
+	assert.Equal(t, 1, strings.Count(rss, "<atom:link"))
+}
+
+// TestEnclosureType tests detecting the media type of episode files.
+func TestEnclosureType(t *testing.T) {
+	tests := map[string]string{
+		"/assets/Show/episode.mp3":                        "audio/mpeg",
+		"/assets/Show/What? An episode.M4A":               "audio/mp4",
+		"https://cdn.example.com/ep.ogg?token=abc":        "audio/ogg",
+		"https://cdn.example.com/video/ep.mp4#t=10":       "video/mp4",
+		"https://cdn.example.com/stream?file=episode.m4a": "audio/mpeg",
+		"": "audio/mpeg",
+	}
+	for location, want := range tests {
+		assert.Equal(t, want, EnclosureType(location), location)
+	}
+}
@@ -0,0 +1,509 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/akhilrex/podgrab/db"
+	"github.com/akhilrex/podgrab/internal/logger"
+	"github.com/robfig/cron/v3"
+	uuid "github.com/satori/go.uuid"
+)
+
+// Job run triggers.
+const (
+	JobTriggerSchedule = "schedule"
+	JobTriggerManual   = "manual"
+)
+
+const (
+	// jobLease is how long a job lock stays held after its last heartbeat, so
+	// the lock of a process that died is released without a cleanup job.
+	jobLease = 2 * time.Minute
+	// jobMaxRuntime is how many minutes a job may hold its lock before
+	// readiness reports it as stuck.
+	jobMaxRuntime = 120
+	// jobRunHistory is how many runs are kept for each job.
+	jobRunHistory = 50
+	// scheduleSamples bounds how many upcoming runs scheduleInterval looks at.
+	scheduleSamples = 10000
+)
+
+// jobHeartbeat is how often a running job renews its lease.
+var jobHeartbeat = 30 * time.Second
+
+// Scheduler errors.
+var (
+	ErrJobNotFound     = errors.New("job not found")
+	ErrJobRunning      = errors.New("job is already running")
+	ErrJobLocked       = errors.New("job is locked by another run")
+	ErrInvalidSchedule = errors.New("invalid schedule")
+)
+
+// errNothingToDo is returned by jobs that found no work. Such scheduled runs
+// are not kept in the run history, so frequent jobs do not push out the runs
+// that did something.
+var errNothingToDo = errors.New("nothing to do")
+
+// nothingToDoIf returns errNothingToDo for a run that succeeded without
+// handling any items.
+func nothingToDoIf(items int, err error) error {
+	if err == nil && items == 0 {
+		return errNothingToDo
+	}
+	return err
+}
+
+// Job is a background task run by the scheduler. Run is passed a context that
+// is cancelled when Podgrab shuts down.
+type Job struct {
+	Run         func(ctx context.Context) error
+	Name        string
+	Description string
+	// DefaultSchedule is a cron expression used until the schedule is changed.
+	DefaultSchedule string
+}
+
+// JobInfo describes a scheduled job, its schedule and its most recent run.
+type JobInfo struct {
+	NextRun         *time.Time `json:"nextRun"`
+	LastRun         *db.JobRun `json:"lastRun"`
+	Name            string     `json:"name"`
+	Description     string     `json:"description"`
+	Schedule        string     `json:"schedule"`
+	DefaultSchedule string     `json:"defaultSchedule"`
+	Enabled         bool       `json:"enabled"`
+	Running         bool       `json:"running"`
+}
+
+type scheduledJob struct {
+	run      func() error
+	job      Job
+	schedule string
+	entryID  cron.EntryID
+	enabled  bool
+	running  bool
+}
+
+var (
+	scheduler      = cron.New()
+	scheduledJobs  = make(map[string]*scheduledJob)
+	schedulerMutex sync.Mutex
+	runningJobs    sync.WaitGroup
+	// heldLocks maps the owner of each lock held by this process to its release function.
+	heldLocks      = make(map[string]func())
+	heldLocksMutex sync.Mutex
+)
+
+// DefaultJobs returns the background jobs. Feed related jobs run every
+// checkFrequency minutes by default.
+func DefaultJobs(checkFrequency int) []Job {
+	every := func(minutes int) string {
+		return fmt.Sprintf("@every %dm", minutes)
+	}
+	return []Job{
+		{
+			Name:            "RefreshEpisodes",
+			Description:     "Check every feed for new episodes and download them",
+			DefaultSchedule: every(checkFrequency),
+			Run:             RefreshEpisodes,
+		},
+		{
+			Name:            "ScanLocalPodcasts",
+			Description:     "Pick up new, changed and removed files in the folders of local podcasts",
+			DefaultSchedule: "@every 5m",
+			Run: func(ctx context.Context) error {
+				return nothingToDoIf(scanLocalPodcasts(ctx))
+			},
+		},
+		{
+			Name:            "CheckMissingFiles",
+			Description:     "Find downloaded episodes whose files were removed",
+			DefaultSchedule: every(checkFrequency),
+			Run: func(context.Context) error {
+				return CheckMissingFiles()
+			},
+		},
+		{
+			Name:            "UpdateAllFileSizes",
+			Description:     "Record the size of downloaded files",
+			DefaultSchedule: every(checkFrequency * 3),
+			Run: func(ctx context.Context) error {
+				UpdateAllFileSizes(ctx)
+				return nil
+			},
+		},
+		{
+			Name:            "DownloadMissingImages",
+			Description:     "Download episode images that are missing",
+			DefaultSchedule: every(checkFrequency),
+			Run:             DownloadMissingImages,
+		},
+		{
+			Name:            "RetryNotifications",
+			Description:     "Retry notifications that could not be delivered",
+			DefaultSchedule: "@every 5m",
+			Run: func(context.Context) error {
+				return nothingToDoIf(retryNotifications())
+			},
+		},
+		{
+			Name:            "CreateBackup",
+			Description:     "Back up the database",
+			DefaultSchedule: "@every 48h",
+			Run: func(context.Context) error {
+				_, err := CreateBackup()
+				return err
+			},
+		},
+	}
+}
+
+// StartScheduler registers jobs with their stored schedules and starts running them.
+func StartScheduler(jobs []Job) error {
+	schedules, err := db.GetAllJobSchedules()
+	if err != nil {
+		return err
+	}
+	stored := make(map[string]db.JobSchedule, len(*schedules))
+	for _, schedule := range *schedules {
+		stored[schedule.Name] = schedule
+	}
+
+	schedulerMutex.Lock()
+	defer schedulerMutex.Unlock()
+	for _, job := range jobs {
+		sj := &scheduledJob{job: job, schedule: job.DefaultSchedule, enabled: true}
+		if schedule, ok := stored[job.Name]; ok {
+			if schedule.Schedule != "" {
+				sj.schedule = schedule.Schedule
+			}
+			sj.enabled = !schedule.Disabled
+		}
+		// Runs left unfinished by a previous process have lost their lease.
+		if !db.GetLock(job.Name).IsLocked() {
+			if err := db.InterruptJobRuns(job.Name); err != nil {
+				logger.Log.Errorw("Marking job runs as interrupted", "job_name", job.Name, "error", err)
+			}
+		}
+		scheduledJobs[job.Name] = sj
+		if err := scheduleJob(sj); err != nil {
+			logger.Log.Errorw("Invalid job schedule, using the default", "job_name", job.Name, "schedule", sj.schedule, "error", err)
+			sj.schedule = job.DefaultSchedule
+			if err := scheduleJob(sj); err != nil {
+				return err
+			}
+		}
+	}
+	scheduler.Start()
+	return nil
+}
+
+// stopScheduler stops starting scheduled jobs. Running jobs are not interrupted.
+func stopScheduler() {
+	schedulerMutex.Lock()
+	defer schedulerMutex.Unlock()
+	scheduler.Stop()
+}
+
+// scheduleJob adds sj to the scheduler, replacing its previous entry. The
+// caller holds schedulerMutex.
+func scheduleJob(sj *scheduledJob) error {
+	schedule, err := cron.ParseStandard(sj.schedule)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSchedule, err)
+	}
+	if sj.entryID != 0 {
+		scheduler.Remove(sj.entryID)
+		sj.entryID = 0
+	}
+	run := sj.job.Run
+	sj.run = func() error {
+		return run(BackgroundContext())
+	}
+	if !sj.enabled {
+		untrackJob(sj.job.Name)
+		return nil
+	}
+	sj.run = TrackJob(sj.job.Name, scheduleInterval(schedule), sj.run)
+	name := sj.job.Name
+	sj.entryID = scheduler.Schedule(schedule, cron.FuncJob(func() {
+		if err := startJob(name, JobTriggerSchedule); err != nil {
+			logger.Log.Debugw("Skipping scheduled job", "job_name", name, "error", err)
+		}
+	}))
+	return nil
+}
+
+// scheduleInterval returns the longest time between the runs of schedule in
+// the coming year, so that a schedule skipping nights or weekends is not
+// reported as missed over them.
+func scheduleInterval(schedule cron.Schedule) time.Duration {
+	next := schedule.Next(time.Now())
+	horizon := next.AddDate(1, 0, 0)
+	var longest time.Duration
+	for i := 0; i < scheduleSamples && !next.After(horizon); i++ {
+		following := schedule.Next(next)
+		if following.IsZero() {
+			break
+		}
+		longest = max(longest, following.Sub(next))
+		next = following
+	}
+	return longest
+}
+
+// RunJob starts a job now, outside its schedule.
+func RunJob(name string) error {
+	return startJob(name, JobTriggerManual)
+}
+
+func startJob(name, trigger string) error {
+	schedulerMutex.Lock()
+	defer schedulerMutex.Unlock()
+	sj, ok := scheduledJobs[name]
+	if !ok {
+		return ErrJobNotFound
+	}
+	if sj.running {
+		return ErrJobRunning
+	}
+	if !startWork(&runningJobs) {
+		return ErrShuttingDown
+	}
+	sj.running = true
+	run := sj.run
+	go func() {
+		defer runningJobs.Done()
+		executeJob(name, trigger, run)
+
+		schedulerMutex.Lock()
+		sj.running = false
+		schedulerMutex.Unlock()
+	}()
+	return nil
+}
+
+// executeJob runs a job while holding its lock and records the run.
+func executeJob(name, trigger string, run func() error) {
+	record := db.JobRun{
+		Name:      name,
+		Trigger:   trigger,
+		StartedAt: time.Now(),
+		Status:    db.JobRunRunning,
+	}
+	release, err := holdJobLock(name, jobMaxRuntime)
+	if err != nil {
+		record.Status = db.JobRunFailed
+		if errors.Is(err, ErrJobLocked) {
+			record.Status = db.JobRunSkipped
+		}
+		record.Error = err.Error()
+		finishJobRun(&record)
+		return
+	}
+	defer release()
+
+	// Scheduled runs are only recorded once they finish, when it is known
+	// whether they did anything.
+	if trigger == JobTriggerManual {
+		if err := db.CreateJobRun(&record); err != nil {
+			logger.Log.Errorw("Recording job run", "job_name", name, "error", err)
+		}
+	}
+	record.Status = db.JobRunSucceeded
+	err = run()
+	if errors.Is(err, errNothingToDo) {
+		if trigger == JobTriggerSchedule {
+			return
+		}
+		err = nil
+	}
+	if err != nil {
+		record.Status = db.JobRunFailed
+		record.Error = err.Error()
+		logger.Log.Errorw("Scheduled job failed", "job_name", name, "error", err)
+	}
+	finishJobRun(&record)
+}
+
+func finishJobRun(record *db.JobRun) {
+	finishedAt := time.Now()
+	record.FinishedAt = &finishedAt
+	record.DurationMs = finishedAt.Sub(record.StartedAt).Milliseconds()
+	logger.Log.Infow("Job finished",
+		"job_name", record.Name,
+		"trigger", record.Trigger,
+		"status", record.Status,
+		"duration_ms", record.DurationMs)
+
+	var err error
+	if record.ID == "" {
+		err = db.CreateJobRun(record)
+	} else {
+		err = db.UpdateJobRun(record)
+	}
+	if err != nil {
+		logger.Log.Errorw("Recording job run", "job_name", record.Name, "error", err)
+		return
+	}
+	if err := db.PruneJobRuns(record.Name, jobRunHistory); err != nil {
+		logger.Log.Errorw("Pruning job runs", "job_name", record.Name, "error", err)
+	}
+}
+
+// holdJobLock takes the named lock and renews its lease until the returned
+// release function is called. It returns ErrJobLocked if another run holds it.
+func holdJobLock(name string, maxRuntime int) (func(), error) {
+	owner := newLockOwner()
+	acquired, err := db.AcquireLock(name, owner, maxRuntime, jobLease)
+	if err != nil {
+		return nil, err
+	}
+	if !acquired {
+		return nil, ErrJobLocked
+	}
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(jobHeartbeat)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				renewed, err := db.RenewLock(name, owner, jobLease)
+				if err != nil || !renewed {
+					logger.Log.Errorw("Renewing job lock", "job_name", name, "renewed", renewed, "error", err)
+				}
+			}
+		}
+	}()
+
+	var once sync.Once
+	release := func() {
+		once.Do(func() {
+			close(done)
+			wg.Wait()
+			if err := db.ReleaseLock(name, owner); err != nil {
+				logger.Log.Errorw("Releasing job lock", "job_name", name, "error", err)
+			}
+			heldLocksMutex.Lock()
+			delete(heldLocks, owner)
+			heldLocksMutex.Unlock()
+		})
+	}
+	heldLocksMutex.Lock()
+	heldLocks[owner] = release
+	heldLocksMutex.Unlock()
+	return release, nil
+}
+
+// releaseHeldLocks releases every lock held by this process, so other
+// processes do not wait for the leases to expire.
+func releaseHeldLocks() {
+	heldLocksMutex.Lock()
+	releases := make([]func(), 0, len(heldLocks))
+	for _, release := range heldLocks {
+		releases = append(releases, release)
+	}
+	heldLocksMutex.Unlock()
+	for _, release := range releases {
+		release()
+	}
+}
+
+// newLockOwner returns an identifier that is unique to a single run.
+func newLockOwner() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "podgrab"
+	}
+	return fmt.Sprintf("%s:%d:%s", host, os.Getpid(), uuid.NewV4().String())
+}
+
+// UpdateJobSchedule changes the schedule of a job and whether it runs. An empty
+// schedule restores the default.
+func UpdateJobSchedule(name, schedule string, enabled bool) error {
+	schedulerMutex.Lock()
+	defer schedulerMutex.Unlock()
+	sj, ok := scheduledJobs[name]
+	if !ok {
+		return ErrJobNotFound
+	}
+	if schedule == sj.job.DefaultSchedule {
+		schedule = ""
+	}
+	spec := schedule
+	if spec == "" {
+		spec = sj.job.DefaultSchedule
+	}
+	if _, err := cron.ParseStandard(spec); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSchedule, err)
+	}
+	if err := db.SaveJobSchedule(&db.JobSchedule{Name: name, Schedule: schedule, Disabled: !enabled}); err != nil {
+		return err
+	}
+	sj.schedule = spec
+	sj.enabled = enabled
+	return scheduleJob(sj)
+}
+
+// GetJobs returns every registered job ordered by name.
+func GetJobs() []JobInfo {
+	schedulerMutex.Lock()
+	jobs := make([]JobInfo, 0, len(scheduledJobs))
+	for _, sj := range scheduledJobs {
+		info := JobInfo{
+			Name:            sj.job.Name,
+			Description:     sj.job.Description,
+			Schedule:        sj.schedule,
+			DefaultSchedule: sj.job.DefaultSchedule,
+			Enabled:         sj.enabled,
+			Running:         sj.running,
+		}
+		if sj.entryID != 0 {
+			if next := scheduler.Entry(sj.entryID).Next; !next.IsZero() {
+				info.NextRun = &next
+			}
+		}
+		jobs = append(jobs, info)
+	}
+	schedulerMutex.Unlock()
+
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].Name < jobs[j].Name
+	})
+	for i := range jobs {
+		run, err := db.GetLastJobRun(jobs[i].Name)
+		if err != nil {
+			logger.Log.Errorw("Getting last job run", "job_name", jobs[i].Name, "error", err)
+			continue
+		}
+		jobs[i].LastRun = run
+	}
+	return jobs
+}
+
+// GetJobRuns returns a page of a job's runs, newest first.
+func GetJobRuns(name string, page, count int) ([]db.JobRun, int64, error) {
+	schedulerMutex.Lock()
+	_, ok := scheduledJobs[name]
+	schedulerMutex.Unlock()
+	if !ok {
+		return nil, 0, ErrJobNotFound
+	}
+	var runs []db.JobRun
+	var total int64
+	err := db.GetPaginatedJobRuns(name, page, count, &runs, &total)
+	return runs, total, err
+}
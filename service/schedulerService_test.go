@@ -0,0 +1,271 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/akhilrex/podgrab/db"
+	"github.com/robfig/cron/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// useTestScheduler gives the test an empty scheduler backed by a test database.
+func useTestScheduler(t *testing.T) {
+	t.Helper()
+	useTestDB(t)
+	resetScheduler()
+	resetJobStatuses(t)
+	t.Cleanup(func() {
+		runningJobs.Wait()
+		resetScheduler()
+		resetJobStatuses(t)
+	})
+}
+
+func resetScheduler() {
+	schedulerMutex.Lock()
+	defer schedulerMutex.Unlock()
+	<-scheduler.Stop().Done()
+	scheduler = cron.New()
+	scheduledJobs = make(map[string]*scheduledJob)
+}
+
+func findJob(t *testing.T, name string) JobInfo {
+	t.Helper()
+	for _, job := range GetJobs() {
+		if job.Name == name {
+			return job
+		}
+	}
+	t.Fatalf("job %s not found", name)
+	return JobInfo{}
+}
+
+// TestDefaultJobs tests that every default job has a valid schedule.
+func TestDefaultJobs(t *testing.T) {
+	names := make(map[string]bool)
+	for _, job := range DefaultJobs(30) {
+		assert.False(t, names[job.Name], "Job names should be unique")
+		names[job.Name] = true
+		_, err := cron.ParseStandard(job.DefaultSchedule)
+		assert.NoError(t, err, "Default schedule of %s should parse", job.Name)
+		assert.NotNil(t, job.Run)
+	}
+	assert.Equal(t, "@every 30m", DefaultJobs(30)[0].DefaultSchedule, "Feed checks should follow the check frequency")
+}
+
+// TestRunJob tests that manual runs are recorded with their outcome.
+func TestRunJob(t *testing.T) {
+	useTestScheduler(t)
+
+	release := make(chan struct{})
+	fail := errors.New("boom")
+	require.NoError(t, StartScheduler([]Job{
+		{Name: "Good", DefaultSchedule: "@every 1h", Run: func(context.Context) error { return nil }},
+		{Name: "Bad", DefaultSchedule: "@every 1h", Run: func(context.Context) error { return fail }},
+		{Name: "Slow", DefaultSchedule: "@every 1h", Run: func(context.Context) error {
+			<-release
+			return nil
+		}},
+	}))
+
+	require.NoError(t, RunJob("Good"))
+	require.NoError(t, RunJob("Bad"))
+	require.NoError(t, RunJob("Slow"))
+	assert.ErrorIs(t, RunJob("Slow"), ErrJobRunning, "Should not start a job twice")
+	assert.ErrorIs(t, RunJob("Missing"), ErrJobNotFound)
+	close(release)
+	runningJobs.Wait()
+
+	good := findJob(t, "Good")
+	require.NotNil(t, good.LastRun)
+	assert.Equal(t, db.JobRunSucceeded, good.LastRun.Status)
+	assert.Equal(t, JobTriggerManual, good.LastRun.Trigger)
+	assert.NotNil(t, good.LastRun.FinishedAt)
+	assert.NotNil(t, good.NextRun, "Enabled job should have a next run")
+	assert.False(t, good.Running)
+
+	bad := findJob(t, "Bad")
+	require.NotNil(t, bad.LastRun)
+	assert.Equal(t, db.JobRunFailed, bad.LastRun.Status)
+	assert.Equal(t, "boom", bad.LastRun.Error)
+
+	for _, status := range GetJobStatuses() {
+		if status.Name == "Bad" {
+			assert.Equal(t, "boom", status.LastError, "Runs should be reported to readiness")
+		}
+	}
+
+	assert.False(t, db.GetLock("Good").IsLocked(), "Lock should be released after the run")
+
+	runs, total, err := GetJobRuns("Good", 1, 10)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), total)
+	assert.Len(t, runs, 1)
+	_, _, err = GetJobRuns("Missing", 1, 10)
+	assert.ErrorIs(t, err, ErrJobNotFound)
+}
+
+// TestRunJob_SkipsWhenLocked tests that a job locked by another process does not run.
+func TestRunJob_SkipsWhenLocked(t *testing.T) {
+	useTestScheduler(t)
+
+	ran := false
+	require.NoError(t, StartScheduler([]Job{
+		{Name: "Locked", DefaultSchedule: "@every 1h", Run: func(context.Context) error {
+			ran = true
+			return nil
+		}},
+	}))
+	acquired, err := db.AcquireLock("Locked", "other-process", jobMaxRuntime, time.Minute)
+	require.NoError(t, err)
+	require.True(t, acquired)
+
+	require.NoError(t, RunJob("Locked"))
+	runningJobs.Wait()
+
+	assert.False(t, ran, "Job should not run while another process holds the lock")
+	job := findJob(t, "Locked")
+	require.NotNil(t, job.LastRun)
+	assert.Equal(t, db.JobRunSkipped, job.LastRun.Status)
+}
+
+// TestRunJob_NothingToDo tests that scheduled runs without work are not kept
+// but still count as successes, while manual ones are recorded.
+func TestRunJob_NothingToDo(t *testing.T) {
+	useTestScheduler(t)
+
+	var recordedWhileRunning *db.JobRun
+	require.NoError(t, StartScheduler([]Job{
+		{Name: "Idle", DefaultSchedule: "@every 1h", Run: func(context.Context) error {
+			recordedWhileRunning, _ = db.GetLastJobRun("Idle")
+			return errNothingToDo
+		}},
+	}))
+
+	require.NoError(t, startJob("Idle", JobTriggerSchedule))
+	runningJobs.Wait()
+	assert.Nil(t, recordedWhileRunning, "Scheduled run should not be recorded before it finishes")
+	assert.Nil(t, findJob(t, "Idle").LastRun, "Idle scheduled run should not be recorded")
+	for _, status := range GetJobStatuses() {
+		if status.Name == "Idle" {
+			assert.Empty(t, status.LastError)
+			assert.False(t, status.LastSuccess.IsZero(), "Idle run should count as a success")
+		}
+	}
+
+	require.NoError(t, RunJob("Idle"))
+	runningJobs.Wait()
+	job := findJob(t, "Idle")
+	require.NotNil(t, job.LastRun, "Manual runs should always be recorded")
+	assert.Equal(t, db.JobRunSucceeded, job.LastRun.Status)
+	assert.Equal(t, JobTriggerManual, job.LastRun.Trigger)
+}
+
+// TestUpdateJobSchedule tests changing, disabling and resetting schedules.
+func TestUpdateJobSchedule(t *testing.T) {
+	useTestScheduler(t)
+
+	require.NoError(t, StartScheduler([]Job{
+		{Name: "Job", DefaultSchedule: "@every 1h", Run: func(context.Context) error { return nil }},
+	}))
+
+	assert.ErrorIs(t, UpdateJobSchedule("Job", "not a schedule", true), ErrInvalidSchedule)
+	assert.ErrorIs(t, UpdateJobSchedule("Missing", "@daily", true), ErrJobNotFound)
+
+	require.NoError(t, UpdateJobSchedule("Job", "*/5 * * * *", true))
+	job := findJob(t, "Job")
+	assert.Equal(t, "*/5 * * * *", job.Schedule)
+	require.NotNil(t, job.NextRun)
+	assert.Equal(t, 0, job.NextRun.Minute()%5, "Next run should follow the new schedule")
+	schedules, err := db.GetAllJobSchedules()
+	require.NoError(t, err)
+	require.Len(t, *schedules, 1)
+	assert.Equal(t, "*/5 * * * *", (*schedules)[0].Schedule)
+
+	require.NoError(t, UpdateJobSchedule("Job", "*/5 * * * *", false))
+	job = findJob(t, "Job")
+	assert.False(t, job.Enabled)
+	assert.Nil(t, job.NextRun, "Disabled job should not be scheduled")
+	assert.Empty(t, GetJobStatuses(), "Disabled job should not be checked by readiness")
+	require.NoError(t, RunJob("Job"), "Disabled job can still be run manually")
+	runningJobs.Wait()
+
+	require.NoError(t, UpdateJobSchedule("Job", "", true))
+	job = findJob(t, "Job")
+	assert.Equal(t, "@every 1h", job.Schedule, "Empty schedule should restore the default")
+	schedules, err = db.GetAllJobSchedules()
+	require.NoError(t, err)
+	assert.Empty(t, (*schedules)[0].Schedule, "Default schedule should not be stored")
+}
+
+// TestStartScheduler_StoredState tests that stored schedules apply and stale runs are interrupted.
+func TestStartScheduler_StoredState(t *testing.T) {
+	useTestScheduler(t)
+
+	require.NoError(t, db.SaveJobSchedule(&db.JobSchedule{Name: "Custom", Schedule: "0 3 * * *"}))
+	require.NoError(t, db.SaveJobSchedule(&db.JobSchedule{Name: "Broken", Schedule: "every day"}))
+	require.NoError(t, db.SaveJobSchedule(&db.JobSchedule{Name: "Off", Disabled: true}))
+	require.NoError(t, db.CreateJobRun(&db.JobRun{Name: "Custom", StartedAt: time.Now(), Status: db.JobRunRunning}))
+
+	noop := func(context.Context) error { return nil }
+	require.NoError(t, StartScheduler([]Job{
+		{Name: "Custom", DefaultSchedule: "@every 1h", Run: noop},
+		{Name: "Broken", DefaultSchedule: "@every 1h", Run: noop},
+		{Name: "Off", DefaultSchedule: "@every 1h", Run: noop},
+	}))
+
+	custom := findJob(t, "Custom")
+	assert.Equal(t, "0 3 * * *", custom.Schedule)
+	require.NotNil(t, custom.LastRun)
+	assert.Equal(t, db.JobRunInterrupted, custom.LastRun.Status, "Run left by a previous process should be interrupted")
+	assert.Equal(t, "@every 1h", findJob(t, "Broken").Schedule, "Invalid stored schedule should fall back to the default")
+	assert.False(t, findJob(t, "Off").Enabled)
+}
+
+// TestHoldJobLock tests that a held lock is renewed until released.
+func TestHoldJobLock(t *testing.T) {
+	useTestDB(t)
+
+	originalHeartbeat := jobHeartbeat
+	jobHeartbeat = 10 * time.Millisecond
+	defer func() { jobHeartbeat = originalHeartbeat }()
+
+	release, err := holdJobLock("Job", jobMaxRuntime)
+	require.NoError(t, err)
+	leased := db.GetLock("Job").LeaseUntil
+
+	_, err = holdJobLock("Job", jobMaxRuntime)
+	assert.ErrorIs(t, err, ErrJobLocked, "Second run should not take a held lock")
+
+	assert.Eventually(t, func() bool {
+		return db.GetLock("Job").LeaseUntil.After(leased)
+	}, time.Second, 10*time.Millisecond, "Lease should be renewed while held")
+
+	release()
+	assert.False(t, db.GetLock("Job").IsLocked(), "Lock should be released")
+}
+
+// TestScheduleInterval tests that the interval of a schedule is its longest
+// gap between runs.
+func TestScheduleInterval(t *testing.T) {
+	tests := []struct {
+		schedule string
+		want     time.Duration
+	}{
+		{schedule: "@every 5m", want: 5 * time.Minute},
+		{schedule: "0 3 * * *", want: 24 * time.Hour},
+		{schedule: "0 9 * * 1-5", want: 72 * time.Hour},
+		{schedule: "*/10 9-17 * * *", want: 15*time.Hour + 10*time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.schedule, func(t *testing.T) {
+			schedule, err := cron.ParseStandard(tt.schedule)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, scheduleInterval(schedule))
+		})
+	}
+}
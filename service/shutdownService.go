@@ -0,0 +1,81 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/akhilrex/podgrab/internal/logger"
+)
+
+// ErrShuttingDown is returned for work that was refused or interrupted because
+// Podgrab is stopping.
+var ErrShuttingDown = errors.New("podgrab is shutting down")
+
+// checkpointTimeout is how long interrupted downloads get to stop once the
+// shutdown deadline has passed.
+const checkpointTimeout = 5 * time.Second
+
+var (
+	lifecycleMutex  sync.Mutex
+	shuttingDown    bool
+	activeDownloads sync.WaitGroup
+	// backgroundContext is cancelled with ErrShuttingDown when the shutdown
+	// deadline passes, which interrupts running downloads and feed fetches.
+	backgroundContext, cancelBackground = context.WithCancelCause(context.Background())
+)
+
+// BackgroundContext returns the context for work that outlives the request
+// that started it, such as downloads and scheduled jobs.
+func BackgroundContext() context.Context {
+	return backgroundContext
+}
+
+// startWork adds one to wg unless shutdown has begun. Checking and adding under
+// one lock keeps the Add from racing with the Wait in Shutdown.
+func startWork(wg *sync.WaitGroup) bool {
+	lifecycleMutex.Lock()
+	defer lifecycleMutex.Unlock()
+	if shuttingDown {
+		return false
+	}
+	wg.Add(1)
+	return true
+}
+
+// Shutdown stops scheduling jobs and starting downloads, then waits for
+// running jobs, downloads and notification deliveries to finish. If ctx ends
+// first, running downloads are interrupted and keep their partial files so the
+// next start resumes them. Job locks still held by this process are released
+// either way.
+func Shutdown(ctx context.Context) error {
+	lifecycleMutex.Lock()
+	shuttingDown = true
+	lifecycleMutex.Unlock()
+	stopScheduler()
+
+	drained := make(chan struct{})
+	go func() {
+		runningJobs.Wait()
+		activeDownloads.Wait()
+		pendingDeliveries.Wait()
+		close(drained)
+	}()
+
+	var err error
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		err = ctx.Err()
+		logger.Log.Warn("Shutdown deadline reached, interrupting downloads")
+		cancelBackground(ErrShuttingDown)
+		select {
+		case <-drained:
+		case <-time.After(checkpointTimeout):
+			logger.Log.Warn("Background work still running, stopping anyway")
+		}
+	}
+	releaseHeldLocks()
+	return err
+}
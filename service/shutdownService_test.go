@@ -0,0 +1,237 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/akhilrex/podgrab/db"
+	testhelpers "github.com/akhilrex/podgrab/internal/testing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// resetShutdown lets the test shut down and restores normal operation afterwards.
+func resetShutdown(t *testing.T) {
+	t.Helper()
+	t.Cleanup(func() {
+		lifecycleMutex.Lock()
+		shuttingDown = false
+		lifecycleMutex.Unlock()
+		backgroundContext, cancelBackground = context.WithCancelCause(context.Background())
+	})
+}
+
+func useTestDataDir(t *testing.T) {
+	t.Helper()
+	_, cleanup := testhelpers.SetupTestDataDir(t)
+	t.Cleanup(cleanup)
+	useTestDB(t)
+	db.CreateTestSetting(t, db.DB)
+}
+
+func partFilePath(link, title string) string {
+	return filepath.Join(createDataFolderIfNotExists("Podcast"), getFileName(link, title, ".mp3")) + ".part"
+}
+
+// rangeServer serves content, honouring Range requests, and returns a function
+// listing the requested ranges. When stall is set, full responses stop after
+// half the content until the client goes away.
+func rangeServer(t *testing.T, content []byte, stall bool) (*httptest.Server, func() []string) {
+	t.Helper()
+	var mu sync.Mutex
+	var ranges []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested := r.Header.Get("Range")
+		mu.Lock()
+		ranges = append(ranges, requested)
+		mu.Unlock()
+		if requested != "" {
+			start, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(requested, "bytes="), "-"))
+			require.NoError(t, err)
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, len(content)-1, len(content)))
+			w.WriteHeader(http.StatusPartialContent)
+			_, _ = w.Write(content[start:]) // Test server - error handling not required
+			return
+		}
+		if !stall {
+			_, _ = w.Write(content) // Test server - error handling not required
+			return
+		}
+		_, _ = w.Write(content[:len(content)/2]) // Test server - error handling not required
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	t.Cleanup(server.Close)
+	return server, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), ranges...)
+	}
+}
+
+// TestShutdown_RefusesNewWork tests that jobs and downloads do not start after shutdown begins.
+func TestShutdown_RefusesNewWork(t *testing.T) {
+	useTestScheduler(t)
+	resetShutdown(t)
+
+	ran := false
+	require.NoError(t, StartScheduler([]Job{
+		{Name: "Job", DefaultSchedule: "@every 1h", Run: func(context.Context) error {
+			ran = true
+			return nil
+		}},
+	}))
+
+	require.NoError(t, Shutdown(context.Background()))
+
+	assert.ErrorIs(t, RunJob("Job"), ErrShuttingDown)
+	assert.False(t, ran)
+	_, err := Download(context.Background(), "http://127.0.0.1:1/episode.mp3", "Episode", "Podcast", "")
+	assert.ErrorIs(t, err, ErrShuttingDown)
+}
+
+// TestShutdown_WaitsForRunningJob tests that a running job finishes and releases its lock.
+func TestShutdown_WaitsForRunningJob(t *testing.T) {
+	useTestScheduler(t)
+	resetShutdown(t)
+
+	started := make(chan struct{})
+	require.NoError(t, StartScheduler([]Job{
+		{Name: "Slow", DefaultSchedule: "@every 1h", Run: func(context.Context) error {
+			close(started)
+			time.Sleep(100 * time.Millisecond)
+			return nil
+		}},
+	}))
+	require.NoError(t, RunJob("Slow"))
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, Shutdown(ctx))
+
+	job := findJob(t, "Slow")
+	require.NotNil(t, job.LastRun)
+	assert.Equal(t, db.JobRunSucceeded, job.LastRun.Status, "Running job should finish")
+	assert.False(t, db.GetLock("Slow").IsLocked(), "Lock should be released")
+}
+
+// TestShutdown_ReleasesHeldLocks tests that locks of work still running at the deadline are released.
+func TestShutdown_ReleasesHeldLocks(t *testing.T) {
+	useTestDB(t)
+	resetShutdown(t)
+
+	_, err := holdJobLock("Stuck", jobMaxRuntime)
+	require.NoError(t, err)
+	require.True(t, db.GetLock("Stuck").IsLocked())
+
+	require.NoError(t, Shutdown(context.Background()))
+	assert.False(t, db.GetLock("Stuck").IsLocked(), "Lock should be released on shutdown")
+}
+
+// TestShutdown_InterruptsAndResumesDownload tests that a download cut by the
+// shutdown deadline keeps its partial file and resumes with a Range request.
+func TestShutdown_InterruptsAndResumesDownload(t *testing.T) {
+	useTestDataDir(t)
+	resetShutdown(t)
+
+	content := []byte(strings.Repeat("podcast audio ", 4096))
+	server, ranges := rangeServer(t, content, true)
+
+	result := make(chan error, 1)
+	go func() {
+		_, err := Download(BackgroundContext(), server.URL+"/episode.mp3", "Interrupted", "Podcast", "")
+		result <- err
+	}()
+
+	partPath := partFilePath(server.URL+"/episode.mp3", "Interrupted")
+	require.Eventually(t, func() bool {
+		info, err := os.Stat(partPath)
+		return err == nil && info.Size() == int64(len(content)/2)
+	}, 5*time.Second, 10*time.Millisecond, "Should write the first half")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, Shutdown(ctx), context.DeadlineExceeded)
+	assert.ErrorIs(t, <-result, ErrShuttingDown)
+	assert.FileExists(t, partPath, "Partial file should be kept")
+
+	// Start again and resume.
+	lifecycleMutex.Lock()
+	shuttingDown = false
+	lifecycleMutex.Unlock()
+	backgroundContext, cancelBackground = context.WithCancelCause(context.Background())
+
+	filePath, err := Download(context.Background(), server.URL+"/episode.mp3", "Interrupted", "Podcast", "")
+	require.NoError(t, err)
+	saved, err := os.ReadFile(filePath) // nolint:gosec // Test code with controlled file path
+	require.NoError(t, err)
+	assert.Equal(t, content, saved, "Resumed file should be complete")
+	assert.NoFileExists(t, partPath)
+	assert.Equal(t, []string{"", fmt.Sprintf("bytes=%d-", len(content)/2)}, ranges())
+}
+
+// TestDownload_PartialFile tests resuming from partial files the server cannot continue.
+func TestDownload_PartialFile(t *testing.T) {
+	useTestDataDir(t)
+	content := []byte("fake mp3 content")
+
+	writePart := func(t *testing.T, title, link string, data []byte) string {
+		t.Helper()
+		partPath := partFilePath(link, title)
+		require.NoError(t, os.WriteFile(partPath, data, 0o600))
+		return partPath
+	}
+
+	t.Run("range_ignored", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			_, _ = w.Write(content) // Test server - error handling not required
+		}))
+		defer server.Close()
+		partPath := writePart(t, "Ignored", server.URL, []byte("stale"))
+
+		filePath, err := Download(context.Background(), server.URL, "Ignored", "Podcast", "")
+		require.NoError(t, err)
+		saved, err := os.ReadFile(filePath) // nolint:gosec // Test code with controlled file path
+		require.NoError(t, err)
+		assert.Equal(t, content, saved, "Should start over when the server sends the whole file")
+		assert.NoFileExists(t, partPath)
+	})
+
+	t.Run("already_complete", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", len(content)))
+			w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+		}))
+		defer server.Close()
+		writePart(t, "Complete", server.URL, content)
+
+		filePath, err := Download(context.Background(), server.URL, "Complete", "Podcast", "")
+		require.NoError(t, err)
+		saved, err := os.ReadFile(filePath) // nolint:gosec // Test code with controlled file path
+		require.NoError(t, err)
+		assert.Equal(t, content, saved)
+	})
+
+	t.Run("unusable", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.Header().Set("Content-Range", "bytes */100")
+			w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+		}))
+		defer server.Close()
+		partPath := writePart(t, "Unusable", server.URL, content)
+
+		_, err := Download(context.Background(), server.URL, "Unusable", "Podcast", "")
+		assert.Error(t, err)
+		assert.NoFileExists(t, partPath, "Unusable partial file should be removed")
+	})
+}
@@ -0,0 +1,86 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/akhilrex/podgrab/db"
+	"github.com/akhilrex/podgrab/model"
+)
+
+// ErrInvalidSmartPlaylist is returned for smart playlists without a name or
+// with criteria that cannot match.
+var ErrInvalidSmartPlaylist = errors.New("invalid smart playlist")
+
+// episodeSorts lists the sort orders of smart playlists.
+var episodeSorts = []model.EpisodeSort{model.ReleaseDesc, model.ReleaseAsc, model.DurationAsc, model.DurationDesc}
+
+// ValidateSmartPlaylist checks the name and criteria of a smart playlist,
+// trimming its name and sorting it by release date, newest first, unless it
+// has another order.
+func ValidateSmartPlaylist(playlist *db.SmartPlaylist) error {
+	playlist.Name = strings.TrimSpace(playlist.Name)
+	if playlist.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidSmartPlaylist)
+	}
+	if playlist.Sorting == "" {
+		playlist.Sorting = string(model.ReleaseDesc)
+	}
+	if !slices.Contains(episodeSorts, model.EpisodeSort(playlist.Sorting)) {
+		return fmt.Errorf("%w: unknown sorting %q", ErrInvalidSmartPlaylist, playlist.Sorting)
+	}
+	if playlist.MaxAgeDays < 0 || playlist.MinDuration < 0 || playlist.MaxDuration < 0 || playlist.Limit < 0 {
+		return fmt.Errorf("%w: ages, durations and the limit must not be negative", ErrInvalidSmartPlaylist)
+	}
+	if playlist.MaxDuration > 0 && playlist.MinDuration > playlist.MaxDuration {
+		return fmt.Errorf("%w: the minimum duration is longer than the maximum", ErrInvalidSmartPlaylist)
+	}
+	return nil
+}
+
+// GetSmartPlaylistItems returns the episodes a smart playlist matches, with
+// their podcasts, in its order.
+func GetSmartPlaylistItems(playlist *db.SmartPlaylist) ([]db.PodcastItem, error) {
+	items, err := db.GetPlaylistPodcastItems(smartPlaylistFilter(playlist), playlist.Limit)
+	if err != nil {
+		return nil, err
+	}
+	return *items, nil
+}
+
+// smartPlaylistFilter returns the episode filter of a smart playlist.
+func smartPlaylistFilter(playlist *db.SmartPlaylist) *model.EpisodesFilter {
+	return &model.EpisodesFilter{
+		IsPlayed:     formatFilterBool(playlist.IsPlayed),
+		IsDownloaded: formatFilterBool(playlist.IsDownloaded),
+		Sorting:      model.EpisodeSort(playlist.Sorting),
+		TagIDs:       splitIDs(playlist.TagIDs),
+		PodcastIDs:   splitIDs(playlist.PodcastIDs),
+		MaxAgeDays:   playlist.MaxAgeDays,
+		MinDuration:  playlist.MinDuration,
+		MaxDuration:  playlist.MaxDuration,
+	}
+}
+
+// formatFilterBool returns value as the string the episode filter expects.
+func formatFilterBool(value *bool) *string {
+	if value == nil {
+		return nil
+	}
+	formatted := strconv.FormatBool(*value)
+	return &formatted
+}
+
+// splitIDs splits a comma separated list of IDs, which is empty for "".
+func splitIDs(list string) []string {
+	var ids []string
+	for _, id := range strings.Split(list, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
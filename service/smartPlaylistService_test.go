@@ -0,0 +1,81 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/akhilrex/podgrab/db"
+	"github.com/akhilrex/podgrab/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// itemTitles returns the titles of items in order.
+func itemTitles(items []db.PodcastItem) []string {
+	titles := make([]string, 0, len(items))
+	for i := range items {
+		titles = append(titles, items[i].Title)
+	}
+	return titles
+}
+
+// TestValidateSmartPlaylist tests the names and criteria smart playlists
+// accept.
+func TestValidateSmartPlaylist(t *testing.T) {
+	playlist := &db.SmartPlaylist{Name: "  Commute  "}
+	require.NoError(t, ValidateSmartPlaylist(playlist))
+	assert.Equal(t, "Commute", playlist.Name)
+	assert.Equal(t, string(model.ReleaseDesc), playlist.Sorting, "Playlists should default to the newest first")
+
+	for name, invalid := range map[string]*db.SmartPlaylist{
+		"no name":          {Name: " "},
+		"unknown sorting":  {Name: "List", Sorting: "title"},
+		"negative age":     {Name: "List", MaxAgeDays: -1},
+		"negative limit":   {Name: "List", Limit: -1},
+		"inverted lengths": {Name: "List", MinDuration: 600, MaxDuration: 300},
+	} {
+		assert.ErrorIs(t, ValidateSmartPlaylist(invalid), ErrInvalidSmartPlaylist, name)
+	}
+}
+
+// TestGetSmartPlaylistItems tests that smart playlists select, order and
+// cap the episodes matching their criteria.
+func TestGetSmartPlaylistItems(t *testing.T) {
+	useTestDB(t)
+	news := db.CreateTestPodcast(t, db.DB, &db.Podcast{Title: "News"})
+	talk := db.CreateTestPodcast(t, db.DB, &db.Podcast{Title: "Talk"})
+	tag := db.CreateTestTag(t, db.DB, "Daily")
+	require.NoError(t, db.AddTagToPodcast(news.ID, tag.ID))
+
+	day := 24 * time.Hour
+	db.CreateTestPodcastItem(t, db.DB, news.ID, &db.PodcastItem{Title: "Short", Duration: 300, PubDate: time.Now().Add(-day)})
+	db.CreateTestPodcastItem(t, db.DB, news.ID, &db.PodcastItem{Title: "Long", Duration: 3600, PubDate: time.Now().Add(-2 * day)})
+	db.CreateTestPodcastItem(t, db.DB, news.ID, &db.PodcastItem{Title: "Old", Duration: 300, PubDate: time.Now().Add(-30 * day)})
+	db.CreateTestPodcastItem(t, db.DB, news.ID, &db.PodcastItem{Title: "Played", Duration: 300, PubDate: time.Now().Add(-day), IsPlayed: true})
+	db.CreateTestPodcastItem(t, db.DB, talk.ID, &db.PodcastItem{Title: "Downloaded", Duration: 600, PubDate: time.Now().Add(-3 * day), DownloadStatus: db.Downloaded})
+
+	unplayed, downloaded := false, true
+	tests := []struct {
+		name     string
+		playlist db.SmartPlaylist
+		want     []string
+	}{
+		{"tagged and unplayed", db.SmartPlaylist{TagIDs: tag.ID, IsPlayed: &unplayed}, []string{"Short", "Long", "Old"}},
+		{"recent", db.SmartPlaylist{MaxAgeDays: 7, IsPlayed: &unplayed}, []string{"Short", "Long", "Downloaded"}},
+		{"duration range", db.SmartPlaylist{MinDuration: 400, MaxDuration: 1800}, []string{"Downloaded"}},
+		{"downloaded", db.SmartPlaylist{PodcastIDs: news.ID + "," + talk.ID, IsDownloaded: &downloaded}, []string{"Downloaded"}},
+		{"longest first, capped", db.SmartPlaylist{Sorting: string(model.DurationDesc), Limit: 2}, []string{"Long", "Downloaded"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.playlist.Name = tt.name
+			require.NoError(t, ValidateSmartPlaylist(&tt.playlist))
+			items, err := GetSmartPlaylistItems(&tt.playlist)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, itemTitles(items))
+			for i := range items {
+				assert.NotEmpty(t, items[i].Podcast.Title, "Episodes should come with their podcast")
+			}
+		})
+	}
+}
@@ -0,0 +1,324 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/akhilrex/podgrab/db"
+	"github.com/akhilrex/podgrab/internal/config"
+	"github.com/akhilrex/podgrab/internal/logger"
+)
+
+// Transcode formats.
+const (
+	TranscodeOpus = "opus"
+	TranscodeAAC  = "aac"
+)
+
+// DefaultTranscodeBitrate is the bitrate, in kbit/s, of transcodes that do
+// not ask for one.
+const DefaultTranscodeBitrate = 64
+
+// maxTranscodes is how many episodes are encoded at once.
+const maxTranscodes = 2
+
+var (
+	// ErrInvalidTranscode is returned for unknown formats and bitrates.
+	ErrInvalidTranscode = errors.New("invalid transcode request")
+	// ErrTranscoderUnavailable is returned when no encoder is installed.
+	ErrTranscoderUnavailable = errors.New("transcoding is not available")
+	// ErrEpisodeNotDownloaded is returned for episodes without a downloaded
+	// file to transcode.
+	ErrEpisodeNotDownloaded = errors.New("episode is not downloaded")
+)
+
+// TranscodeBitrates are the bitrates, in kbit/s, episodes can be transcoded
+// to.
+var TranscodeBitrates = []int{24, 32, 48, 64, 96, 128}
+
+// transcodeFormat is how the encoder writes a format. The muxers can be
+// written to a pipe, so transcodes stream while they are encoded.
+type transcodeFormat struct {
+	codec       string
+	muxer       string
+	extension   string
+	contentType string
+}
+
+var transcodeFormats = map[string]transcodeFormat{
+	TranscodeOpus: {codec: "libopus", muxer: "ogg", extension: ".opus", contentType: "audio/ogg"},
+	TranscodeAAC:  {codec: "aac", muxer: "adts", extension: ".aac", contentType: "audio/aac"},
+}
+
+var (
+	transcodeSlots = make(chan struct{}, maxTranscodes)
+	// cachingMutex guards caching, the cache files being written.
+	cachingMutex sync.Mutex
+	caching      = make(map[string]bool)
+)
+
+// TranscodeOptions describes the transcodes the server can make.
+type TranscodeOptions struct {
+	Formats        []string `json:"formats"`
+	Bitrates       []int    `json:"bitrates"`
+	DefaultBitrate int      `json:"defaultBitrate"`
+	Available      bool     `json:"available"`
+}
+
+// GetTranscodeOptions returns the formats and bitrates episodes can be
+// transcoded to, and whether an encoder is installed.
+func GetTranscodeOptions() TranscodeOptions {
+	_, err := encoderPath()
+	return TranscodeOptions{
+		Formats:        []string{TranscodeOpus, TranscodeAAC},
+		Bitrates:       TranscodeBitrates,
+		DefaultBitrate: DefaultTranscodeBitrate,
+		Available:      err == nil,
+	}
+}
+
+// encoderPath returns the ffmpeg executable to transcode with.
+func encoderPath() (string, error) {
+	name := config.Get().Transcoding.FFmpeg
+	if name == "" {
+		name = "ffmpeg"
+	}
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrTranscoderUnavailable, err)
+	}
+	return path, nil
+}
+
+// Transcode is an episode's downloaded file converted to another format and
+// bitrate. Cached transcodes have a complete file at Path.
+type Transcode struct {
+	ModTime     time.Time
+	ContentType string
+	Path        string
+	source      string
+	encoder     string
+	format      transcodeFormat
+	bitrate     int
+	Cached      bool
+}
+
+// FileName returns the name of the transcoded file for downloads.
+func (transcode *Transcode) FileName() string {
+	name := filepath.Base(transcode.source)
+	return strings.TrimSuffix(name, filepath.Ext(name)) + transcode.format.extension
+}
+
+// PrepareTranscode checks that an episode can be transcoded to format at
+// bitrate kbit/s and returns its transcode, which is cached if an earlier
+// request encoded it since the episode was downloaded. A zero bitrate uses
+// DefaultTranscodeBitrate.
+func PrepareTranscode(item *db.PodcastItem, format string, bitrate int) (*Transcode, error) {
+	spec, ok := transcodeFormats[format]
+	if !ok {
+		return nil, fmt.Errorf("%w: format must be %s or %s", ErrInvalidTranscode, TranscodeOpus, TranscodeAAC)
+	}
+	if bitrate == 0 {
+		bitrate = DefaultTranscodeBitrate
+	}
+	if !slices.Contains(TranscodeBitrates, bitrate) {
+		return nil, fmt.Errorf("%w: bitrate must be one of %v", ErrInvalidTranscode, TranscodeBitrates)
+	}
+	source, err := os.Stat(item.DownloadPath)
+	if item.DownloadPath == "" || err != nil {
+		return nil, ErrEpisodeNotDownloaded
+	}
+	encoder, err := encoderPath()
+	if err != nil {
+		return nil, err
+	}
+	transcode := &Transcode{
+		ContentType: spec.contentType,
+		Path:        filepath.Join(transcodeCacheDir(), item.ID+"-"+strconv.Itoa(bitrate)+spec.extension),
+		source:      item.DownloadPath,
+		encoder:     encoder,
+		format:      spec,
+		bitrate:     bitrate,
+	}
+	if cached, statErr := os.Stat(transcode.Path); statErr == nil && !cached.ModTime().Before(source.ModTime()) {
+		// Streaming a transcode keeps it in the cache longer
+		now := time.Now()
+		if err := os.Chtimes(transcode.Path, now, now); err != nil {
+			logger.Log.Warnw("touching cached transcode", "path", transcode.Path, "error", err)
+		}
+		transcode.ModTime = now
+		transcode.Cached = true
+	}
+	return transcode, nil
+}
+
+func transcodeCacheDir() string {
+	return filepath.Join(config.Get().ConfigDir, "transcodes")
+}
+
+// Stream encodes the transcode and writes it to w as it is encoded. The
+// first request for a transcode also writes it to the cache, and keeps
+// encoding when ctx ends so that the next request is served from the cache.
+func (transcode *Transcode) Stream(ctx context.Context, w io.Writer) error {
+	select {
+	case transcodeSlots <- struct{}{}:
+	case <-ctx.Done():
+		return context.Cause(ctx)
+	}
+	if !startCaching(transcode.Path) {
+		defer func() { <-transcodeSlots }()
+		return transcode.encode(ctx, w)
+	}
+
+	client := &detachableWriter{w: w}
+	done := make(chan error, 1)
+	go func() {
+		defer func() { <-transcodeSlots }()
+		defer stopCaching(transcode.Path)
+		done <- transcode.encodeToCache(client)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		client.detach()
+		return context.Cause(ctx)
+	}
+}
+
+// encodeToCache encodes the transcode into the cache, copying it to client.
+func (transcode *Transcode) encodeToCache(client io.Writer) error {
+	if err := os.MkdirAll(filepath.Dir(transcode.Path), 0o750); err != nil {
+		return err
+	}
+	partPath := transcode.Path + ".part"
+	file, err := os.Create(partPath) //nolint:gosec // G304: path is built from the episode ID
+	if err != nil {
+		return err
+	}
+	encodeErr := transcode.encode(BackgroundContext(), io.MultiWriter(file, client))
+	if closeErr := file.Close(); encodeErr == nil {
+		encodeErr = closeErr
+	}
+	if encodeErr != nil {
+		if removeErr := os.Remove(partPath); removeErr != nil {
+			logger.Log.Warnw("removing partial transcode", "path", partPath, "error", removeErr)
+		}
+		return encodeErr
+	}
+	if err := os.Rename(partPath, transcode.Path); err != nil {
+		return err
+	}
+	logger.Log.Infow("Cached transcoded episode", "path", transcode.Path)
+	pruneTranscodeCache()
+	return nil
+}
+
+// encode runs the encoder on the episode's file, writing its output to w.
+func (transcode *Transcode) encode(ctx context.Context, w io.Writer) error {
+	cmd := exec.CommandContext(ctx, transcode.encoder, //nolint:gosec // G204: the encoder is configured by the operator
+		"-nostdin", "-hide_banner", "-loglevel", "error",
+		"-i", transcode.source,
+		"-map", "0:a:0", "-vn",
+		"-c:a", transcode.format.codec,
+		"-b:a", strconv.Itoa(transcode.bitrate)+"k",
+		"-f", transcode.format.muxer,
+		"pipe:1")
+	var stderr strings.Builder
+	cmd.Stdout = w
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return context.Cause(ctx)
+		}
+		return fmt.Errorf("transcoding %s: %w: %s", filepath.Base(transcode.source), err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+func startCaching(path string) bool {
+	cachingMutex.Lock()
+	defer cachingMutex.Unlock()
+	if caching[path] {
+		return false
+	}
+	caching[path] = true
+	return true
+}
+
+func stopCaching(path string) {
+	cachingMutex.Lock()
+	defer cachingMutex.Unlock()
+	delete(caching, path)
+}
+
+// detachableWriter writes to w until it is detached, then discards writes,
+// so that encoding can outlive the request it streams to.
+type detachableWriter struct {
+	w        io.Writer
+	mu       sync.Mutex
+	detached bool
+}
+
+func (writer *detachableWriter) Write(p []byte) (int, error) {
+	writer.mu.Lock()
+	defer writer.mu.Unlock()
+	if !writer.detached {
+		if _, err := writer.w.Write(p); err != nil {
+			writer.detached = true
+		}
+	}
+	return len(p), nil
+}
+
+func (writer *detachableWriter) detach() {
+	writer.mu.Lock()
+	defer writer.mu.Unlock()
+	writer.detached = true
+}
+
+// pruneTranscodeCache removes the least recently streamed transcodes until
+// the cache fits its configured size.
+func pruneTranscodeCache() {
+	dir := transcodeCacheDir()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		logger.Log.Errorw("reading transcode cache", "error", err)
+		return
+	}
+	var files []os.FileInfo
+	var total int64
+	for _, entry := range entries {
+		info, infoErr := entry.Info()
+		if infoErr != nil || !info.Mode().IsRegular() || strings.HasSuffix(entry.Name(), ".part") {
+			continue
+		}
+		files = append(files, info)
+		total += info.Size()
+	}
+	limit := int64(config.Get().Transcoding.CacheMB) * 1024 * 1024
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].ModTime().Before(files[j].ModTime())
+	})
+	for _, info := range files {
+		if total <= limit {
+			break
+		}
+		if err := os.Remove(filepath.Join(dir, info.Name())); err != nil && !os.IsNotExist(err) {
+			logger.Log.Errorw("pruning transcode cache", "error", err)
+			continue
+		}
+		total -= info.Size()
+	}
+}
@@ -0,0 +1,106 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/akhilrex/podgrab/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeEncoder installs a script standing in for ffmpeg, which writes the
+// requested bitrate followed by its input, and returns a downloaded episode.
+func fakeEncoder(t *testing.T) *db.PodcastItem {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake encoder is a shell script")
+	}
+	useTestDataDir(t)
+	t.Setenv("CONFIG", t.TempDir())
+	script := filepath.Join(t.TempDir(), "ffmpeg")
+	require.NoError(t, os.WriteFile(script, []byte(`#!/bin/sh
+while [ $# -gt 0 ]; do
+	case "$1" in
+		-i) shift; input="$1" ;;
+		-b:a) shift; bitrate="$1" ;;
+	esac
+	shift
+done
+printf 'encoded %s ' "$bitrate"
+cat "$input"
+`), 0o700)) //nolint:gosec // G306: the script must be executable
+	t.Setenv("FFMPEG_PATH", script)
+
+	file := filepath.Join(t.TempDir(), "episode.mp3")
+	require.NoError(t, os.WriteFile(file, []byte("audio"), 0o600))
+	podcast := db.CreateTestPodcast(t, db.DB)
+	return db.CreateTestPodcastItem(t, db.DB, podcast.ID, &db.PodcastItem{DownloadPath: file, DownloadStatus: db.Downloaded})
+}
+
+// TestPrepareTranscode_Rejects tests the transcodes that cannot be made.
+func TestPrepareTranscode_Rejects(t *testing.T) {
+	item := fakeEncoder(t)
+
+	_, err := PrepareTranscode(item, "flac", 0)
+	assert.ErrorIs(t, err, ErrInvalidTranscode)
+	_, err = PrepareTranscode(item, TranscodeOpus, 1000)
+	assert.ErrorIs(t, err, ErrInvalidTranscode)
+	_, err = PrepareTranscode(&db.PodcastItem{}, TranscodeOpus, 0)
+	assert.ErrorIs(t, err, ErrEpisodeNotDownloaded)
+
+	t.Setenv("FFMPEG_PATH", filepath.Join(t.TempDir(), "missing"))
+	_, err = PrepareTranscode(item, TranscodeOpus, 0)
+	assert.ErrorIs(t, err, ErrTranscoderUnavailable)
+	assert.False(t, GetTranscodeOptions().Available)
+}
+
+// TestTranscode_Stream tests that transcodes stream while they are encoded,
+// are cached, and are encoded again when the episode's file changes.
+func TestTranscode_Stream(t *testing.T) {
+	item := fakeEncoder(t)
+
+	transcode, err := PrepareTranscode(item, TranscodeOpus, 0)
+	require.NoError(t, err)
+	assert.False(t, transcode.Cached)
+	assert.Equal(t, "audio/ogg", transcode.ContentType)
+	assert.Equal(t, "episode.opus", transcode.FileName())
+	var streamed bytes.Buffer
+	require.NoError(t, transcode.Stream(context.Background(), &streamed))
+	assert.Equal(t, "encoded 64k audio", streamed.String())
+
+	cached, err := PrepareTranscode(item, TranscodeOpus, 0)
+	require.NoError(t, err)
+	assert.True(t, cached.Cached)
+	content, err := os.ReadFile(cached.Path)
+	require.NoError(t, err)
+	assert.Equal(t, "encoded 64k audio", string(content))
+
+	other, err := PrepareTranscode(item, TranscodeAAC, 32)
+	require.NoError(t, err)
+	assert.False(t, other.Cached, "Other formats and bitrates are cached apart")
+
+	later := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(item.DownloadPath, later, later))
+	changed, err := PrepareTranscode(item, TranscodeOpus, 0)
+	require.NoError(t, err)
+	assert.False(t, changed.Cached, "A changed file should be encoded again")
+}
+
+// TestTranscode_PrunesCache tests that the cache keeps to its size.
+func TestTranscode_PrunesCache(t *testing.T) {
+	item := fakeEncoder(t)
+	t.Setenv("TRANSCODE_CACHE_MB", "0")
+
+	transcode, err := PrepareTranscode(item, TranscodeAAC, 0)
+	require.NoError(t, err)
+	var streamed bytes.Buffer
+	require.NoError(t, transcode.Stream(context.Background(), &streamed))
+	assert.Equal(t, "encoded 64k audio", streamed.String(), "Transcodes should stream without a cache")
+	assert.NoFileExists(t, transcode.Path)
+}